@@ -0,0 +1,174 @@
+package bankstatement
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"invoice-go/money"
+)
+
+// csvColumns maps the header names banks use onto the fields of a line.
+// Headers are matched in lower case with underscores read as spaces.
+var csvColumns = map[string]string{
+	"date":               "date",
+	"transaction date":   "date",
+	"booking date":       "date",
+	"posting date":       "date",
+	"value date":         "date",
+	"tanggal":            "date",
+	"amount":             "amount",
+	"jumlah":             "amount",
+	"credit":             "credit",
+	"paid in":            "credit",
+	"money in":           "credit",
+	"deposit":            "credit",
+	"kredit":             "credit",
+	"debit":              "debit",
+	"paid out":           "debit",
+	"money out":          "debit",
+	"withdrawal":         "debit",
+	"currency":           "currency",
+	"ccy":                "currency",
+	"mata uang":          "currency",
+	"description":        "description",
+	"details":            "description",
+	"narrative":          "description",
+	"memo":               "description",
+	"remarks":            "description",
+	"keterangan":         "description",
+	"reference":          "reference",
+	"payment reference":  "reference",
+	"customer reference": "reference",
+	"referensi":          "reference",
+	"transaction id":     "bank_reference",
+	"bank reference":     "bank_reference",
+	"id":                 "bank_reference",
+	"fitid":              "bank_reference",
+}
+
+// csvDateLayouts are the date layouts tried in order; day-first layouts win
+// over month-first ones, as exported by Indonesian and European banks
+var csvDateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	time.RFC3339,
+	"2006/01/02",
+	"02/01/2006",
+	"02-01-2006",
+	"02.01.2006",
+	"02/01/06",
+	"2 Jan 2006",
+	"02 Jan 2006",
+	"20060102",
+}
+
+// parseCSV reads a CSV statement with a header row naming at least a date
+// column and an amount column, or separate credit and debit columns. The
+// delimiter is a comma or, when the header has more of them, a semicolon.
+func parseCSV(r io.Reader) (*Statement, error) {
+	buffered := bufio.NewReader(r)
+	header, err := buffered.Peek(4096)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("failed to read CSV statement: %w", err)
+	}
+	firstLine := string(header)
+	if i := strings.IndexByte(firstLine, '\n'); i >= 0 {
+		firstLine = firstLine[:i]
+	}
+
+	reader := csv.NewReader(buffered)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if strings.Count(firstLine, ";") > strings.Count(firstLine, ",") {
+		reader.Comma = ';'
+	}
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV statement: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, ErrNoLines
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		key := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		key = strings.ReplaceAll(key, "_", " ")
+		if field, ok := csvColumns[key]; ok {
+			if _, seen := columns[field]; !seen {
+				columns[field] = i
+			}
+		}
+	}
+	_, hasAmount := columns["amount"]
+	_, hasCredit := columns["credit"]
+	_, hasDebit := columns["debit"]
+	if _, ok := columns["date"]; !ok || !(hasAmount || hasCredit || hasDebit) {
+		return nil, errors.New("CSV statement needs a header with a date column and an amount, credit or debit column")
+	}
+
+	statement := &Statement{Format: FormatCSV}
+	for n, record := range records[1:] {
+		row := n + 2
+		value := func(field string) string {
+			if i, ok := columns[field]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if strings.Join(record, "") == "" {
+			continue
+		}
+
+		date, err := parseCSVDate(value("date"))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", row, err)
+		}
+		amount := money.Zero()
+		if hasAmount {
+			if amount, err = parseAmount(value("amount")); err != nil {
+				return nil, fmt.Errorf("row %d: %w", row, err)
+			}
+		} else {
+			if credit := value("credit"); credit != "" {
+				paidIn, err := parseAmount(credit)
+				if err != nil {
+					return nil, fmt.Errorf("row %d: %w", row, err)
+				}
+				amount = amount.Add(paidIn.Abs())
+			}
+			if debit := value("debit"); debit != "" {
+				paidOut, err := parseAmount(debit)
+				if err != nil {
+					return nil, fmt.Errorf("row %d: %w", row, err)
+				}
+				amount = amount.Sub(paidOut.Abs())
+			}
+		}
+
+		statement.Lines = append(statement.Lines, Line{
+			Date:          date,
+			Amount:        amount,
+			Currency:      strings.ToUpper(value("currency")),
+			Description:   value("description"),
+			Reference:     value("reference"),
+			BankReference: value("bank_reference"),
+		})
+	}
+	return statement, nil
+}
+
+// parseCSVDate reads a date in the first of csvDateLayouts it matches
+func parseCSVDate(s string) (time.Time, error) {
+	for _, layout := range csvDateLayouts {
+		if date, err := time.Parse(layout, s); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
@@ -0,0 +1,108 @@
+package bankstatement
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// mt940Tag matches the start of a field, e.g. ":61:" or ":60F:"
+var mt940Tag = regexp.MustCompile(`^:([0-9]{2}[A-Z]?):`)
+
+// mt940Balance matches an opening balance: mark, date, currency and amount
+var mt940Balance = regexp.MustCompile(`^[CD]\d{6}([A-Z]{3})`)
+
+// mt940Line matches a statement line: value date, optional entry date, mark
+// (C, D, RC or RD), optional funds code, amount, transaction type, the
+// reference for the account owner, the bank reference and supplementary details
+var mt940Line = regexp.MustCompile(`(?s)^(\d{6})(\d{4})?(R?[CD])([A-Z])?(\d[\d,]*)([NFS][A-Z0-9]{3})([^/\n]*)(?://([^\n]*))?(?:\n(.*))?$`)
+
+// parseMT940 reads an MT940 statement, made of one or more messages. Each
+// :61: field becomes a line described by its supplementary details followed by
+// the :86: field right after it. An :86: field after the closing balance is
+// about the statement and is not added to a line.
+func parseMT940(r io.Reader) (*Statement, error) {
+	statement := &Statement{Format: FormatMT940}
+
+	// Group the lines of the file into fields, continuation lines included
+	type field struct{ tag, value string }
+	var fields []field
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), "\r ")
+		if m := mt940Tag.FindStringSubmatch(text); m != nil {
+			fields = append(fields, field{tag: m[1], value: text[len(m[0]):]})
+			continue
+		}
+		if text == "-" || text == "" || len(fields) == 0 {
+			continue
+		}
+		fields[len(fields)-1].value += "\n" + text
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read MT940 statement: %w", err)
+	}
+
+	var last *Line // The line an :86: field describes
+	for _, f := range fields {
+		if f.tag != "86" {
+			last = nil
+		}
+		switch f.tag {
+		case "25":
+			statement.Account = strings.TrimSpace(f.value)
+		case "60F", "60M":
+			if m := mt940Balance.FindStringSubmatch(f.value); m != nil {
+				statement.Currency = m[1]
+			}
+		case "61":
+			line, err := mt940StatementLine(f.value)
+			if err != nil {
+				return nil, err
+			}
+			statement.Lines = append(statement.Lines, line)
+			last = &statement.Lines[len(statement.Lines)-1]
+		case "86":
+			if last != nil {
+				last.Description = strings.TrimSpace(last.Description + " " + strings.ReplaceAll(f.value, "\n", " "))
+			}
+		}
+	}
+	return statement, nil
+}
+
+// mt940StatementLine reads a :61: field
+func mt940StatementLine(value string) (Line, error) {
+	m := mt940Line.FindStringSubmatch(value)
+	if m == nil {
+		return Line{}, fmt.Errorf("invalid MT940 statement line %q", value)
+	}
+	date, err := time.Parse("060102", m[1])
+	if err != nil {
+		return Line{}, fmt.Errorf("invalid MT940 statement line date %q", m[1])
+	}
+	amount, err := parseAmount(m[5])
+	if err != nil {
+		return Line{}, err
+	}
+	// Debits and reversals of credits take money out of the account
+	if m[3] == "D" || m[3] == "RC" {
+		amount = amount.Neg()
+	}
+
+	reference := strings.TrimSpace(m[7])
+	if strings.EqualFold(reference, "NONREF") {
+		reference = ""
+	}
+	return Line{
+		Date:          date,
+		Amount:        amount,
+		Reference:     reference,
+		BankReference: strings.TrimSpace(m[8]),
+		Description:   strings.TrimSpace(m[9]),
+	}, nil
+}
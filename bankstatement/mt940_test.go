@@ -0,0 +1,121 @@
+package bankstatement
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"invoice-go/money"
+)
+
+func TestParseMT940(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Line
+	}{
+		{
+			name: "narrative only",
+			content: `:20:STMT0001
+:25:NL91ABNA0417164300
+:28C:1/1
+:60F:C250301EUR1000,00
+:61:2503010301C150,00NTRFINV-2025-0001//B123
+:86:Payment from Acme Corp
+ for March
+:62F:C250301EUR1150,00
+-`,
+			want: []Line{{
+				Date:          time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+				Amount:        mustAmount("150.00"),
+				Currency:      "EUR",
+				Description:   "Payment from Acme Corp for March",
+				Reference:     "INV-2025-0001",
+				BankReference: "B123",
+			}},
+		},
+		{
+			name: "supplementary details and narrative",
+			content: `:20:STMT0002
+:25:NL91ABNA0417164300
+:60F:C250301EUR1000,00
+:61:250302D25,50NTRFNONREF//B124
+SEPA DIRECT DEBIT
+:86:Bank charges March
+:61:250303C99,NMSCREF-9//B125
+CARD REFUND
+:86:Refund order 9
+:62F:C250303EUR1073,50
+:86:Closing balance information
+-`,
+			want: []Line{
+				{
+					Date:          time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC),
+					Amount:        mustAmount("-25.50"),
+					Currency:      "EUR",
+					Description:   "SEPA DIRECT DEBIT Bank charges March",
+					BankReference: "B124",
+				},
+				{
+					Date:          time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC),
+					Amount:        mustAmount("99"),
+					Currency:      "EUR",
+					Description:   "CARD REFUND Refund order 9",
+					Reference:     "REF-9",
+					BankReference: "B125",
+				},
+			},
+		},
+		{
+			name: "supplementary details without narrative",
+			content: `:20:STMT0003
+:25:123456789
+:60F:C250301IDR0,00
+:61:250304RD1500000,00NTRF//B126
+REVERSAL OF DEBIT
+:62F:C250304IDR1500000,00
+-`,
+			want: []Line{{
+				Date:          time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC),
+				Amount:        mustAmount("1500000"),
+				Currency:      "IDR",
+				Description:   "REVERSAL OF DEBIT",
+				BankReference: "B126",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statement, err := Parse(FormatMT940, strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			assertLines(t, statement.Lines, tt.want)
+		})
+	}
+}
+
+// assertLines compares parsed lines field by field
+func assertLines(t *testing.T, got, want []Line) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if !g.Date.Equal(w.Date) || !g.Amount.Equal(w.Amount) || g.Currency != w.Currency ||
+			g.Description != w.Description || g.Reference != w.Reference || g.BankReference != w.BankReference {
+			t.Errorf("line %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+// mustAmount parses an amount written in a test table
+func mustAmount(s string) money.Amount {
+	amount, err := money.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return amount
+}
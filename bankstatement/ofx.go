@@ -0,0 +1,99 @@
+package bankstatement
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// parseOFX reads an OFX statement, either OFX 1.x SGML, where elements
+// holding a value are not closed, or OFX 2.x XML. Every STMTTRN aggregate
+// becomes a line.
+func parseOFX(r io.Reader) (*Statement, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OFX statement: %w", err)
+	}
+	text := string(content)
+	start := strings.Index(strings.ToUpper(text), "<OFX>")
+	if start < 0 {
+		return nil, fmt.Errorf("OFX statement has no <OFX> element")
+	}
+
+	statement := &Statement{Format: FormatOFX}
+	var transaction map[string]string
+	for _, token := range strings.Split(text[start:], "<")[1:] {
+		end := strings.IndexByte(token, '>')
+		if end < 0 {
+			continue
+		}
+		tag := strings.ToUpper(strings.TrimSpace(token[:end]))
+		value := html.UnescapeString(strings.TrimSpace(token[end+1:]))
+
+		switch {
+		case tag == "STMTTRN":
+			transaction = map[string]string{}
+		case tag == "/STMTTRN":
+			if transaction != nil {
+				line, err := ofxLine(transaction)
+				if err != nil {
+					return nil, err
+				}
+				statement.Lines = append(statement.Lines, line)
+			}
+			transaction = nil
+		case strings.HasPrefix(tag, "/"), value == "":
+			// Closing tags of OFX 2.x and aggregates carry no value
+		case transaction != nil:
+			transaction[tag] = value
+		case tag == "CURDEF":
+			statement.Currency = strings.ToUpper(value)
+		case tag == "ACCTID":
+			statement.Account = value
+		}
+	}
+	return statement, nil
+}
+
+// ofxLine converts the elements of a STMTTRN aggregate into a line
+func ofxLine(transaction map[string]string) (Line, error) {
+	date, err := parseOFXDate(transaction["DTPOSTED"])
+	if err != nil {
+		return Line{}, fmt.Errorf("transaction %s: %w", transaction["FITID"], err)
+	}
+	amount, err := parseAmount(transaction["TRNAMT"])
+	if err != nil {
+		return Line{}, fmt.Errorf("transaction %s: %w", transaction["FITID"], err)
+	}
+
+	description := transaction["NAME"]
+	if memo := transaction["MEMO"]; memo != "" && memo != description {
+		description = strings.TrimSpace(description + " " + memo)
+	}
+	reference := transaction["REFNUM"]
+	if reference == "" {
+		reference = transaction["CHECKNUM"]
+	}
+	return Line{
+		Date:          date,
+		Amount:        amount,
+		Currency:      strings.ToUpper(transaction["CURSYM"]),
+		Description:   description,
+		Reference:     reference,
+		BankReference: transaction["FITID"],
+	}, nil
+}
+
+// parseOFXDate reads the date of an OFX datetime such as 20250301120000.000[+7:WIB]
+func parseOFXDate(s string) (time.Time, error) {
+	if len(s) < 8 {
+		return time.Time{}, fmt.Errorf("invalid date %q", s)
+	}
+	date, err := time.Parse("20060102", s[:8])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", s)
+	}
+	return date, nil
+}
@@ -0,0 +1,152 @@
+// Package bankstatement parses the statements banks export, as CSV, OFX or
+// MT940 files, into statement lines.
+package bankstatement
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"invoice-go/money"
+)
+
+// Statement formats
+const (
+	FormatCSV   = "csv"
+	FormatOFX   = "ofx"
+	FormatMT940 = "mt940"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown bank statement format, expected one of: csv, ofx, mt940")
+	ErrNoLines       = errors.New("bank statement has no transactions")
+)
+
+// Statement is a parsed bank statement
+type Statement struct {
+	Format   string
+	Account  string // Account number, when the format carries it
+	Currency string // Currency of the account, when the format carries it
+	Lines    []Line
+}
+
+// Line is one transaction on a bank statement
+type Line struct {
+	Date          time.Time
+	Amount        money.Amount // Positive for money received, negative for money paid out
+	Currency      string       // Empty when neither the line nor the statement says
+	Description   string
+	Reference     string // Reference given by the payer, e.g. an end-to-end ID
+	BankReference string // Identifier of the transaction at the bank, used to skip lines imported before
+}
+
+// Parse reads a statement in the given format. Lines without a currency of
+// their own get the currency of the statement.
+func Parse(format string, r io.Reader) (*Statement, error) {
+	var statement *Statement
+	var err error
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case FormatCSV:
+		statement, err = parseCSV(r)
+	case FormatOFX:
+		statement, err = parseOFX(r)
+	case FormatMT940:
+		statement, err = parseMT940(r)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(statement.Lines) == 0 {
+		return nil, ErrNoLines
+	}
+	for i := range statement.Lines {
+		line := &statement.Lines[i]
+		if line.Currency == "" {
+			line.Currency = statement.Currency
+		}
+		line.Description = strings.Join(strings.Fields(line.Description), " ")
+		line.Reference = strings.TrimSpace(line.Reference)
+		line.BankReference = strings.TrimSpace(line.BankReference)
+	}
+	return statement, nil
+}
+
+// DetectFormat guesses the format of a statement from its file name, falling
+// back on its content. Anything not recognisable as OFX or MT940 is CSV.
+func DetectFormat(filename string, content []byte) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".ofx", ".qfx":
+		return FormatOFX
+	case ".sta", ".mt940", ".940":
+		return FormatMT940
+	case ".csv":
+		return FormatCSV
+	}
+	head := content
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	switch {
+	case bytes.Contains(head, []byte("OFXHEADER")) || bytes.Contains(bytes.ToUpper(head), []byte("<OFX>")):
+		return FormatOFX
+	case bytes.Contains(head, []byte(":20:")) && bytes.Contains(head, []byte(":61:")):
+		return FormatMT940
+	}
+	return FormatCSV
+}
+
+// parseAmount reads an amount written with either a comma or a period as the
+// decimal separator, with optional thousands separators, currency symbols
+// and parentheses or a trailing minus for negative amounts
+func parseAmount(s string) (money.Amount, error) {
+	value := strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		negative = true
+		value = value[1 : len(value)-1]
+	}
+	if strings.HasSuffix(value, "-") {
+		negative = true
+		value = strings.TrimSuffix(value, "-")
+	}
+
+	var digits strings.Builder
+	for _, r := range value {
+		if (r >= '0' && r <= '9') || r == '.' || r == ',' || r == '-' || r == '+' {
+			digits.WriteRune(r)
+		}
+	}
+	value = digits.String()
+
+	// The last separator is the decimal one when both are used, a lone comma
+	// is decimal when followed by at most two digits
+	dot, comma := strings.LastIndex(value, "."), strings.LastIndex(value, ",")
+	switch {
+	case dot >= 0 && comma >= 0 && comma > dot:
+		value = strings.ReplaceAll(value, ".", "")
+		value = strings.Replace(value, ",", ".", 1)
+	case dot >= 0 && comma >= 0:
+		value = strings.ReplaceAll(value, ",", "")
+	case comma >= 0 && strings.Count(value, ",") == 1 && len(value)-comma-1 <= 2:
+		value = strings.Replace(value, ",", ".", 1)
+	case comma >= 0:
+		value = strings.ReplaceAll(value, ",", "")
+	case strings.Count(value, ".") > 1:
+		value = strings.ReplaceAll(value, ".", "")
+	}
+
+	amount, err := money.Parse(value)
+	if err != nil || value == "" {
+		return money.Zero(), fmt.Errorf("invalid amount %q", s)
+	}
+	if negative {
+		amount = amount.Neg()
+	}
+	return amount, nil
+}
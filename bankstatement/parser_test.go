@@ -0,0 +1,224 @@
+package bankstatement
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"1250.50", "1250.50", false},
+		{"1,234.56", "1234.56", false},
+		{"1.234,56", "1234.56", false},
+		{"1.234.567", "1234567.00", false},
+		{"1,000", "1000.00", false},
+		{"12,5", "12.50", false},
+		{"(12.00)", "-12.00", false},
+		{"12.00-", "-12.00", false},
+		{"-99.95", "-99.95", false},
+		{"+15", "15.00", false},
+		{"Rp 1.500.000,00", "1500000.00", false},
+		{"EUR 2.500,75", "2500.75", false},
+		{"", "", true},
+		{"n/a", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseAmount(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAmount(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("parseAmount(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Line
+		wantErr bool
+	}{
+		{
+			name: "amount column with comma delimiter",
+			content: "Date,Description,Reference,Amount,Currency,Transaction ID\n" +
+				"2025-03-01,Payment Acme,INV-2025-0001,\"1,250.50\",usd,T1\n" +
+				"2025-03-02,Bank fee,,-5.00,USD,T2\n",
+			want: []Line{
+				{Date: day(2025, 3, 1), Amount: mustAmount("1250.50"), Currency: "USD", Description: "Payment Acme", Reference: "INV-2025-0001", BankReference: "T1"},
+				{Date: day(2025, 3, 2), Amount: mustAmount("-5"), Currency: "USD", Description: "Bank fee", BankReference: "T2"},
+			},
+		},
+		{
+			name: "credit and debit columns with semicolons and day-first dates",
+			content: "\ufeffTanggal;Keterangan;Kredit;Debit\n" +
+				"01/03/2025;Transfer   dari  PT Maju;1.500.000,00;\n" +
+				";;;\n" +
+				"02/03/2025;Biaya admin;;6.500,00\n",
+			want: []Line{
+				{Date: day(2025, 3, 1), Amount: mustAmount("1500000"), Description: "Transfer dari PT Maju"},
+				{Date: day(2025, 3, 2), Amount: mustAmount("-6500"), Description: "Biaya admin"},
+			},
+		},
+		{
+			name:    "header without an amount column",
+			content: "Date,Description\n2025-03-01,Payment\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid date",
+			content: "Date,Amount\n31/31/2025,10.00\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statement, err := Parse(FormatCSV, strings.NewReader(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				assertLines(t, statement.Lines, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOFX(t *testing.T) {
+	sgml := `OFXHEADER:100
+DATA:OFXSGML
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>SGD
+<BANKACCTFROM><ACCTID>0012345678</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20250301120000.000[+8:SGT]
+<TRNAMT>1250.50
+<FITID>F1
+<REFNUM>INV-2025-0001
+<NAME>ACME PTE LTD
+<MEMO>Invoice payment
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20250302
+<TRNAMT>-12.00
+<FITID>F2
+<CHECKNUM>1001
+<NAME>Service charge
+<MEMO>Service charge
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>`
+	xml := `<?xml version="1.0"?>
+<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>EUR</CURDEF>
+<BANKACCTFROM><ACCTID>DE89370400440532013000</ACCTID></BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>CREDIT</TRNTYPE><DTPOSTED>20250303</DTPOSTED><TRNAMT>99.00</TRNAMT><FITID>X1</FITID><NAME>M&amp;M GmbH</NAME><CURSYM>usd</CURSYM></STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>`
+
+	tests := []struct {
+		name        string
+		content     string
+		wantAccount string
+		want        []Line
+		wantErr     bool
+	}{
+		{
+			name:        "SGML",
+			content:     sgml,
+			wantAccount: "0012345678",
+			want: []Line{
+				{Date: day(2025, 3, 1), Amount: mustAmount("1250.50"), Currency: "SGD", Description: "ACME PTE LTD Invoice payment", Reference: "INV-2025-0001", BankReference: "F1"},
+				{Date: day(2025, 3, 2), Amount: mustAmount("-12"), Currency: "SGD", Description: "Service charge", Reference: "1001", BankReference: "F2"},
+			},
+		},
+		{
+			name:        "XML",
+			content:     xml,
+			wantAccount: "DE89370400440532013000",
+			want: []Line{
+				{Date: day(2025, 3, 3), Amount: mustAmount("99"), Currency: "USD", Description: "M&M GmbH", BankReference: "X1"},
+			},
+		},
+		{
+			name:    "no OFX element",
+			content: "OFXHEADER:100\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid date",
+			content: "<OFX><STMTTRN><DTPOSTED>2025<TRNAMT>1.00</STMTTRN></OFX>",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statement, err := Parse(FormatOFX, strings.NewReader(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if statement.Account != tt.wantAccount {
+				t.Errorf("Account = %q, want %q", statement.Account, tt.wantAccount)
+			}
+			assertLines(t, statement.Lines, tt.want)
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := Parse("qif", strings.NewReader("")); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("unknown format error = %v, want ErrUnknownFormat", err)
+	}
+	if _, err := Parse(FormatCSV, strings.NewReader("Date,Amount\n")); !errors.Is(err, ErrNoLines) {
+		t.Errorf("empty statement error = %v, want ErrNoLines", err)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		filename string
+		content  string
+		want     string
+	}{
+		{"march.ofx", "", FormatOFX},
+		{"march.QFX", "", FormatOFX},
+		{"march.sta", "", FormatMT940},
+		{"march.940", "", FormatMT940},
+		{"march.csv", "<OFX>", FormatCSV},
+		{"export", "OFXHEADER:100\n<OFX>", FormatOFX},
+		{"export.txt", "<?xml version=\"1.0\"?><ofx>", FormatOFX},
+		{"export.txt", ":20:STMT\n:25:123\n:61:250301C1,00NTRFNONREF\n", FormatMT940},
+		{"export.txt", "Date,Amount\n", FormatCSV},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			if got := DetectFormat(tt.filename, []byte(tt.content)); got != tt.want {
+				t.Errorf("DetectFormat(%q) = %q, want %q", tt.filename, got, tt.want)
+			}
+		})
+	}
+}
+
+// day returns midnight UTC of a date, as the parsers return dates
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
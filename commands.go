@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"invoice-go/database"
+	"invoice-go/notify"
+	"time"
+)
+
+// runCommand runs a command-line subcommand, e.g. `invoice-go overdue`.
+// Commands connect without setting up the schema, so they never drop data.
+func runCommand(name string, args []string) error {
+	switch name {
+	case "overdue":
+		db := database.Connect()
+		run, err := database.MarkOverdueInvoices(db, time.Now())
+		fmt.Printf("Marked %d invoices overdue, %d overdue in total\n", run.Marked, run.Overdue)
+		return err
+	case "reminders":
+		db := database.Connect()
+		run, err := database.SendPaymentReminders(db, notify.FromEnv(), time.Now())
+		fmt.Printf("Generated %d payment reminders, sent %d, %d failed, %d cancelled\n", run.Generated, run.Sent, run.Failed, run.Cancelled)
+		return err
+	case "late-fees":
+		db := database.Connect()
+		run, err := database.ChargeLateFees(db, time.Now())
+		fmt.Printf("Charged late fees on %d invoices\n", run.Charged)
+		return err
+	case "reconcile":
+		// `invoice-go reconcile` reports drifted invoice balances, `-repair` fixes them
+		flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+		repair := flags.Bool("repair", false, "recompute the drifted invoices and fix payment status spelling")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		db := database.Connect()
+		run, err := database.ReconcileInvoices(db, *repair)
+		for _, drift := range run.Drifted {
+			fmt.Printf("%s (%d): stored paid %s, withheld %s, credited %s, credit applied %s, due %s, %s; expected paid %s, withheld %s, credited %s, credit applied %s, due %s, %s\n",
+				drift.InvoiceNumber, drift.InvoiceID,
+				drift.Stored.AmountPaid, drift.Stored.AmountWithheld, drift.Stored.AmountCredited, drift.Stored.CreditApplied, drift.Stored.AmountDue, drift.Stored.Status,
+				drift.Expected.AmountPaid, drift.Expected.AmountWithheld, drift.Expected.AmountCredited, drift.Expected.CreditApplied, drift.Expected.AmountDue, drift.Expected.Status)
+		}
+		fmt.Printf("Checked %d invoices, %d drifted, %d repaired; %d payment statuses misspelled, %d repaired, %d unknown\n",
+			run.Checked, len(run.Drifted), run.Repaired, run.PaymentStatuses, run.StatusesRepaired, run.UnknownStatuses)
+		return err
+	}
+	return fmt.Errorf("unknown command, expected one of: overdue, reminders, late-fees, reconcile")
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"fmt"
+	"invoice-go/models"
+	"invoice-go/money"
+	"invoice-go/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// agingRow is an invoice with what was paid and credited on it by the report date
+type agingRow struct {
+	InvoiceID          uint         `gorm:"column:invoice_id"`
+	RecipientCompanyID uint         `gorm:"column:recipient_company_id"`
+	CompanyName        string       `gorm:"column:company_name"`
+	DueDate            time.Time    `gorm:"column:due_date"`
+	GrandTotal         money.Amount `gorm:"column:grand_total"`
+	ExchangeRate       float64      `gorm:"column:exchange_rate"`
+	Paid               money.Amount `gorm:"column:paid"`
+	Credited           money.Amount `gorm:"column:credited"`    // Negative, as on the credit notes
+	Transferred        money.Amount `gorm:"column:transferred"` // Moved from the credit balance to the invoice, negative for excess moved out
+}
+
+// GetAgingReport ages the amounts due on the invoices issued by asOf per
+// customer company. The amount due of each invoice is rebuilt from the
+// payments (cash and withholding), credit notes and credit balance entries
+// dated on or before asOf, and bucketed by the days between its due date and
+// asOf. Amounts are converted into the base currency with the invoice
+// exchange rate. Drafts, void and written-off invoices are left out.
+func GetAgingReport(db *gorm.DB, asOf time.Time) (*models.AgingReport, error) {
+	day := asOf.Format("2006-01-02")
+	var rows []agingRow
+	err := db.Table("invoices AS i").
+		Select(`i.invoice_id, i.recipient_company_id, c.company_name, i.due_date, i.grand_total, i.exchange_rate,
+			(SELECT COALESCE(SUM(p.amount + p.withholding_amount), 0) FROM payments AS p
+				WHERE p.invoice_id = i.invoice_id AND p.status = ? AND DATE(p.payment_date) <= ?) AS paid,
+			(SELECT COALESCE(SUM(cn.grand_total), 0) FROM credit_notes AS cn
+				WHERE cn.invoice_id = i.invoice_id AND DATE(cn.credit_note_date) <= ?) AS credited,
+			(SELECT COALESCE(SUM(ce.amount), 0) FROM credit_entries AS ce
+				WHERE ce.invoice_id = i.invoice_id AND DATE(ce.entry_date) <= ?) AS transferred`, models.PaymentStatusCompleted, day, day, day).
+		Joins("JOIN companies AS c ON c.company_id = i.recipient_company_id").
+		Where("i.status NOT IN ? AND DATE(i.invoice_date) <= ?",
+			[]string{models.InvoiceStatusDraft, models.InvoiceStatusVoid, models.InvoiceStatusWrittenOff}, day).
+		Order("c.company_name, i.recipient_company_id, i.invoice_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch invoices for aging: %w", err)
+	}
+
+	base := utils.BaseCurrency()
+	report := &models.AgingReport{
+		AsOf:      dateOnly(asOf),
+		Currency:  base,
+		Customers: []models.CustomerAging{},
+	}
+	for _, row := range rows {
+		due := row.GrandTotal.Sub(row.Paid).Add(row.Credited).Add(row.Transferred)
+		if !due.IsPositive() {
+			continue
+		}
+		rate := row.ExchangeRate
+		if rate == 0 {
+			rate = 1
+		}
+		amount := due.Mul(rate).Round(base)
+		daysOverdue := int(report.AsOf.Sub(dateOnly(row.DueDate)).Hours() / 24)
+		bucket := models.AgingBucket(daysOverdue)
+
+		if n := len(report.Customers); n == 0 || report.Customers[n-1].CompanyID != row.RecipientCompanyID {
+			report.Customers = append(report.Customers, models.CustomerAging{
+				CompanyID:   row.RecipientCompanyID,
+				CompanyName: row.CompanyName,
+			})
+		}
+		customer := &report.Customers[len(report.Customers)-1]
+		customer.InvoiceCount++
+		customer.Add(bucket, amount)
+		report.Totals.Add(bucket, amount)
+	}
+	return report, nil
+}
+
+// dateOnly drops the time of day, keeping the calendar date
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"fmt"
+	"invoice-go/models"
+	"invoice-go/money"
+	"invoice-go/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GetCompanyBalance summarises the invoices, credit notes, payments and withheld taxes of a
+// customer company in the base currency, converting each document with the
+// exchange rate stored on its invoice. Draft and void invoices are not part
+// of the balance. The credit balance of the customer is converted at today's
+// rates; receipts left unallocated and refunds of credit, which are on no
+// invoice, are taken into the outstanding amount at those rates too.
+func GetCompanyBalance(db *gorm.DB, companyID uint) (*models.CompanyBalance, error) {
+	balance := models.CompanyBalance{CompanyID: companyID, Currency: utils.BaseCurrency()}
+	excluded := []string{models.InvoiceStatusDraft, models.InvoiceStatusVoid}
+
+	if err := db.Model(&models.Invoice{}).
+		Select("COALESCE(SUM(grand_total * exchange_rate), 0)").
+		Where("recipient_company_id = ? AND status NOT IN ?", companyID, excluded).
+		Row().Scan(&balance.TotalInvoiced); err != nil {
+		return nil, fmt.Errorf("failed to calculate invoiced total: %w", err)
+	}
+
+	var credited money.Amount
+	if err := db.Table("credit_notes AS cn").
+		Select("COALESCE(SUM(cn.grand_total * i.exchange_rate), 0)").
+		Joins("JOIN invoices AS i ON i.invoice_id = cn.invoice_id").
+		Where("cn.recipient_company_id = ?", companyID).
+		Row().Scan(&credited); err != nil {
+		return nil, fmt.Errorf("failed to calculate credited total: %w", err)
+	}
+	balance.TotalCredited = credited.Neg()
+
+	if err := db.Table("payments AS p").
+		Select("COALESCE(SUM(p.amount * i.exchange_rate), 0), COALESCE(SUM(p.withholding_amount * i.exchange_rate), 0)").
+		Joins("JOIN invoices AS i ON i.invoice_id = p.invoice_id").
+		Where("i.recipient_company_id = ? AND i.status NOT IN ? AND p.status = ?", companyID, excluded, models.PaymentStatusCompleted).
+		Row().Scan(&balance.TotalPaid, &balance.TotalWithheld); err != nil {
+		return nil, fmt.Errorf("failed to calculate paid total: %w", err)
+	}
+
+	balance.Outstanding = balance.TotalInvoiced.Sub(balance.TotalCredited).Sub(balance.TotalPaid).Sub(balance.TotalWithheld)
+
+	now := time.Now()
+	var unallocated []models.CreditBalance
+	if err := db.Model(&models.CreditEntry{}).
+		Select("currency, SUM(amount) AS amount").
+		Where("company_id = ? AND invoice_id IS NULL", companyID).
+		Group("currency").
+		Scan(&unallocated).Error; err != nil {
+		return nil, fmt.Errorf("failed to calculate unallocated receipts: %w", err)
+	}
+	for _, credit := range unallocated {
+		amount, err := ConvertAmount(db, credit.Amount, credit.Currency, balance.Currency, now)
+		if err != nil {
+			return nil, err
+		}
+		balance.Outstanding = balance.Outstanding.Sub(amount)
+	}
+
+	credits, err := GetCreditBalances(db, companyID)
+	if err != nil {
+		return nil, err
+	}
+	for _, credit := range credits {
+		amount, err := ConvertAmount(db, credit.Amount, credit.Currency, balance.Currency, now)
+		if err != nil {
+			return nil, err
+		}
+		balance.CreditBalance = balance.CreditBalance.Add(amount)
+	}
+	return &balance, nil
+}
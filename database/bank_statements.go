@@ -0,0 +1,473 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/bankstatement"
+	"invoice-go/models"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrBankStatementNotFound = errors.New("bank statement not found")
+	ErrBankLineNotFound      = errors.New("bank statement line not found")
+	ErrBankMatchNotFound     = errors.New("match not found for this bank statement line")
+	ErrBankLineSettled       = errors.New("bank statement line is already matched or ignored")
+	ErrBankLineNotReceipt    = errors.New("only money received can be matched to an invoice")
+	ErrBankMatchRequired     = errors.New("match_id or invoice_id is required")
+	ErrPaymentAlreadyMatched = errors.New("payment is already matched to another bank statement line")
+	ErrBankLinePaymentAmount = errors.New("bank statement line does not agree with the payment")
+)
+
+// bankTransferMethod is the method of the payments recorded from bank statement lines
+const bankTransferMethod = "bank_transfer"
+
+// minReferenceLength keeps short payment references and invoice numbers,
+// e.g. "1", from matching every line whose description happens to contain them
+const minReferenceLength = 4
+
+// queueStatuses are the statuses of the lines waiting in the reconciliation queue
+var queueStatuses = []string{models.BankLineUnmatched, models.BankLineProposed}
+
+// GetBankStatements lists the imported bank statements, newest first
+func GetBankStatements(db *gorm.DB) ([]models.BankStatement, error) {
+	statements := []models.BankStatement{}
+	if err := db.Order("bank_statement_id DESC").Find(&statements).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch bank statements: %w", err)
+	}
+	return statements, nil
+}
+
+// GetBankStatement fetches a bank statement with its lines and their proposed matches
+func GetBankStatement(db *gorm.DB, statementID uint) (*models.BankStatement, error) {
+	var statement models.BankStatement
+	err := db.Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return db.Order("line_date, bank_statement_line_id")
+	}).Preload("Lines.Matches", func(db *gorm.DB) *gorm.DB {
+		return db.Order("score DESC, bank_match_id")
+	}).First(&statement, statementID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBankStatementNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch bank statement: %w", err)
+	}
+	return &statement, nil
+}
+
+// GetReconciliationQueue lists the bank statement lines still to be matched
+// or ignored, oldest first, with the matches proposed for them
+func GetReconciliationQueue(db *gorm.DB) ([]models.BankStatementLine, error) {
+	lines := []models.BankStatementLine{}
+	err := db.Preload("Matches", func(db *gorm.DB) *gorm.DB {
+		return db.Order("score DESC, bank_match_id")
+	}).Where("status IN ?", queueStatuses).
+		Order("line_date, bank_statement_line_id").
+		Find(&lines).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch reconciliation queue: %w", err)
+	}
+	return lines, nil
+}
+
+// ImportBankStatement stores a parsed bank statement and proposes matches for
+// every line. Lines without a currency get currency. Lines whose bank
+// reference was imported before for the same account are skipped, so
+// overlapping statements can be uploaded.
+func ImportBankStatement(tx *gorm.DB, fileName string, parsed *bankstatement.Statement, currency string) (*models.BankStatement, error) {
+	statement := models.BankStatement{
+		FileName: fileName,
+		Format:   parsed.Format,
+		Currency: currency,
+	}
+	if parsed.Currency != "" {
+		statement.Currency = parsed.Currency
+	}
+	if parsed.Account != "" {
+		statement.Account = &parsed.Account
+	}
+	if err := tx.Omit("Lines").Create(&statement).Error; err != nil {
+		return nil, fmt.Errorf("failed to create bank statement: %w", err)
+	}
+
+	for _, parsedLine := range parsed.Lines {
+		if parsedLine.BankReference != "" {
+			imported, err := bankLineImported(tx, statement.Account, parsedLine.BankReference)
+			if err != nil {
+				return nil, err
+			}
+			if imported {
+				statement.SkippedCount++
+				continue
+			}
+		}
+
+		line := models.BankStatementLine{
+			BankStatementID: statement.BankStatementID,
+			LineDate:        parsedLine.Date,
+			Amount:          parsedLine.Amount,
+			Currency:        parsedLine.Currency,
+			Description:     parsedLine.Description,
+			Reference:       optionalString(parsedLine.Reference),
+			BankReference:   optionalString(parsedLine.BankReference),
+			Status:          models.BankLineUnmatched,
+		}
+		if line.Currency == "" {
+			line.Currency = statement.Currency
+		}
+		line.Amount = line.Amount.Round(line.Currency)
+		if err := tx.Omit("Matches").Create(&line).Error; err != nil {
+			return nil, fmt.Errorf("failed to create bank statement line: %w", err)
+		}
+		if _, err := ProposeBankMatches(tx, &line); err != nil {
+			return nil, err
+		}
+		statement.LineCount++
+	}
+
+	if err := tx.Model(&statement).Updates(map[string]interface{}{
+		"line_count":    statement.LineCount,
+		"skipped_count": statement.SkippedCount,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update bank statement: %w", err)
+	}
+	return GetBankStatement(tx, statement.BankStatementID)
+}
+
+// ProposeBankMatches replaces the matches proposed for a line that is still
+// in the reconciliation queue, best first, and moves it to proposed or
+// unmatched. Only money received is matched, to open invoices in the line
+// currency:
+//   - a payment recorded with the line reference, or a reference found in its
+//     description, scores 100
+//   - an invoice number found in the reference or description scores 80, 95
+//     when the amount due is the line amount
+//   - an amount due equal to the line amount scores 60 for a single invoice,
+//     50 when several invoices are due that amount
+func ProposeBankMatches(tx *gorm.DB, line *models.BankStatementLine) ([]models.BankMatch, error) {
+	if err := tx.Where("bank_statement_line_id = ?", line.BankStatementLineID).Delete(&models.BankMatch{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to clear proposed matches: %w", err)
+	}
+
+	matches := map[uint]models.BankMatch{}
+	propose := func(match models.BankMatch) {
+		if current, ok := matches[match.InvoiceID]; !ok || match.Score > current.Score {
+			match.BankStatementLineID = line.BankStatementLineID
+			matches[match.InvoiceID] = match
+		}
+	}
+
+	if line.Amount.IsPositive() {
+		text := line.Description
+		if line.Reference != nil {
+			text = *line.Reference + " " + text
+		}
+
+		// Payments recorded before with the reference of the line. LOCATE takes
+		// the reference literally, where LIKE would read _ and % in it as wildcards
+		var payments []models.Payment
+		matched := tx.Model(&models.BankStatementLine{}).Select("payment_id").Where("payment_id IS NOT NULL")
+		if err := tx.Preload("Invoice").
+			Where("reverses_payment_id IS NULL AND currency = ? AND CHAR_LENGTH(transaction_reference) >= ?", line.Currency, minReferenceLength).
+			Where("LOCATE(transaction_reference, ?) > 0", text).
+			Where("payment_id NOT IN (?)", matched).
+			Order("payment_id").Find(&payments).Error; err != nil {
+			return nil, fmt.Errorf("failed to match payment references: %w", err)
+		}
+		for _, payment := range payments {
+			propose(models.BankMatch{
+				InvoiceID:     payment.InvoiceID,
+				InvoiceNumber: payment.Invoice.InvoiceNumber,
+				PaymentID:     &payment.PaymentID,
+				Rule:          models.BankMatchTransactionReference,
+				Score:         100,
+				AmountDue:     payment.Invoice.AmountDue,
+			})
+		}
+
+		open := tx.Model(&models.Invoice{}).
+			Where("currency = ? AND status IN ? AND amount_due > 0", line.Currency, payableStatuses)
+
+		// Invoice numbers written as a whole word of the reference or
+		// description, so INV-2025-00012 does not match INV-2025-0001
+		var numbered []models.Invoice
+		if tokens := referenceTokens(text); len(tokens) > 0 {
+			if err := open.Session(&gorm.Session{}).
+				Where("invoice_number IN ?", tokens).
+				Order("invoice_id").Find(&numbered).Error; err != nil {
+				return nil, fmt.Errorf("failed to match invoice numbers: %w", err)
+			}
+		}
+		for _, invoice := range numbered {
+			score := 80
+			if invoice.AmountDue.Equal(line.Amount) {
+				score = 95
+			}
+			propose(models.BankMatch{
+				InvoiceID:     invoice.InvoiceID,
+				InvoiceNumber: invoice.InvoiceNumber,
+				Rule:          models.BankMatchInvoiceNumber,
+				Score:         score,
+				AmountDue:     invoice.AmountDue,
+			})
+		}
+
+		// Amounts due equal to the line amount, oldest due first
+		var due []models.Invoice
+		if err := open.Session(&gorm.Session{}).
+			Where("amount_due = ?", line.Amount).
+			Order("due_date, invoice_id").Limit(10).Find(&due).Error; err != nil {
+			return nil, fmt.Errorf("failed to match amounts due: %w", err)
+		}
+		for _, invoice := range due {
+			score := 50
+			if len(due) == 1 {
+				score = 60
+			}
+			propose(models.BankMatch{
+				InvoiceID:     invoice.InvoiceID,
+				InvoiceNumber: invoice.InvoiceNumber,
+				Rule:          models.BankMatchAmount,
+				Score:         score,
+				AmountDue:     invoice.AmountDue,
+			})
+		}
+	}
+
+	proposed := make([]models.BankMatch, 0, len(matches))
+	for _, match := range matches {
+		proposed = append(proposed, match)
+	}
+	sort.Slice(proposed, func(i, j int) bool {
+		if proposed[i].Score != proposed[j].Score {
+			return proposed[i].Score > proposed[j].Score
+		}
+		return proposed[i].InvoiceID < proposed[j].InvoiceID
+	})
+	if len(proposed) > 0 {
+		if err := tx.Create(&proposed).Error; err != nil {
+			return nil, fmt.Errorf("failed to record proposed matches: %w", err)
+		}
+	}
+
+	status := models.BankLineUnmatched
+	if len(proposed) > 0 {
+		status = models.BankLineProposed
+	}
+	if err := tx.Model(line).Update("status", status).Error; err != nil {
+		return nil, fmt.Errorf("failed to update bank statement line: %w", err)
+	}
+	line.Status = status
+	line.Matches = proposed
+	return proposed, nil
+}
+
+// referenceTokens splits the text of a bank statement line into the words
+// that could be a document number: runs of letters, digits and the - / . _
+// separators numbers are written with, without separators at either end and
+// at least minReferenceLength long
+func referenceTokens(text string) []string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-/._", r)
+	})
+	seen := make(map[string]bool, len(words))
+	tokens := make([]string, 0, len(words))
+	for _, word := range words {
+		word = strings.Trim(word, "-/._")
+		if utf8.RuneCountInString(word) < minReferenceLength || seen[word] {
+			continue
+		}
+		seen[word] = true
+		tokens = append(tokens, word)
+	}
+	return tokens
+}
+
+// ConfirmBankLine reconciles a line of the queue with one of its proposed
+// matches, or with an invoice picked by hand when matchID is zero. A match on
+// a payment recorded before completes that payment, provided the line is for
+// the same amount and currency; otherwise the line is
+// recorded as a completed bank transfer of the invoice, any excess going to
+// the customer's credit balance. Callers are expected to pass a transaction.
+func ConfirmBankLine(tx *gorm.DB, lineID, matchID, invoiceID uint) (*models.BankStatementLine, error) {
+	line, err := lockBankLine(tx, lineID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case line.Status != models.BankLineUnmatched && line.Status != models.BankLineProposed:
+		return nil, ErrBankLineSettled
+	case !line.Amount.IsPositive():
+		return nil, ErrBankLineNotReceipt
+	}
+
+	var paymentID *uint
+	if matchID != 0 {
+		var match models.BankMatch
+		if err := tx.Where("bank_match_id = ? AND bank_statement_line_id = ?", matchID, lineID).First(&match).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrBankMatchNotFound
+			}
+			return nil, fmt.Errorf("failed to fetch match: %w", err)
+		}
+		invoiceID = match.InvoiceID
+		paymentID = match.PaymentID
+	}
+	if invoiceID == 0 {
+		return nil, ErrBankMatchRequired
+	}
+
+	if paymentID != nil {
+		var matched int64
+		if err := tx.Model(&models.BankStatementLine{}).Where("payment_id = ?", *paymentID).Count(&matched).Error; err != nil {
+			return nil, fmt.Errorf("failed to check payment matches: %w", err)
+		}
+		if matched > 0 {
+			return nil, ErrPaymentAlreadyMatched
+		}
+		payment, err := lockPayment(tx, *paymentID)
+		if err != nil {
+			return nil, err
+		}
+		if payment.Currency != line.Currency || !payment.Amount.Equal(line.Amount) {
+			return nil, fmt.Errorf("%w: line %s %s, payment %s %s", ErrBankLinePaymentAmount,
+				line.Currency, line.Amount, payment.Currency, payment.Amount)
+		}
+		if models.NormalizePaymentStatus(payment.Status) != models.PaymentStatusCompleted {
+			if _, err := UpdatePaymentStatus(tx, payment.PaymentID, models.PaymentStatusCompleted); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		method := bankTransferMethod
+		reference := line.Reference
+		if reference == nil {
+			reference = line.BankReference
+		}
+		payment := models.Payment{
+			InvoiceID:            invoiceID,
+			PaymentDate:          line.LineDate,
+			Amount:               line.Amount,
+			Currency:             line.Currency,
+			Method:               &method,
+			TransactionReference: reference,
+			Status:               models.PaymentStatusCompleted,
+			Type:                 models.PaymentTypePayment,
+		}
+		if err := RecordPayment(tx, &payment); err != nil {
+			return nil, err
+		}
+		paymentID = &payment.PaymentID
+	}
+
+	if err := tx.Model(line).Updates(map[string]interface{}{
+		"status":     models.BankLineMatched,
+		"payment_id": *paymentID,
+		"updated_at": time.Now(),
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update bank statement line: %w", err)
+	}
+	line.Status = models.BankLineMatched
+	line.PaymentID = paymentID
+	return line, nil
+}
+
+// RematchBankLine proposes matches afresh for a line of the queue, e.g. once
+// the invoice it pays has been issued
+func RematchBankLine(tx *gorm.DB, lineID uint) (*models.BankStatementLine, error) {
+	line, err := lockBankLine(tx, lineID)
+	if err != nil {
+		return nil, err
+	}
+	if line.Status != models.BankLineUnmatched && line.Status != models.BankLineProposed {
+		return nil, ErrBankLineSettled
+	}
+	if _, err := ProposeBankMatches(tx, line); err != nil {
+		return nil, err
+	}
+	return line, nil
+}
+
+// IgnoreBankLine takes a line that is not a customer payment, e.g. bank
+// charges, off the reconciliation queue
+func IgnoreBankLine(tx *gorm.DB, lineID uint) (*models.BankStatementLine, error) {
+	line, err := lockBankLine(tx, lineID)
+	if err != nil {
+		return nil, err
+	}
+	if line.Status != models.BankLineUnmatched && line.Status != models.BankLineProposed {
+		return nil, ErrBankLineSettled
+	}
+	if err := tx.Model(line).Update("status", models.BankLineIgnored).Error; err != nil {
+		return nil, fmt.Errorf("failed to update bank statement line: %w", err)
+	}
+	line.Status = models.BankLineIgnored
+	return line, nil
+}
+
+// unmatchBankLines unlinks the lines reconciled with a payment that is being
+// deleted and returns them, to be put back in the reconciliation queue with
+// ProposeBankMatches once the payment is gone
+func unmatchBankLines(tx *gorm.DB, paymentID uint) ([]models.BankStatementLine, error) {
+	var lines []models.BankStatementLine
+	if err := tx.Where("payment_id = ?", paymentID).Find(&lines).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch matched bank statement lines: %w", err)
+	}
+	for i := range lines {
+		if err := tx.Model(&lines[i]).Updates(map[string]interface{}{
+			"status":     models.BankLineUnmatched,
+			"payment_id": nil,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+			return nil, fmt.Errorf("failed to unmatch bank statement line: %w", err)
+		}
+		lines[i].Status = models.BankLineUnmatched
+		lines[i].PaymentID = nil
+	}
+	return lines, nil
+}
+
+// bankLineImported reports whether a line with this bank reference was
+// imported before for the account
+func bankLineImported(tx *gorm.DB, account *string, bankReference string) (bool, error) {
+	q := tx.Table("bank_statement_lines AS l").
+		Joins("JOIN bank_statements AS s ON s.bank_statement_id = l.bank_statement_id").
+		Where("l.bank_reference = ?", bankReference)
+	if account != nil {
+		q = q.Where("s.account = ?", *account)
+	} else {
+		q = q.Where("s.account IS NULL")
+	}
+	var count int64
+	if err := q.Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check imported bank statement lines: %w", err)
+	}
+	return count > 0, nil
+}
+
+// lockBankLine loads a bank statement line and locks its row for the rest of the transaction
+func lockBankLine(tx *gorm.DB, lineID uint) (*models.BankStatementLine, error) {
+	var line models.BankStatementLine
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&line, lineID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBankLineNotFound
+		}
+		return nil, fmt.Errorf("failed to load bank statement line: %w", err)
+	}
+	return &line, nil
+}
+
+// optionalString returns nil for an empty string
+func optionalString(s string) *string {
+	if s = strings.TrimSpace(s); s == "" {
+		return nil
+	}
+	return &s
+}
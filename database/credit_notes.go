@@ -0,0 +1,214 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/models"
+	"invoice-go/money"
+	"invoice-go/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCreditNoteNotFound   = errors.New("credit note not found")
+	ErrInvoiceNotCreditable = errors.New("only issued invoices can be credited")
+	ErrInvoiceItemNotFound  = errors.New("invoice line does not belong to this invoice")
+	ErrOverCrediting        = errors.New("requested quantity exceeds the quantity left to credit on the invoice line")
+	ErrNothingToCredit      = errors.New("invoice has nothing left to credit")
+)
+
+// CreditNoteOptions controls how a credit note is created
+type CreditNoteOptions struct {
+	CreditNoteDate time.Time
+	Reason         *string
+	// Lines restricts the credit note to the given invoice lines and quantities.
+	// Without lines every quantity not yet credited is reversed.
+	Lines []CreditNoteLine
+}
+
+// CreditNoteLine selects a (positive) quantity of an invoice line to credit
+type CreditNoteLine struct {
+	InvoiceItemID uint
+	Quantity      float64
+}
+
+// CreateCreditNote reverses all or part of an issued invoice. The credit note
+// takes its number from the sender's credit note series, its lines are the
+// negated invoice lines, and the invoice's amount due is reduced accordingly.
+func CreateCreditNote(tx *gorm.DB, invoiceID uint, opts CreditNoteOptions) (*models.CreditNote, error) {
+	invoice, err := lockInvoice(tx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	switch models.NormalizeInvoiceStatus(invoice.Status) {
+	case models.InvoiceStatusDraft, models.InvoiceStatusVoid, "":
+		return nil, ErrInvoiceNotCreditable
+	}
+
+	var invoiceItems []models.InvoiceItem
+	if err := tx.Where("invoice_id = ?", invoiceID).Order("invoice_item_id").Find(&invoiceItems).Error; err != nil {
+		return nil, fmt.Errorf("failed to load invoice items: %w", err)
+	}
+	credited, err := creditedQuantities(tx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	quantities := make(map[uint]float64, len(invoiceItems))
+	remaining := make(map[uint]float64, len(invoiceItems))
+	for _, item := range invoiceItems {
+		remaining[item.InvoiceItemID] = utils.RoundAmount(item.Quantity - credited[item.InvoiceItemID])
+	}
+	if len(opts.Lines) > 0 {
+		for _, line := range opts.Lines {
+			left, ok := remaining[line.InvoiceItemID]
+			if !ok {
+				return nil, ErrInvoiceItemNotFound
+			}
+			quantities[line.InvoiceItemID] += line.Quantity
+			if quantities[line.InvoiceItemID]-left > quantityTolerance {
+				return nil, ErrOverCrediting
+			}
+		}
+	} else {
+		for id, left := range remaining {
+			quantities[id] = left
+		}
+	}
+
+	creditDate := opts.CreditNoteDate
+	if creditDate.IsZero() {
+		creditDate = time.Now()
+	}
+	creditNote := models.CreditNote{
+		InvoiceID:          invoice.InvoiceID,
+		SenderCompanyID:    invoice.SenderCompanyID,
+		RecipientCompanyID: invoice.RecipientCompanyID,
+		CreditNoteDate:     creditDate,
+		Reason:             opts.Reason,
+		Currency:           invoice.Currency,
+		TaxInclusive:       invoice.TaxInclusive,
+	}
+
+	lines := make([]utils.InvoiceLine, 0, len(invoiceItems))
+	for _, item := range invoiceItems {
+		quantity := quantities[item.InvoiceItemID]
+		if quantity <= 0 {
+			continue
+		}
+		creditItem := models.CreditNoteItem{
+			InvoiceItemID:             item.InvoiceItemID,
+			ItemID:                    item.ItemID,
+			Description:               item.Description,
+			Quantity:                  -quantity,
+			UnitPrice:                 item.UnitPrice,
+			Discount:                  creditedDiscount(item, quantity, invoice.Currency),
+			TaxRatePercentage:         item.TaxRatePercentage,
+			TaxCode:                   item.TaxCode,
+			WithholdingTaxCode:        item.WithholdingTaxCode,
+			WithholdingRatePercentage: item.WithholdingRatePercentage,
+		}
+		creditNote.CreditNoteItems = append(creditNote.CreditNoteItems, creditItem)
+		lines = append(lines, utils.InvoiceLine{
+			Quantity:       creditItem.Quantity,
+			UnitPrice:      creditItem.UnitPrice,
+			DiscountAmount: creditItem.Discount,
+			Taxes:          lineTaxes(creditItem.TaxCode, creditItem.TaxRatePercentage, creditItem.WithholdingTaxCode, creditItem.WithholdingRatePercentage),
+		})
+	}
+	if len(creditNote.CreditNoteItems) == 0 {
+		return nil, ErrNothingToCredit
+	}
+	totals := utils.CalculateInvoiceTotals(lines, invoice.Currency, invoicePricing(invoice))
+	for i, line := range totals.Lines {
+		creditNote.CreditNoteItems[i].Discount = line.Discount
+		creditNote.CreditNoteItems[i].ItemTotal = line.Total
+	}
+	creditNote.Subtotal, creditNote.TaxTotal, creditNote.GrandTotal = totals.Subtotal, totals.TaxTotal, totals.GrandTotal
+
+	number, err := AllocateDocumentNumber(tx, invoice.SenderCompanyID, models.DocumentTypeCreditNote, creditDate)
+	if err != nil {
+		return nil, err
+	}
+	creditNote.CreditNoteNumber = number
+
+	if err := tx.Create(&creditNote).Error; err != nil {
+		return nil, fmt.Errorf("failed to create credit note: %w", err)
+	}
+
+	// Reduce the original invoice's amount due
+	if _, _, err := GetPaymentStatus(tx, invoiceID); err != nil {
+		return nil, err
+	}
+
+	return &creditNote, nil
+}
+
+// creditedDiscount returns the line and invoice discounts of an invoice line
+// falling on a credited quantity, negative like the credit note lines
+func creditedDiscount(item models.InvoiceItem, quantity float64, currency string) money.Amount {
+	return prorate(item.Discount.Add(item.InvoiceDiscount), quantity, item.Quantity, currency).Neg()
+}
+
+// GetCreditNote fetches a credit note with its lines
+func GetCreditNote(db *gorm.DB, creditNoteID uint) (*models.CreditNote, error) {
+	var creditNote models.CreditNote
+	if err := db.Preload("CreditNoteItems").First(&creditNote, creditNoteID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCreditNoteNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch credit note: %w", err)
+	}
+	return &creditNote, nil
+}
+
+// GetInvoiceCreditNotes lists the credit notes issued against an invoice
+func GetInvoiceCreditNotes(db *gorm.DB, invoiceID uint) ([]models.CreditNote, error) {
+	var creditNotes []models.CreditNote
+	err := db.Preload("CreditNoteItems").
+		Where("invoice_id = ?", invoiceID).
+		Order("credit_note_date, credit_note_id").
+		Find(&creditNotes).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch credit notes: %w", err)
+	}
+	return creditNotes, nil
+}
+
+// GetCreditedAmount returns the total credited against an invoice as a positive amount
+func GetCreditedAmount(db *gorm.DB, invoiceID uint) (money.Amount, error) {
+	var total money.Amount
+	if err := db.Model(&models.CreditNote{}).
+		Select("COALESCE(SUM(grand_total), 0)").
+		Where("invoice_id = ?", invoiceID).
+		Row().Scan(&total); err != nil {
+		return money.Zero(), fmt.Errorf("failed to calculate credited amount: %w", err)
+	}
+	return total.Neg(), nil
+}
+
+// creditedQuantities returns the quantity already credited per invoice line (positive)
+func creditedQuantities(db *gorm.DB, invoiceID uint) (map[uint]float64, error) {
+	type creditedLine struct {
+		InvoiceItemID uint
+		Quantity      float64
+	}
+	var lines []creditedLine
+	err := db.Table("credit_note_items AS cni").
+		Select("cni.invoice_item_id, COALESCE(SUM(-cni.quantity), 0) AS quantity").
+		Joins("JOIN credit_notes AS cn ON cn.credit_note_id = cni.credit_note_id").
+		Where("cn.invoice_id = ?", invoiceID).
+		Group("cni.invoice_item_id").
+		Scan(&lines).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load credited quantities: %w", err)
+	}
+
+	credited := make(map[uint]float64, len(lines))
+	for _, line := range lines {
+		credited[line.InvoiceItemID] = line.Quantity
+	}
+	return credited, nil
+}
@@ -0,0 +1,219 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/models"
+	"invoice-go/money"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInsufficientCredit = errors.New("amount exceeds the credit balance of the customer")
+	ErrCreditAmount       = errors.New("amount must be positive")
+	ErrNothingToApply     = errors.New("no credit balance or amount due to apply it to")
+)
+
+// GetCreditBalances returns the credit a customer company holds, one balance
+// per currency it holds credit in
+func GetCreditBalances(db *gorm.DB, companyID uint) ([]models.CreditBalance, error) {
+	balances := []models.CreditBalance{}
+	if err := db.Model(&models.CreditEntry{}).
+		Select("currency, SUM(amount) AS amount").
+		Where("company_id = ?", companyID).
+		Group("currency").
+		Having("SUM(amount) <> 0").
+		Order("currency").
+		Scan(&balances).Error; err != nil {
+		return nil, fmt.Errorf("failed to calculate credit balance: %w", err)
+	}
+	return balances, nil
+}
+
+// GetCreditBalance returns the credit a customer company holds in one currency
+func GetCreditBalance(db *gorm.DB, companyID uint, currency string) (money.Amount, error) {
+	var balance money.Amount
+	if err := db.Model(&models.CreditEntry{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("company_id = ? AND currency = ?", companyID, currency).
+		Row().Scan(&balance); err != nil {
+		return money.Zero(), fmt.Errorf("failed to calculate credit balance: %w", err)
+	}
+	return balance, nil
+}
+
+// GetCreditEntries lists the credit ledger of a customer company, oldest first
+func GetCreditEntries(db *gorm.DB, companyID uint) ([]models.CreditEntry, error) {
+	var entries []models.CreditEntry
+	if err := db.Where("company_id = ?", companyID).Order("entry_date, credit_entry_id").Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch credit entries: %w", err)
+	}
+	return entries, nil
+}
+
+// ApplyCredit applies credit of a customer to one of its unpaid invoices, in
+// the invoice currency. Without an amount the credit balance is applied up to
+// the amount due.
+func ApplyCredit(tx *gorm.DB, companyID, invoiceID uint, amount *money.Amount) (*models.CreditEntry, error) {
+	if err := lockCredit(tx, companyID); err != nil {
+		return nil, err
+	}
+	invoice, err := lockInvoice(tx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case invoice.RecipientCompanyID != companyID:
+		return nil, fmt.Errorf("%w: %s", ErrInvoiceNotOfCustomer, invoice.InvoiceNumber)
+	case !models.InvoiceAcceptsPayments(invoice.Status):
+		return nil, fmt.Errorf("%w in status %s: %s", ErrInvoiceNotPayable, invoice.Status, invoice.InvoiceNumber)
+	}
+	_, due, err := GetPaymentStatus(tx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := GetCreditBalance(tx, companyID, invoice.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := money.Min(due, balance)
+	if amount != nil {
+		applied = amount.Round(invoice.Currency)
+		switch {
+		case !applied.IsPositive():
+			return nil, ErrCreditAmount
+		case applied.GreaterThan(balance):
+			return nil, fmt.Errorf("%w: %s %s", ErrInsufficientCredit, invoice.Currency, balance)
+		case applied.GreaterThan(due):
+			return nil, fmt.Errorf("%w %s: %s %s", ErrAllocationExceedsDue, invoice.InvoiceNumber, invoice.Currency, due)
+		}
+	}
+	if !applied.IsPositive() {
+		return nil, ErrNothingToApply
+	}
+
+	entry := models.CreditEntry{
+		CompanyID:   companyID,
+		EntryDate:   time.Now(),
+		Type:        models.CreditEntryApplied,
+		Amount:      applied.Neg(),
+		Currency:    invoice.Currency,
+		InvoiceID:   &invoice.InvoiceID,
+		Description: "Applied to invoice " + invoice.InvoiceNumber,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, fmt.Errorf("failed to record credit entry: %w", err)
+	}
+	if _, _, err := GetPaymentStatus(tx, invoiceID); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// RefundCredit records credit paid back to a customer and takes it off its
+// credit balance in the refund currency
+func RefundCredit(tx *gorm.DB, refund *models.CreditRefund) (*models.CreditEntry, error) {
+	refund.Amount = refund.Amount.Round(refund.Currency)
+	if !refund.Amount.IsPositive() {
+		return nil, ErrCreditAmount
+	}
+	if err := lockCredit(tx, refund.CompanyID); err != nil {
+		return nil, err
+	}
+	balance, err := GetCreditBalance(tx, refund.CompanyID, refund.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if refund.Amount.GreaterThan(balance) {
+		return nil, fmt.Errorf("%w: %s %s", ErrInsufficientCredit, refund.Currency, balance)
+	}
+	if err := tx.Create(refund).Error; err != nil {
+		return nil, fmt.Errorf("failed to record refund: %w", err)
+	}
+
+	description := "Refund"
+	if refund.TransactionReference != nil && *refund.TransactionReference != "" {
+		description += " " + *refund.TransactionReference
+	}
+	entry := models.CreditEntry{
+		CompanyID:      refund.CompanyID,
+		EntryDate:      refund.RefundDate,
+		Type:           models.CreditEntryRefund,
+		Amount:         refund.Amount.Neg(),
+		Currency:       refund.Currency,
+		CreditRefundID: &refund.CreditRefundID,
+		Description:    description,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, fmt.Errorf("failed to record credit entry: %w", err)
+	}
+	return &entry, nil
+}
+
+// recordExcessCredit moves what was paid or credited on an invoice beyond its
+// amount due to the credit balance of its customer
+func recordExcessCredit(tx *gorm.DB, invoice *models.Invoice, excess money.Amount, overpaid bool) (*models.CreditEntry, error) {
+	entry := models.CreditEntry{
+		CompanyID:   invoice.RecipientCompanyID,
+		EntryDate:   time.Now(),
+		Type:        models.CreditEntryCreditNote,
+		Amount:      excess,
+		Currency:    invoice.Currency,
+		InvoiceID:   &invoice.InvoiceID,
+		Description: "Credit note excess on invoice " + invoice.InvoiceNumber,
+	}
+	if overpaid {
+		entry.Type = models.CreditEntryOverpayment
+		entry.Description = "Overpayment of invoice " + invoice.InvoiceNumber
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, fmt.Errorf("failed to record credit entry: %w", err)
+	}
+	return &entry, nil
+}
+
+// recordReceiptCredit records a change of the unallocated part of a receipt
+// on the credit balance of its customer: positive for what is left over,
+// negative for what is allocated later
+func recordReceiptCredit(tx *gorm.DB, receipt *models.Receipt, amount money.Amount) error {
+	description := "Unallocated receipt"
+	if amount.IsNegative() {
+		description = "Allocated receipt"
+	}
+	if receipt.TransactionReference != nil && *receipt.TransactionReference != "" {
+		description += " " + *receipt.TransactionReference
+	}
+	entry := models.CreditEntry{
+		CompanyID:   receipt.RecipientCompanyID,
+		EntryDate:   time.Now(),
+		Type:        models.CreditEntryReceipt,
+		Amount:      amount,
+		Currency:    receipt.Currency,
+		ReceiptID:   &receipt.ReceiptID,
+		Description: description,
+	}
+	if amount.IsPositive() {
+		entry.EntryDate = receipt.ReceiptDate
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to record credit entry: %w", err)
+	}
+	return nil
+}
+
+// lockCredit locks the company row so that changes to its credit balance are
+// made one at a time
+func lockCredit(tx *gorm.DB, companyID uint) error {
+	var company models.Company
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&company, companyID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCompanyNotFound
+		}
+		return fmt.Errorf("failed to lock company: %w", err)
+	}
+	return nil
+}
@@ -16,6 +16,19 @@ var DB *gorm.DB
 
 // InitDB establishes a connection to the database and configures the schema
 func InitDB() *gorm.DB {
+	db := Connect()
+
+	// Set up the database schema using the mixed migration approach
+	if err := setupDatabaseSchema(db); err != nil {
+		log.Fatalf("Failed to set up database schema: %v", err)
+	}
+
+	return db
+}
+
+// Connect establishes a connection to the database without touching the
+// schema, for commands working on an existing database
+func Connect() *gorm.DB {
 	// Get database connection parameters from environment variables
 	// or use defaults for local development
 	dbUser := getEnv("DB_USER", "root")
@@ -23,11 +36,14 @@ func InitDB() *gorm.DB {
 	dbPort := getEnv("DB_PORT", "3306")
 	dbName := getEnv("DB_NAME", "invoice-go")
 
-	var dbPassword string
-	fmt.Print("Enter database password: ") // Prompt the user
-	_, errScan := fmt.Scan(&dbPassword)     // Read input into dbPassword
-	if errScan != nil {
-		log.Fatalf("Failed to read password: %v", errScan)
+	// The password is prompted for unless DB_PASSWORD is set
+	dbPassword, ok := os.LookupEnv("DB_PASSWORD")
+	if !ok {
+		fmt.Print("Enter database password: ") // Prompt the user
+		_, errScan := fmt.Scan(&dbPassword)     // Read input into dbPassword
+		if errScan != nil {
+			log.Fatalf("Failed to read password: %v", errScan)
+		}
 	}
 
 	// Construct the connection DSN
@@ -45,8 +61,10 @@ func InitDB() *gorm.DB {
 	)
 
 	// Connect to the database
+	// Duplicate keys surface as gorm.ErrDuplicatedKey
 	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
-		Logger: newLogger,
+		Logger:         newLogger,
+		TranslateError: true,
 	})
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
@@ -63,11 +81,6 @@ func InitDB() *gorm.DB {
 	sqlDB.SetMaxOpenConns(100)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
-	// Set up the database schema using the mixed migration approach
-	if err := setupDatabaseSchema(db); err != nil {
-		log.Fatalf("Failed to set up database schema: %v", err)
-	}
-
 	DB = db
 	return db
 }
@@ -93,7 +106,15 @@ func setupDatabaseSchema(db *gorm.DB) error {
 	
 	tablesToDrop := []string{
 		"payments", "invoice_items", "invoices", "order_items", "orders", 
-		"addresses", "items", "companies",
+		"addresses", "items", "companies", "document_number_series",
+		"document_number_years",
+		"credit_note_items", "credit_notes", "invoice_templates", "exchange_rates",
+		"invoice_taxes", "tax_rules", "tax_codes", "discount_codes",
+		"recurring_invoice_items", "recurring_invoices",
+		"invoice_reminders", "dunning_levels",
+		"late_fee_charges", "late_fee_policies", "receipts",
+		"credit_entries", "credit_refunds",
+		"bank_matches", "bank_statement_lines", "bank_statements",
 	}
 	
 	for _, table := range tablesToDrop {
@@ -117,6 +138,7 @@ func setupDatabaseSchema(db *gorm.DB) error {
 			is_vendor BOOLEAN NOT NULL DEFAULT FALSE,
 			default_billing_address_id INT UNSIGNED,
 			default_shipping_address_id INT UNSIGNED,
+			tax_rounding VARCHAR(10) NOT NULL DEFAULT 'line',
 			created_at TIMESTAMP NULL,
 			updated_at TIMESTAMP NULL,
 			PRIMARY KEY (company_id),
@@ -157,6 +179,8 @@ func setupDatabaseSchema(db *gorm.DB) error {
 			name VARCHAR(100) NOT NULL,
 			description TEXT,
 			unit_price DECIMAL(10,2) NOT NULL,
+			currency CHAR(3) NOT NULL DEFAULT 'IDR',
+			tax_inclusive BOOLEAN NOT NULL DEFAULT FALSE,
 			type VARCHAR(50) NOT NULL,
 			stock INT NOT NULL DEFAULT 0,
 			image_path VARCHAR(255),
@@ -175,6 +199,11 @@ func setupDatabaseSchema(db *gorm.DB) error {
 			customer_company_id INT UNSIGNED NOT NULL,
 			order_date TIMESTAMP NOT NULL,
 			total_price DECIMAL(10,2),
+			discount_code VARCHAR(50) NULL,
+			discount_percentage DECIMAL(5,2) NOT NULL DEFAULT 0.00,
+			discount_amount DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			discount DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			currency CHAR(3) NOT NULL DEFAULT 'IDR',
 			status VARCHAR(50) NOT NULL DEFAULT 'Pending',
 			created_at TIMESTAMP NULL,
 			updated_at TIMESTAMP NULL,
@@ -194,6 +223,9 @@ func setupDatabaseSchema(db *gorm.DB) error {
 			item_id INT UNSIGNED NOT NULL,
 			quantity DECIMAL(10,2) NOT NULL,
 			unit_price DECIMAL(10,2) NOT NULL,
+			discount_percentage DECIMAL(5,2) NOT NULL DEFAULT 0.00,
+			discount_amount DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			discount DECIMAL(10,2) NOT NULL DEFAULT 0.00,
 			item_total DECIMAL(10,2) NOT NULL,
 			PRIMARY KEY (order_item_id),
 			INDEX idx_order_items_order (order_id),
@@ -212,27 +244,46 @@ func setupDatabaseSchema(db *gorm.DB) error {
 			billing_address_id INT UNSIGNED NOT NULL,
 			shipping_address_id INT UNSIGNED,
 			order_id INT UNSIGNED,
+			recurring_invoice_id INT UNSIGNED,
+			recurrence_date DATE NULL,
 			invoice_number VARCHAR(50) NOT NULL,
 			invoice_date TIMESTAMP NOT NULL,
 			due_date TIMESTAMP NOT NULL,
+			days_overdue INT NOT NULL DEFAULT 0,
+			dunning_level INT NOT NULL DEFAULT 0,
+			fee_for_invoice_id INT UNSIGNED NULL,
 			invoice_subject VARCHAR(255),
 			subtotal DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			discount_percentage DECIMAL(5,2) NOT NULL DEFAULT 0.00,
+			discount_amount DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			discount DECIMAL(10,2) NOT NULL DEFAULT 0.00,
 			tax_total DECIMAL(10,2) NOT NULL DEFAULT 0.00,
 			grand_total DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			withholding_total DECIMAL(10,2) NOT NULL DEFAULT 0.00,
 			amount_paid DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			amount_withheld DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			amount_credited DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			credit_applied DECIMAL(10,2) NOT NULL DEFAULT 0.00,
 			amount_due DECIMAL(10,2) NOT NULL DEFAULT 0.00,
 			status VARCHAR(50) NOT NULL DEFAULT 'Draft',
 			notes TEXT,
+			currency CHAR(3) NOT NULL DEFAULT 'IDR',
+			exchange_rate DECIMAL(18,8) NOT NULL DEFAULT 1,
+			tax_inclusive BOOLEAN NOT NULL DEFAULT FALSE,
+			tax_rounding VARCHAR(10) NOT NULL DEFAULT 'line',
 			created_at TIMESTAMP NULL,
 			updated_at TIMESTAMP NULL,
 			PRIMARY KEY (invoice_id),
-			UNIQUE KEY unique_invoice_number (invoice_number),
+			UNIQUE KEY unique_invoice_number (sender_company_id, invoice_number),
+			UNIQUE KEY unique_invoice_recurrence (recurring_invoice_id, recurrence_date),
 			INDEX idx_invoices_sender (sender_company_id),
 			INDEX idx_invoices_recipient (recipient_company_id),
 			INDEX idx_invoices_billing (billing_address_id),
 			INDEX idx_invoices_shipping (shipping_address_id),
 			INDEX idx_invoices_order (order_id),
-			INDEX idx_invoices_status (status)
+			INDEX idx_invoices_status (status),
+			INDEX idx_invoices_due_date (due_date),
+			INDEX idx_invoices_fee_for (fee_for_invoice_id)
 		)
 	`).Error; err != nil {
 		return fmt.Errorf("failed to create invoices table: %w", err)
@@ -247,11 +298,20 @@ func setupDatabaseSchema(db *gorm.DB) error {
 			description VARCHAR(255) NOT NULL,
 			quantity DECIMAL(10,2) NOT NULL,
 			unit_price DECIMAL(10,2) NOT NULL,
+			discount_percentage DECIMAL(5,2) NOT NULL DEFAULT 0.00,
+			discount_amount DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			discount DECIMAL(10,2) NOT NULL DEFAULT 0.00,
 			item_total DECIMAL(10,2) NOT NULL,
+			invoice_discount DECIMAL(10,2) NOT NULL DEFAULT 0.00,
 			tax_rate_percentage DECIMAL(5,2) DEFAULT 0.00,
+			tax_code VARCHAR(20) NULL,
+			withholding_tax_code VARCHAR(20) NULL,
+			withholding_rate_percentage DECIMAL(5,2) DEFAULT 0.00,
+			order_item_id INT UNSIGNED,
 			PRIMARY KEY (invoice_item_id),
 			INDEX idx_invoice_items_invoice (invoice_id),
-			INDEX idx_invoice_items_item (item_id)
+			INDEX idx_invoice_items_item (item_id),
+			INDEX idx_invoice_items_order_item (order_item_id)
 		)
 	`).Error; err != nil {
 		return fmt.Errorf("failed to create invoice_items table: %w", err)
@@ -264,17 +324,502 @@ func setupDatabaseSchema(db *gorm.DB) error {
 			invoice_id INT UNSIGNED NOT NULL,
 			payment_date TIMESTAMP NOT NULL,
 			amount DECIMAL(10,2) NOT NULL,
+			withholding_amount DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			withholding_tax_code VARCHAR(20) NULL,
+			certificate_number VARCHAR(100) NULL,
+			certificate_date TIMESTAMP NULL,
+			currency CHAR(3) NOT NULL DEFAULT 'IDR',
 			method VARCHAR(50),
 			transaction_reference VARCHAR(255),
-			status VARCHAR(50) NOT NULL DEFAULT 'Completed',
+			status VARCHAR(50) NOT NULL DEFAULT 'completed',
+			receipt_id INT UNSIGNED NULL,
+			type VARCHAR(20) NOT NULL DEFAULT 'payment',
+			reverses_payment_id INT UNSIGNED NULL,
+			reason VARCHAR(255) NULL,
 			created_at TIMESTAMP NULL,
 			PRIMARY KEY (payment_id),
-			INDEX idx_payments_invoice (invoice_id)
+			INDEX idx_payments_invoice (invoice_id),
+			INDEX idx_payments_receipt (receipt_id),
+			INDEX idx_payments_reverses (reverses_payment_id)
 		)
 	`).Error; err != nil {
 		return fmt.Errorf("failed to create payments table: %w", err)
 	}
 	
+	// Document number series - one gap-free series per sender company and document type
+	if err := db.Exec(`
+		CREATE TABLE document_number_series (
+			series_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			company_id INT UNSIGNED NOT NULL,
+			document_type VARCHAR(30) NOT NULL,
+			prefix VARCHAR(20) NOT NULL DEFAULT 'INV',
+			pattern VARCHAR(100) NOT NULL DEFAULT '{PREFIX}-{YYYY}-{SEQ}',
+			padding INT NOT NULL DEFAULT 4,
+			reset_yearly BOOLEAN NOT NULL DEFAULT TRUE,
+			current_year INT NOT NULL DEFAULT 0,
+			next_value BIGINT NOT NULL DEFAULT 1,
+			created_at TIMESTAMP NULL,
+			updated_at TIMESTAMP NULL,
+			PRIMARY KEY (series_id),
+			UNIQUE INDEX idx_series_company_type (company_id, document_type)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create document_number_series table: %w", err)
+	}
+	
+	// Document number years - the counters of years a yearly series has moved on from
+	if err := db.Exec(`
+		CREATE TABLE document_number_years (
+			series_id INT UNSIGNED NOT NULL,
+			year INT NOT NULL,
+			next_value BIGINT NOT NULL DEFAULT 1,
+			PRIMARY KEY (series_id, year)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create document_number_years table: %w", err)
+	}
+	
+	// Credit notes - reverse all or part of an issued invoice
+	if err := db.Exec(`
+		CREATE TABLE credit_notes (
+			credit_note_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			invoice_id INT UNSIGNED NOT NULL,
+			sender_company_id INT UNSIGNED NOT NULL,
+			recipient_company_id INT UNSIGNED NOT NULL,
+			credit_note_number VARCHAR(50) NOT NULL,
+			credit_note_date DATETIME NOT NULL,
+			reason VARCHAR(500),
+			subtotal DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			tax_total DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			grand_total DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			currency CHAR(3) NOT NULL DEFAULT 'IDR',
+			tax_inclusive BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP NULL,
+			updated_at TIMESTAMP NULL,
+			PRIMARY KEY (credit_note_id),
+			UNIQUE KEY unique_credit_note_number (sender_company_id, credit_note_number),
+			INDEX idx_credit_notes_invoice (invoice_id),
+			INDEX idx_credit_notes_recipient (recipient_company_id)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create credit_notes table: %w", err)
+	}
+	
+	// Credit note items - negative lines referencing the invoice lines they reverse
+	if err := db.Exec(`
+		CREATE TABLE credit_note_items (
+			credit_note_item_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			credit_note_id INT UNSIGNED NOT NULL,
+			invoice_item_id INT UNSIGNED NOT NULL,
+			item_id INT UNSIGNED,
+			description VARCHAR(255) NOT NULL,
+			quantity DECIMAL(10,2) NOT NULL,
+			unit_price DECIMAL(10,2) NOT NULL,
+			discount DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			item_total DECIMAL(10,2) NOT NULL,
+			tax_rate_percentage DECIMAL(5,2) DEFAULT 0.00,
+			tax_code VARCHAR(20) NULL,
+			withholding_tax_code VARCHAR(20) NULL,
+			withholding_rate_percentage DECIMAL(5,2) DEFAULT 0.00,
+			PRIMARY KEY (credit_note_item_id),
+			INDEX idx_credit_note_items_credit_note (credit_note_id),
+			INDEX idx_credit_note_items_invoice_item (invoice_item_id)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create credit_note_items table: %w", err)
+	}
+	
+	// Invoice templates - layouts of the sender companies, one active per company
+	if err := db.Exec(`
+		CREATE TABLE invoice_templates (
+			template_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			company_id INT UNSIGNED NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			language VARCHAR(10) NOT NULL DEFAULT 'en',
+			primary_color VARCHAR(7) NOT NULL DEFAULT '#333333',
+			accent_color VARCHAR(7) NOT NULL DEFAULT '#E6E6E6',
+			footer_text TEXT,
+			bank_details TEXT,
+			body MEDIUMTEXT,
+			is_active TINYINT(1) NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NULL,
+			updated_at TIMESTAMP NULL,
+			PRIMARY KEY (template_id),
+			INDEX idx_invoice_templates_company (company_id, is_active)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create invoice_templates table: %w", err)
+	}
+	
+	// Exchange rates - one rate per currency pair and effective date
+	if err := db.Exec(`
+		CREATE TABLE exchange_rates (
+			rate_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			from_currency CHAR(3) NOT NULL,
+			to_currency CHAR(3) NOT NULL,
+			rate DECIMAL(18,8) NOT NULL,
+			effective_date DATE NOT NULL,
+			created_at TIMESTAMP NULL,
+			updated_at TIMESTAMP NULL,
+			PRIMARY KEY (rate_id),
+			UNIQUE KEY unique_exchange_rate (from_currency, to_currency, effective_date)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create exchange_rates table: %w", err)
+	}
+	
+	// Tax codes - one row per code and effective date
+	if err := db.Exec(`
+		CREATE TABLE tax_codes (
+			tax_code_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			code VARCHAR(20) NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			kind VARCHAR(20) NOT NULL DEFAULT 'standard',
+			rate_percentage DECIMAL(5,2) NOT NULL DEFAULT 0.00,
+			effective_date DATE NOT NULL,
+			created_at TIMESTAMP NULL,
+			updated_at TIMESTAMP NULL,
+			PRIMARY KEY (tax_code_id),
+			UNIQUE KEY unique_tax_code (code, effective_date)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create tax_codes table: %w", err)
+	}
+	
+	// Tax rules - which tax code applies to a seller, buyer and item type
+	if err := db.Exec(`
+		CREATE TABLE tax_rules (
+			rule_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			tax_code VARCHAR(20) NOT NULL,
+			seller_country VARCHAR(100) NOT NULL DEFAULT '',
+			seller_state_province VARCHAR(100) NOT NULL DEFAULT '',
+			buyer_country VARCHAR(100) NOT NULL DEFAULT '',
+			buyer_state_province VARCHAR(100) NOT NULL DEFAULT '',
+			item_type VARCHAR(50) NOT NULL DEFAULT '',
+			priority INT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NULL,
+			updated_at TIMESTAMP NULL,
+			PRIMARY KEY (rule_id),
+			INDEX idx_tax_rules_code (tax_code)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create tax_rules table: %w", err)
+	}
+	
+	// Invoice taxes - tax breakdown of an invoice per tax code and rate
+	if err := db.Exec(`
+		CREATE TABLE invoice_taxes (
+			invoice_tax_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			invoice_id INT UNSIGNED NOT NULL,
+			tax_code VARCHAR(20) NOT NULL DEFAULT '',
+			name VARCHAR(100) NOT NULL DEFAULT '',
+			kind VARCHAR(20) NOT NULL DEFAULT 'standard',
+			rate_percentage DECIMAL(5,2) NOT NULL,
+			taxable_amount DECIMAL(10,2) NOT NULL,
+			tax_amount DECIMAL(10,2) NOT NULL,
+			PRIMARY KEY (invoice_tax_id),
+			INDEX idx_invoice_taxes_invoice (invoice_id)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create invoice_taxes table: %w", err)
+	}
+	
+	// Discount codes - promo codes redeemable on orders
+	if err := db.Exec(`
+		CREATE TABLE discount_codes (
+			discount_code_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			code VARCHAR(50) NOT NULL,
+			description VARCHAR(255),
+			discount_percentage DECIMAL(5,2) NOT NULL DEFAULT 0.00,
+			discount_amount DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			currency CHAR(3) NOT NULL DEFAULT 'IDR',
+			valid_from TIMESTAMP NULL,
+			valid_until TIMESTAMP NULL,
+			max_uses INT,
+			times_used INT NOT NULL DEFAULT 0,
+			is_active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP NULL,
+			updated_at TIMESTAMP NULL,
+			PRIMARY KEY (discount_code_id),
+			UNIQUE KEY unique_discount_code (code)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create discount_codes table: %w", err)
+	}
+	
+	// Recurring invoices - schedules generating an invoice every interval
+	if err := db.Exec(`
+		CREATE TABLE recurring_invoices (
+			recurring_invoice_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			sender_company_id INT UNSIGNED NOT NULL,
+			recipient_company_id INT UNSIGNED NOT NULL,
+			billing_address_id INT UNSIGNED NOT NULL,
+			shipping_address_id INT UNSIGNED,
+			invoice_subject VARCHAR(255),
+			notes TEXT,
+			currency CHAR(3) NOT NULL DEFAULT 'IDR',
+			tax_inclusive BOOLEAN NOT NULL DEFAULT FALSE,
+			discount_percentage DECIMAL(5,2) NOT NULL DEFAULT 0.00,
+			discount_amount DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			interval_unit VARCHAR(20) NOT NULL,
+			start_date DATE NOT NULL,
+			end_date DATE NULL,
+			next_run_date DATE NOT NULL,
+			occurrences INT NOT NULL DEFAULT 0,
+			payment_term_days INT NOT NULL DEFAULT 30,
+			auto_issue BOOLEAN NOT NULL DEFAULT FALSE,
+			is_active BOOLEAN NOT NULL DEFAULT TRUE,
+			last_invoice_id INT UNSIGNED,
+			created_at TIMESTAMP NULL,
+			updated_at TIMESTAMP NULL,
+			PRIMARY KEY (recurring_invoice_id),
+			INDEX idx_recurring_invoices_sender (sender_company_id),
+			INDEX idx_recurring_invoices_recipient (recipient_company_id),
+			INDEX idx_recurring_invoices_next_run (next_run_date)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create recurring_invoices table: %w", err)
+	}
+	
+	// Recurring invoice items - lines copied into every generated invoice
+	if err := db.Exec(`
+		CREATE TABLE recurring_invoice_items (
+			recurring_invoice_item_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			recurring_invoice_id INT UNSIGNED NOT NULL,
+			item_id INT UNSIGNED,
+			description VARCHAR(255) NOT NULL,
+			quantity DECIMAL(10,2) NOT NULL,
+			unit_price DECIMAL(10,2) NULL,
+			tax_rate_percentage DECIMAL(5,2) DEFAULT 0.00,
+			tax_code VARCHAR(20) NULL,
+			withholding_tax_code VARCHAR(20) NULL,
+			discount_percentage DECIMAL(5,2) DEFAULT 0.00,
+			discount_amount DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			PRIMARY KEY (recurring_invoice_item_id),
+			INDEX idx_recurring_invoice_items_schedule (recurring_invoice_id)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create recurring_invoice_items table: %w", err)
+	}
+	
+	// Dunning levels - reminders each sender sends relative to the due date
+	if err := db.Exec(`
+		CREATE TABLE dunning_levels (
+			dunning_level_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			company_id INT UNSIGNED NOT NULL,
+			level INT NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			days_after_due INT NOT NULL,
+			subject VARCHAR(255) NOT NULL DEFAULT '',
+			body TEXT,
+			is_active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP NULL,
+			updated_at TIMESTAMP NULL,
+			PRIMARY KEY (dunning_level_id),
+			UNIQUE KEY unique_dunning_level (company_id, level)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create dunning_levels table: %w", err)
+	}
+	
+	// Invoice reminders - one per invoice and dunning level reached
+	if err := db.Exec(`
+		CREATE TABLE invoice_reminders (
+			reminder_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			invoice_id INT UNSIGNED NOT NULL,
+			dunning_level_id INT UNSIGNED NULL,
+			level INT NOT NULL,
+			recipient VARCHAR(255) NOT NULL DEFAULT '',
+			subject VARCHAR(255) NOT NULL,
+			body TEXT,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			attempts INT NOT NULL DEFAULT 0,
+			last_error VARCHAR(1000) NULL,
+			sent_at TIMESTAMP NULL,
+			created_at TIMESTAMP NULL,
+			PRIMARY KEY (reminder_id),
+			UNIQUE KEY unique_invoice_reminder (invoice_id, level),
+			INDEX idx_invoice_reminders_status (status),
+			INDEX idx_invoice_reminders_level (dunning_level_id)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create invoice_reminders table: %w", err)
+	}
+	
+	// Late fee policies - late charges each sender applies to overdue invoices
+	if err := db.Exec(`
+		CREATE TABLE late_fee_policies (
+			late_fee_policy_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			company_id INT UNSIGNED NOT NULL,
+			flat_fee DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			interest_percentage DECIMAL(5,2) NOT NULL DEFAULT 0.00,
+			period_days INT NOT NULL DEFAULT 30,
+			grace_days INT NOT NULL DEFAULT 0,
+			max_amount DECIMAL(10,2) NULL,
+			currency CHAR(3) NOT NULL DEFAULT 'IDR',
+			method VARCHAR(20) NOT NULL DEFAULT 'fee_invoice',
+			is_active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP NULL,
+			updated_at TIMESTAMP NULL,
+			PRIMARY KEY (late_fee_policy_id),
+			UNIQUE KEY unique_late_fee_policy_company (company_id)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create late_fee_policies table: %w", err)
+	}
+	
+	// Late fee charges - audit trail of the late charges added to invoices
+	if err := db.Exec(`
+		CREATE TABLE late_fee_charges (
+			late_fee_charge_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			invoice_id INT UNSIGNED NOT NULL,
+			late_fee_policy_id INT UNSIGNED NULL,
+			charge_date DATE NOT NULL,
+			days_overdue INT NOT NULL,
+			periods INT NOT NULL,
+			principal DECIMAL(10,2) NOT NULL,
+			flat_fee DECIMAL(10,2) NOT NULL,
+			interest DECIMAL(10,2) NOT NULL,
+			accrued DECIMAL(10,2) NOT NULL,
+			previously_charged DECIMAL(10,2) NOT NULL,
+			amount DECIMAL(10,2) NOT NULL,
+			currency CHAR(3) NOT NULL,
+			method VARCHAR(20) NOT NULL,
+			invoice_item_id INT UNSIGNED NULL,
+			fee_invoice_id INT UNSIGNED NULL,
+			calculation TEXT,
+			created_at TIMESTAMP NULL,
+			PRIMARY KEY (late_fee_charge_id),
+			UNIQUE KEY unique_late_fee_charge (invoice_id, charge_date),
+			INDEX idx_late_fee_charges_policy (late_fee_policy_id)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create late_fee_charges table: %w", err)
+	}
+	
+	// Receipts - money received from a customer, allocated to its invoices as payments
+	if err := db.Exec(`
+		CREATE TABLE receipts (
+			receipt_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			recipient_company_id INT UNSIGNED NOT NULL,
+			receipt_date TIMESTAMP NOT NULL,
+			amount DECIMAL(10,2) NOT NULL,
+			amount_allocated DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			amount_unallocated DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+			currency CHAR(3) NOT NULL DEFAULT 'IDR',
+			method VARCHAR(50),
+			transaction_reference VARCHAR(255),
+			notes TEXT,
+			created_at TIMESTAMP NULL,
+			updated_at TIMESTAMP NULL,
+			PRIMARY KEY (receipt_id),
+			INDEX idx_receipts_company (recipient_company_id)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create receipts table: %w", err)
+	}
+	
+	// Credit refunds - credit balance paid back to customers
+	if err := db.Exec(`
+		CREATE TABLE credit_refunds (
+			credit_refund_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			company_id INT UNSIGNED NOT NULL,
+			refund_date TIMESTAMP NOT NULL,
+			amount DECIMAL(10,2) NOT NULL,
+			currency CHAR(3) NOT NULL,
+			method VARCHAR(50),
+			transaction_reference VARCHAR(255),
+			notes TEXT,
+			created_at TIMESTAMP NULL,
+			PRIMARY KEY (credit_refund_id),
+			INDEX idx_credit_refunds_company (company_id)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create credit_refunds table: %w", err)
+	}
+	
+	// Credit entries - ledger of the credit balances of customers
+	if err := db.Exec(`
+		CREATE TABLE credit_entries (
+			credit_entry_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			company_id INT UNSIGNED NOT NULL,
+			entry_date TIMESTAMP NOT NULL,
+			type VARCHAR(20) NOT NULL,
+			amount DECIMAL(10,2) NOT NULL,
+			currency CHAR(3) NOT NULL,
+			invoice_id INT UNSIGNED NULL,
+			receipt_id INT UNSIGNED NULL,
+			credit_refund_id INT UNSIGNED NULL,
+			description VARCHAR(255),
+			created_at TIMESTAMP NULL,
+			PRIMARY KEY (credit_entry_id),
+			INDEX idx_credit_entries_company (company_id, currency),
+			INDEX idx_credit_entries_invoice (invoice_id)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create credit_entries table: %w", err)
+	}
+	
+	// Bank statements - uploaded statement files and their lines to reconcile
+	if err := db.Exec(`
+		CREATE TABLE bank_statements (
+			bank_statement_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			file_name VARCHAR(255) NOT NULL,
+			format VARCHAR(10) NOT NULL,
+			account VARCHAR(100) NULL,
+			currency CHAR(3) NOT NULL,
+			line_count INT NOT NULL DEFAULT 0,
+			skipped_count INT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NULL,
+			PRIMARY KEY (bank_statement_id)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create bank_statements table: %w", err)
+	}
+	
+	if err := db.Exec(`
+		CREATE TABLE bank_statement_lines (
+			bank_statement_line_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			bank_statement_id INT UNSIGNED NOT NULL,
+			line_date DATE NOT NULL,
+			amount DECIMAL(10,2) NOT NULL,
+			currency CHAR(3) NOT NULL,
+			description TEXT,
+			reference VARCHAR(255) NULL,
+			bank_reference VARCHAR(255) NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'unmatched',
+			payment_id INT UNSIGNED NULL,
+			created_at TIMESTAMP NULL,
+			updated_at TIMESTAMP NULL,
+			PRIMARY KEY (bank_statement_line_id),
+			INDEX idx_bank_lines_statement (bank_statement_id),
+			INDEX idx_bank_lines_status (status),
+			INDEX idx_bank_lines_bank_reference (bank_reference),
+			INDEX idx_bank_lines_payment (payment_id)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create bank_statement_lines table: %w", err)
+	}
+	
+	// Bank matches - open invoices proposed for a bank statement line
+	if err := db.Exec(`
+		CREATE TABLE bank_matches (
+			bank_match_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+			bank_statement_line_id INT UNSIGNED NOT NULL,
+			invoice_id INT UNSIGNED NOT NULL,
+			invoice_number VARCHAR(50) NOT NULL,
+			payment_id INT UNSIGNED NULL,
+			rule VARCHAR(30) NOT NULL,
+			score INT NOT NULL,
+			amount_due DECIMAL(10,2) NOT NULL,
+			created_at TIMESTAMP NULL,
+			PRIMARY KEY (bank_match_id),
+			INDEX idx_bank_matches_line (bank_statement_line_id)
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to create bank_matches table: %w", err)
+	}
+	
 	// STEP 4: Add all foreign key constraints
 	log.Println("Adding foreign key constraints...")
 	
@@ -312,8 +857,75 @@ func setupDatabaseSchema(db *gorm.DB) error {
 		// InvoiceItems → Items (optional relationship)
 		"ALTER TABLE invoice_items ADD CONSTRAINT fk_invoiceitem_item FOREIGN KEY (item_id) REFERENCES items(item_id) ON DELETE RESTRICT",
 		
+		// InvoiceItems → OrderItems (which order line an invoice line bills)
+		"ALTER TABLE invoice_items ADD CONSTRAINT fk_invoiceitem_orderitem FOREIGN KEY (order_item_id) REFERENCES order_items(order_item_id) ON DELETE RESTRICT",
+		
 		// Payments → Invoices
 		"ALTER TABLE payments ADD CONSTRAINT fk_payment_invoice FOREIGN KEY (invoice_id) REFERENCES invoices(invoice_id) ON DELETE RESTRICT",
+		
+		// DocumentNumberSeries → Companies
+		"ALTER TABLE document_number_series ADD CONSTRAINT fk_series_company FOREIGN KEY (company_id) REFERENCES companies(company_id) ON DELETE CASCADE",
+		"ALTER TABLE document_number_years ADD CONSTRAINT fk_seriesyear_series FOREIGN KEY (series_id) REFERENCES document_number_series(series_id) ON DELETE CASCADE",
+		
+		// CreditNotes → Invoices, Companies
+		"ALTER TABLE credit_notes ADD CONSTRAINT fk_creditnote_invoice FOREIGN KEY (invoice_id) REFERENCES invoices(invoice_id) ON DELETE RESTRICT",
+		"ALTER TABLE credit_notes ADD CONSTRAINT fk_creditnote_sender FOREIGN KEY (sender_company_id) REFERENCES companies(company_id) ON DELETE RESTRICT",
+		"ALTER TABLE credit_notes ADD CONSTRAINT fk_creditnote_recipient FOREIGN KEY (recipient_company_id) REFERENCES companies(company_id) ON DELETE RESTRICT",
+		
+		// CreditNoteItems → CreditNotes, InvoiceItems
+		"ALTER TABLE credit_note_items ADD CONSTRAINT fk_creditnoteitem_creditnote FOREIGN KEY (credit_note_id) REFERENCES credit_notes(credit_note_id) ON DELETE CASCADE",
+		"ALTER TABLE credit_note_items ADD CONSTRAINT fk_creditnoteitem_invoiceitem FOREIGN KEY (invoice_item_id) REFERENCES invoice_items(invoice_item_id) ON DELETE RESTRICT",
+		
+		// InvoiceTemplates → Companies
+		"ALTER TABLE invoice_templates ADD CONSTRAINT fk_template_company FOREIGN KEY (company_id) REFERENCES companies(company_id) ON DELETE CASCADE",
+		
+		// InvoiceTaxes → Invoices
+		"ALTER TABLE invoice_taxes ADD CONSTRAINT fk_invoicetax_invoice FOREIGN KEY (invoice_id) REFERENCES invoices(invoice_id) ON DELETE CASCADE",
+		
+		// RecurringInvoices → Companies, Addresses; RecurringInvoiceItems → RecurringInvoices, Items
+		"ALTER TABLE recurring_invoices ADD CONSTRAINT fk_recurring_sender FOREIGN KEY (sender_company_id) REFERENCES companies(company_id) ON DELETE RESTRICT",
+		"ALTER TABLE recurring_invoices ADD CONSTRAINT fk_recurring_recipient FOREIGN KEY (recipient_company_id) REFERENCES companies(company_id) ON DELETE RESTRICT",
+		"ALTER TABLE recurring_invoices ADD CONSTRAINT fk_recurring_billing FOREIGN KEY (billing_address_id) REFERENCES addresses(address_id) ON DELETE RESTRICT",
+		"ALTER TABLE recurring_invoices ADD CONSTRAINT fk_recurring_shipping FOREIGN KEY (shipping_address_id) REFERENCES addresses(address_id) ON DELETE RESTRICT",
+		"ALTER TABLE recurring_invoice_items ADD CONSTRAINT fk_recurringitem_schedule FOREIGN KEY (recurring_invoice_id) REFERENCES recurring_invoices(recurring_invoice_id) ON DELETE CASCADE",
+		"ALTER TABLE recurring_invoice_items ADD CONSTRAINT fk_recurringitem_item FOREIGN KEY (item_id) REFERENCES items(item_id) ON DELETE RESTRICT",
+		
+		// Invoices → RecurringInvoices (the schedule that generated the invoice)
+		"ALTER TABLE invoices ADD CONSTRAINT fk_invoice_recurring FOREIGN KEY (recurring_invoice_id) REFERENCES recurring_invoices(recurring_invoice_id) ON DELETE SET NULL",
+		
+		// DunningLevels → Companies; InvoiceReminders → Invoices, DunningLevels
+		"ALTER TABLE dunning_levels ADD CONSTRAINT fk_dunninglevel_company FOREIGN KEY (company_id) REFERENCES companies(company_id) ON DELETE CASCADE",
+		"ALTER TABLE invoice_reminders ADD CONSTRAINT fk_reminder_invoice FOREIGN KEY (invoice_id) REFERENCES invoices(invoice_id) ON DELETE CASCADE",
+		"ALTER TABLE invoice_reminders ADD CONSTRAINT fk_reminder_level FOREIGN KEY (dunning_level_id) REFERENCES dunning_levels(dunning_level_id) ON DELETE SET NULL",
+		
+		// LateFeePolicies → Companies; LateFeeCharges → Invoices, LateFeePolicies, InvoiceItems; fee Invoices → Invoices
+		"ALTER TABLE late_fee_policies ADD CONSTRAINT fk_latefeepolicy_company FOREIGN KEY (company_id) REFERENCES companies(company_id) ON DELETE CASCADE",
+		"ALTER TABLE late_fee_charges ADD CONSTRAINT fk_latefeecharge_invoice FOREIGN KEY (invoice_id) REFERENCES invoices(invoice_id) ON DELETE CASCADE",
+		"ALTER TABLE late_fee_charges ADD CONSTRAINT fk_latefeecharge_policy FOREIGN KEY (late_fee_policy_id) REFERENCES late_fee_policies(late_fee_policy_id) ON DELETE SET NULL",
+		"ALTER TABLE late_fee_charges ADD CONSTRAINT fk_latefeecharge_item FOREIGN KEY (invoice_item_id) REFERENCES invoice_items(invoice_item_id) ON DELETE SET NULL",
+		"ALTER TABLE late_fee_charges ADD CONSTRAINT fk_latefeecharge_feeinvoice FOREIGN KEY (fee_invoice_id) REFERENCES invoices(invoice_id) ON DELETE SET NULL",
+		"ALTER TABLE invoices ADD CONSTRAINT fk_invoice_fee_for FOREIGN KEY (fee_for_invoice_id) REFERENCES invoices(invoice_id) ON DELETE RESTRICT",
+		
+		// Receipts → Companies; Payments → Receipts (the receipt a payment was allocated from)
+		"ALTER TABLE receipts ADD CONSTRAINT fk_receipt_company FOREIGN KEY (recipient_company_id) REFERENCES companies(company_id) ON DELETE RESTRICT",
+		"ALTER TABLE payments ADD CONSTRAINT fk_payment_receipt FOREIGN KEY (receipt_id) REFERENCES receipts(receipt_id) ON DELETE RESTRICT",
+		
+		// Payments → Payments (the payment a refund or chargeback reverses)
+		"ALTER TABLE payments ADD CONSTRAINT fk_payment_reverses FOREIGN KEY (reverses_payment_id) REFERENCES payments(payment_id) ON DELETE RESTRICT",
+		
+		// CreditEntries → Companies, Invoices, Receipts, CreditRefunds; CreditRefunds → Companies
+		"ALTER TABLE credit_entries ADD CONSTRAINT fk_creditentry_company FOREIGN KEY (company_id) REFERENCES companies(company_id) ON DELETE RESTRICT",
+		"ALTER TABLE credit_entries ADD CONSTRAINT fk_creditentry_invoice FOREIGN KEY (invoice_id) REFERENCES invoices(invoice_id) ON DELETE RESTRICT",
+		"ALTER TABLE credit_entries ADD CONSTRAINT fk_creditentry_receipt FOREIGN KEY (receipt_id) REFERENCES receipts(receipt_id) ON DELETE RESTRICT",
+		"ALTER TABLE credit_entries ADD CONSTRAINT fk_creditentry_refund FOREIGN KEY (credit_refund_id) REFERENCES credit_refunds(credit_refund_id) ON DELETE RESTRICT",
+		"ALTER TABLE credit_refunds ADD CONSTRAINT fk_creditrefund_company FOREIGN KEY (company_id) REFERENCES companies(company_id) ON DELETE RESTRICT",
+		
+		// BankStatementLines → BankStatements, Payments; BankMatches → BankStatementLines, Invoices, Payments
+		"ALTER TABLE bank_statement_lines ADD CONSTRAINT fk_bankline_statement FOREIGN KEY (bank_statement_id) REFERENCES bank_statements(bank_statement_id) ON DELETE CASCADE",
+		"ALTER TABLE bank_statement_lines ADD CONSTRAINT fk_bankline_payment FOREIGN KEY (payment_id) REFERENCES payments(payment_id) ON DELETE SET NULL",
+		"ALTER TABLE bank_matches ADD CONSTRAINT fk_bankmatch_line FOREIGN KEY (bank_statement_line_id) REFERENCES bank_statement_lines(bank_statement_line_id) ON DELETE CASCADE",
+		"ALTER TABLE bank_matches ADD CONSTRAINT fk_bankmatch_invoice FOREIGN KEY (invoice_id) REFERENCES invoices(invoice_id) ON DELETE CASCADE",
+		"ALTER TABLE bank_matches ADD CONSTRAINT fk_bankmatch_payment FOREIGN KEY (payment_id) REFERENCES payments(payment_id) ON DELETE CASCADE",
 	}
 	
 	for _, constraint := range fkConstraints {
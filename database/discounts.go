@@ -0,0 +1,63 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/models"
+	"invoice-go/money"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrDiscountCodeNotFound = errors.New("discount code not found")
+	ErrDiscountCodeInactive = errors.New("discount code is not active")
+	ErrDiscountCodeExpired  = errors.New("discount code is not valid on this date")
+	ErrDiscountCodeUsedUp   = errors.New("discount code has reached its maximum number of uses")
+)
+
+// RedeemDiscountCode checks that a discount code can be used on a date and
+// counts one use of it. The code row is locked so concurrent orders cannot
+// exceed its maximum number of uses. The fixed amount of the code is returned
+// converted into the given currency at the date.
+func RedeemDiscountCode(tx *gorm.DB, code, currency string, date time.Time) (*models.DiscountCode, money.Amount, error) {
+	var discountCode models.DiscountCode
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("code = ?", strings.TrimSpace(code)).
+		First(&discountCode).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, money.Zero(), fmt.Errorf("%w: %s", ErrDiscountCodeNotFound, code)
+		}
+		return nil, money.Zero(), fmt.Errorf("failed to fetch discount code: %w", err)
+	}
+
+	switch {
+	case !discountCode.IsActive:
+		return nil, money.Zero(), ErrDiscountCodeInactive
+	case discountCode.ValidFrom != nil && date.Before(*discountCode.ValidFrom),
+		discountCode.ValidUntil != nil && date.After(*discountCode.ValidUntil):
+		return nil, money.Zero(), ErrDiscountCodeExpired
+	case discountCode.MaxUses != nil && discountCode.TimesUsed >= *discountCode.MaxUses:
+		return nil, money.Zero(), ErrDiscountCodeUsedUp
+	}
+
+	amount := money.Zero()
+	if !discountCode.DiscountAmount.IsZero() {
+		converted, err := ConvertAmount(tx, discountCode.DiscountAmount, discountCode.Currency, currency, date)
+		if err != nil {
+			return nil, money.Zero(), err
+		}
+		amount = converted
+	}
+
+	if err := tx.Model(&discountCode).
+		Update("times_used", gorm.Expr("times_used + 1")).Error; err != nil {
+		return nil, money.Zero(), fmt.Errorf("failed to redeem discount code: %w", err)
+	}
+	discountCode.TimesUsed++
+	return &discountCode, amount, nil
+}
@@ -0,0 +1,246 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/models"
+	"invoice-go/notify"
+	"invoice-go/render"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDunningLevelNotFound = errors.New("dunning level not found")
+	ErrNoRecipientEmail     = errors.New("customer has no email address")
+)
+
+// remindersLockName is the MySQL named lock held while payment reminders are generated and sent
+const remindersLockName = "invoice-go.payment-reminders"
+
+// maxReminderAttempts is how many times delivering a reminder is tried before it is marked failed
+const maxReminderAttempts = 5
+
+// remindableStatuses are the invoice statuses reminders are sent for
+var remindableStatuses = []string{models.InvoiceStatusIssued, models.InvoiceStatusPartiallyPaid, models.InvoiceStatusOverdue}
+
+// ReminderRun summarises a run of SendPaymentReminders
+type ReminderRun struct {
+	Generated int `json:"generated"` // Reminders generated for invoices reaching a new dunning level
+	Sent      int `json:"sent"`
+	Failed    int `json:"failed"`    // Reminders given up on after their last attempt
+	Cancelled int `json:"cancelled"` // Pending reminders of invoices paid or closed before they went out
+}
+
+// GetDunningLevels lists the dunning levels of a sender company, lowest level first
+func GetDunningLevels(db *gorm.DB, companyID uint) ([]models.DunningLevel, error) {
+	var levels []models.DunningLevel
+	if err := db.Where("company_id = ?", companyID).Order("level").Find(&levels).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch dunning levels: %w", err)
+	}
+	return levels, nil
+}
+
+// GetDunningLevel fetches one dunning level of a sender company
+func GetDunningLevel(db *gorm.DB, companyID, levelID uint) (*models.DunningLevel, error) {
+	var level models.DunningLevel
+	err := db.Where("company_id = ? AND dunning_level_id = ?", companyID, levelID).First(&level).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDunningLevelNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch dunning level: %w", err)
+	}
+	return &level, nil
+}
+
+// GetInvoiceReminders lists the reminders generated for an invoice, oldest first
+func GetInvoiceReminders(db *gorm.DB, invoiceID uint) ([]models.InvoiceReminder, error) {
+	var reminders []models.InvoiceReminder
+	if err := db.Where("invoice_id = ?", invoiceID).Order("level, reminder_id").Find(&reminders).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch invoice reminders: %w", err)
+	}
+	return reminders, nil
+}
+
+// SendPaymentReminders generates the reminders of the dunning levels the
+// unpaid invoices reached by now and delivers the pending ones through the
+// notifier. An invoice moves straight to the highest level it reached and
+// never gets a level twice, so running it again sends nothing new. Failed
+// deliveries are retried on the next runs. A MySQL named lock keeps several
+// instances from running it at the same time. The run is returned along with
+// the errors of the invoices and reminders that failed.
+func SendPaymentReminders(db *gorm.DB, notifier notify.Notifier, now time.Time) (*ReminderRun, error) {
+	run := &ReminderRun{}
+	err := withNamedLock(db, remindersLockName, func(conn *gorm.DB) error {
+		generated, genErr := generateReminders(conn, now)
+		run.Generated = generated
+		sendRun, sendErr := deliverReminders(conn, notifier, now)
+		run.Sent, run.Failed, run.Cancelled = sendRun.Sent, sendRun.Failed, sendRun.Cancelled
+		return errors.Join(genErr, sendErr)
+	})
+	return run, err
+}
+
+// generateReminders records a reminder for every unpaid invoice that reached
+// a dunning level above the one it is at. Levels are walked from the highest
+// down so that an invoice only gets the highest level it reached.
+func generateReminders(db *gorm.DB, now time.Time) (int, error) {
+	today := now.Format("2006-01-02")
+	var levels []models.DunningLevel
+	if err := db.Where("is_active = ?", true).Order("company_id, level DESC").Find(&levels).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch dunning levels: %w", err)
+	}
+
+	generated := 0
+	var errs []error
+	for _, level := range levels {
+		var ids []uint
+		if err := db.Model(&models.Invoice{}).
+			Where("sender_company_id = ? AND status IN ? AND amount_due > 0 AND dunning_level < ? AND DATEDIFF(?, DATE(due_date)) >= ?",
+				level.CompanyID, remindableStatuses, level.Level, today, level.DaysAfterDue).
+			Order("invoice_id").
+			Pluck("invoice_id", &ids).Error; err != nil {
+			errs = append(errs, fmt.Errorf("failed to fetch invoices for dunning level %d: %w", level.DunningLevelID, err))
+			continue
+		}
+
+		for _, id := range ids {
+			var created bool
+			err := db.Transaction(func(tx *gorm.DB) error {
+				invoice, err := lockInvoice(tx, id)
+				if err != nil {
+					return err
+				}
+				if invoice.DunningLevel >= level.Level {
+					return nil
+				}
+				_, due, err := GetPaymentStatus(tx, id)
+				if err != nil {
+					return err
+				}
+				if !due.IsPositive() {
+					return nil
+				}
+				invoice.AmountDue = due
+
+				reminder, err := buildReminder(tx, invoice, level, now)
+				if err != nil {
+					return err
+				}
+				if err := tx.Create(reminder).Error; err != nil {
+					return fmt.Errorf("failed to record reminder: %w", err)
+				}
+				created = true
+				return tx.Model(invoice).Update("dunning_level", level.Level).Error
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invoice %d: %w", id, err))
+				continue
+			}
+			if created {
+				generated++
+			}
+		}
+	}
+	return generated, errors.Join(errs...)
+}
+
+// buildReminder renders the reminder of a dunning level for an invoice,
+// addressed to the email of the customer. Customers without an email get a
+// failed reminder, so the level is still recorded as reached.
+func buildReminder(tx *gorm.DB, invoice *models.Invoice, level models.DunningLevel, now time.Time) (*models.InvoiceReminder, error) {
+	view := render.ReminderView{Invoice: *invoice, Level: level}
+	if err := tx.First(&view.Customer, invoice.RecipientCompanyID).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch customer: %w", err)
+	}
+	if err := tx.First(&view.Sender, invoice.SenderCompanyID).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch sender: %w", err)
+	}
+	view.DaysOverdue = int(dateOnly(now).Sub(dateOnly(invoice.DueDate)).Hours() / 24)
+
+	subject, body, err := render.ReminderMessage(view)
+	if err != nil {
+		return nil, err
+	}
+	reminder := &models.InvoiceReminder{
+		InvoiceID:      invoice.InvoiceID,
+		DunningLevelID: &level.DunningLevelID,
+		Level:          level.Level,
+		Subject:        subject,
+		Body:           body,
+		Status:         models.ReminderStatusPending,
+	}
+	if view.Customer.Email != nil && strings.TrimSpace(*view.Customer.Email) != "" {
+		reminder.Recipient = strings.TrimSpace(*view.Customer.Email)
+	} else {
+		msg := ErrNoRecipientEmail.Error()
+		reminder.Status = models.ReminderStatusFailed
+		reminder.LastError = &msg
+	}
+	return reminder, nil
+}
+
+// deliverReminders sends the pending reminders, marking each sent, or failed
+// once its last attempt failed. A reminder whose invoice was paid or closed
+// since it was generated, e.g. between two attempts, is cancelled unsent.
+func deliverReminders(db *gorm.DB, notifier notify.Notifier, now time.Time) (ReminderRun, error) {
+	var run ReminderRun
+	var reminders []models.InvoiceReminder
+	if err := db.Where("status = ?", models.ReminderStatusPending).Order("reminder_id").Find(&reminders).Error; err != nil {
+		return run, fmt.Errorf("failed to fetch pending reminders: %w", err)
+	}
+
+	var errs []error
+	for _, reminder := range reminders {
+		var due int64
+		if err := db.Model(&models.Invoice{}).
+			Where("invoice_id = ? AND status IN ? AND amount_due > 0", reminder.InvoiceID, remindableStatuses).
+			Count(&due).Error; err != nil {
+			errs = append(errs, fmt.Errorf("failed to check invoice of reminder %d: %w", reminder.ReminderID, err))
+			continue
+		}
+		if due == 0 {
+			if err := db.Model(&models.InvoiceReminder{}).Where("reminder_id = ?", reminder.ReminderID).
+				Update("status", models.ReminderStatusCancelled).Error; err != nil {
+				errs = append(errs, fmt.Errorf("failed to cancel reminder %d: %w", reminder.ReminderID, err))
+				continue
+			}
+			run.Cancelled++
+			continue
+		}
+
+		updates := map[string]interface{}{"attempts": reminder.Attempts + 1}
+		sendErr := notifier.Notify(notify.Message{
+			To:      []string{reminder.Recipient},
+			Subject: reminder.Subject,
+			Body:    reminder.Body,
+		})
+		if sendErr == nil {
+			updates["status"] = models.ReminderStatusSent
+			updates["sent_at"] = now
+			updates["last_error"] = nil
+			run.Sent++
+		} else {
+			updates["last_error"] = truncate(sendErr.Error(), 1000)
+			if reminder.Attempts+1 >= maxReminderAttempts {
+				updates["status"] = models.ReminderStatusFailed
+				run.Failed++
+			}
+		}
+		if err := db.Model(&models.InvoiceReminder{}).Where("reminder_id = ?", reminder.ReminderID).Updates(updates).Error; err != nil {
+			errs = append(errs, fmt.Errorf("failed to update reminder %d: %w", reminder.ReminderID, err))
+		}
+	}
+	return run, errors.Join(errs...)
+}
+
+// truncate shortens a string to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
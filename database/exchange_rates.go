@@ -0,0 +1,96 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/models"
+	"invoice-go/money"
+	"invoice-go/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrExchangeRateNotFound = errors.New("exchange rate not found")
+	ErrNoExchangeRate       = errors.New("no exchange rate is effective for the currency pair on that date")
+	ErrCurrencyMismatch     = errors.New("currency does not match the invoice currency")
+)
+
+// FindExchangeRate returns how many units of the to currency one unit of the
+// from currency is worth on a date. The latest rate effective on that date is
+// used; when only the opposite pair is recorded its inverse is returned.
+func FindExchangeRate(db *gorm.DB, from, to string, date time.Time) (float64, error) {
+	from, to = utils.NormalizeCurrency(from), utils.NormalizeCurrency(to)
+	if from == to {
+		return 1, nil
+	}
+	day := date.Format("2006-01-02")
+
+	var rate models.ExchangeRate
+	err := db.Where("from_currency = ? AND to_currency = ? AND effective_date <= ?", from, to, day).
+		Order("effective_date DESC").
+		First(&rate).Error
+	if err == nil {
+		return rate.Rate, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, fmt.Errorf("failed to fetch exchange rate: %w", err)
+	}
+
+	err = db.Where("from_currency = ? AND to_currency = ? AND effective_date <= ?", to, from, day).
+		Order("effective_date DESC").
+		First(&rate).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, fmt.Errorf("%w: %s to %s on %s", ErrNoExchangeRate, from, to, day)
+		}
+		return 0, fmt.Errorf("failed to fetch exchange rate: %w", err)
+	}
+	return 1 / rate.Rate, nil
+}
+
+// ConvertAmount converts an amount between currencies at the rate effective on a date
+func ConvertAmount(db *gorm.DB, amount money.Amount, from, to string, date time.Time) (money.Amount, error) {
+	rate, err := FindExchangeRate(db, from, to, date)
+	if err != nil {
+		return money.Zero(), err
+	}
+	return amount.Mul(rate).Round(to), nil
+}
+
+// applyInvoiceCurrency defaults the invoice currency to the base currency and
+// fixes the exchange rate into the base currency at the invoice date
+func applyInvoiceCurrency(tx *gorm.DB, invoice *models.Invoice) error {
+	invoice.Currency = utils.NormalizeCurrency(invoice.Currency)
+	if invoice.Currency == "" {
+		invoice.Currency = utils.BaseCurrency()
+	}
+	rate, err := FindExchangeRate(tx, invoice.Currency, utils.BaseCurrency(), invoice.InvoiceDate)
+	if err != nil {
+		return err
+	}
+	invoice.ExchangeRate = rate
+	return nil
+}
+
+// invoiceBaseAmounts converts the totals of an invoice into the base currency
+func invoiceBaseAmounts(invoice *models.Invoice) models.BaseAmounts {
+	rate := invoice.ExchangeRate
+	if rate == 0 {
+		rate = 1
+	}
+	base := utils.BaseCurrency()
+	return models.BaseAmounts{
+		Currency:       base,
+		ExchangeRate:   rate,
+		Subtotal:       invoice.Subtotal.Mul(rate).Round(base),
+		TaxTotal:       invoice.TaxTotal.Mul(rate).Round(base),
+		GrandTotal:     invoice.GrandTotal.Mul(rate).Round(base),
+		AmountPaid:     invoice.AmountPaid.Mul(rate).Round(base),
+		AmountWithheld: invoice.AmountWithheld.Mul(rate).Round(base),
+		AmountCredited: invoice.AmountCredited.Mul(rate).Round(base),
+		CreditApplied:  invoice.CreditApplied.Mul(rate).Round(base),
+		AmountDue:      invoice.AmountDue.Mul(rate).Round(base),
+	}
+}
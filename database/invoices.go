@@ -0,0 +1,300 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/models"
+	"invoice-go/money"
+	"invoice-go/utils"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvoiceNotFound         = errors.New("invoice not found")
+	ErrUnknownInvoiceStatus    = errors.New("unknown invoice status")
+	ErrIllegalStatusTransition = errors.New("illegal invoice status transition")
+	ErrInvoiceLocked           = errors.New("invoice is no longer a draft and cannot be modified")
+	ErrDuplicateInvoiceNumber  = errors.New("invoice number is already used by the sender")
+)
+
+// applyInvoiceTotals resolves the tax codes of the items and the pricing of the
+// invoice, then computes the discounts, the line totals, the invoice totals and
+// the tax breakdown
+func applyInvoiceTotals(tx *gorm.DB, invoice *models.Invoice, items []models.InvoiceItem) error {
+	codes, err := applyInvoiceTaxCodes(tx, invoice, items)
+	if err != nil {
+		return err
+	}
+	if err := applyInvoicePricing(tx, invoice, items); err != nil {
+		return err
+	}
+
+	lines := make([]utils.InvoiceLine, 0, len(items))
+	for i := range items {
+		lines = append(lines, utils.InvoiceLine{
+			Quantity:           items[i].Quantity,
+			UnitPrice:          items[i].UnitPrice,
+			DiscountPercentage: items[i].DiscountPercentage,
+			DiscountAmount:     items[i].DiscountAmount,
+			Taxes:              lineTaxes(items[i].TaxCode, items[i].TaxRatePercentage, items[i].WithholdingTaxCode, items[i].WithholdingRatePercentage),
+		})
+	}
+
+	pricing := invoicePricing(invoice)
+	pricing.DiscountPercentage = invoice.DiscountPercentage
+	pricing.DiscountAmount = invoice.DiscountAmount
+	totals := utils.CalculateInvoiceTotals(lines, invoice.Currency, pricing)
+	for i, line := range totals.Lines {
+		items[i].Discount = line.Discount
+		items[i].ItemTotal = line.Total
+		items[i].InvoiceDiscount = line.InvoiceDiscount
+	}
+	invoice.Subtotal = totals.Subtotal
+	invoice.Discount = totals.Discount
+	invoice.TaxTotal = totals.TaxTotal
+	invoice.WithholdingTotal = totals.WithholdingTotal
+	invoice.GrandTotal = totals.GrandTotal
+	invoice.AmountDue = totals.GrandTotal.Sub(invoice.AmountPaid).Sub(invoice.AmountWithheld).Sub(invoice.AmountCredited).Sub(invoice.CreditApplied)
+	invoice.Taxes = invoiceTaxes(totals.Taxes, codes)
+	return nil
+}
+
+// CreateInvoiceWithItems computes the totals and tax breakdown of an invoice from
+// its line items and persists the header, the items and the breakdown. Without an invoice number the next
+// number of the sender's series is allocated, and the exchange rate into the
+// base currency is fixed at the invoice date. Callers are expected to pass a
+// transaction so the header, items and number are written atomically.
+func CreateInvoiceWithItems(tx *gorm.DB, invoice *models.Invoice, items []models.InvoiceItem) error {
+	invoice.AmountPaid = money.Zero()
+	invoice.AmountWithheld = money.Zero()
+	invoice.AmountCredited = money.Zero()
+	invoice.CreditApplied = money.Zero()
+	if err := applyInvoiceCurrency(tx, invoice); err != nil {
+		return err
+	}
+	if err := applyInvoiceTotals(tx, invoice, items); err != nil {
+		return err
+	}
+
+	if invoice.InvoiceNumber == "" {
+		number, err := AllocateDocumentNumber(tx, invoice.SenderCompanyID, models.DocumentTypeInvoice, invoice.InvoiceDate)
+		if err != nil {
+			return err
+		}
+		invoice.InvoiceNumber = number
+	}
+
+	if err := checkInvoiceNumber(tx, invoice); err != nil {
+		return err
+	}
+	if err := reserveOrderLines(tx, invoice.OrderID, items); err != nil {
+		return err
+	}
+	if err := tx.Omit("InvoiceItems", "Taxes").Create(invoice).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return fmt.Errorf("%w: %s", ErrDuplicateInvoiceNumber, invoice.InvoiceNumber)
+		}
+		return fmt.Errorf("failed to create invoice: %w", err)
+	}
+
+	if err := createInvoiceItems(tx, invoice.InvoiceID, items); err != nil {
+		return err
+	}
+	invoice.InvoiceItems = items
+	if err := replaceInvoiceTaxes(tx, invoice.InvoiceID, invoice.Taxes); err != nil {
+		return err
+	}
+	if invoice.OrderID != nil {
+		if err := refreshOrderStatus(tx, *invoice.OrderID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateDraftInvoice replaces the header fields and line items of a draft
+// invoice and recomputes its totals. Invoices that left Draft are immutable.
+// Lines billing order lines are checked against what remains to be invoiced
+// of the order, not counting the lines they replace.
+func UpdateDraftInvoice(tx *gorm.DB, invoiceID uint, header models.Invoice, items []models.InvoiceItem) (*models.Invoice, error) {
+	invoice, err := lockInvoice(tx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if !models.InvoiceIsEditable(invoice.Status) {
+		return nil, ErrInvoiceLocked
+	}
+	previousOrderID := invoice.OrderID
+
+	invoice.SenderCompanyID = header.SenderCompanyID
+	invoice.RecipientCompanyID = header.RecipientCompanyID
+	invoice.BillingAddressID = header.BillingAddressID
+	invoice.ShippingAddressID = header.ShippingAddressID
+	invoice.OrderID = header.OrderID
+	if header.InvoiceNumber != "" {
+		invoice.InvoiceNumber = header.InvoiceNumber
+	}
+	invoice.InvoiceDate = header.InvoiceDate
+	invoice.DueDate = header.DueDate
+	invoice.InvoiceSubject = header.InvoiceSubject
+	invoice.Notes = header.Notes
+	invoice.TaxInclusive = header.TaxInclusive
+	invoice.DiscountPercentage = header.DiscountPercentage
+	invoice.DiscountAmount = header.DiscountAmount
+	if header.Currency != "" {
+		invoice.Currency = header.Currency
+	}
+	// The rate follows the (possibly changed) invoice date until the invoice is issued
+	if err := applyInvoiceCurrency(tx, invoice); err != nil {
+		return nil, err
+	}
+	if err := applyInvoiceTotals(tx, invoice, items); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("invoice_id = ?", invoiceID).Delete(&models.InvoiceItem{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to remove invoice items: %w", err)
+	}
+	if err := checkInvoiceNumber(tx, invoice); err != nil {
+		return nil, err
+	}
+	if err := reserveOrderLines(tx, invoice.OrderID, items); err != nil {
+		return nil, err
+	}
+	if err := tx.Omit(clause.Associations).Save(invoice).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateInvoiceNumber, invoice.InvoiceNumber)
+		}
+		return nil, fmt.Errorf("failed to update invoice: %w", err)
+	}
+	if err := createInvoiceItems(tx, invoiceID, items); err != nil {
+		return nil, err
+	}
+	invoice.InvoiceItems = items
+	if err := replaceInvoiceTaxes(tx, invoiceID, invoice.Taxes); err != nil {
+		return nil, err
+	}
+	for _, orderID := range []*uint{previousOrderID, invoice.OrderID} {
+		if orderID != nil {
+			if err := refreshOrderStatus(tx, *orderID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return invoice, nil
+}
+
+// TransitionInvoiceStatus moves an invoice to a new lifecycle status, enforcing
+// the allowed transitions. Invoices with payments cannot be voided.
+func TransitionInvoiceStatus(tx *gorm.DB, invoiceID uint, status string) (*models.Invoice, error) {
+	to := models.NormalizeInvoiceStatus(status)
+	if to == "" {
+		return nil, ErrUnknownInvoiceStatus
+	}
+
+	invoice, err := lockInvoice(tx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	from := models.NormalizeInvoiceStatus(invoice.Status)
+	if !models.CanTransitionInvoice(from, to) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrIllegalStatusTransition, invoice.Status, to)
+	}
+	if to == models.InvoiceStatusVoid && (invoice.AmountPaid.IsPositive() || invoice.AmountWithheld.IsPositive()) {
+		return nil, fmt.Errorf("%w: invoice has payments and cannot be voided", ErrIllegalStatusTransition)
+	}
+
+	if err := tx.Model(invoice).Updates(map[string]interface{}{
+		"status":     to,
+		"updated_at": time.Now(),
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update invoice status: %w", err)
+	}
+
+	return invoice, nil
+}
+
+// settlementStatus derives the lifecycle status implied by the payments on an
+// invoice. Drafts and closed invoices keep their status, and a derived status
+// that is not reachable from the current one is ignored. Paid invoices are
+// reopened once something is due on them again.
+func settlementStatus(current string, totalPaid, amountDue money.Amount) string {
+	current = models.NormalizeInvoiceStatus(current)
+	switch current {
+	case models.InvoiceStatusDraft, models.InvoiceStatusVoid, models.InvoiceStatusWrittenOff, "":
+		return current
+	}
+
+	var derived string
+	switch {
+	case !amountDue.IsPositive():
+		derived = models.InvoiceStatusPaid
+	case current == models.InvoiceStatusPaid:
+		// Refunds and chargebacks reopen a paid invoice, outside of the lifecycle transitions
+		if totalPaid.IsPositive() {
+			return models.InvoiceStatusPartiallyPaid
+		}
+		return models.InvoiceStatusIssued
+	case current == models.InvoiceStatusOverdue:
+		// Partial payments do not bring an overdue invoice back on time
+		derived = models.InvoiceStatusOverdue
+	case totalPaid.IsPositive():
+		derived = models.InvoiceStatusPartiallyPaid
+	default:
+		derived = models.InvoiceStatusIssued
+	}
+
+	if derived != current && !models.CanTransitionInvoice(current, derived) {
+		return current
+	}
+	return derived
+}
+
+// checkInvoiceNumber rejects an invoice number another invoice of the sender
+// already carries. Numbers given by hand can collide with numbered invoices,
+// and allocated numbers with numbers given by hand before.
+func checkInvoiceNumber(tx *gorm.DB, invoice *models.Invoice) error {
+	var count int64
+	if err := tx.Model(&models.Invoice{}).
+		Where("sender_company_id = ? AND invoice_number = ? AND invoice_id <> ?", invoice.SenderCompanyID, invoice.InvoiceNumber, invoice.InvoiceID).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check invoice number: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %s", ErrDuplicateInvoiceNumber, invoice.InvoiceNumber)
+	}
+	return nil
+}
+
+// lockInvoice loads an invoice and locks its row for the rest of the transaction
+func lockInvoice(tx *gorm.DB, invoiceID uint) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&invoice, invoiceID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvoiceNotFound
+		}
+		return nil, fmt.Errorf("failed to load invoice: %w", err)
+	}
+	return &invoice, nil
+}
+
+// createInvoiceItems inserts the line items of an invoice
+func createInvoiceItems(tx *gorm.DB, invoiceID uint, items []models.InvoiceItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	for i := range items {
+		items[i].InvoiceItemID = 0
+		items[i].InvoiceID = invoiceID
+	}
+	if err := tx.Omit("Invoice", "Item").Create(&items).Error; err != nil {
+		return fmt.Errorf("failed to create invoice items: %w", err)
+	}
+	return nil
+}
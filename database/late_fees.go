@@ -0,0 +1,285 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/models"
+	"invoice-go/money"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrLateFeePolicyNotFound = errors.New("late fee policy not found")
+
+// lateFeesLockName is the MySQL named lock held while late fees are charged
+const lateFeesLockName = "invoice-go.late-fees"
+
+// lateFeeTaxName names the exempt entry late charges added as a line item take
+// in the tax breakdown of the invoice
+const lateFeeTaxName = "Late payment charges"
+
+// LateFeeRun summarises a run of ChargeLateFees
+type LateFeeRun struct {
+	Charged int `json:"charged"` // Invoices late charges were added to
+}
+
+// GetLateFeePolicy fetches the late fee policy of a sender company
+func GetLateFeePolicy(db *gorm.DB, companyID uint) (*models.LateFeePolicy, error) {
+	var policy models.LateFeePolicy
+	if err := db.Where("company_id = ?", companyID).First(&policy).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLateFeePolicyNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch late fee policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// GetLateFeeCharges lists the late charges added to an invoice, oldest first
+func GetLateFeeCharges(db *gorm.DB, invoiceID uint) ([]models.LateFeeCharge, error) {
+	var charges []models.LateFeeCharge
+	if err := db.Where("invoice_id = ?", invoiceID).Order("charge_date, late_fee_charge_id").Find(&charges).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch late fee charges: %w", err)
+	}
+	return charges, nil
+}
+
+// ChargeLateFees adds the late charges accrued by now to the overdue invoices
+// of the senders with an active late fee policy. The charges an invoice owes
+// in total are recomputed on every run and only the difference with what was
+// already charged is added, so running it again the same day charges nothing.
+// Fee invoices are not charged late fees themselves. A MySQL named lock keeps
+// several instances from running it at the same time.
+func ChargeLateFees(db *gorm.DB, now time.Time) (*LateFeeRun, error) {
+	today := now.Format("2006-01-02")
+	run := &LateFeeRun{}
+	err := withNamedLock(db, lateFeesLockName, func(conn *gorm.DB) error {
+		var policies []models.LateFeePolicy
+		if err := conn.Where("is_active = ?", true).Order("company_id").Find(&policies).Error; err != nil {
+			return fmt.Errorf("failed to fetch late fee policies: %w", err)
+		}
+
+		var errs []error
+		for _, policy := range policies {
+			var ids []uint
+			if err := conn.Model(&models.Invoice{}).
+				Where("sender_company_id = ? AND status = ? AND amount_due > 0 AND fee_for_invoice_id IS NULL AND DATEDIFF(?, DATE(due_date)) > ?",
+					policy.CompanyID, models.InvoiceStatusOverdue, today, policy.GraceDays).
+				Order("invoice_id").
+				Pluck("invoice_id", &ids).Error; err != nil {
+				errs = append(errs, fmt.Errorf("failed to fetch overdue invoices of company %d: %w", policy.CompanyID, err))
+				continue
+			}
+
+			for _, id := range ids {
+				var charge *models.LateFeeCharge
+				err := conn.Transaction(func(tx *gorm.DB) error {
+					var err error
+					charge, err = chargeLateFee(tx, id, &policy, now)
+					return err
+				})
+				if err != nil {
+					errs = append(errs, fmt.Errorf("invoice %d: %w", id, err))
+					continue
+				}
+				if charge != nil {
+					run.Charged++
+				}
+			}
+		}
+		return errors.Join(errs...)
+	})
+	return run, err
+}
+
+// chargeLateFee adds the late charges an overdue invoice accrued by now
+// under a policy, returning nil when nothing more is due
+func chargeLateFee(tx *gorm.DB, invoiceID uint, policy *models.LateFeePolicy, now time.Time) (*models.LateFeeCharge, error) {
+	invoice, err := lockInvoice(tx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if invoice.Status != models.InvoiceStatusOverdue || invoice.FeeForInvoiceID != nil {
+		return nil, nil
+	}
+	_, due, err := GetPaymentStatus(tx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	daysOverdue := int(dateOnly(now).Sub(dateOnly(invoice.DueDate)).Hours() / 24)
+	if !due.IsPositive() || daysOverdue <= policy.GraceDays {
+		return nil, nil
+	}
+
+	// Interest is not charged on the late charges added to the invoice itself
+	var charged, chargedOnInvoice money.Amount
+	if err := tx.Model(&models.LateFeeCharge{}).
+		Select("COALESCE(SUM(amount), 0), COALESCE(SUM(CASE WHEN method = ? THEN amount ELSE 0 END), 0)", models.LateFeeMethodLineItem).
+		Where("invoice_id = ?", invoiceID).
+		Row().Scan(&charged, &chargedOnInvoice); err != nil {
+		return nil, fmt.Errorf("failed to sum late fee charges: %w", err)
+	}
+	principal := due.Sub(chargedOnInvoice)
+	if principal.IsNegative() {
+		principal = money.Zero()
+	}
+
+	flatFee, err := ConvertAmount(tx, policy.FlatFee, policy.Currency, invoice.Currency, now)
+	if err != nil {
+		return nil, err
+	}
+	var maxAmount *money.Amount
+	if policy.MaxAmount != nil {
+		converted, err := ConvertAmount(tx, *policy.MaxAmount, policy.Currency, invoice.Currency, now)
+		if err != nil {
+			return nil, err
+		}
+		maxAmount = &converted
+	}
+
+	charge := calculateLateFee(policy, invoice.Currency, daysOverdue, principal, flatFee, maxAmount, charged)
+	if !charge.Amount.IsPositive() {
+		return nil, nil
+	}
+	charge.InvoiceID = invoiceID
+	charge.LateFeePolicyID = &policy.LateFeePolicyID
+	charge.ChargeDate = dateOnly(now)
+
+	description := fmt.Sprintf("Late payment charge on invoice %s (%d days overdue)", invoice.InvoiceNumber, daysOverdue)
+	item := models.InvoiceItem{
+		Description: description,
+		Quantity:    1,
+		UnitPrice:   charge.Amount,
+		ItemTotal:   charge.Amount,
+	}
+	if policy.Method == models.LateFeeMethodLineItem {
+		// The charge is exempt from tax and not discounted, so it adds to the
+		// subtotal and grand total as is, leaves tax_total alone and shows in
+		// the tax breakdown as an exempt amount
+		if err := createInvoiceItems(tx, invoiceID, []models.InvoiceItem{item}); err != nil {
+			return nil, err
+		}
+		if err := addExemptTaxable(tx, invoiceID, charge.Amount); err != nil {
+			return nil, err
+		}
+		if err := tx.Model(invoice).Updates(map[string]interface{}{
+			"subtotal":    invoice.Subtotal.Add(charge.Amount),
+			"grand_total": invoice.GrandTotal.Add(charge.Amount),
+			"updated_at":  now,
+		}).Error; err != nil {
+			return nil, fmt.Errorf("failed to update invoice totals: %w", err)
+		}
+		if _, _, err := GetPaymentStatus(tx, invoiceID); err != nil {
+			return nil, err
+		}
+		charge.InvoiceItemID = &item.InvoiceItemID
+	} else {
+		feeInvoice, err := createFeeInvoice(tx, invoice, item, now)
+		if err != nil {
+			return nil, err
+		}
+		charge.FeeInvoiceID = &feeInvoice.InvoiceID
+	}
+
+	if err := tx.Create(&charge).Error; err != nil {
+		return nil, fmt.Errorf("failed to record late fee charge: %w", err)
+	}
+	return &charge, nil
+}
+
+// addExemptTaxable adds a late charge to the exempt entry of an invoice's tax
+// breakdown, creating the entry on the first charge
+func addExemptTaxable(tx *gorm.DB, invoiceID uint, amount money.Amount) error {
+	var entry models.InvoiceTax
+	err := tx.Where("invoice_id = ? AND kind = ? AND tax_code = '' AND name = ?", invoiceID, models.TaxKindExempt, lateFeeTaxName).
+		First(&entry).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		entry = models.InvoiceTax{
+			InvoiceID:     invoiceID,
+			Name:          lateFeeTaxName,
+			Kind:          models.TaxKindExempt,
+			TaxableAmount: amount,
+			TaxAmount:     money.Zero(),
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return fmt.Errorf("failed to add late charges to the tax breakdown: %w", err)
+		}
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to load the tax breakdown: %w", err)
+	}
+	if err := tx.Model(&entry).Update("taxable_amount", entry.TaxableAmount.Add(amount)).Error; err != nil {
+		return fmt.Errorf("failed to add late charges to the tax breakdown: %w", err)
+	}
+	return nil
+}
+
+// createFeeInvoice bills a late charge on a separate invoice to the customer
+// of the overdue invoice, issued and due immediately
+func createFeeInvoice(tx *gorm.DB, invoice *models.Invoice, item models.InvoiceItem, now time.Time) (*models.Invoice, error) {
+	subject := "Late payment charges on invoice " + invoice.InvoiceNumber
+	feeInvoice := models.Invoice{
+		SenderCompanyID:    invoice.SenderCompanyID,
+		RecipientCompanyID: invoice.RecipientCompanyID,
+		BillingAddressID:   invoice.BillingAddressID,
+		ShippingAddressID:  invoice.ShippingAddressID,
+		FeeForInvoiceID:    &invoice.InvoiceID,
+		InvoiceDate:        now,
+		DueDate:            now,
+		InvoiceSubject:     &subject,
+		Currency:           invoice.Currency,
+		Status:             models.InvoiceStatusDraft,
+	}
+	if err := CreateInvoiceWithItems(tx, &feeInvoice, []models.InvoiceItem{item}); err != nil {
+		return nil, err
+	}
+	if _, err := TransitionInvoiceStatus(tx, feeInvoice.InvoiceID, models.InvoiceStatusIssued); err != nil {
+		return nil, err
+	}
+	feeInvoice.Status = models.InvoiceStatusIssued
+	return &feeInvoice, nil
+}
+
+// calculateLateFee computes the late charges an invoice owes in total after
+// daysOverdue days and what is left to charge, describing the calculation.
+// The flat fee and cap are in the invoice currency already.
+func calculateLateFee(policy *models.LateFeePolicy, currency string, daysOverdue int, principal, flatFee money.Amount, maxAmount *money.Amount, previouslyCharged money.Amount) models.LateFeeCharge {
+	periodDays := policy.PeriodDays
+	if periodDays <= 0 {
+		periodDays = 30
+	}
+	// Every started period after the grace days counts in full
+	lateDays := daysOverdue - policy.GraceDays
+	periods := (lateDays + periodDays - 1) / periodDays
+	interest := principal.Percent(policy.InterestPercentage * float64(periods)).Round(currency)
+	accrued := flatFee.Add(interest)
+
+	var calculation strings.Builder
+	fmt.Fprintf(&calculation, "%d days overdue, %d after %d grace days: flat fee %s + %s%% x %d period(s) of %d days on %s = %s; accrued %s",
+		daysOverdue, lateDays, policy.GraceDays, flatFee, strconv.FormatFloat(policy.InterestPercentage, 'f', -1, 64),
+		periods, periodDays, principal, interest, accrued)
+	if maxAmount != nil && accrued.GreaterThan(*maxAmount) {
+		accrued = *maxAmount
+		fmt.Fprintf(&calculation, ", capped at %s", accrued)
+	}
+	amount := accrued.Sub(previouslyCharged)
+	fmt.Fprintf(&calculation, "; %s charged before, %s charged now", previouslyCharged, amount)
+
+	return models.LateFeeCharge{
+		DaysOverdue:       daysOverdue,
+		Periods:           periods,
+		Principal:         principal,
+		FlatFee:           flatFee,
+		Interest:          interest,
+		Accrued:           accrued,
+		PreviouslyCharged: previouslyCharged,
+		Amount:            amount,
+		Currency:          currency,
+		Method:            policy.Method,
+		Calculation:       calculation.String(),
+	}
+}
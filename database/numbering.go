@@ -0,0 +1,164 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/models"
+	"invoice-go/utils"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidNumberPattern = errors.New("number pattern must contain the {SEQ} token, and {YYYY} or {YY} when the series resets yearly")
+	ErrSeriesRewind         = errors.New("next_value cannot be lower than the current value of the series")
+)
+
+// defaultPrefixes are the prefixes of series a company has not configured yet
+var defaultPrefixes = map[string]string{
+	models.DocumentTypeInvoice:    "INV",
+	models.DocumentTypeCreditNote: "CN",
+}
+
+// defaultSeries returns the series used when a company has not configured one
+func defaultSeries(companyID uint, documentType string) models.DocumentNumberSeries {
+	prefix, ok := defaultPrefixes[documentType]
+	if !ok {
+		prefix = strings.ToUpper(documentType)
+	}
+	return models.DocumentNumberSeries{
+		CompanyID:    companyID,
+		DocumentType: documentType,
+		Prefix:       prefix,
+		Pattern:      "{PREFIX}-{YYYY}-{SEQ}",
+		Padding:      4,
+		ResetYearly:  true,
+		NextValue:    1,
+	}
+}
+
+// lockSeries returns the number series of a company for a document type with
+// its row locked, creating the default series on first use
+func lockSeries(tx *gorm.DB, companyID uint, documentType string) (*models.DocumentNumberSeries, error) {
+	series := defaultSeries(companyID, documentType)
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&series).Error; err != nil {
+		return nil, fmt.Errorf("failed to initialise number series: %w", err)
+	}
+
+	var locked models.DocumentNumberSeries
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("company_id = ? AND document_type = ?", companyID, documentType).
+		First(&locked).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock number series: %w", err)
+	}
+	return &locked, nil
+}
+
+// AllocateDocumentNumber hands out the next number of a company's series. The
+// series row stays locked until the surrounding transaction ends, so parallel
+// requests are serialised and a rolled back document gives its number back,
+// which keeps the series free of gaps.
+func AllocateDocumentNumber(tx *gorm.DB, companyID uint, documentType string, date time.Time) (string, error) {
+	series, err := lockSeries(tx, companyID, documentType)
+	if err != nil {
+		return "", err
+	}
+
+	year := date.Year()
+	if series.ResetYearly && series.CurrentYear > year {
+		// A back-dated document is numbered in the series of its own year
+		seq, err := allocateYearNumber(tx, series, year)
+		if err != nil {
+			return "", err
+		}
+		return utils.FormatDocumentNumber(series.Pattern, series.Prefix, series.Padding, date, seq), nil
+	}
+	if series.ResetYearly && series.CurrentYear != year {
+		// Keep where the finished year stopped for documents back-dated into it
+		if series.CurrentYear != 0 {
+			finished := models.DocumentNumberYear{SeriesID: series.SeriesID, Year: series.CurrentYear, NextValue: series.NextValue}
+			if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&finished).Error; err != nil {
+				return "", fmt.Errorf("failed to close number series year: %w", err)
+			}
+		}
+		series.NextValue = 1
+	}
+
+	seq := series.NextValue
+	if err := tx.Model(series).Updates(map[string]interface{}{
+		"next_value":   seq + 1,
+		"current_year": year,
+		"updated_at":   time.Now(),
+	}).Error; err != nil {
+		return "", fmt.Errorf("failed to advance number series: %w", err)
+	}
+
+	return utils.FormatDocumentNumber(series.Pattern, series.Prefix, series.Padding, date, seq), nil
+}
+
+// allocateYearNumber hands out the next number of a past year of a series
+// that resets yearly. The series row is locked by the caller; a year nothing
+// was numbered in yet starts at 1.
+func allocateYearNumber(tx *gorm.DB, series *models.DocumentNumberSeries, year int) (int64, error) {
+	counter := models.DocumentNumberYear{SeriesID: series.SeriesID, Year: year, NextValue: 1}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&counter).Error; err != nil {
+		return 0, fmt.Errorf("failed to initialise number series year: %w", err)
+	}
+	if err := tx.Where("series_id = ? AND year = ?", series.SeriesID, year).First(&counter).Error; err != nil {
+		return 0, fmt.Errorf("failed to load number series year: %w", err)
+	}
+
+	seq := counter.NextValue
+	if err := tx.Model(&models.DocumentNumberYear{}).
+		Where("series_id = ? AND year = ?", series.SeriesID, year).
+		Update("next_value", seq+1).Error; err != nil {
+		return 0, fmt.Errorf("failed to advance number series year: %w", err)
+	}
+	return seq, nil
+}
+
+// GetNumberSeries lists the number series configured for a company
+func GetNumberSeries(db *gorm.DB, companyID uint) ([]models.DocumentNumberSeries, error) {
+	var series []models.DocumentNumberSeries
+	if err := db.Where("company_id = ?", companyID).Order("document_type").Find(&series).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch number series: %w", err)
+	}
+	return series, nil
+}
+
+// ConfigureNumberSeries updates the pattern of a company's series. The counter
+// can only be moved forward, e.g. to continue a series from a previous system.
+func ConfigureNumberSeries(tx *gorm.DB, companyID uint, documentType string, config models.DocumentNumberSeries) (*models.DocumentNumberSeries, error) {
+	if !strings.Contains(config.Pattern, "{SEQ}") {
+		return nil, ErrInvalidNumberPattern
+	}
+	// Without the year in the number, a reset or a back-dated document would
+	// hand out a number the series already used
+	if config.ResetYearly && !strings.Contains(config.Pattern, "{YYYY}") && !strings.Contains(config.Pattern, "{YY}") {
+		return nil, ErrInvalidNumberPattern
+	}
+
+	series, err := lockSeries(tx, companyID, documentType)
+	if err != nil {
+		return nil, err
+	}
+	if config.NextValue != 0 && config.NextValue < series.NextValue {
+		return nil, ErrSeriesRewind
+	}
+
+	series.Prefix = config.Prefix
+	series.Pattern = config.Pattern
+	series.Padding = config.Padding
+	series.ResetYearly = config.ResetYearly
+	if config.NextValue != 0 {
+		series.NextValue = config.NextValue
+	}
+	if err := tx.Save(series).Error; err != nil {
+		return nil, fmt.Errorf("failed to update number series: %w", err)
+	}
+	return series, nil
+}
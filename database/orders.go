@@ -0,0 +1,411 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/models"
+	"invoice-go/money"
+	"invoice-go/utils"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrOrderNotFound         = errors.New("order not found")
+	ErrOrderAlreadyInvoiced  = errors.New("order has already been invoiced")
+	ErrSenderCompanyRequired = errors.New("sender company is required")
+	ErrMissingBillingAddress = errors.New("customer has no default billing address")
+	ErrSenderCompanyNotFound = errors.New("sender company not found")
+	ErrOrderFullyInvoiced    = errors.New("order has nothing left to invoice")
+	ErrOverInvoicing         = errors.New("requested quantity exceeds the remaining quantity of the order line")
+	ErrOrderItemNotFound     = errors.New("order line does not belong to this order")
+	ErrInvalidInvoiceSplit   = errors.New("specify either lines or percentage, not both")
+)
+
+// quantityTolerance absorbs float rounding when comparing DECIMAL(10,2) quantities
+const quantityTolerance = 0.005
+
+// OrderInvoiceOptions controls how an invoice is generated from an order
+type OrderInvoiceOptions struct {
+	SenderCompanyID   *uint
+	InvoiceNumber     string
+	InvoiceDate       time.Time
+	DueDate           time.Time
+	InvoiceSubject    *string
+	Notes             *string
+	TaxRatePercentage float64
+	Partial           bool
+	// Lines restricts the invoice to the given order lines and quantities
+	Lines []OrderInvoiceLine
+	// Percentage invoices the given share (0-100) of every order line
+	Percentage float64
+}
+
+// OrderInvoiceLine selects a quantity of one order line for a partial invoice
+type OrderInvoiceLine struct {
+	OrderItemID uint
+	Quantity    float64
+}
+
+// InvoiceOrder creates an invoice for an order, copying order lines into invoice
+// items. Without lines or a percentage every remaining quantity is invoiced.
+// Over-invoicing an order line is rejected, and the order moves to "invoiced"
+// once every line is fully billed ("partially_invoiced" before that). The order
+// row is locked so concurrent requests cannot invoice the same quantities twice.
+func InvoiceOrder(tx *gorm.DB, orderID uint, opts OrderInvoiceOptions) (*models.Invoice, error) {
+	var order models.Order
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("OrderItems.Item").
+		Preload("CustomerCompany").
+		First(&order, orderID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, fmt.Errorf("failed to load order: %w", err)
+	}
+
+	// Refuse to invoice the same order twice unless partial invoicing is requested
+	var existing int64
+	if err := tx.Model(&models.Invoice{}).
+		Where("order_id = ? AND status <> ?", orderID, models.InvoiceStatusVoid).
+		Count(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to check existing invoices: %w", err)
+	}
+	if existing > 0 && !opts.Partial {
+		return nil, ErrOrderAlreadyInvoiced
+	}
+	if len(opts.Lines) > 0 && opts.Percentage > 0 {
+		return nil, ErrInvalidInvoiceSplit
+	}
+
+	if err := LoadOrderInvoicing(tx, &order); err != nil {
+		return nil, err
+	}
+	quantities, err := invoiceQuantities(&order, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	senderID, err := resolveSenderCompanyID(tx, opts.SenderCompanyID)
+	if err != nil {
+		return nil, err
+	}
+
+	billingAddressID, err := companyAddressID(tx, order.CustomerCompany.CompanyID, order.CustomerCompany.DefaultBillingAddressID, "billing")
+	if err != nil {
+		return nil, err
+	}
+	if billingAddressID == nil {
+		return nil, ErrMissingBillingAddress
+	}
+	shippingAddressID, err := companyAddressID(tx, order.CustomerCompany.CompanyID, order.CustomerCompany.DefaultShippingAddressID, "shipping")
+	if err != nil {
+		return nil, err
+	}
+
+	invoiceDate := opts.InvoiceDate
+	if invoiceDate.IsZero() {
+		invoiceDate = time.Now()
+	}
+	dueDate := opts.DueDate
+	if dueDate.IsZero() {
+		dueDate = invoiceDate.AddDate(0, 0, 30)
+	}
+
+	invoice := models.Invoice{
+		SenderCompanyID:    senderID,
+		RecipientCompanyID: order.CustomerCompanyID,
+		BillingAddressID:   *billingAddressID,
+		ShippingAddressID:  shippingAddressID,
+		OrderID:            &order.OrderID,
+		InvoiceNumber:      opts.InvoiceNumber,
+		InvoiceDate:        invoiceDate,
+		DueDate:            dueDate,
+		InvoiceSubject:     opts.InvoiceSubject,
+		Notes:              opts.Notes,
+		Currency:           order.Currency,
+		Status:             models.InvoiceStatusDraft,
+	}
+
+	// Order lines carry catalog prices; the invoice includes tax when all of them do
+	invoice.TaxInclusive = len(order.OrderItems) > 0
+	for _, orderItem := range order.OrderItems {
+		invoice.TaxInclusive = invoice.TaxInclusive && orderItem.Item.TaxInclusive
+	}
+
+	items := make([]models.InvoiceItem, 0, len(order.OrderItems))
+	orderLines, invoicedLines := money.Zero(), money.Zero()
+	for _, orderItem := range order.OrderItems {
+		orderLines = orderLines.Add(orderItem.ItemTotal)
+		quantity := quantities[orderItem.OrderItemID]
+		if quantity <= 0 {
+			continue
+		}
+		invoicedLines = invoicedLines.Add(prorate(orderItem.ItemTotal, quantity, orderItem.Quantity, order.Currency))
+		itemID := orderItem.ItemID
+		orderItemID := orderItem.OrderItemID
+		items = append(items, models.InvoiceItem{
+			ItemID:            &itemID,
+			OrderItemID:       &orderItemID,
+			Description:       orderItem.Item.Name,
+			Quantity:          quantity,
+			UnitPrice:         orderItem.UnitPrice,
+			DiscountAmount:    prorate(orderItem.Discount, quantity, orderItem.Quantity, order.Currency),
+			TaxRatePercentage: opts.TaxRatePercentage,
+			PriceTaxInclusive: &orderItem.Item.TaxInclusive,
+		})
+	}
+	if len(items) == 0 {
+		return nil, ErrOrderFullyInvoiced
+	}
+
+	// The order discount carries over, its fixed part in proportion to the invoiced lines
+	invoice.DiscountPercentage = order.DiscountPercentage
+	if !order.DiscountAmount.IsZero() && !orderLines.IsZero() {
+		invoice.DiscountAmount = order.DiscountAmount.Share(invoicedLines, orderLines).Round(order.Currency)
+	}
+
+	// Creating the invoice moves the order to invoiced or partially_invoiced
+	if err := CreateInvoiceWithItems(tx, &invoice, items); err != nil {
+		return nil, err
+	}
+
+	return &invoice, nil
+}
+
+// resolveSenderCompanyID returns the requested sender company, falling back to
+// the DEFAULT_SENDER_COMPANY_ID environment variable
+func resolveSenderCompanyID(tx *gorm.DB, requested *uint) (uint, error) {
+	var senderID uint
+	if requested != nil {
+		senderID = *requested
+	} else if v := os.Getenv("DEFAULT_SENDER_COMPANY_ID"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid DEFAULT_SENDER_COMPANY_ID: %w", err)
+		}
+		senderID = uint(id)
+	} else {
+		return 0, ErrSenderCompanyRequired
+	}
+
+	var count int64
+	if err := tx.Model(&models.Company{}).Where("company_id = ?", senderID).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to check sender company: %w", err)
+	}
+	if count == 0 {
+		return 0, ErrSenderCompanyNotFound
+	}
+	return senderID, nil
+}
+
+// companyAddressID returns the company's default address when set, otherwise the
+// first address of the given type (e.g. "billing") registered for the company
+func companyAddressID(tx *gorm.DB, companyID uint, defaultID *uint, addressType string) (*uint, error) {
+	if defaultID != nil {
+		return defaultID, nil
+	}
+
+	var address models.Address
+	err := tx.Where("company_id = ? AND LOWER(address_type) = ?", companyID, addressType).
+		Order("address_id").
+		First(&address).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to look up %s address: %w", addressType, err)
+	}
+	return &address.AddressID, nil
+}
+
+// invoiceQuantities works out how much of each order line goes on the new
+// invoice, keyed by order_item_id
+func invoiceQuantities(order *models.Order, opts OrderInvoiceOptions) (map[uint]float64, error) {
+	quantities := make(map[uint]float64, len(order.OrderItems))
+	lines := make(map[uint]*models.OrderItem, len(order.OrderItems))
+	for i := range order.OrderItems {
+		lines[order.OrderItems[i].OrderItemID] = &order.OrderItems[i]
+	}
+
+	switch {
+	case len(opts.Lines) > 0:
+		for _, line := range opts.Lines {
+			orderItem, ok := lines[line.OrderItemID]
+			if !ok {
+				return nil, ErrOrderItemNotFound
+			}
+			quantities[line.OrderItemID] += line.Quantity
+			if quantities[line.OrderItemID]-orderItem.RemainingQuantity > quantityTolerance {
+				return nil, ErrOverInvoicing
+			}
+		}
+	case opts.Percentage > 0:
+		for _, orderItem := range order.OrderItems {
+			quantity := utils.RoundAmount(orderItem.Quantity * opts.Percentage / 100)
+			if quantity-orderItem.RemainingQuantity > quantityTolerance {
+				return nil, ErrOverInvoicing
+			}
+			quantities[orderItem.OrderItemID] = quantity
+		}
+	default:
+		for _, orderItem := range order.OrderItems {
+			quantities[orderItem.OrderItemID] = orderItem.RemainingQuantity
+		}
+	}
+
+	return quantities, nil
+}
+
+// prorate returns the part of an amount falling on quantity units out of total
+func prorate(amount money.Amount, quantity, total float64, currency string) money.Amount {
+	if amount.IsZero() || total == 0 {
+		return money.Zero()
+	}
+	if quantity == total {
+		return amount
+	}
+	return amount.Mul(quantity / total).Round(currency)
+}
+
+// LoadOrderInvoicing fills in how much of each order line has already been
+// invoiced and what remains, both as quantity and as net amount. Void invoices
+// do not count towards the invoiced quantities.
+func LoadOrderInvoicing(db *gorm.DB, order *models.Order) error {
+	type invoicedLine struct {
+		OrderItemID uint
+		Quantity    float64
+		Amount      money.Amount
+	}
+	var invoiced []invoicedLine
+	err := db.Table("invoice_items AS ii").
+		Select("ii.order_item_id, COALESCE(SUM(ii.quantity), 0) AS quantity, COALESCE(SUM(ii.item_total), 0) AS amount").
+		Joins("JOIN order_items AS oi ON oi.order_item_id = ii.order_item_id").
+		Joins("JOIN invoices AS i ON i.invoice_id = ii.invoice_id").
+		Where("oi.order_id = ? AND i.status <> ?", order.OrderID, models.InvoiceStatusVoid).
+		Group("ii.order_item_id").
+		Scan(&invoiced).Error
+	if err != nil {
+		return fmt.Errorf("failed to load invoiced quantities: %w", err)
+	}
+
+	byLine := make(map[uint]invoicedLine, len(invoiced))
+	for _, line := range invoiced {
+		byLine[line.OrderItemID] = line
+	}
+
+	order.InvoicedTotal = money.Zero()
+	order.RemainingTotal = money.Zero()
+	for i := range order.OrderItems {
+		orderItem := &order.OrderItems[i]
+		line := byLine[orderItem.OrderItemID]
+		orderItem.InvoicedQuantity = utils.RoundAmount(line.Quantity)
+		orderItem.RemainingQuantity = utils.RoundAmount(orderItem.Quantity - line.Quantity)
+		orderItem.InvoicedAmount = line.Amount
+		orderItem.RemainingAmount = orderItem.ItemTotal.Sub(line.Amount)
+		order.InvoicedTotal = order.InvoicedTotal.Add(orderItem.InvoicedAmount)
+		order.RemainingTotal = order.RemainingTotal.Add(orderItem.RemainingAmount)
+	}
+
+	return nil
+}
+
+// reserveOrderLines checks the invoice lines that bill order lines: they must
+// belong to the invoice's order and leave no order line over-invoiced. The
+// order row is locked so concurrent invoices cannot bill the same quantities
+// twice. Lines the invoice had before must be removed beforehand, so an
+// edited draft does not count against itself.
+func reserveOrderLines(tx *gorm.DB, orderID *uint, items []models.InvoiceItem) error {
+	quantities := make(map[uint]float64)
+	for _, item := range items {
+		if item.OrderItemID != nil {
+			quantities[*item.OrderItemID] += item.Quantity
+		}
+	}
+	if len(quantities) == 0 {
+		return nil
+	}
+	if orderID == nil {
+		return ErrOrderItemNotFound
+	}
+
+	order, err := lockOrder(tx, *orderID)
+	if err != nil {
+		return err
+	}
+	remaining := make(map[uint]float64, len(order.OrderItems))
+	for _, orderItem := range order.OrderItems {
+		remaining[orderItem.OrderItemID] = orderItem.RemainingQuantity
+	}
+	for orderItemID, quantity := range quantities {
+		left, ok := remaining[orderItemID]
+		if !ok {
+			return ErrOrderItemNotFound
+		}
+		if quantity-left > quantityTolerance {
+			return ErrOverInvoicing
+		}
+	}
+	return nil
+}
+
+// refreshOrderStatus moves an order to "invoiced" once every line is fully
+// billed by invoices that are not void, or to "partially_invoiced" while only
+// part of it is. An order with nothing invoiced keeps its status.
+func refreshOrderStatus(tx *gorm.DB, orderID uint) error {
+	order, err := lockOrder(tx, orderID)
+	if err != nil {
+		return err
+	}
+	fullyInvoiced, invoiced := true, false
+	for _, orderItem := range order.OrderItems {
+		if orderItem.RemainingQuantity > quantityTolerance {
+			fullyInvoiced = false
+		}
+		if orderItem.InvoicedQuantity > quantityTolerance {
+			invoiced = true
+		}
+	}
+	if !invoiced {
+		return nil
+	}
+
+	status := "invoiced"
+	if !fullyInvoiced {
+		status = "partially_invoiced"
+	}
+	if status == order.Status {
+		return nil
+	}
+	if err := tx.Model(&models.Order{}).
+		Where("order_id = ?", orderID).
+		Updates(map[string]interface{}{
+			"status":     status,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+		return fmt.Errorf("failed to update order status: %w", err)
+	}
+	return nil
+}
+
+// lockOrder loads an order with its lines and how much of them is invoiced,
+// locking the order row for the rest of the transaction
+func lockOrder(tx *gorm.DB, orderID uint) (*models.Order, error) {
+	var order models.Order
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("OrderItems").First(&order, orderID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, fmt.Errorf("failed to load order: %w", err)
+	}
+	if err := LoadOrderInvoicing(tx, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"invoice-go/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrJobLocked is returned when another instance is already running a job
+var ErrJobLocked = errors.New("job is already running in another instance")
+
+// overdueLockName is the MySQL named lock held while invoices are marked overdue
+const overdueLockName = "invoice-go.overdue-invoices"
+
+// withNamedLock runs fn while holding a MySQL named lock, so that only one
+// instance of the service runs it at a time. Named locks belong to a session,
+// so fn is given the connection holding the lock. ErrJobLocked is returned
+// without running fn when the lock is held elsewhere.
+func withNamedLock(db *gorm.DB, name string, fn func(conn *gorm.DB) error) error {
+	return db.Connection(func(conn *gorm.DB) error {
+		var acquired sql.NullInt64
+		if err := conn.Raw("SELECT GET_LOCK(?, 0)", name).Scan(&acquired).Error; err != nil {
+			return fmt.Errorf("failed to acquire lock %s: %w", name, err)
+		}
+		if !acquired.Valid || acquired.Int64 != 1 {
+			return ErrJobLocked
+		}
+		defer conn.Exec("SELECT RELEASE_LOCK(?)", name)
+		return fn(conn)
+	})
+}
+
+// OverdueRun summarises a run of MarkOverdueInvoices
+type OverdueRun struct {
+	Marked  int   `json:"marked"`  // Invoices that became Overdue
+	Overdue int64 `json:"overdue"` // Overdue invoices in total after the run
+}
+
+// MarkOverdueInvoices moves the issued and partially paid invoices that are
+// past their due date with an amount still due to Overdue, and refreshes the
+// days_overdue of every invoice. The amount due of each candidate is
+// recomputed from its payments and credit notes before it is marked. Running
+// it again on the same day changes nothing, and a MySQL named lock keeps
+// several instances from running it at the same time. An invoice that fails
+// does not stop the run; the errors are returned together with the run.
+func MarkOverdueInvoices(db *gorm.DB, now time.Time) (*OverdueRun, error) {
+	today := now.Format("2006-01-02")
+	run := &OverdueRun{}
+	err := withNamedLock(db, overdueLockName, func(conn *gorm.DB) error {
+		var ids []uint
+		if err := conn.Model(&models.Invoice{}).
+			Where("status IN ? AND amount_due > 0 AND DATE(due_date) < ?",
+				[]string{models.InvoiceStatusIssued, models.InvoiceStatusPartiallyPaid}, today).
+			Order("invoice_id").
+			Pluck("invoice_id", &ids).Error; err != nil {
+			return fmt.Errorf("failed to fetch invoices past due: %w", err)
+		}
+
+		var errs []error
+		for _, id := range ids {
+			var marked bool
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if _, err := lockInvoice(tx, id); err != nil {
+					return err
+				}
+				status, due, err := GetPaymentStatus(tx, id)
+				if err != nil {
+					return err
+				}
+				if !due.IsPositive() || !models.CanTransitionInvoice(status, models.InvoiceStatusOverdue) {
+					return nil
+				}
+				marked = true
+				return tx.Model(&models.Invoice{}).
+					Where("invoice_id = ?", id).
+					Updates(map[string]interface{}{
+						"status":     models.InvoiceStatusOverdue,
+						"updated_at": now,
+					}).Error
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to mark invoice %d overdue: %w", id, err))
+				continue
+			}
+			if marked {
+				run.Marked++
+			}
+		}
+
+		// Count the days from the due date while an amount is due, zero otherwise
+		if err := conn.Exec(`UPDATE invoices SET days_overdue = DATEDIFF(?, DATE(due_date))
+			WHERE status = ? AND amount_due > 0 AND days_overdue <> DATEDIFF(?, DATE(due_date))`,
+			today, models.InvoiceStatusOverdue, today).Error; err != nil {
+			errs = append(errs, fmt.Errorf("failed to update days overdue: %w", err))
+		}
+		if err := conn.Exec(`UPDATE invoices SET days_overdue = 0
+			WHERE days_overdue <> 0 AND (status <> ? OR amount_due <= 0)`,
+			models.InvoiceStatusOverdue).Error; err != nil {
+			errs = append(errs, fmt.Errorf("failed to reset days overdue: %w", err))
+		}
+
+		if err := conn.Model(&models.Invoice{}).
+			Where("status = ?", models.InvoiceStatusOverdue).
+			Count(&run.Overdue).Error; err != nil {
+			errs = append(errs, fmt.Errorf("failed to count overdue invoices: %w", err))
+		}
+		return errors.Join(errs...)
+	})
+	return run, err
+}
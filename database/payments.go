@@ -0,0 +1,150 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPaymentStatus      = errors.New("unknown payment status, expected one of: pending, completed, failed, cancelled")
+	ErrPaymentReversed    = errors.New("payment has refunds or chargebacks")
+	ErrPaymentFromReceipt = errors.New("payment was allocated from a receipt")
+	ErrPaymentIsReversal  = errors.New("refunds and chargebacks are deleted rather than changed")
+)
+
+// RecordPayment records a payment of an invoice that accepts payments, in the
+// invoice currency, and brings the invoice's amounts and status up to date.
+// Callers are expected to pass a transaction.
+func RecordPayment(tx *gorm.DB, payment *models.Payment) error {
+	status := models.NormalizePaymentStatus(payment.Status)
+	if status == "" {
+		return ErrPaymentStatus
+	}
+	payment.Status = status
+
+	invoice, err := lockInvoice(tx, payment.InvoiceID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !models.InvoiceAcceptsPayments(invoice.Status):
+		return fmt.Errorf("%w in status %s: %s", ErrInvoiceNotPayable, invoice.Status, invoice.InvoiceNumber)
+	case payment.Currency != invoice.Currency:
+		return fmt.Errorf("%w %s: %s", ErrCurrencyMismatch, invoice.Currency, invoice.InvoiceNumber)
+	}
+
+	if err := tx.Omit("Invoice").Create(payment).Error; err != nil {
+		return fmt.Errorf("failed to record payment: %w", err)
+	}
+	if _, _, err := GetPaymentStatus(tx, payment.InvoiceID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdatePaymentStatus changes the status of a payment and brings the invoice's
+// amounts and status up to date. Payments allocated from a receipt, and
+// payments with refunds or chargebacks, keep their status so the receipt and
+// the reversals stay consistent with them. Callers are expected to pass a
+// transaction.
+func UpdatePaymentStatus(tx *gorm.DB, paymentID uint, status string) (*models.Payment, error) {
+	normalized := models.NormalizePaymentStatus(status)
+	if normalized == "" {
+		return nil, ErrPaymentStatus
+	}
+
+	payment, err := lockPayment(tx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPaymentChange(tx, payment); err != nil {
+		return nil, err
+	}
+	if _, err := lockInvoice(tx, payment.InvoiceID); err != nil {
+		return nil, err
+	}
+
+	// The payments table has no updated_at column
+	if err := tx.Model(payment).Update("status", normalized).Error; err != nil {
+		return nil, fmt.Errorf("failed to update payment status: %w", err)
+	}
+	payment.Status = normalized
+	if _, _, err := GetPaymentStatus(tx, payment.InvoiceID); err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// DeletePayment deletes a payment recorded by mistake, or a refund or
+// chargeback, and returns its invoice with the amounts and status brought up
+// to date. Bank statement lines reconciled with it go back to the
+// reconciliation queue. Payments allocated from a receipt or with refunds or chargebacks
+// cannot be deleted. Callers are expected to pass a transaction.
+func DeletePayment(tx *gorm.DB, paymentID uint) (*models.Invoice, error) {
+	payment, err := lockPayment(tx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPaymentChange(tx, payment); err != nil && !errors.Is(err, ErrPaymentIsReversal) {
+		return nil, err
+	}
+	if _, err := lockInvoice(tx, payment.InvoiceID); err != nil {
+		return nil, err
+	}
+
+	lines, err := unmatchBankLines(tx, payment.PaymentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Delete(&models.Payment{}, payment.PaymentID).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete payment: %w", err)
+	}
+	for i := range lines {
+		if _, err := ProposeBankMatches(tx, &lines[i]); err != nil {
+			return nil, err
+		}
+	}
+	if _, _, err := GetPaymentStatus(tx, payment.InvoiceID); err != nil {
+		return nil, err
+	}
+
+	var invoice models.Invoice
+	if err := tx.First(&invoice, payment.InvoiceID).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch invoice: %w", err)
+	}
+	return &invoice, nil
+}
+
+// checkPaymentChange reports why a payment cannot be changed or deleted on its own
+func checkPaymentChange(tx *gorm.DB, payment *models.Payment) error {
+	if payment.ReversesPaymentID != nil {
+		return ErrPaymentIsReversal
+	}
+	if payment.ReceiptID != nil {
+		return fmt.Errorf("%w: receipt %d", ErrPaymentFromReceipt, *payment.ReceiptID)
+	}
+	var reversals int64
+	if err := tx.Model(&models.Payment{}).Where("reverses_payment_id = ?", payment.PaymentID).Count(&reversals).Error; err != nil {
+		return fmt.Errorf("failed to count payment reversals: %w", err)
+	}
+	if reversals > 0 {
+		return ErrPaymentReversed
+	}
+	return nil
+}
+
+// lockPayment loads a payment and locks its row for the rest of the transaction
+func lockPayment(tx *gorm.DB, paymentID uint) (*models.Payment, error) {
+	var payment models.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, paymentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, fmt.Errorf("failed to load payment: %w", err)
+	}
+	return &payment, nil
+}
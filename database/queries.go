@@ -3,6 +3,7 @@ package database
 import (
 	"fmt"
 	"invoice-go/models"
+	"invoice-go/money"
 	"gorm.io/gorm"
 	"time"
 )
@@ -44,65 +45,81 @@ func GetTransactionDetails(db *gorm.DB, invoiceID uint) (*models.Invoice, error)
 }
 
 // GetSubtotalCalculation (v02)
-func GetSubtotalCalculation(db *gorm.DB, invoiceID uint) (float64, error) {
-	var subtotal float64
+func GetSubtotalCalculation(db *gorm.DB, invoiceID uint) (money.Amount, error) {
+	var subtotal money.Amount
 	
 	// Calculate the sum of all invoice items
 	err := db.Model(&models.InvoiceItem{}).
 		Select("SUM(item_total)").
 		Where("invoice_id = ?", invoiceID).
-		Scan(&subtotal).Error
+		Row().Scan(&subtotal)
 	
 	if err != nil {
-		return 0, fmt.Errorf("failed to calculate subtotal: %w", err)
+		return money.Zero(), fmt.Errorf("failed to calculate subtotal: %w", err)
 	}
 	
 	return subtotal, nil
 }
 
-// GetPaymentStatus returns the payment status and amount due for an invoice - V02
-func GetPaymentStatus(db *gorm.DB, invoiceID uint) (string, float64, error) {
-	var invoice models.Invoice
-	var totalPaid float64
-	
+// GetPaymentStatus returns the lifecycle status and amount due for an invoice - V02.
+// The status follows the payments (Issued, PartiallyPaid, Paid) but only along
+// transitions allowed by the invoice lifecycle. Tax withheld by the customer
+// settles the invoice like the cash it paid, and so does credit applied from
+// the customer's credit balance. Payments and credit notes beyond what is due
+// are moved to the credit balance, so the amount due never goes negative. The
+// invoice row is locked while its amounts are brought up to date.
+func GetPaymentStatus(db *gorm.DB, invoiceID uint) (string, money.Amount, error) {
+	var status string
+	var amountDue money.Amount
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		status, amountDue, err = settleInvoice(tx, invoiceID)
+		return err
+	})
+	if err != nil {
+		return "", money.Zero(), err
+	}
+	return status, amountDue, nil
+}
+
+// settleInvoice recomputes the amounts and status of a locked invoice for GetPaymentStatus
+func settleInvoice(tx *gorm.DB, invoiceID uint) (string, money.Amount, error) {
 	// Get the invoice
-	if err := db.Where("invoice_id = ?", invoiceID).First(&invoice).Error; err != nil {
-		return "", 0, fmt.Errorf("failed to find invoice: %w", err)
+	invoice, err := lockInvoice(tx, invoiceID)
+	if err != nil {
+		return "", money.Zero(), fmt.Errorf("failed to find invoice: %w", err)
 	}
 	
-	// Calculate total payments
-	if err := db.Model(&models.Payment{}).
-		Select("COALESCE(SUM(amount), 0)").
-		Where("invoice_id = ? AND status = 'completed'", invoiceID).
-		Scan(&totalPaid).Error; err != nil {
-		return "", 0, fmt.Errorf("failed to calculate payments: %w", err)
+	// Work out the balance from the payments, credit notes and credit entries
+	balance, excess, err := invoiceBalance(tx, invoice)
+	if err != nil {
+		return "", money.Zero(), err
 	}
 	
-	// Calculate amount due
-	amountDue := invoice.GrandTotal - totalPaid
-	
-	// Determine payment status
-	var status string
-	switch {
-	case amountDue <= 0:
-		status = "paid"
-	case totalPaid > 0:
-		status = "partial"
-	default:
-		status = "unpaid"
+	// Move what was paid or credited beyond the amount due to the credit balance
+	if excess.IsPositive() {
+		overpaid := balance.AmountPaid.Add(balance.AmountWithheld).GreaterThan(invoice.GrandTotal)
+		if _, err := recordExcessCredit(tx, invoice, excess, overpaid); err != nil {
+			return "", money.Zero(), err
+		}
 	}
 	
 	// Update invoice payment fields if they're out of sync
-	if totalPaid != invoice.AmountPaid || amountDue != invoice.AmountDue || status != invoice.Status {
-		db.Model(&invoice).Updates(map[string]interface{}{
-			"amount_paid": totalPaid,
-			"amount_due":  amountDue,
-			"status":      status,
+	if !balance.Equal(storedBalance(invoice)) {
+		if err := tx.Model(invoice).Updates(map[string]interface{}{
+			"amount_paid":     balance.AmountPaid,
+			"amount_withheld": balance.AmountWithheld,
+			"amount_credited": balance.AmountCredited,
+			"credit_applied":  balance.CreditApplied,
+			"amount_due":      balance.AmountDue,
+			"status":      balance.Status,
 			"updated_at":  time.Now(),
-		})
+		}).Error; err != nil {
+			return "", money.Zero(), fmt.Errorf("failed to update invoice amounts: %w", err)
+		}
 	}
 	
-	return status, amountDue, nil
+	return balance.Status, balance.AmountDue, nil
 }
 
 // Invoice Details Function
@@ -113,15 +130,22 @@ func GenerateInvoiceDetails(db *gorm.DB, invoiceID uint) ([]models.InvoiceDetail
             SELECT
                 ii.invoice_id,
                 ii.invoice_item_id,
-                itm.name,
+                COALESCE(itm.name, '') AS name,
                 ii.description,
                 ii.quantity,
                 ii.unit_price,
+                ii.discount_percentage,
+                ii.discount_amount,
+                ii.discount,
                 ii.item_total,
-                ii.tax_rate_percentage
+                ii.invoice_discount,
+                ii.tax_rate_percentage,
+                ii.tax_code,
+                ii.withholding_tax_code,
+                ii.withholding_rate_percentage
             FROM
                 invoice_items AS ii
-            JOIN
+            LEFT JOIN
                 items AS itm ON ii.item_id = itm.item_id
             WHERE
                 ii.invoice_id = ?
@@ -134,8 +158,15 @@ func GenerateInvoiceDetails(db *gorm.DB, invoiceID uint) ([]models.InvoiceDetail
             d.description,
             d.quantity,
             d.unit_price,
+            d.discount_percentage,
+            d.discount_amount,
+            d.discount,
             d.item_total,
-            d.tax_rate_percentage
+            d.invoice_discount,
+            d.tax_rate_percentage,
+            d.tax_code,
+            d.withholding_tax_code,
+            d.withholding_rate_percentage
         FROM
             details AS d
         JOIN
@@ -174,17 +205,19 @@ func GenerateInvoiceReport(db *gorm.DB, invoiceID uint) (*models.InvoiceReportRe
 
     // Fetch sender and recipient companies
     var senderCompany, recipientCompany models.Company
-    if err := db.First(&senderCompany, "company_id = ?", invoiceAddress.SenderCompanyID).Error; err != nil {
+    if err := db.Preload("DefaultBillingAddress").First(&senderCompany, "company_id = ?", invoiceAddress.SenderCompanyID).Error; err != nil {
         return nil, fmt.Errorf("sender company not found: %w", err)
     }
     if err := db.First(&recipientCompany, "company_id = ?", invoiceAddress.RecipientCompanyID).Error; err != nil {
         return nil, fmt.Errorf("recipient company not found: %w", err)
     }
 
-    // Fetch order details
+    // Fetch order details; manually created invoices have no order
     var order models.Order
-    if err := db.Preload("OrderItems.Item").First(&order, "order_id = ?", invoiceAddress.OrderID).Error; err != nil {
-        return nil, fmt.Errorf("order details not found: %w", err)
+    if invoiceAddress.OrderID != nil {
+        if err := db.Preload("OrderItems.Item").First(&order, "order_id = ?", *invoiceAddress.OrderID).Error; err != nil {
+            return nil, fmt.Errorf("order details not found: %w", err)
+        }
     }
 
     // Fetch invoice items using optimized query
@@ -198,23 +231,51 @@ func GenerateInvoiceReport(db *gorm.DB, invoiceID uint) (*models.InvoiceReportRe
     for _, d := range details {
         item := &models.Item{Name: d.ItemName} // Populate item name
         invoiceItems = append(invoiceItems, models.InvoiceItem{
-            InvoiceItemID:     d.InvoiceItemID,
-            InvoiceID:         d.InvoiceID,
-            Description:       d.Description,
-            Quantity:          d.Quantity,
-            UnitPrice:         d.UnitPrice,
-            ItemTotal:         d.ItemTotal,
-            TaxRatePercentage: d.TaxRatePercentage,
-            Item:              item,
+            InvoiceItemID:             d.InvoiceItemID,
+            InvoiceID:                 d.InvoiceID,
+            Description:               d.Description,
+            Quantity:                  d.Quantity,
+            UnitPrice:                 d.UnitPrice,
+            DiscountPercentage:        d.DiscountPercentage,
+            DiscountAmount:            d.DiscountAmount,
+            Discount:                  d.Discount,
+            ItemTotal:                 d.ItemTotal,
+            InvoiceDiscount:           d.InvoiceDiscount,
+            TaxRatePercentage:         d.TaxRatePercentage,
+            TaxCode:                   d.TaxCode,
+            WithholdingTaxCode:        d.WithholdingTaxCode,
+            WithholdingRatePercentage: d.WithholdingRatePercentage,
+            Item:                      item,
         })
     }
 
+    // Fetch the tax breakdown
+    if err := db.Where("invoice_id = ?", invoiceID).Order("invoice_tax_id").Find(&invoiceAddress.Taxes).Error; err != nil {
+        return nil, fmt.Errorf("invoice taxes fetch failed: %w", err)
+    }
+
     // Fetch payments
     var payments []models.Payment
     if err := db.Where("invoice_id = ?", invoiceID).Find(&payments).Error; err != nil {
         return nil, fmt.Errorf("payments fetch failed: %w", err)
     }
 
+    // Fetch credit notes issued against the invoice
+    creditNotes, err := GetInvoiceCreditNotes(db, invoiceID)
+    if err != nil {
+        return nil, err
+    }
+
+    // Reload the invoice, GetPaymentStatus may have synced its balance
+    var current models.Invoice
+    if err := db.First(&current, invoiceID).Error; err != nil {
+        return nil, fmt.Errorf("failed to reload invoice: %w", err)
+    }
+    invoiceAddress.AmountPaid = current.AmountPaid
+    invoiceAddress.AmountCredited = current.AmountCredited
+    invoiceAddress.AmountDue = current.AmountDue
+    invoiceAddress.Status = current.Status
+
     // Populate the final report
     report = models.InvoiceReportResponse{
         Invoice:          *invoiceAddress,
@@ -225,7 +286,9 @@ func GenerateInvoiceReport(db *gorm.DB, invoiceID uint) (*models.InvoiceReportRe
         Order:            order,
         Items:            invoiceItems,
         Payments:         payments,
+        CreditNotes:       creditNotes,
         PaymentStatus:    paymentStatus,
+        BaseAmounts:      invoiceBaseAmounts(invoiceAddress),
     }
 
     return &report, nil
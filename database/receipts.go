@@ -0,0 +1,213 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/models"
+	"invoice-go/money"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrReceiptNotFound      = errors.New("receipt not found")
+	ErrInvoiceNotOfCustomer = errors.New("invoice is not billed to this customer")
+	ErrInvoiceNotPayable    = errors.New("invoice does not accept payments")
+	ErrAllocationAmount     = errors.New("allocation amount must be positive")
+	ErrOverAllocation       = errors.New("allocations exceed what is left to allocate on the receipt")
+	ErrAllocationExceedsDue = errors.New("allocation exceeds the amount due on the invoice")
+)
+
+// payableStatuses are the invoice statuses receipts are allocated to
+var payableStatuses = []string{models.InvoiceStatusIssued, models.InvoiceStatusPartiallyPaid, models.InvoiceStatusOverdue}
+
+// ReceiptAllocation allocates part of a receipt to one invoice
+type ReceiptAllocation struct {
+	InvoiceID uint
+	Amount    money.Amount
+}
+
+// GetReceipt fetches a receipt with the payments allocated from it
+func GetReceipt(db *gorm.DB, receiptID uint) (*models.Receipt, error) {
+	var receipt models.Receipt
+	err := db.Preload("Allocations", func(db *gorm.DB) *gorm.DB {
+		return db.Order("payment_id")
+	}).First(&receipt, receiptID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReceiptNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch receipt: %w", err)
+	}
+	return &receipt, nil
+}
+
+// CreateReceipt records the money received from a customer and allocates it,
+// first to the invoices of the explicit allocations, then, when auto is set,
+// to the oldest unpaid invoices of the customer. Whatever is left is added to
+// the credit balance of the customer.
+func CreateReceipt(tx *gorm.DB, receipt *models.Receipt, allocations []ReceiptAllocation, auto bool) error {
+	receipt.Amount = receipt.Amount.Round(receipt.Currency)
+	receipt.AmountAllocated = money.Zero()
+	receipt.AmountUnallocated = receipt.Amount
+	if err := tx.Omit("Allocations").Create(receipt).Error; err != nil {
+		return fmt.Errorf("failed to create receipt: %w", err)
+	}
+	if _, err := allocateReceipt(tx, receipt, allocations, auto, receipt.Amount); err != nil {
+		return err
+	}
+	if receipt.AmountUnallocated.IsPositive() {
+		return recordReceiptCredit(tx, receipt, receipt.AmountUnallocated)
+	}
+	return nil
+}
+
+// AllocateReceipt allocates the part of a receipt left unallocated like
+// CreateReceipt, taking it off the credit balance of the customer, and returns
+// the receipt with all its allocations. No more than the credit balance can
+// be allocated, as the credit may have been applied or refunded since.
+func AllocateReceipt(tx *gorm.DB, receiptID uint, allocations []ReceiptAllocation, auto bool) (*models.Receipt, error) {
+	var receipt models.Receipt
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&receipt, receiptID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReceiptNotFound
+		}
+		return nil, fmt.Errorf("failed to load receipt: %w", err)
+	}
+	if err := lockCredit(tx, receipt.RecipientCompanyID); err != nil {
+		return nil, err
+	}
+	balance, err := GetCreditBalance(tx, receipt.RecipientCompanyID, receipt.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	allocated, err := allocateReceipt(tx, &receipt, allocations, auto, money.Min(receipt.AmountUnallocated, balance))
+	if err != nil {
+		return nil, err
+	}
+	if allocated.IsPositive() {
+		if err := recordReceiptCredit(tx, &receipt, allocated.Neg()); err != nil {
+			return nil, err
+		}
+	}
+	return GetReceipt(tx, receiptID)
+}
+
+// allocateReceipt records a completed payment on every invoice the receipt
+// is allocated to, up to available, and updates the allocated and unallocated
+// amounts. It returns the amount allocated.
+func allocateReceipt(tx *gorm.DB, receipt *models.Receipt, allocations []ReceiptAllocation, auto bool, available money.Amount) (money.Amount, error) {
+	remaining := available
+	for _, allocation := range allocations {
+		amount := allocation.Amount.Round(receipt.Currency)
+		if !amount.IsPositive() {
+			return money.Zero(), ErrAllocationAmount
+		}
+		if amount.GreaterThan(remaining) {
+			return money.Zero(), ErrOverAllocation
+		}
+		invoice, due, err := lockPayableInvoice(tx, receipt, allocation.InvoiceID)
+		if err != nil {
+			return money.Zero(), err
+		}
+		if amount.GreaterThan(due) {
+			return money.Zero(), fmt.Errorf("%w %s: %s %s", ErrAllocationExceedsDue, invoice.InvoiceNumber, invoice.Currency, due)
+		}
+		if err := allocateToInvoice(tx, receipt, invoice.InvoiceID, amount); err != nil {
+			return money.Zero(), err
+		}
+		remaining = remaining.Sub(amount)
+	}
+
+	if auto && remaining.IsPositive() {
+		// Oldest first by due date, the order customers expect their money to settle invoices in
+		var ids []uint
+		if err := tx.Model(&models.Invoice{}).
+			Where("recipient_company_id = ? AND currency = ? AND status IN ? AND amount_due > 0",
+				receipt.RecipientCompanyID, receipt.Currency, payableStatuses).
+			Order("due_date, invoice_date, invoice_id").
+			Pluck("invoice_id", &ids).Error; err != nil {
+			return money.Zero(), fmt.Errorf("failed to fetch unpaid invoices: %w", err)
+		}
+		for _, id := range ids {
+			if !remaining.IsPositive() {
+				break
+			}
+			invoice, due, err := lockPayableInvoice(tx, receipt, id)
+			if errors.Is(err, ErrInvoiceNotPayable) {
+				continue
+			}
+			if err != nil {
+				return money.Zero(), err
+			}
+			if !due.IsPositive() {
+				continue
+			}
+			amount := money.Min(due, remaining)
+			if err := allocateToInvoice(tx, receipt, invoice.InvoiceID, amount); err != nil {
+				return money.Zero(), err
+			}
+			remaining = remaining.Sub(amount)
+		}
+	}
+
+	allocated := available.Sub(remaining)
+	receipt.AmountAllocated = receipt.AmountAllocated.Add(allocated)
+	receipt.AmountUnallocated = receipt.AmountUnallocated.Sub(allocated)
+	if err := tx.Model(receipt).Updates(map[string]interface{}{
+		"amount_allocated":   receipt.AmountAllocated,
+		"amount_unallocated": receipt.AmountUnallocated,
+		"updated_at":         time.Now(),
+	}).Error; err != nil {
+		return money.Zero(), fmt.Errorf("failed to update receipt: %w", err)
+	}
+	return allocated, nil
+}
+
+// lockPayableInvoice locks an invoice of the receipt's customer that accepts
+// payments in the receipt currency and returns its current amount due
+func lockPayableInvoice(tx *gorm.DB, receipt *models.Receipt, invoiceID uint) (*models.Invoice, money.Amount, error) {
+	invoice, err := lockInvoice(tx, invoiceID)
+	if err != nil {
+		return nil, money.Zero(), err
+	}
+	switch {
+	case invoice.RecipientCompanyID != receipt.RecipientCompanyID:
+		return nil, money.Zero(), fmt.Errorf("%w: %s", ErrInvoiceNotOfCustomer, invoice.InvoiceNumber)
+	case !models.InvoiceAcceptsPayments(invoice.Status):
+		return nil, money.Zero(), fmt.Errorf("%w in status %s: %s", ErrInvoiceNotPayable, invoice.Status, invoice.InvoiceNumber)
+	case invoice.Currency != receipt.Currency:
+		return nil, money.Zero(), fmt.Errorf("%w %s: %s", ErrCurrencyMismatch, invoice.Currency, invoice.InvoiceNumber)
+	}
+	_, due, err := GetPaymentStatus(tx, invoiceID)
+	if err != nil {
+		return nil, money.Zero(), err
+	}
+	return invoice, due, nil
+}
+
+// allocateToInvoice records part of a receipt as a completed payment of an
+// invoice and brings the invoice's amounts and status up to date
+func allocateToInvoice(tx *gorm.DB, receipt *models.Receipt, invoiceID uint, amount money.Amount) error {
+	payment := models.Payment{
+		InvoiceID:            invoiceID,
+		PaymentDate:          receipt.ReceiptDate,
+		Amount:               amount,
+		Currency:             receipt.Currency,
+		Method:               receipt.Method,
+		TransactionReference: receipt.TransactionReference,
+		Status:               models.PaymentStatusCompleted,
+		Type:                 models.PaymentTypePayment,
+		ReceiptID:            &receipt.ReceiptID,
+	}
+	if err := tx.Omit("Invoice").Create(&payment).Error; err != nil {
+		return fmt.Errorf("failed to record payment: %w", err)
+	}
+	if _, _, err := GetPaymentStatus(tx, invoiceID); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/models"
+	"invoice-go/money"
+
+	"gorm.io/gorm"
+)
+
+// InvoiceBalance is the part of an invoice kept in step with its payments,
+// credit notes and credit entries
+type InvoiceBalance struct {
+	AmountPaid     money.Amount `json:"amount_paid"`
+	AmountWithheld money.Amount `json:"amount_withheld"`
+	AmountCredited money.Amount `json:"amount_credited"`
+	CreditApplied  money.Amount `json:"credit_applied"`
+	AmountDue      money.Amount `json:"amount_due"`
+	Status         string       `json:"status"`
+}
+
+// Equal reports whether two balances have the same amounts and status
+func (b InvoiceBalance) Equal(other InvoiceBalance) bool {
+	return b.AmountPaid.Equal(other.AmountPaid) && b.AmountWithheld.Equal(other.AmountWithheld) &&
+		b.AmountCredited.Equal(other.AmountCredited) && b.CreditApplied.Equal(other.CreditApplied) &&
+		b.AmountDue.Equal(other.AmountDue) && b.Status == other.Status
+}
+
+// InvoiceDrift is an invoice whose stored balance differs from the one its
+// payments, credit notes and credit entries add up to
+type InvoiceDrift struct {
+	InvoiceID     uint           `json:"invoice_id"`
+	InvoiceNumber string         `json:"invoice_number"`
+	Stored        InvoiceBalance `json:"stored"`
+	Expected      InvoiceBalance `json:"expected"`
+}
+
+// ReconcileRun summarises a run of ReconcileInvoices
+type ReconcileRun struct {
+	Checked          int            `json:"checked"`           // Invoices checked
+	Drifted          []InvoiceDrift `json:"drifted"`           // Invoices whose stored balance was off
+	Repaired         int            `json:"repaired"`          // Drifted invoices brought up to date
+	PaymentStatuses  int            `json:"payment_statuses"`  // Payments whose status was not in its canonical spelling
+	UnknownStatuses  int            `json:"unknown_statuses"`  // Payments with a status that is not a payment status
+	StatusesRepaired int            `json:"statuses_repaired"` // Payment statuses rewritten in their canonical spelling
+}
+
+// ReconcileInvoices looks for invoices whose stored amounts paid, withheld,
+// credited and due or status have drifted from their payments, credit notes
+// and credit entries, and for payments whose status is not spelled the way
+// the balance queries expect, e.g. 'Completed'. With repair set, statuses are
+// rewritten first and every drifted invoice is then recomputed in a
+// transaction of its own, the way GetPaymentStatus would.
+func ReconcileInvoices(db *gorm.DB, repair bool) (*ReconcileRun, error) {
+	run := &ReconcileRun{Drifted: []InvoiceDrift{}}
+
+	rows, err := db.Model(&models.Payment{}).Select("payment_id, status").Order("payment_id").Rows()
+	if err != nil {
+		return run, fmt.Errorf("failed to fetch payment statuses: %w", err)
+	}
+	misspelled := map[uint]string{}
+	for rows.Next() {
+		var id uint
+		var status string
+		if err := rows.Scan(&id, &status); err != nil {
+			rows.Close()
+			return run, fmt.Errorf("failed to read payment status: %w", err)
+		}
+		switch canonical := models.NormalizePaymentStatus(status); {
+		case canonical == "":
+			run.UnknownStatuses++
+		case canonical != status:
+			misspelled[id] = canonical
+		}
+	}
+	rows.Close()
+	run.PaymentStatuses = len(misspelled)
+	if repair {
+		for id, status := range misspelled {
+			if err := db.Model(&models.Payment{}).Where("payment_id = ?", id).Update("status", status).Error; err != nil {
+				return run, fmt.Errorf("failed to update status of payment %d: %w", id, err)
+			}
+			run.StatusesRepaired++
+		}
+	}
+
+	var ids []uint
+	if err := db.Model(&models.Invoice{}).Order("invoice_id").Pluck("invoice_id", &ids).Error; err != nil {
+		return run, fmt.Errorf("failed to fetch invoices: %w", err)
+	}
+
+	var errs []error
+	for _, id := range ids {
+		var invoice models.Invoice
+		if err := db.First(&invoice, id).Error; err != nil {
+			errs = append(errs, fmt.Errorf("failed to fetch invoice %d: %w", id, err))
+			continue
+		}
+		run.Checked++
+		expected, _, err := invoiceBalance(db, &invoice)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invoice %d: %w", id, err))
+			continue
+		}
+		stored := storedBalance(&invoice)
+		if expected.Equal(stored) {
+			continue
+		}
+		run.Drifted = append(run.Drifted, InvoiceDrift{
+			InvoiceID:     invoice.InvoiceID,
+			InvoiceNumber: invoice.InvoiceNumber,
+			Stored:        stored,
+			Expected:      expected,
+		})
+		if !repair {
+			continue
+		}
+		if _, _, err := GetPaymentStatus(db, id); err != nil {
+			errs = append(errs, fmt.Errorf("failed to repair invoice %d: %w", id, err))
+			continue
+		}
+		run.Repaired++
+	}
+	return run, errors.Join(errs...)
+}
+
+// invoiceBalance works out the balance an invoice should have from its
+// payments, credit notes and credit entries. What was paid or credited beyond
+// the amount due on an invoice that is no longer editable is returned as
+// excess, already counted as moved to the credit balance.
+func invoiceBalance(db *gorm.DB, invoice *models.Invoice) (InvoiceBalance, money.Amount, error) {
+	var balance InvoiceBalance
+	var transferred money.Amount
+
+	// Total payments and the tax withheld on them
+	if err := db.Model(&models.Payment{}).
+		Select("COALESCE(SUM(amount), 0), COALESCE(SUM(withholding_amount), 0)").
+		Where("invoice_id = ? AND status = ?", invoice.InvoiceID, models.PaymentStatusCompleted).
+		Row().Scan(&balance.AmountPaid, &balance.AmountWithheld); err != nil {
+		return balance, money.Zero(), fmt.Errorf("failed to calculate payments: %w", err)
+	}
+
+	// Credit notes issued against the invoice
+	credited, err := GetCreditedAmount(db, invoice.InvoiceID)
+	if err != nil {
+		return balance, money.Zero(), err
+	}
+	balance.AmountCredited = credited
+
+	// Credit moved between the invoice and the credit balance
+	if err := db.Model(&models.CreditEntry{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("invoice_id = ?", invoice.InvoiceID).
+		Row().Scan(&transferred); err != nil {
+		return balance, money.Zero(), fmt.Errorf("failed to calculate applied credit: %w", err)
+	}
+	balance.CreditApplied = transferred.Neg()
+
+	// Amount due, exact since every amount is held at the column scale
+	balance.AmountDue = invoice.GrandTotal.Sub(balance.AmountPaid).Sub(balance.AmountWithheld).Sub(balance.AmountCredited).Sub(balance.CreditApplied)
+
+	excess := money.Zero()
+	if balance.AmountDue.IsNegative() && !models.InvoiceIsEditable(invoice.Status) {
+		excess = balance.AmountDue.Neg()
+		balance.CreditApplied = balance.CreditApplied.Sub(excess)
+		balance.AmountDue = money.Zero()
+	}
+
+	balance.Status = settlementStatus(invoice.Status, balance.AmountPaid.Add(balance.AmountWithheld).Add(balance.CreditApplied), balance.AmountDue)
+	return balance, excess, nil
+}
+
+// storedBalance returns the balance stored on an invoice
+func storedBalance(invoice *models.Invoice) InvoiceBalance {
+	return InvoiceBalance{
+		AmountPaid:     invoice.AmountPaid,
+		AmountWithheld: invoice.AmountWithheld,
+		AmountCredited: invoice.AmountCredited,
+		CreditApplied:  invoice.CreditApplied,
+		AmountDue:      invoice.AmountDue,
+		Status:         invoice.Status,
+	}
+}
@@ -0,0 +1,248 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRecurringInvoiceNotFound = errors.New("recurring invoice not found")
+	ErrRecurringInvoiceInactive = errors.New("recurring invoice is paused")
+	ErrRecurringInvoiceEnded    = errors.New("recurring invoice has no run left before its end date")
+)
+
+// RecurrenceDate returns the n-th run of a schedule starting on start. Monthly,
+// quarterly and yearly runs keep the day of the start date, falling back to
+// the last day of shorter months.
+func RecurrenceDate(start time.Time, interval string, n int) time.Time {
+	switch interval {
+	case models.RecurrenceWeekly:
+		return start.AddDate(0, 0, 7*n)
+	case models.RecurrenceQuarterly:
+		return addMonths(start, 3*n)
+	case models.RecurrenceYearly:
+		return addMonths(start, 12*n)
+	default:
+		return addMonths(start, n)
+	}
+}
+
+// addMonths adds months to a date, clamping the day to the end of the month
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	day := t.Day()
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, t.Location())
+}
+
+// NextRecurrence returns the number of runs of a schedule falling before a date,
+// so that the run it counts to is the first one on or after the date
+func NextRecurrence(start time.Time, interval string, date time.Time) int {
+	n := 0
+	for RecurrenceDate(start, interval, n).Before(date) {
+		n++
+	}
+	return n
+}
+
+// recurringInvoiceEnded reports whether the next run of a schedule falls after its end date
+func recurringInvoiceEnded(schedule *models.RecurringInvoice) bool {
+	return schedule.EndDate != nil && schedule.NextRunDate.After(*schedule.EndDate)
+}
+
+// lockRecurringInvoice loads a schedule with its lines, locking the row so
+// concurrent runs, even from other instances, wait for each other
+func lockRecurringInvoice(tx *gorm.DB, id uint) (*models.RecurringInvoice, error) {
+	var schedule models.RecurringInvoice
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("recurring_invoice_item_id") }).
+		First(&schedule, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRecurringInvoiceNotFound
+		}
+		return nil, fmt.Errorf("failed to load recurring invoice: %w", err)
+	}
+	return &schedule, nil
+}
+
+// recurringInvoiceItems turns the lines of a schedule into invoice items,
+// pricing lines without a unit price from the catalog at the invoice date
+func recurringInvoiceItems(tx *gorm.DB, schedule *models.RecurringInvoice, date time.Time) ([]models.InvoiceItem, error) {
+	items := make([]models.InvoiceItem, 0, len(schedule.Items))
+	for _, line := range schedule.Items {
+		item := models.InvoiceItem{
+			ItemID:             line.ItemID,
+			Description:        line.Description,
+			Quantity:           line.Quantity,
+			TaxRatePercentage:  line.TaxRatePercentage,
+			TaxCode:            line.TaxCode,
+			WithholdingTaxCode: line.WithholdingTaxCode,
+			DiscountPercentage: line.DiscountPercentage,
+			DiscountAmount:     line.DiscountAmount,
+		}
+		if line.UnitPrice != nil {
+			item.UnitPrice = *line.UnitPrice
+		} else if line.ItemID != nil {
+			var catalogItem models.Item
+			if err := tx.First(&catalogItem, *line.ItemID).Error; err != nil {
+				return nil, fmt.Errorf("failed to load item %d: %w", *line.ItemID, err)
+			}
+			price, err := ConvertAmount(tx, catalogItem.UnitPrice, catalogItem.Currency, schedule.Currency, date)
+			if err != nil {
+				return nil, err
+			}
+			item.UnitPrice = price
+			item.PriceTaxInclusive = &catalogItem.TaxInclusive
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// generateRecurringInvoice creates the invoice of the next run of a locked
+// schedule, dated invoiceDate, and moves the schedule on to the following run.
+// The run date is stored on the invoice, where a unique key rejects a second
+// invoice for the same run.
+func generateRecurringInvoice(tx *gorm.DB, schedule *models.RecurringInvoice, invoiceDate time.Time) (*models.Invoice, error) {
+	items, err := recurringInvoiceItems(tx, schedule, invoiceDate)
+	if err != nil {
+		return nil, err
+	}
+
+	runDate := schedule.NextRunDate
+	invoice := models.Invoice{
+		SenderCompanyID:    schedule.SenderCompanyID,
+		RecipientCompanyID: schedule.RecipientCompanyID,
+		BillingAddressID:   schedule.BillingAddressID,
+		ShippingAddressID:  schedule.ShippingAddressID,
+		RecurringInvoiceID: &schedule.RecurringInvoiceID,
+		RecurrenceDate:     &runDate,
+		InvoiceDate:        invoiceDate,
+		DueDate:            invoiceDate.AddDate(0, 0, schedule.PaymentTermDays),
+		InvoiceSubject:     schedule.InvoiceSubject,
+		Notes:              schedule.Notes,
+		Currency:           schedule.Currency,
+		TaxInclusive:       schedule.TaxInclusive,
+		DiscountPercentage: schedule.DiscountPercentage,
+		DiscountAmount:     schedule.DiscountAmount,
+		Status:             models.InvoiceStatusDraft,
+	}
+	if err := CreateInvoiceWithItems(tx, &invoice, items); err != nil {
+		return nil, err
+	}
+	if schedule.AutoIssue {
+		issued, err := TransitionInvoiceStatus(tx, invoice.InvoiceID, models.InvoiceStatusIssued)
+		if err != nil {
+			return nil, err
+		}
+		invoice.Status = issued.Status
+	}
+
+	if err := advanceRecurringInvoice(tx, schedule, &invoice.InvoiceID); err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// advanceRecurringInvoice counts the next run of a schedule as done
+func advanceRecurringInvoice(tx *gorm.DB, schedule *models.RecurringInvoice, invoiceID *uint) error {
+	schedule.Occurrences++
+	schedule.NextRunDate = RecurrenceDate(schedule.StartDate, schedule.Interval, schedule.Occurrences)
+	updates := map[string]interface{}{
+		"occurrences":   schedule.Occurrences,
+		"next_run_date": schedule.NextRunDate,
+		"updated_at":    time.Now(),
+	}
+	if invoiceID != nil {
+		schedule.LastInvoiceID = invoiceID
+		updates["last_invoice_id"] = *invoiceID
+	}
+	if err := tx.Model(schedule).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to advance recurring invoice: %w", err)
+	}
+	return nil
+}
+
+// RunRecurringInvoice generates the next run of a schedule immediately,
+// dated now, whether it is due or not
+func RunRecurringInvoice(tx *gorm.DB, id uint, now time.Time) (*models.Invoice, error) {
+	schedule, err := lockRecurringInvoice(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case !schedule.IsActive:
+		return nil, ErrRecurringInvoiceInactive
+	case recurringInvoiceEnded(schedule):
+		return nil, ErrRecurringInvoiceEnded
+	}
+	return generateRecurringInvoice(tx, schedule, now)
+}
+
+// SkipRecurringInvoice moves a schedule past its next run without invoicing it
+func SkipRecurringInvoice(tx *gorm.DB, id uint) (*models.RecurringInvoice, error) {
+	schedule, err := lockRecurringInvoice(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if recurringInvoiceEnded(schedule) {
+		return nil, ErrRecurringInvoiceEnded
+	}
+	if err := advanceRecurringInvoice(tx, schedule, nil); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// GenerateDueRecurringInvoices invoices every run of the active schedules that
+// fell due by now, dating each invoice on its run date so runs missed while
+// the service was down are caught up. Each run is generated in its own
+// transaction with the schedule locked and its due date checked again, so
+// several instances can run this concurrently. It returns the number of
+// invoices generated; a failing schedule does not stop the others.
+func GenerateDueRecurringInvoices(db *gorm.DB, now time.Time) (int, error) {
+	today := now.Format("2006-01-02")
+	var ids []uint
+	if err := db.Model(&models.RecurringInvoice{}).
+		Where("is_active = ? AND next_run_date <= ? AND (end_date IS NULL OR next_run_date <= end_date)", true, today).
+		Order("recurring_invoice_id").
+		Pluck("recurring_invoice_id", &ids).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch due recurring invoices: %w", err)
+	}
+
+	generated := 0
+	var errs []error
+	for _, id := range ids {
+		for {
+			var invoice *models.Invoice
+			err := db.Transaction(func(tx *gorm.DB) error {
+				schedule, err := lockRecurringInvoice(tx, id)
+				if err != nil {
+					return err
+				}
+				if !schedule.IsActive || recurringInvoiceEnded(schedule) || schedule.NextRunDate.Format("2006-01-02") > today {
+					return nil
+				}
+				invoice, err = generateRecurringInvoice(tx, schedule, schedule.NextRunDate)
+				return err
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("recurring invoice %d: %w", id, err))
+				break
+			}
+			if invoice == nil {
+				break
+			}
+			generated++
+		}
+	}
+	return generated, errors.Join(errs...)
+}
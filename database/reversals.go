@@ -0,0 +1,136 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/models"
+	"invoice-go/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPaymentNotReversible = errors.New("only completed payments can be refunded or charged back")
+	ErrReversalAmount       = errors.New("amount must be positive")
+	ErrReversalExceedsPaid  = errors.New("amount exceeds what is left to reverse on the payment")
+)
+
+// PaymentReversal describes a refund or chargeback of a payment
+type PaymentReversal struct {
+	Type                 string        // models.PaymentTypeRefund or models.PaymentTypeChargeback
+	Amount               *money.Amount // Positive; nil reverses what is left of the payment
+	Reason               string
+	Date                 time.Time
+	Method               *string // Defaults to the method of the payment
+	TransactionReference *string
+}
+
+// GetPaymentReversals lists the refunds and chargebacks of a payment, oldest first
+func GetPaymentReversals(db *gorm.DB, paymentID uint) ([]models.Payment, error) {
+	reversals := []models.Payment{}
+	if err := db.Where("reverses_payment_id = ?", paymentID).Order("payment_id").Find(&reversals).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch payment reversals: %w", err)
+	}
+	return reversals, nil
+}
+
+// ReversePayment records a refund or chargeback of a completed payment as a
+// negative payment linked to it and recomputes the invoice balance. No more
+// than the cash received on the payment, less its earlier reversals, can be
+// reversed; withheld tax is not. Neither can what was paid beyond the amount
+// due and moved to the customer's credit balance, which is refunded from the
+// balance instead. Callers are expected to pass a transaction.
+func ReversePayment(tx *gorm.DB, paymentID uint, reversal PaymentReversal) (*models.Payment, error) {
+	payment, err := lockPayment(tx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment.ReversesPaymentID != nil || !payment.Amount.IsPositive() || models.NormalizePaymentStatus(payment.Status) != models.PaymentStatusCompleted {
+		return nil, ErrPaymentNotReversible
+	}
+	invoice, err := lockInvoice(tx, payment.InvoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var reversed money.Amount
+	if err := tx.Model(&models.Payment{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("reverses_payment_id = ? AND status = ?", paymentID, models.PaymentStatusCompleted).
+		Row().Scan(&reversed); err != nil {
+		return nil, fmt.Errorf("failed to sum payment reversals: %w", err)
+	}
+	// Reversals are negative
+	left := payment.Amount.Add(reversed)
+	kept, err := invoiceKeptPayments(tx, invoice)
+	if err != nil {
+		return nil, err
+	}
+	if left.GreaterThan(kept) {
+		left = kept
+	}
+
+	amount := left
+	if reversal.Amount != nil {
+		amount = reversal.Amount.Round(payment.Currency)
+		if !amount.IsPositive() {
+			return nil, ErrReversalAmount
+		}
+	}
+	if amount.GreaterThan(left) || !amount.IsPositive() {
+		return nil, fmt.Errorf("%w: %s %s", ErrReversalExceedsPaid, payment.Currency, left)
+	}
+
+	method := payment.Method
+	if reversal.Method != nil {
+		method = reversal.Method
+	}
+	reason := reversal.Reason
+	reverse := models.Payment{
+		InvoiceID:            payment.InvoiceID,
+		PaymentDate:          reversal.Date,
+		Amount:               amount.Neg(),
+		Currency:             payment.Currency,
+		Method:               method,
+		TransactionReference: reversal.TransactionReference,
+		Status:               models.PaymentStatusCompleted,
+		Type:                 reversal.Type,
+		ReversesPaymentID:    &payment.PaymentID,
+		Reason:               &reason,
+	}
+	if err := tx.Omit("Invoice").Create(&reverse).Error; err != nil {
+		return nil, fmt.Errorf("failed to record %s: %w", reversal.Type, err)
+	}
+	if _, _, err := GetPaymentStatus(tx, payment.InvoiceID); err != nil {
+		return nil, err
+	}
+	return &reverse, nil
+}
+
+// invoiceKeptPayments returns the payments an invoice holds, net of their
+// reversals and of the excess moved from the invoice to the credit balance
+func invoiceKeptPayments(tx *gorm.DB, invoice *models.Invoice) (money.Amount, error) {
+	var paid, transferred money.Amount
+	if err := tx.Model(&models.Payment{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("invoice_id = ? AND status = ?", invoice.InvoiceID, models.PaymentStatusCompleted).
+		Row().Scan(&paid); err != nil {
+		return money.Zero(), fmt.Errorf("failed to calculate payments: %w", err)
+	}
+	// Positive on balance when excess went to the credit balance, negative
+	// when credit was applied to the invoice
+	if err := tx.Model(&models.CreditEntry{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("invoice_id = ?", invoice.InvoiceID).
+		Row().Scan(&transferred); err != nil {
+		return money.Zero(), fmt.Errorf("failed to calculate credit moved from the invoice: %w", err)
+	}
+	if transferred.IsPositive() {
+		paid = paid.Sub(transferred)
+	}
+	if paid.IsNegative() {
+		return money.Zero(), nil
+	}
+	return paid, nil
+}
@@ -67,6 +67,11 @@ func SeedDatabase(db *gorm.DB) error {
 			return fmt.Errorf("failed to seed invoices: %w", err)
 		}
 
+		// Seed number series
+		if err := seedNumberSeries(tx); err != nil {
+			return fmt.Errorf("failed to seed number series: %w", err)
+		}
+
 		// Seed invoice items
 		if err := seedInvoiceItems(tx); err != nil {
 			return fmt.Errorf("failed to seed invoice items: %w", err)
@@ -330,22 +335,41 @@ func seedInvoices(db *gorm.DB) error {
 	INSERT INTO invoices (sender_company_id, recipient_company_id, billing_address_id, shipping_address_id, order_id, invoice_number, invoice_date, due_date, invoice_subject, subtotal, tax_total, grand_total, amount_paid, amount_due, status, notes)
 	VALUES
 	-- Alpha Technologies invoices
-	(1, 2, 4, 5, 1, 'INV-2025-0001', '2025-03-01', '2025-03-31', 'March Services and Products', 650.00, 52.00, 702.00, 702.00, 0.00, 'paid', 'Thank you for your business!'),
-	(1, 2, 4, 5, 2, 'INV-2025-0002', '2025-03-15', '2025-04-14', 'Premium Support Plan', 500.00, 40.00, 540.00, 540.00, 0.00, 'paid', 'Premium support plan monthly fee'),
+	(1, 2, 4, 5, 1, 'INV-2025-0001', '2025-03-01', '2025-03-31', 'March Services and Products', 650.00, 52.00, 702.00, 702.00, 0.00, 'Paid', 'Thank you for your business!'),
+	(1, 2, 4, 5, 2, 'INV-2025-0002', '2025-03-15', '2025-04-14', 'Premium Support Plan', 500.00, 40.00, 540.00, 540.00, 0.00, 'Paid', 'Premium support plan monthly fee'),
 
 	-- Beta Solutions invoices
-	(1, 3, 6, 7, 3, 'INV-2025-0003', '2025-03-05', '2025-04-04', 'Software Licenses and Services', 875.00, 70.00, 945.00, 945.00, 0.00, 'paid', ''),
-	(1, 3, 6, 7, 4, 'INV-2025-0004', '2025-03-20', '2025-04-19', 'System Audit Services', 2500.00, 200.00, 2700.00, 2700.00, 0.00, 'paid', 'Comprehensive security audit completed'),
+	(1, 3, 6, 7, 3, 'INV-2025-0003', '2025-03-05', '2025-04-04', 'Software Licenses and Services', 875.00, 70.00, 945.00, 945.00, 0.00, 'Paid', ''),
+	(1, 3, 6, 7, 4, 'INV-2025-0004', '2025-03-20', '2025-04-19', 'System Audit Services', 2500.00, 200.00, 2700.00, 2700.00, 0.00, 'Paid', 'Comprehensive security audit completed'),
 
 	-- Gamma Industries invoices
-	(1, 4, 8, 9, 5, 'INV-2025-0005', '2025-03-10', '2025-04-09', 'Network Equipment Order', 1487.50, 119.00, 1606.50, 1606.50, 0.00, 'paid', ''),
-	(1, 4, 8, 9, 6, 'INV-2025-0006', '2025-03-25', '2025-04-24', 'Network Switch', 350.00, 28.00, 378.00, 0.00, 378.00, 'sent', ''),
+	(1, 4, 8, 9, 5, 'INV-2025-0005', '2025-03-10', '2025-04-09', 'Network Equipment Order', 1487.50, 119.00, 1606.50, 1606.50, 0.00, 'Paid', ''),
+	(1, 4, 8, 9, 6, 'INV-2025-0006', '2025-03-25', '2025-04-24', 'Network Switch', 350.00, 28.00, 378.00, 0.00, 378.00, 'Issued', ''),
 
 	-- Delta Innovations invoices
-	(1, 5, 10, 11, 7, 'INV-2025-0007', '2025-04-02', '2025-05-02', 'Server Equipment Order', 2750.00, 220.00, 2970.00, 1500.00, 1470.00, 'partial', 'Partial payment received'),
+	(1, 5, 10, 11, 7, 'INV-2025-0007', '2025-04-02', '2025-05-02', 'Server Equipment Order', 2750.00, 220.00, 2970.00, 1500.00, 1470.00, 'PartiallyPaid', 'Partial payment received'),
 
 	-- Invoice example for presentation
-	(1, 2, 4, 5, 11, 'INV-2025-0500', '2025-04-30', '2025-05-30', 'April Products and Services', 1250.00, 100.00, 1350.00, 0.00, 1350.00, 'sent', 'Example invoice for demonstration');
+	(1, 2, 4, 5, 11, 'INV-2025-0500', '2025-04-30', '2025-05-30', 'April Products and Services', 1250.00, 100.00, 1350.00, 0.00, 1350.00, 'Issued', 'Example invoice for demonstration');
+	`
+	
+	if err := db.Exec(query).Error; err != nil {
+		return err
+	}
+	
+	return nil
+}
+
+// seedNumberSeries continues the invoice series of the senders after the
+// seeded invoice numbers, so the next allocated number is not already taken
+func seedNumberSeries(db *gorm.DB) error {
+	log.Println("Seeding number series...")
+	
+	query := `
+	INSERT INTO document_number_series (company_id, document_type, prefix, pattern, padding, reset_yearly, current_year, next_value, created_at, updated_at)
+	VALUES
+	-- Alpha Technologies: INV-2025-0001 to INV-2025-0500 are seeded
+	(1, 'invoice', 'INV', '{PREFIX}-{YYYY}-{SEQ}', 4, TRUE, 2025, 501, NOW(), NOW());
 	`
 	
 	if err := db.Exec(query).Error; err != nil {
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/models"
+	"invoice-go/money"
+	"invoice-go/utils"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrCompanyNotFound = errors.New("company not found")
+
+// statementRow is a document of a customer read for its statement
+type statementRow struct {
+	DocumentID        uint         `gorm:"column:document_id"`
+	Reference         string       `gorm:"column:reference"`
+	InvoiceID         uint         `gorm:"column:invoice_id"`
+	InvoiceNumber     string       `gorm:"column:invoice_number"`
+	Date              time.Time    `gorm:"column:date"`
+	Amount            money.Amount `gorm:"column:amount"`
+	WithholdingAmount money.Amount `gorm:"column:withholding_amount"`
+	Currency          string       `gorm:"column:currency"`
+	ExchangeRate      float64      `gorm:"column:exchange_rate"`
+	PaymentType       string       `gorm:"column:payment_type"`
+}
+
+// statementEntryOrder ranks the documents of a same day on a statement
+var statementEntryOrder = map[string]int{
+	models.StatementEntryInvoice:     0,
+	models.StatementEntryCreditNote:  1,
+	models.StatementEntryPayment:     2,
+	models.StatementEntryWithholding: 3,
+	models.StatementEntryUnallocated: 4,
+	models.StatementEntryRefund:      5,
+	models.StatementEntryChargeback:  6,
+}
+
+// statementCreditRow is a credit balance entry of a customer that is not tied
+// to an invoice, read for its statement
+type statementCreditRow struct {
+	CreditEntryID uint         `gorm:"column:credit_entry_id"`
+	Type          string       `gorm:"column:type"`
+	Reference     string       `gorm:"column:reference"`
+	EntryDate     time.Time    `gorm:"column:entry_date"`
+	Amount        money.Amount `gorm:"column:amount"`
+	Currency      string       `gorm:"column:currency"`
+}
+
+// GetStatement builds the statement of account of a customer company from
+// from to to, both dates included. Invoices are debited; credit notes,
+// completed payments and the tax withheld on them are credited and their
+// refunds and chargebacks debited, each converted into the base currency with
+// the exchange rate of its invoice.
+// Receipts left unallocated are credited and refunds of credit debited,
+// converted with the rate of their date. Documents dated before from make up
+// the opening balance. Drafts and void invoices, with their documents, are
+// left out. A non-zero senderID limits the statement to the invoices of that
+// sender, without the receipts and refunds.
+func GetStatement(db *gorm.DB, companyID, senderID uint, from, to time.Time) (*models.Statement, error) {
+	statement := &models.Statement{
+		From:     dateOnly(from),
+		To:       dateOnly(to),
+		Currency: utils.BaseCurrency(),
+		Entries:  []models.StatementEntry{},
+	}
+	if err := db.Preload("DefaultBillingAddress").First(&statement.Company, companyID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCompanyNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch company: %w", err)
+	}
+	if senderID != 0 {
+		var sender models.Company
+		if err := db.Preload("DefaultBillingAddress").First(&sender, senderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrSenderCompanyNotFound
+			}
+			return nil, fmt.Errorf("failed to fetch sender company: %w", err)
+		}
+		statement.SenderCompany = &sender
+	}
+
+	day := statement.To.Format("2006-01-02")
+	excluded := []string{models.InvoiceStatusDraft, models.InvoiceStatusVoid}
+	documents := func(table, columns, dateColumn string) *gorm.DB {
+		q := db.Table(table).
+			Select(columns+", i.invoice_id, i.invoice_number, i.currency, i.exchange_rate").
+			Where("i.recipient_company_id = ? AND i.status NOT IN ? AND DATE("+dateColumn+") <= ?", companyID, excluded, day)
+		if senderID != 0 {
+			q = q.Where("i.sender_company_id = ?", senderID)
+		}
+		return q
+	}
+
+	var invoices, creditNotes, payments []statementRow
+	if err := documents("invoices AS i",
+		"i.invoice_id AS document_id, i.invoice_number AS reference, i.invoice_date AS date, i.grand_total AS amount",
+		"i.invoice_date").
+		Scan(&invoices).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch invoices for statement: %w", err)
+	}
+	if err := documents("credit_notes AS cn",
+		"cn.credit_note_id AS document_id, cn.credit_note_number AS reference, cn.credit_note_date AS date, cn.grand_total AS amount",
+		"cn.credit_note_date").
+		Joins("JOIN invoices AS i ON i.invoice_id = cn.invoice_id").
+		Scan(&creditNotes).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch credit notes for statement: %w", err)
+	}
+	if err := documents("payments AS p",
+		"p.payment_id AS document_id, COALESCE(p.transaction_reference, '') AS reference, p.payment_date AS date, p.amount, p.withholding_amount, p.type AS payment_type",
+		"p.payment_date").
+		Joins("JOIN invoices AS i ON i.invoice_id = p.invoice_id").
+		Where("p.status = ?", models.PaymentStatusCompleted).
+		Scan(&payments).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch payments for statement: %w", err)
+	}
+
+	var credits []statementCreditRow
+	if senderID == 0 {
+		if err := db.Table("credit_entries AS ce").
+			Select("ce.credit_entry_id, ce.type, COALESCE(r.transaction_reference, cr.transaction_reference, '') AS reference, ce.entry_date, ce.amount, ce.currency").
+			Joins("LEFT JOIN receipts AS r ON r.receipt_id = ce.receipt_id").
+			Joins("LEFT JOIN credit_refunds AS cr ON cr.credit_refund_id = ce.credit_refund_id").
+			Where("ce.company_id = ? AND ce.invoice_id IS NULL AND DATE(ce.entry_date) <= ?", companyID, day).
+			Scan(&credits).Error; err != nil {
+			return nil, fmt.Errorf("failed to fetch credit entries for statement: %w", err)
+		}
+	}
+
+	var entries []models.StatementEntry
+	entry := func(row statementRow, entryType string, amount money.Amount, debit bool) {
+		rate := row.ExchangeRate
+		if rate == 0 {
+			rate = 1
+		}
+		e := models.StatementEntry{
+			Date:          row.Date,
+			Type:          entryType,
+			DocumentID:    row.DocumentID,
+			Reference:     row.Reference,
+			InvoiceID:     row.InvoiceID,
+			InvoiceNumber: row.InvoiceNumber,
+			Currency:      row.Currency,
+			Amount:        amount,
+		}
+		if debit {
+			e.Debit = amount.Mul(rate).Round(statement.Currency)
+		} else {
+			e.Credit = amount.Mul(rate).Round(statement.Currency)
+		}
+		entries = append(entries, e)
+	}
+	for _, row := range invoices {
+		entry(row, models.StatementEntryInvoice, row.Amount, true)
+	}
+	for _, row := range creditNotes {
+		// Credit note totals are negative
+		entry(row, models.StatementEntryCreditNote, row.Amount.Neg(), false)
+	}
+	for _, row := range payments {
+		switch {
+		case row.PaymentType == models.PaymentTypeRefund:
+			// Reversals are negative payments
+			entry(row, models.StatementEntryRefund, row.Amount.Neg(), true)
+		case row.PaymentType == models.PaymentTypeChargeback:
+			entry(row, models.StatementEntryChargeback, row.Amount.Neg(), true)
+		case !row.Amount.IsZero():
+			entry(row, models.StatementEntryPayment, row.Amount, false)
+		}
+		if !row.WithholdingAmount.IsZero() {
+			entry(row, models.StatementEntryWithholding, row.WithholdingAmount, false)
+		}
+	}
+
+	for _, row := range credits {
+		amount, err := ConvertAmount(db, row.Amount, row.Currency, statement.Currency, row.EntryDate)
+		if err != nil {
+			return nil, err
+		}
+		e := models.StatementEntry{
+			Date:       row.EntryDate,
+			Type:       models.StatementEntryUnallocated,
+			DocumentID: row.CreditEntryID,
+			Reference:  row.Reference,
+			Currency:   row.Currency,
+			Amount:     row.Amount.Abs(),
+		}
+		if row.Type == models.CreditEntryRefund {
+			e.Type = models.StatementEntryRefund
+		}
+		// Credit added to the balance is credited, credit taken off it debited
+		if row.Amount.IsPositive() {
+			e.Credit = amount.Round(statement.Currency)
+		} else {
+			e.Debit = amount.Neg().Round(statement.Currency)
+		}
+		entries = append(entries, e)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if dayA, dayB := dateOnly(a.Date), dateOnly(b.Date); !dayA.Equal(dayB) {
+			return dayA.Before(dayB)
+		}
+		if statementEntryOrder[a.Type] != statementEntryOrder[b.Type] {
+			return statementEntryOrder[a.Type] < statementEntryOrder[b.Type]
+		}
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		return a.DocumentID < b.DocumentID
+	})
+
+	balance := money.Zero()
+	for _, e := range entries {
+		balance = balance.Add(e.Debit).Sub(e.Credit)
+		if dateOnly(e.Date).Before(statement.From) {
+			statement.OpeningBalance = balance
+			continue
+		}
+		e.Balance = balance
+		statement.TotalDebits = statement.TotalDebits.Add(e.Debit)
+		statement.TotalCredits = statement.TotalCredits.Add(e.Credit)
+		statement.Entries = append(statement.Entries, e)
+	}
+	statement.ClosingBalance = balance
+	return statement, nil
+}
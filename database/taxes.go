@@ -0,0 +1,370 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/models"
+	"invoice-go/utils"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTaxCodeNotFound     = errors.New("tax code not found")
+	ErrTaxRuleNotFound     = errors.New("tax rule not found")
+	ErrTaxCodeNotEffective = errors.New("tax code is not effective on that date")
+	ErrTaxCodeKind         = errors.New("tax code cannot be used for this tax")
+)
+
+// FindTaxCode returns the version of a tax code effective on a date
+func FindTaxCode(db *gorm.DB, code string, date time.Time) (*models.TaxCode, error) {
+	var taxCode models.TaxCode
+	err := db.Where("code = ? AND effective_date <= ?", strings.TrimSpace(code), date.Format("2006-01-02")).
+		Order("effective_date DESC").
+		First(&taxCode).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s on %s", ErrTaxCodeNotEffective, code, date.Format("2006-01-02"))
+		}
+		return nil, fmt.Errorf("failed to fetch tax code: %w", err)
+	}
+	return &taxCode, nil
+}
+
+// TaxJurisdiction is where the seller and the buyer of a document are located
+type TaxJurisdiction struct {
+	SellerCountry       string `json:"seller_country"`
+	SellerStateProvince string `json:"seller_state_province"`
+	BuyerCountry        string `json:"buyer_country"`
+	BuyerStateProvince  string `json:"buyer_state_province"`
+}
+
+// LoadTaxJurisdiction locates the parties of an invoice: the seller by its
+// default billing address (or first billing address), the buyer by the billing
+// address of the invoice. Missing addresses leave the fields empty.
+func LoadTaxJurisdiction(db *gorm.DB, invoice *models.Invoice) (TaxJurisdiction, error) {
+	var jurisdiction TaxJurisdiction
+
+	var seller models.Company
+	if err := db.First(&seller, invoice.SenderCompanyID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return jurisdiction, ErrSenderCompanyNotFound
+		}
+		return jurisdiction, fmt.Errorf("failed to load sender company: %w", err)
+	}
+	sellerAddressID, err := companyAddressID(db, seller.CompanyID, seller.DefaultBillingAddressID, "billing")
+	if err != nil {
+		return jurisdiction, err
+	}
+	if sellerAddressID != nil {
+		var address models.Address
+		if err := db.First(&address, *sellerAddressID).Error; err == nil {
+			jurisdiction.SellerCountry = address.Country
+			if address.StateProvince != nil {
+				jurisdiction.SellerStateProvince = *address.StateProvince
+			}
+		}
+	}
+
+	var buyerAddress models.Address
+	if err := db.First(&buyerAddress, invoice.BillingAddressID).Error; err == nil {
+		jurisdiction.BuyerCountry = buyerAddress.Country
+		if buyerAddress.StateProvince != nil {
+			jurisdiction.BuyerStateProvince = *buyerAddress.StateProvince
+		}
+	}
+	return jurisdiction, nil
+}
+
+// taxResolver picks the tax codes of invoice lines from the tax rules
+type taxResolver struct {
+	db           *gorm.DB
+	jurisdiction TaxJurisdiction
+	date         time.Time
+	rules        []models.TaxRule
+	codes        map[string]*models.TaxCode
+}
+
+func newTaxResolver(db *gorm.DB, jurisdiction TaxJurisdiction, date time.Time) (*taxResolver, error) {
+	r := &taxResolver{db: db, jurisdiction: jurisdiction, date: date, codes: make(map[string]*models.TaxCode)}
+	if err := db.Order("rule_id").Find(&r.rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to load tax rules: %w", err)
+	}
+	return r, nil
+}
+
+// code returns the version of a code effective on the document date, nil when
+// the code has no version effective yet
+func (r *taxResolver) code(code string) (*models.TaxCode, error) {
+	if taxCode, ok := r.codes[code]; ok {
+		return taxCode, nil
+	}
+	taxCode, err := FindTaxCode(r.db, code, r.date)
+	if err != nil && !errors.Is(err, ErrTaxCodeNotEffective) {
+		return nil, err
+	}
+	r.codes[code] = taxCode
+	return taxCode, nil
+}
+
+// resolve returns the best matching sales tax and withholding codes for an item
+// type; either is nil when no rule applies
+func (r *taxResolver) resolve(itemType string) (sales, withholding *models.TaxCode, err error) {
+	bestSales, bestWithholding := -1, -1
+	var salesRule, withholdingRule models.TaxRule
+
+	for _, rule := range r.rules {
+		score, ok := r.match(rule, itemType)
+		if !ok {
+			continue
+		}
+		taxCode, err := r.code(rule.TaxCode)
+		if err != nil {
+			return nil, nil, err
+		}
+		if taxCode == nil {
+			continue
+		}
+		if taxCode.Kind == models.TaxKindWithholding {
+			if betterRule(score, rule, bestWithholding, withholdingRule) {
+				bestWithholding, withholdingRule, withholding = score, rule, taxCode
+			}
+		} else if betterRule(score, rule, bestSales, salesRule) {
+			bestSales, salesRule, sales = score, rule, taxCode
+		}
+	}
+	return sales, withholding, nil
+}
+
+// ResolveTaxCodes returns the sales tax and withholding codes the tax rules
+// assign to an item type in a jurisdiction on a date; either is nil when no
+// rule applies
+func ResolveTaxCodes(db *gorm.DB, jurisdiction TaxJurisdiction, itemType string, date time.Time) (sales, withholding *models.TaxCode, err error) {
+	resolver, err := newTaxResolver(db, jurisdiction, date)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resolver.resolve(itemType)
+}
+
+// match reports whether a rule applies and how many of its criteria are set
+func (r *taxResolver) match(rule models.TaxRule, itemType string) (int, bool) {
+	score := 0
+	criteria := []struct{ want, have string }{
+		{rule.SellerCountry, r.jurisdiction.SellerCountry},
+		{rule.SellerStateProvince, r.jurisdiction.SellerStateProvince},
+		{rule.BuyerCountry, r.jurisdiction.BuyerCountry},
+		{rule.BuyerStateProvince, r.jurisdiction.BuyerStateProvince},
+		{rule.ItemType, itemType},
+	}
+	for _, c := range criteria {
+		if strings.TrimSpace(c.want) == "" {
+			continue
+		}
+		if !strings.EqualFold(strings.TrimSpace(c.want), strings.TrimSpace(c.have)) {
+			return 0, false
+		}
+		score++
+	}
+	return score, true
+}
+
+// betterRule reports whether a matching rule beats the best one so far: more
+// criteria first, then higher priority, then the older rule
+func betterRule(score int, rule models.TaxRule, bestScore int, best models.TaxRule) bool {
+	if score != bestScore {
+		return score > bestScore
+	}
+	return rule.Priority > best.Priority
+}
+
+// applyInvoiceTaxCodes sets the tax codes and rates of the invoice lines. An
+// explicit code on a line is kept and its effective rate applied; otherwise the
+// tax rules decide. Lines no rule applies to keep their free-typed rate. The
+// effective versions of the codes used are returned by code.
+func applyInvoiceTaxCodes(tx *gorm.DB, invoice *models.Invoice, items []models.InvoiceItem) (map[string]*models.TaxCode, error) {
+	jurisdiction, err := LoadTaxJurisdiction(tx, invoice)
+	if err != nil {
+		return nil, err
+	}
+	resolver, err := newTaxResolver(tx, jurisdiction, invoice.InvoiceDate)
+	if err != nil {
+		return nil, err
+	}
+	itemTypes, err := invoiceItemTypes(tx, items)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range items {
+		item := &items[i]
+		itemType := ""
+		if item.ItemID != nil {
+			itemType = itemTypes[*item.ItemID]
+		}
+		sales, withholding, err := resolver.resolve(itemType)
+		if err != nil {
+			return nil, err
+		}
+
+		if item.TaxCode != nil && *item.TaxCode != "" {
+			if sales, err = explicitTaxCode(resolver, *item.TaxCode, false); err != nil {
+				return nil, err
+			}
+		}
+		if sales != nil {
+			code := sales.Code
+			item.TaxCode = &code
+			item.TaxRatePercentage = sales.RatePercentage
+		} else {
+			item.TaxCode = nil
+		}
+
+		if item.WithholdingTaxCode != nil && *item.WithholdingTaxCode != "" {
+			if withholding, err = explicitTaxCode(resolver, *item.WithholdingTaxCode, true); err != nil {
+				return nil, err
+			}
+		}
+		if withholding != nil {
+			code := withholding.Code
+			item.WithholdingTaxCode = &code
+			item.WithholdingRatePercentage = withholding.RatePercentage
+		} else {
+			item.WithholdingTaxCode = nil
+			item.WithholdingRatePercentage = 0
+		}
+	}
+	return resolver.codes, nil
+}
+
+// explicitTaxCode looks up a code requested on a line and checks its kind
+func explicitTaxCode(resolver *taxResolver, code string, withholding bool) (*models.TaxCode, error) {
+	taxCode, err := resolver.code(code)
+	if err != nil {
+		return nil, err
+	}
+	if taxCode == nil {
+		return nil, fmt.Errorf("%w: %s on %s", ErrTaxCodeNotEffective, code, resolver.date.Format("2006-01-02"))
+	}
+	if (taxCode.Kind == models.TaxKindWithholding) != withholding {
+		return nil, fmt.Errorf("%w: %s is a %s code", ErrTaxCodeKind, code, taxCode.Kind)
+	}
+	return taxCode, nil
+}
+
+// invoiceItemTypes returns the catalog type of the items referenced by the lines
+func invoiceItemTypes(tx *gorm.DB, items []models.InvoiceItem) (map[uint]string, error) {
+	ids := make([]uint, 0, len(items))
+	for _, item := range items {
+		if item.ItemID != nil {
+			ids = append(ids, *item.ItemID)
+		}
+	}
+	types := make(map[uint]string, len(ids))
+	if len(ids) == 0 {
+		return types, nil
+	}
+
+	var catalog []models.Item
+	if err := tx.Select("item_id", "type").Where("item_id IN ?", ids).Find(&catalog).Error; err != nil {
+		return nil, fmt.Errorf("failed to load item types: %w", err)
+	}
+	for _, item := range catalog {
+		types[item.ItemID] = item.Type
+	}
+	return types, nil
+}
+
+// applyInvoicePricing copies the tax rounding policy of the sender company onto
+// the invoice, and converts catalog prices whose tax inclusion differs from the
+// invoice at the sales tax rate of their line
+func applyInvoicePricing(tx *gorm.DB, invoice *models.Invoice, items []models.InvoiceItem) error {
+	var sender models.Company
+	if err := tx.Select("company_id", "tax_rounding").First(&sender, invoice.SenderCompanyID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSenderCompanyNotFound
+		}
+		return fmt.Errorf("failed to load sender company: %w", err)
+	}
+	invoice.TaxRounding = sender.TaxRounding
+	if !models.IsTaxRounding(invoice.TaxRounding) {
+		invoice.TaxRounding = models.TaxRoundingLine
+	}
+
+	for i := range items {
+		item := &items[i]
+		if item.PriceTaxInclusive == nil || *item.PriceTaxInclusive == invoice.TaxInclusive {
+			continue
+		}
+		if invoice.TaxInclusive {
+			item.UnitPrice = item.UnitPrice.Add(item.UnitPrice.Percent(item.TaxRatePercentage))
+		} else {
+			item.UnitPrice = item.UnitPrice.Sub(item.UnitPrice.IncludedPercent(item.TaxRatePercentage, item.TaxRatePercentage))
+		}
+		item.UnitPrice = item.UnitPrice.Round(invoice.Currency)
+		item.PriceTaxInclusive = &invoice.TaxInclusive
+	}
+	return nil
+}
+
+// invoicePricing is how the lines of an invoice and its credit notes are taxed.
+// The invoice discount is not part of it: credit notes carry it on their lines.
+func invoicePricing(invoice *models.Invoice) utils.Pricing {
+	return utils.Pricing{TaxInclusive: invoice.TaxInclusive, Rounding: invoice.TaxRounding}
+}
+
+// lineTaxes lists the taxes of a line for utils.CalculateInvoiceTotals
+func lineTaxes(taxCode *string, rate float64, withholdingCode *string, withholdingRate float64) []utils.LineTax {
+	taxes := []utils.LineTax{{RatePercentage: rate}}
+	if taxCode != nil {
+		taxes[0].Code = *taxCode
+	}
+	if withholdingCode != nil {
+		taxes = append(taxes, utils.LineTax{Code: *withholdingCode, RatePercentage: withholdingRate, Withholding: true})
+	}
+	return taxes
+}
+
+// invoiceTaxes turns the computed breakdown into invoice_taxes rows, naming each
+// coded entry after the effective version of its code
+func invoiceTaxes(breakdown []utils.TaxSummary, codes map[string]*models.TaxCode) []models.InvoiceTax {
+	taxes := make([]models.InvoiceTax, 0, len(breakdown))
+	for _, summary := range breakdown {
+		tax := models.InvoiceTax{
+			TaxCode:        summary.Code,
+			Kind:           models.TaxKindStandard,
+			RatePercentage: summary.RatePercentage,
+			TaxableAmount:  summary.Taxable,
+			TaxAmount:      summary.Tax,
+		}
+		if summary.Withholding {
+			tax.Kind = models.TaxKindWithholding
+		}
+		if taxCode := codes[summary.Code]; taxCode != nil {
+			tax.Name = taxCode.Name
+			tax.Kind = taxCode.Kind
+		}
+		taxes = append(taxes, tax)
+	}
+	return taxes
+}
+
+// replaceInvoiceTaxes stores the tax breakdown of an invoice
+func replaceInvoiceTaxes(tx *gorm.DB, invoiceID uint, taxes []models.InvoiceTax) error {
+	if err := tx.Where("invoice_id = ?", invoiceID).Delete(&models.InvoiceTax{}).Error; err != nil {
+		return fmt.Errorf("failed to remove invoice taxes: %w", err)
+	}
+	if len(taxes) == 0 {
+		return nil
+	}
+	for i := range taxes {
+		taxes[i].InvoiceTaxID = 0
+		taxes[i].InvoiceID = invoiceID
+	}
+	if err := tx.Create(&taxes).Error; err != nil {
+		return fmt.Errorf("failed to create invoice taxes: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrTemplateNotFound = errors.New("invoice template not found")
+
+// CreateInvoiceTemplate stores a new template for a sender company. The first
+// template of a company becomes its active one.
+func CreateInvoiceTemplate(tx *gorm.DB, tmpl *models.InvoiceTemplate) error {
+	var count int64
+	if err := tx.Model(&models.InvoiceTemplate{}).Where("company_id = ?", tmpl.CompanyID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to count invoice templates: %w", err)
+	}
+	tmpl.IsActive = count == 0
+
+	if err := tx.Create(tmpl).Error; err != nil {
+		return fmt.Errorf("failed to create invoice template: %w", err)
+	}
+	return nil
+}
+
+// GetInvoiceTemplates lists the templates of a sender company
+func GetInvoiceTemplates(db *gorm.DB, companyID uint) ([]models.InvoiceTemplate, error) {
+	var templates []models.InvoiceTemplate
+	if err := db.Where("company_id = ?", companyID).Order("template_id").Find(&templates).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch invoice templates: %w", err)
+	}
+	return templates, nil
+}
+
+// GetInvoiceTemplate fetches one template of a sender company
+func GetInvoiceTemplate(db *gorm.DB, companyID, templateID uint) (*models.InvoiceTemplate, error) {
+	var tmpl models.InvoiceTemplate
+	err := db.Where("company_id = ? AND template_id = ?", companyID, templateID).First(&tmpl).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTemplateNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch invoice template: %w", err)
+	}
+	return &tmpl, nil
+}
+
+// GetActiveInvoiceTemplate returns the active template of a sender company, or
+// nil when the company renders with the built-in layout
+func GetActiveInvoiceTemplate(db *gorm.DB, companyID uint) (*models.InvoiceTemplate, error) {
+	var tmpl models.InvoiceTemplate
+	err := db.Where("company_id = ? AND is_active = ?", companyID, true).First(&tmpl).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to fetch active invoice template: %w", err)
+	}
+	return &tmpl, nil
+}
+
+// ActivateInvoiceTemplate makes a template the one used for the company's
+// invoices and deactivates the others
+func ActivateInvoiceTemplate(tx *gorm.DB, companyID, templateID uint) (*models.InvoiceTemplate, error) {
+	tmpl, err := GetInvoiceTemplate(tx, companyID, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := tx.Model(&models.InvoiceTemplate{}).
+		Where("company_id = ? AND template_id <> ?", companyID, templateID).
+		Updates(map[string]interface{}{"is_active": false, "updated_at": now}).Error; err != nil {
+		return nil, fmt.Errorf("failed to deactivate invoice templates: %w", err)
+	}
+	if err := tx.Model(tmpl).Updates(map[string]interface{}{"is_active": true, "updated_at": now}).Error; err != nil {
+		return nil, fmt.Errorf("failed to activate invoice template: %w", err)
+	}
+	tmpl.IsActive = true
+	return tmpl, nil
+}
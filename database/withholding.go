@@ -0,0 +1,116 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"invoice-go/models"
+	"invoice-go/money"
+	"invoice-go/utils"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPaymentNotFound = errors.New("payment not found")
+	ErrNoWithholding   = errors.New("no tax was withheld on this payment")
+)
+
+// PaymentWithholdingTaxCode returns the withholding code to record on a
+// payment. A requested code must be a withholding code effective on the
+// payment date; without one the invoice's withholding code is used when its
+// tax breakdown has exactly one.
+func PaymentWithholdingTaxCode(db *gorm.DB, invoiceID uint, code *string, date time.Time) (*string, error) {
+	if code != nil && strings.TrimSpace(*code) != "" {
+		taxCode, err := FindTaxCode(db, *code, date)
+		if err != nil {
+			return nil, err
+		}
+		if taxCode.Kind != models.TaxKindWithholding {
+			return nil, fmt.Errorf("%w: %s is a %s code", ErrTaxCodeKind, taxCode.Code, taxCode.Kind)
+		}
+		return &taxCode.Code, nil
+	}
+
+	var codes []string
+	if err := db.Model(&models.InvoiceTax{}).
+		Distinct("tax_code").
+		Where("invoice_id = ? AND kind = ? AND tax_code <> ''", invoiceID, models.TaxKindWithholding).
+		Pluck("tax_code", &codes).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch invoice taxes: %w", err)
+	}
+	if len(codes) != 1 {
+		return nil, nil
+	}
+	return &codes[0], nil
+}
+
+// RecordWithholdingCertificate stores the reference and date of the
+// certificate a customer issued for the tax it withheld on a payment
+func RecordWithholdingCertificate(tx *gorm.DB, paymentID uint, number string, date time.Time) (*models.Payment, error) {
+	var payment models.Payment
+	if err := tx.First(&payment, paymentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch payment: %w", err)
+	}
+	if !payment.WithholdingAmount.IsPositive() {
+		return nil, ErrNoWithholding
+	}
+
+	number = strings.TrimSpace(number)
+	if err := tx.Model(&payment).Updates(map[string]interface{}{
+		"certificate_number": number,
+		"certificate_date":   date,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to record withholding certificate: %w", err)
+	}
+	payment.CertificateNumber = &number
+	payment.CertificateDate = &date
+	return &payment, nil
+}
+
+// GetPendingCertificates lists the completed payments on which tax was
+// withheld but no certificate has been recorded yet, grouped per customer.
+// Totals are converted into the base currency with the invoice exchange rate.
+// A zero companyID lists every customer.
+func GetPendingCertificates(db *gorm.DB, companyID uint) ([]models.CustomerPendingCertificates, error) {
+	q := db.Table("payments AS p").
+		Select(`p.payment_id, p.invoice_id, i.invoice_number, p.payment_date, p.withholding_tax_code,
+			p.withholding_amount, p.currency, i.exchange_rate,
+			c.company_id, c.company_name`).
+		Joins("JOIN invoices AS i ON i.invoice_id = p.invoice_id").
+		Joins("JOIN companies AS c ON c.company_id = i.recipient_company_id").
+		Where("p.withholding_amount > 0 AND p.certificate_number IS NULL AND p.status = ?", models.PaymentStatusCompleted)
+	if companyID != 0 {
+		q = q.Where("i.recipient_company_id = ?", companyID)
+	}
+
+	var rows []models.PendingCertificate
+	if err := q.Order("c.company_name, c.company_id, p.payment_date, p.payment_id").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch pending withholding certificates: %w", err)
+	}
+
+	base := utils.BaseCurrency()
+	customers := []models.CustomerPendingCertificates{}
+	for _, row := range rows {
+		if len(customers) == 0 || customers[len(customers)-1].CompanyID != row.CompanyID {
+			customers = append(customers, models.CustomerPendingCertificates{
+				CompanyID:     row.CompanyID,
+				CompanyName:   row.CompanyName,
+				Currency:      base,
+				TotalWithheld: money.Zero(),
+			})
+		}
+		customer := &customers[len(customers)-1]
+		rate := row.ExchangeRate
+		if rate == 0 {
+			rate = 1
+		}
+		customer.TotalWithheld = customer.TotalWithheld.Add(row.WithholdingAmount.Mul(rate).Round(base))
+		customer.Payments = append(customer.Payments, row)
+	}
+	return customers, nil
+}
@@ -4,7 +4,9 @@ go 1.24.2
 
 require (
 	github.com/gin-gonic/gin v1.10.0
+	github.com/go-pdf/fpdf v0.9.0
 	github.com/google/uuid v1.6.0
+	github.com/shopspring/decimal v1.4.0
 	gorm.io/driver/mysql v1.5.7
 	gorm.io/gorm v1.26.0
 )
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"invoice-go/bankstatement"
+	"invoice-go/database"
+	"invoice-go/models"
+	"invoice-go/utils"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxBankStatementSize caps the size of an uploaded bank statement
+const maxBankStatementSize = 10 << 20
+
+// BankStatementHandler imports bank statements and reconciles their lines
+// with the payments of open invoices
+type BankStatementHandler struct {
+	DB *gorm.DB
+}
+
+// ConfirmBankLineInput is used for confirming the match of a bank statement line
+type ConfirmBankLineInput struct {
+	MatchID   uint `json:"match_id"`   // one of the proposed matches
+	InvoiceID uint `json:"invoice_id"` // or an invoice picked by hand
+}
+
+// POST /bank-statements - upload a bank statement (multipart `file`, CSV, OFX
+// or MT940) and propose matches for its lines. `format` overrides the format
+// detected from the file; `currency` is used for lines the file gives none
+// for and defaults to the base currency.
+func (h *BankStatementHandler) ImportBankStatement(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBankStatementSize)
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bank statement upload failed"})
+		return
+	}
+	if file.Size > maxBankStatementSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file exceeds 10MB limit"})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to open bank statement"})
+		return
+	}
+	defer src.Close()
+	content, err := io.ReadAll(src)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read bank statement"})
+		return
+	}
+
+	format := c.PostForm("format")
+	if format == "" {
+		format = bankstatement.DetectFormat(file.Filename, content)
+	}
+	currency := utils.NormalizeCurrency(c.PostForm("currency"))
+	if currency == "" {
+		currency = utils.BaseCurrency()
+	}
+
+	parsed, err := bankstatement.Parse(format, bytes.NewReader(content))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var statement *models.BankStatement
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		statement, err = database.ImportBankStatement(tx, filepath.Base(file.Filename), parsed, currency)
+		return err
+	})
+	if err != nil {
+		writeBankStatementError(c, err, "failed to import bank statement")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"bank_statement": statement})
+}
+
+// GET /bank-statements - list the imported bank statements, newest first
+func (h *BankStatementHandler) GetBankStatements(c *gin.Context) {
+	statements, err := database.GetBankStatements(h.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch bank statements"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"bank_statements": statements})
+}
+
+// GET /bank-statements/:id - get a bank statement with its lines and proposed matches
+func (h *BankStatementHandler) GetBankStatement(c *gin.Context) {
+	statementID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bank statement ID"})
+		return
+	}
+
+	statement, err := database.GetBankStatement(h.DB, uint(statementID))
+	if err != nil {
+		writeBankStatementError(c, err, "failed to fetch bank statement")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"bank_statement": statement})
+}
+
+// GET /reconciliation/queue - bank statement lines still to be matched or
+// ignored, with the matches proposed for them
+func (h *BankStatementHandler) GetReconciliationQueue(c *gin.Context) {
+	lines, err := database.GetReconciliationQueue(h.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch reconciliation queue"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"lines": lines})
+}
+
+// POST /reconciliation/lines/:id/confirm - confirm a proposed match, or match
+// an invoice by hand, recording the line as a payment of the invoice
+func (h *BankStatementHandler) ConfirmBankLine(c *gin.Context) {
+	lineID, ok := bankLineID(c)
+	if !ok {
+		return
+	}
+
+	var input ConfirmBankLineInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var line *models.BankStatementLine
+	var payment models.Payment
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if line, err = database.ConfirmBankLine(tx, lineID, input.MatchID, input.InvoiceID); err != nil {
+			return err
+		}
+		return tx.Preload("Invoice").First(&payment, *line.PaymentID).Error
+	})
+	if err != nil {
+		writeBankStatementError(c, err, "failed to confirm match")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"line": line, "payment": payment})
+}
+
+// POST /reconciliation/lines/:id/rematch - propose matches afresh for a line of the queue
+func (h *BankStatementHandler) RematchBankLine(c *gin.Context) {
+	h.updateBankLine(c, database.RematchBankLine, "failed to match bank statement line")
+}
+
+// POST /reconciliation/lines/:id/ignore - take a line that is not a customer
+// payment off the queue
+func (h *BankStatementHandler) IgnoreBankLine(c *gin.Context) {
+	h.updateBankLine(c, database.IgnoreBankLine, "failed to ignore bank statement line")
+}
+
+// updateBankLine runs an operation on the line of the :id path parameter in a transaction
+func (h *BankStatementHandler) updateBankLine(c *gin.Context, update func(tx *gorm.DB, lineID uint) (*models.BankStatementLine, error), fallback string) {
+	lineID, ok := bankLineID(c)
+	if !ok {
+		return
+	}
+
+	var line *models.BankStatementLine
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		line, err = update(tx, lineID)
+		return err
+	})
+	if err != nil {
+		writeBankStatementError(c, err, fallback)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"line": line})
+}
+
+// bankLineID parses the :id path parameter, writing the error response when invalid
+func bankLineID(c *gin.Context) (uint, bool) {
+	lineID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bank statement line ID"})
+		return 0, false
+	}
+	return uint(lineID), true
+}
+
+// writeBankStatementError maps bank statement and reconciliation errors onto HTTP responses
+func writeBankStatementError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, database.ErrBankStatementNotFound), errors.Is(err, database.ErrBankLineNotFound),
+		errors.Is(err, database.ErrBankMatchNotFound), errors.Is(err, database.ErrInvoiceNotFound),
+		errors.Is(err, database.ErrPaymentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrBankMatchRequired), errors.Is(err, database.ErrBankLineNotReceipt),
+		errors.Is(err, database.ErrCurrencyMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrBankLineSettled), errors.Is(err, database.ErrPaymentAlreadyMatched),
+		errors.Is(err, database.ErrInvoiceNotPayable), errors.Is(err, database.ErrPaymentFromReceipt),
+		errors.Is(err, database.ErrPaymentReversed), errors.Is(err, database.ErrPaymentIsReversal),
+		errors.Is(err, database.ErrBankLinePaymentAmount):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -1,12 +1,18 @@
 package handlers
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"github.com/gin-gonic/gin"
 	"time"
 	"gorm.io/gorm"
-	// "invoice-go/utils"
+	"invoice-go/utils"
+	"invoice-go/database"
 	"invoice-go/models"
+	"invoice-go/render"
 )
 
 type CompanyHandler struct {
@@ -33,6 +39,7 @@ type UpdateCompanyInput struct {
 	IsVendor                 *bool   `json:"is_vendor,omitempty"`
 	DefaultBillingAddressID  *uint   `json:"default_billing_address_id,omitempty"`
 	DefaultShippingAddressID *uint   `json:"default_shipping_address_id,omitempty"`
+	TaxRounding              *string `json:"tax_rounding,omitempty" binding:"omitempty,oneof=line invoice"`
 }
 
 // GetAllCompanies returns all companies
@@ -49,7 +56,7 @@ func (h *CompanyHandler) GetAllCompanies(c *gin.Context) {
 	c.JSON(http.StatusOK, companies)
 }
 
-// GetCompanyByID returns a single company by ID
+// GetCompanyByID returns a single company by ID with its credit balance
 func (h *CompanyHandler) GetCompanyByID(c *gin.Context) {
 	id := c.Param("id")
 	var company models.Company
@@ -62,6 +69,13 @@ func (h *CompanyHandler) GetCompanyByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
 		return
 	}
+
+	credit, err := database.GetCreditBalances(h.DB, company.CompanyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate credit balance"})
+		return
+	}
+	company.CreditBalance = credit
 	c.JSON(http.StatusOK, company)
 }
 
@@ -100,9 +114,13 @@ func (h *CompanyHandler) CreateCompany(c *gin.Context) {
 		Phone:                    phonePtr,
 		IsCustomer:               input.IsCustomer,
 		IsVendor:                 input.IsVendor,
+		TaxRounding:              input.TaxRounding,
 		DefaultBillingAddressID:  nil,
 		DefaultShippingAddressID: nil,
 	}
+	if company.TaxRounding == "" {
+		company.TaxRounding = models.TaxRoundingLine
+	}
 
 	tx := h.DB.Begin()
 	defer func() {
@@ -187,6 +205,10 @@ func (h *CompanyHandler) UpdateCompany(c *gin.Context) {
             cleanUpdates[k] = v
         }
     }
+    // Applies to invoices created or edited from now on
+    if input.TaxRounding != nil {
+        cleanUpdates["tax_rounding"] = *input.TaxRounding
+    }
 
     // Explicit update with timestamp control
     result := tx.Model(&models.Company{}).
@@ -222,3 +244,115 @@ func (h *CompanyHandler) UpdateCompany(c *gin.Context) {
     
     c.JSON(http.StatusOK, updatedCompany)
 }
+
+// GetCompanyBalance returns the invoiced, credited, paid and outstanding totals of a customer
+func (h *CompanyHandler) GetCompanyBalance(c *gin.Context) {
+	companyID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+		return
+	}
+
+	var company models.Company
+	if err := h.DB.First(&company, companyID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+		return
+	}
+
+	balance, err := database.GetCompanyBalance(h.DB, company.CompanyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate balance"})
+		return
+	}
+	c.JSON(http.StatusOK, balance)
+}
+
+// GET /companies/:id/statement[?from=&to=&sender_id=&format=json|csv|pdf] - statement
+// of account of a customer with its running balance. The period defaults to
+// the month to date.
+func (h *CompanyHandler) GetCompanyStatement(c *gin.Context) {
+	companyID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+		return
+	}
+
+	to := time.Now()
+	if d := c.Query("to"); d != "" {
+		if to, err = time.Parse("2006-01-02", d); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be formatted as YYYY-MM-DD"})
+			return
+		}
+	}
+	from := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if d := c.Query("from"); d != "" {
+		if from, err = time.Parse("2006-01-02", d); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be formatted as YYYY-MM-DD"})
+			return
+		}
+	}
+	if from.After(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return
+	}
+
+	var senderID uint64
+	if id := c.Query("sender_id"); id != "" {
+		if senderID, err = strconv.ParseUint(id, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sender ID"})
+			return
+		}
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" && format != "pdf" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, csv or pdf"})
+		return
+	}
+
+	statement, err := database.GetStatement(h.DB, uint(companyID), uint(senderID), from, to)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrCompanyNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+		case errors.Is(err, database.ErrSenderCompanyNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build statement"})
+		}
+		return
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "json":
+		c.JSON(http.StatusOK, statement)
+		return
+	case "csv":
+		if err := render.StatementCSV(&buf, statement); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render statement"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", render.StatementFilename(statement, "csv")))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+	case "pdf":
+		// Statements of one sender are printed with its template and logo
+		layout := render.DefaultLayout()
+		logoPath := ""
+		if statement.SenderCompany != nil {
+			tmpl, err := database.GetActiveInvoiceTemplate(h.DB, statement.SenderCompany.CompanyID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invoice template"})
+				return
+			}
+			layout = render.LayoutFromTemplate(tmpl)
+			logoPath, _ = utils.GetCompanyLogoPath(statement.SenderCompany.CompanyID)
+		}
+		if err := render.StatementPDF(&buf, statement, logoPath, layout); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render statement PDF"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", render.StatementFilename(statement, "pdf")))
+		c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+	}
+}
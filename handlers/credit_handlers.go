@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"errors"
+	"invoice-go/database"
+	"invoice-go/models"
+	"invoice-go/money"
+	"invoice-go/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreditHandler manages the credit balances of customer companies
+type CreditHandler struct {
+	DB *gorm.DB
+}
+
+// ApplyCreditInput is used for applying credit to an invoice
+type ApplyCreditInput struct {
+	InvoiceID uint          `json:"invoice_id" binding:"required"`
+	Amount    *money.Amount `json:"amount"` // defaults to as much as the balance and the amount due allow
+}
+
+// CreditRefundInput is used for paying credit back to a customer
+type CreditRefundInput struct {
+	Amount               money.Amount `json:"amount"`                               // must be positive
+	Currency             string       `json:"currency" binding:"omitempty,iso4217"` // defaults to the base currency
+	RefundDate           *time.Time   `json:"refund_date"`                          // defaults to now
+	Method               *string      `json:"method" binding:"omitempty,max=50"`
+	TransactionReference *string      `json:"transaction_reference" binding:"omitempty,max=255"`
+	Notes                *string      `json:"notes"`
+}
+
+// GET /companies/:id/credit - credit balance of a customer per currency, with its ledger
+func (h *CreditHandler) GetCredit(c *gin.Context) {
+	company, ok := h.findCompany(c)
+	if !ok {
+		return
+	}
+
+	balances, err := database.GetCreditBalances(h.DB, company.CompanyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to calculate credit balance"})
+		return
+	}
+	entries, err := database.GetCreditEntries(h.DB, company.CompanyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch credit entries"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"credit_balance": balances, "entries": entries})
+}
+
+// POST /companies/:id/credit/apply - apply credit of a customer to one of its invoices
+func (h *CreditHandler) ApplyCredit(c *gin.Context) {
+	company, ok := h.findCompany(c)
+	if !ok {
+		return
+	}
+
+	var input ApplyCreditInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var entry *models.CreditEntry
+	var invoice models.Invoice
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if entry, err = database.ApplyCredit(tx, company.CompanyID, input.InvoiceID, input.Amount); err != nil {
+			return err
+		}
+		return tx.First(&invoice, input.InvoiceID).Error
+	})
+	if err != nil {
+		writeCreditError(c, err, "failed to apply credit")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"credit_entry": entry, "invoice": invoice})
+}
+
+// POST /companies/:id/credit/refunds - record credit paid back to a customer
+func (h *CreditHandler) RefundCredit(c *gin.Context) {
+	company, ok := h.findCompany(c)
+	if !ok {
+		return
+	}
+
+	var input CreditRefundInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	refund := models.CreditRefund{
+		CompanyID:            company.CompanyID,
+		RefundDate:           time.Now(),
+		Amount:               input.Amount,
+		Currency:             utils.NormalizeCurrency(input.Currency),
+		Method:               input.Method,
+		TransactionReference: input.TransactionReference,
+		Notes:                input.Notes,
+	}
+	if input.RefundDate != nil {
+		refund.RefundDate = *input.RefundDate
+	}
+	if refund.Currency == "" {
+		refund.Currency = utils.BaseCurrency()
+	}
+
+	var entry *models.CreditEntry
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		entry, err = database.RefundCredit(tx, &refund)
+		return err
+	})
+	if err != nil {
+		writeCreditError(c, err, "failed to record refund")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"refund": refund, "credit_entry": entry})
+}
+
+// writeCreditError maps credit balance errors onto HTTP responses
+func writeCreditError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, database.ErrInvoiceNotFound), errors.Is(err, database.ErrCompanyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrCreditAmount), errors.Is(err, database.ErrInsufficientCredit),
+		errors.Is(err, database.ErrAllocationExceedsDue), errors.Is(err, database.ErrInvoiceNotOfCustomer):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrInvoiceNotPayable), errors.Is(err, database.ErrNothingToApply):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// findCompany loads the company of the :id path parameter, writing the error response when missing
+func (h *CreditHandler) findCompany(c *gin.Context) (*models.Company, bool) {
+	companyID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+		return nil, false
+	}
+
+	var company models.Company
+	if err := h.DB.First(&company, companyID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+		return nil, false
+	}
+	return &company, true
+}
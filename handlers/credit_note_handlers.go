@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"invoice-go/database"
+	"invoice-go/models"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreditNoteHandler handles credit notes issued against invoices
+type CreditNoteHandler struct {
+	DB *gorm.DB
+}
+
+// CreditNoteRequest is used for creating a credit note. Without lines the whole
+// invoice (every quantity not yet credited) is reversed.
+type CreditNoteRequest struct {
+	CreditNoteDate *time.Time              `json:"credit_note_date"`
+	Reason         *string                 `json:"reason" binding:"omitempty,max=500"`
+	Lines          []CreditNoteLineRequest `json:"lines" binding:"omitempty,dive"`
+}
+
+// CreditNoteLineRequest selects a quantity of an invoice line to credit
+type CreditNoteLineRequest struct {
+	InvoiceItemID uint    `json:"invoice_item_id" binding:"required"`
+	Quantity      float64 `json:"quantity" binding:"required,gt=0"`
+}
+
+// POST /invoice/:id/credit-notes – credit all or selected lines of an invoice
+func (h *CreditNoteHandler) CreateCreditNote(c *gin.Context) {
+	invoiceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invoice ID"})
+		return
+	}
+
+	var input CreditNoteRequest
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts := database.CreditNoteOptions{Reason: input.Reason}
+	if input.CreditNoteDate != nil {
+		opts.CreditNoteDate = *input.CreditNoteDate
+	}
+	for _, line := range input.Lines {
+		opts.Lines = append(opts.Lines, database.CreditNoteLine{
+			InvoiceItemID: line.InvoiceItemID,
+			Quantity:      line.Quantity,
+		})
+	}
+
+	var creditNote *models.CreditNote
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		creditNote, err = database.CreateCreditNote(tx, uint(invoiceID), opts)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrInvoiceNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice not found"})
+		case errors.Is(err, database.ErrInvoiceItemNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, database.ErrInvoiceNotCreditable),
+			errors.Is(err, database.ErrOverCrediting),
+			errors.Is(err, database.ErrNothingToCredit):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create credit note"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"credit_note": creditNote})
+}
+
+// GET /invoice/:id/credit-notes – list the credit notes of an invoice
+func (h *CreditNoteHandler) GetInvoiceCreditNotes(c *gin.Context) {
+	invoiceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invoice ID"})
+		return
+	}
+
+	creditNotes, err := database.GetInvoiceCreditNotes(h.DB, uint(invoiceID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch credit notes"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"credit_notes": creditNotes})
+}
+
+// GET /credit-notes/:id – fetch one credit note with its lines
+func (h *CreditNoteHandler) GetCreditNote(c *gin.Context) {
+	creditNoteID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid credit note ID"})
+		return
+	}
+
+	creditNote, err := database.GetCreditNote(h.DB, uint(creditNoteID))
+	if err != nil {
+		if errors.Is(err, database.ErrCreditNoteNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "credit note not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch credit note"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"credit_note": creditNote})
+}
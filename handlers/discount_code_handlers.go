@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"errors"
+	"invoice-go/database"
+	"invoice-go/models"
+	"invoice-go/money"
+	"invoice-go/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// DiscountCodeHandler manages the promo codes redeemable on orders
+type DiscountCodeHandler struct {
+	DB *gorm.DB
+}
+
+// DiscountCodeInput is used for creating or replacing a discount code
+type DiscountCodeInput struct {
+	Code               string       `json:"code" binding:"required,max=50"`
+	Description        *string      `json:"description"`
+	DiscountPercentage float64      `json:"discount_percentage" binding:"gte=0,lte=100"`
+	DiscountAmount     money.Amount `json:"discount_amount"`
+	Currency           string       `json:"currency" binding:"omitempty,iso4217"` // of discount_amount, defaults to the base currency
+	ValidFrom          *time.Time   `json:"valid_from"`
+	ValidUntil         *time.Time   `json:"valid_until"`
+	MaxUses            *int         `json:"max_uses" binding:"omitempty,gt=0"`
+	IsActive           *bool        `json:"is_active"` // defaults to true
+}
+
+// GET /discount-codes - list discount codes
+func (h *DiscountCodeHandler) GetDiscountCodes(c *gin.Context) {
+	var codes []models.DiscountCode
+	if err := h.DB.Order("code").Find(&codes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch discount codes"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"discount_codes": codes})
+}
+
+// GET /discount-codes/:id - fetch one discount code
+func (h *DiscountCodeHandler) GetDiscountCode(c *gin.Context) {
+	discountCode, ok := h.findDiscountCode(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"discount_code": discountCode})
+}
+
+// POST /discount-codes - add a discount code
+func (h *DiscountCodeHandler) CreateDiscountCode(c *gin.Context) {
+	var input DiscountCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	discountCode := discountCodeFromInput(input)
+	if msg := validateDiscountCode(discountCode); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if !h.codeAvailable(c, discountCode.Code, 0) {
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&discountCode).Error; err != nil {
+			return err
+		}
+		// is_active defaults to true in the table, so a false value is not inserted
+		if !discountCode.IsActive {
+			return tx.Model(&discountCode).Update("is_active", false).Error
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create discount code"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"discount_code": discountCode})
+}
+
+// PUT /discount-codes/:id - replace a discount code. Its use count is kept.
+func (h *DiscountCodeHandler) UpdateDiscountCode(c *gin.Context) {
+	existing, ok := h.findDiscountCode(c)
+	if !ok {
+		return
+	}
+
+	var input DiscountCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	discountCode := discountCodeFromInput(input)
+	discountCode.DiscountCodeID = existing.DiscountCodeID
+	discountCode.TimesUsed = existing.TimesUsed
+	discountCode.CreatedAt = existing.CreatedAt
+	if msg := validateDiscountCode(discountCode); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if !h.codeAvailable(c, discountCode.Code, discountCode.DiscountCodeID) {
+		return
+	}
+
+	if err := h.DB.Save(&discountCode).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update discount code"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"discount_code": discountCode})
+}
+
+// DELETE /discount-codes/:id - remove a discount code. Orders keep the code they were placed with.
+func (h *DiscountCodeHandler) DeleteDiscountCode(c *gin.Context) {
+	discountCode, ok := h.findDiscountCode(c)
+	if !ok {
+		return
+	}
+	if err := h.DB.Delete(discountCode).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete discount code"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "discount code deleted"})
+}
+
+// discountCodeFromInput builds a discount code with a trimmed code and the default currency
+func discountCodeFromInput(input DiscountCodeInput) models.DiscountCode {
+	currency := strings.ToUpper(input.Currency)
+	if currency == "" {
+		currency = utils.BaseCurrency()
+	}
+	isActive := true
+	if input.IsActive != nil {
+		isActive = *input.IsActive
+	}
+	return models.DiscountCode{
+		Code:               strings.TrimSpace(input.Code),
+		Description:        input.Description,
+		DiscountPercentage: input.DiscountPercentage,
+		DiscountAmount:     input.DiscountAmount,
+		Currency:           currency,
+		ValidFrom:          input.ValidFrom,
+		ValidUntil:         input.ValidUntil,
+		MaxUses:            input.MaxUses,
+		IsActive:           isActive,
+	}
+}
+
+// validateDiscountCode checks the discount and validity period of a code, returning the error message
+func validateDiscountCode(discountCode models.DiscountCode) string {
+	switch {
+	case discountCode.Code == "":
+		return "code must not be blank"
+	case discountCode.DiscountAmount.IsNegative():
+		return "discount_amount must not be negative"
+	case discountCode.DiscountPercentage == 0 && discountCode.DiscountAmount.IsZero():
+		return "a discount code needs a discount_percentage or a discount_amount"
+	case discountCode.ValidFrom != nil && discountCode.ValidUntil != nil && discountCode.ValidUntil.Before(*discountCode.ValidFrom):
+		return "valid_until must not be before valid_from"
+	}
+	return ""
+}
+
+// codeAvailable checks that no other discount code uses the code, writing the error response when taken
+func (h *DiscountCodeHandler) codeAvailable(c *gin.Context, code string, id uint) bool {
+	var count int64
+	if err := h.DB.Model(&models.DiscountCode{}).
+		Where("code = ? AND discount_code_id <> ?", code, id).
+		Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch discount codes"})
+		return false
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "discount code " + code + " already exists"})
+		return false
+	}
+	return true
+}
+
+// findDiscountCode loads the discount code of the :id path parameter, writing the error response when missing
+func (h *DiscountCodeHandler) findDiscountCode(c *gin.Context) (*models.DiscountCode, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid discount code ID"})
+		return nil, false
+	}
+
+	var discountCode models.DiscountCode
+	if err := h.DB.First(&discountCode, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": database.ErrDiscountCodeNotFound.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch discount code"})
+		}
+		return nil, false
+	}
+	return &discountCode, true
+}
+
+// writeDiscountCodeError maps the errors of redeeming a discount code onto HTTP responses
+func writeDiscountCodeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, database.ErrDiscountCodeNotFound), errors.Is(err, database.ErrDiscountCodeInactive),
+		errors.Is(err, database.ErrDiscountCodeExpired), errors.Is(err, database.ErrNoExchangeRate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrDiscountCodeUsedUp):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to redeem discount code"})
+	}
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"errors"
+	"invoice-go/database"
+	"invoice-go/models"
+	"invoice-go/render"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// DunningHandler manages the payment reminder levels of sender companies and
+// the reminders sent for invoices
+type DunningHandler struct {
+	DB *gorm.DB
+}
+
+// DunningLevelInput is used for creating or replacing a dunning level
+type DunningLevelInput struct {
+	Level        int    `json:"level" binding:"required,gt=0"`
+	Name         string `json:"name" binding:"required,max=100"`
+	DaysAfterDue *int   `json:"days_after_due" binding:"required"` // negative before the due date
+	Subject      string `json:"subject" binding:"max=255"`
+	Body         string `json:"body"`
+	IsActive     *bool  `json:"is_active"` // defaults to true
+}
+
+// GET /companies/:id/dunning-levels - list the dunning levels of a sender company
+func (h *DunningHandler) GetDunningLevels(c *gin.Context) {
+	company, ok := h.findCompany(c)
+	if !ok {
+		return
+	}
+
+	levels, err := database.GetDunningLevels(h.DB, company.CompanyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch dunning levels"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"dunning_levels": levels})
+}
+
+// POST /companies/:id/dunning-levels - add a dunning level
+func (h *DunningHandler) CreateDunningLevel(c *gin.Context) {
+	company, ok := h.findCompany(c)
+	if !ok {
+		return
+	}
+
+	var input DunningLevelInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	level := dunningLevelFromInput(company.CompanyID, input)
+	if !h.validDunningLevel(c, company, level, 0) {
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&level).Error; err != nil {
+			return err
+		}
+		// is_active defaults to true in the table, so a false value is not inserted
+		if !level.IsActive {
+			return tx.Model(&level).Update("is_active", false).Error
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create dunning level"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"dunning_level": level})
+}
+
+// PUT /companies/:id/dunning-levels/:level_id - replace a dunning level. Invoices
+// keep the level they reached.
+func (h *DunningHandler) UpdateDunningLevel(c *gin.Context) {
+	company, existing, ok := h.findDunningLevel(c)
+	if !ok {
+		return
+	}
+
+	var input DunningLevelInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	level := dunningLevelFromInput(company.CompanyID, input)
+	level.DunningLevelID = existing.DunningLevelID
+	level.CreatedAt = existing.CreatedAt
+	if !h.validDunningLevel(c, company, level, level.DunningLevelID) {
+		return
+	}
+
+	if err := h.DB.Save(&level).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update dunning level"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"dunning_level": level})
+}
+
+// DELETE /companies/:id/dunning-levels/:level_id - remove a dunning level. The
+// reminders already sent for it are kept.
+func (h *DunningHandler) DeleteDunningLevel(c *gin.Context) {
+	_, level, ok := h.findDunningLevel(c)
+	if !ok {
+		return
+	}
+	if err := h.DB.Delete(level).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete dunning level"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "dunning level deleted"})
+}
+
+// GET /invoice/:id/reminders - list the payment reminders generated for an invoice
+func (h *DunningHandler) GetInvoiceReminders(c *gin.Context) {
+	invoiceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invoice ID"})
+		return
+	}
+
+	var invoice models.Invoice
+	if err := h.DB.First(&invoice, invoiceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch invoice"})
+		}
+		return
+	}
+
+	reminders, err := database.GetInvoiceReminders(h.DB, invoice.InvoiceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch invoice reminders"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"dunning_level": invoice.DunningLevel, "reminders": reminders})
+}
+
+// dunningLevelFromInput builds a dunning level of a company from the request
+func dunningLevelFromInput(companyID uint, input DunningLevelInput) models.DunningLevel {
+	isActive := true
+	if input.IsActive != nil {
+		isActive = *input.IsActive
+	}
+	return models.DunningLevel{
+		CompanyID:    companyID,
+		Level:        input.Level,
+		Name:         strings.TrimSpace(input.Name),
+		DaysAfterDue: *input.DaysAfterDue,
+		Subject:      input.Subject,
+		Body:         input.Body,
+		IsActive:     isActive,
+	}
+}
+
+// validDunningLevel checks that the level number is free within the company
+// and that the templates render on a sample invoice, writing the error
+// response when not
+func (h *DunningHandler) validDunningLevel(c *gin.Context, company *models.Company, level models.DunningLevel, id uint) bool {
+	if level.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must not be blank"})
+		return false
+	}
+	if _, _, err := render.ReminderMessage(render.SampleReminderView(*company, level)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	var count int64
+	if err := h.DB.Model(&models.DunningLevel{}).
+		Where("company_id = ? AND level = ? AND dunning_level_id <> ?", company.CompanyID, level.Level, id).
+		Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch dunning levels"})
+		return false
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "dunning level " + strconv.Itoa(level.Level) + " already exists"})
+		return false
+	}
+	return true
+}
+
+// findDunningLevel loads the company and dunning level of the :id and
+// :level_id path parameters, writing the error response when missing
+func (h *DunningHandler) findDunningLevel(c *gin.Context) (*models.Company, *models.DunningLevel, bool) {
+	company, ok := h.findCompany(c)
+	if !ok {
+		return nil, nil, false
+	}
+	levelID, err := strconv.ParseUint(c.Param("level_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid dunning level ID"})
+		return nil, nil, false
+	}
+
+	level, err := database.GetDunningLevel(h.DB, company.CompanyID, uint(levelID))
+	if err != nil {
+		if errors.Is(err, database.ErrDunningLevelNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch dunning level"})
+		}
+		return nil, nil, false
+	}
+	return company, level, true
+}
+
+// findCompany loads the company of the :id path parameter, writing the error response when missing
+func (h *DunningHandler) findCompany(c *gin.Context) (*models.Company, bool) {
+	companyID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+		return nil, false
+	}
+
+	var company models.Company
+	if err := h.DB.First(&company, companyID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+		return nil, false
+	}
+	return &company, true
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"errors"
+	"invoice-go/database"
+	"invoice-go/models"
+	"invoice-go/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ExchangeRateHandler manages the local table of exchange rates
+type ExchangeRateHandler struct {
+	DB *gorm.DB
+}
+
+// ExchangeRateInput is used for creating an exchange rate: one unit of
+// from_currency is worth rate units of to_currency from effective_date on
+type ExchangeRateInput struct {
+	FromCurrency  string    `json:"from_currency" binding:"required,iso4217"`
+	ToCurrency    string    `json:"to_currency" binding:"required,iso4217,nefield=FromCurrency"`
+	Rate          float64   `json:"rate" binding:"required,gt=0"`
+	EffectiveDate time.Time `json:"effective_date" binding:"required"`
+}
+
+// UpdateExchangeRateInput is used for correcting an exchange rate
+type UpdateExchangeRateInput struct {
+	Rate          *float64   `json:"rate" binding:"omitempty,gt=0"`
+	EffectiveDate *time.Time `json:"effective_date"`
+}
+
+// GET /exchange-rates[?from=…&to=…] - list exchange rates, newest first
+func (h *ExchangeRateHandler) GetExchangeRates(c *gin.Context) {
+	q := h.DB.Order("from_currency, to_currency, effective_date DESC")
+	if from := c.Query("from"); from != "" {
+		q = q.Where("from_currency = ?", utils.NormalizeCurrency(from))
+	}
+	if to := c.Query("to"); to != "" {
+		q = q.Where("to_currency = ?", utils.NormalizeCurrency(to))
+	}
+
+	var rates []models.ExchangeRate
+	if err := q.Find(&rates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch exchange rates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"exchange_rates": rates})
+}
+
+// GET /exchange-rates/effective?from=…&to=…[&date=YYYY-MM-DD] - the rate effective for a pair on a date
+func (h *ExchangeRateHandler) GetEffectiveRate(c *gin.Context) {
+	from, to := c.Query("from"), c.Query("to")
+	if from == "" || to == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to are required"})
+		return
+	}
+	date := time.Now()
+	if d := c.Query("date"); d != "" {
+		parsed, err := time.Parse("2006-01-02", d)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be formatted as YYYY-MM-DD"})
+			return
+		}
+		date = parsed
+	}
+
+	rate, err := database.FindExchangeRate(h.DB, from, to, date)
+	if err != nil {
+		if errors.Is(err, database.ErrNoExchangeRate) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch exchange rate"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"from_currency": utils.NormalizeCurrency(from),
+		"to_currency":   utils.NormalizeCurrency(to),
+		"date":          date.Format("2006-01-02"),
+		"rate":          rate,
+	})
+}
+
+// GET /exchange-rates/:id - fetch one exchange rate
+func (h *ExchangeRateHandler) GetExchangeRate(c *gin.Context) {
+	rate, ok := h.findRate(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"exchange_rate": rate})
+}
+
+// POST /exchange-rates - record the rate of a currency pair from a date on
+func (h *ExchangeRateHandler) CreateExchangeRate(c *gin.Context) {
+	var input ExchangeRateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rate := models.ExchangeRate{
+		FromCurrency:  input.FromCurrency,
+		ToCurrency:    input.ToCurrency,
+		Rate:          input.Rate,
+		EffectiveDate: truncateToDate(input.EffectiveDate),
+	}
+	if h.rateExists(rate, 0) {
+		c.JSON(http.StatusConflict, gin.H{"error": "a rate for this currency pair and effective date already exists"})
+		return
+	}
+	if err := h.DB.Create(&rate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create exchange rate"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"exchange_rate": rate})
+}
+
+// PUT /exchange-rates/:id - correct a rate. Invoices keep the rate they were created with.
+func (h *ExchangeRateHandler) UpdateExchangeRate(c *gin.Context) {
+	rate, ok := h.findRate(c)
+	if !ok {
+		return
+	}
+
+	var input UpdateExchangeRateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Rate != nil {
+		rate.Rate = *input.Rate
+	}
+	if input.EffectiveDate != nil {
+		rate.EffectiveDate = truncateToDate(*input.EffectiveDate)
+		if h.rateExists(*rate, rate.RateID) {
+			c.JSON(http.StatusConflict, gin.H{"error": "a rate for this currency pair and effective date already exists"})
+			return
+		}
+	}
+
+	if err := h.DB.Save(rate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update exchange rate"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"exchange_rate": rate})
+}
+
+// DELETE /exchange-rates/:id - remove an exchange rate
+func (h *ExchangeRateHandler) DeleteExchangeRate(c *gin.Context) {
+	rate, ok := h.findRate(c)
+	if !ok {
+		return
+	}
+	if err := h.DB.Delete(rate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete exchange rate"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "exchange rate deleted"})
+}
+
+// findRate loads the exchange rate of the :id path parameter, writing the error response when missing
+func (h *ExchangeRateHandler) findRate(c *gin.Context) (*models.ExchangeRate, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid exchange rate ID"})
+		return nil, false
+	}
+
+	var rate models.ExchangeRate
+	if err := h.DB.First(&rate, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": database.ErrExchangeRateNotFound.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch exchange rate"})
+		}
+		return nil, false
+	}
+	return &rate, true
+}
+
+// rateExists reports whether another rate is recorded for the pair on the same date
+func (h *ExchangeRateHandler) rateExists(rate models.ExchangeRate, exceptID uint) bool {
+	var count int64
+	h.DB.Model(&models.ExchangeRate{}).
+		Where("from_currency = ? AND to_currency = ? AND effective_date = ? AND rate_id <> ?",
+			rate.FromCurrency, rate.ToCurrency, rate.EffectiveDate.Format("2006-01-02"), exceptID).
+		Count(&count)
+	return count > 0
+}
+
+// truncateToDate drops the time of day, rates are effective per calendar day
+func truncateToDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
@@ -104,4 +104,65 @@ func (h *ImageHandler) DownloadItemImage(c *gin.Context) {
 
 	// Serve the file
 	c.File(imagePath)
-}
\ No newline at end of file
+}
+
+// UploadCompanyLogo stores the logo printed on the invoices a company sends
+func (h *ImageHandler) UploadCompanyLogo(c *gin.Context) {
+	companyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+		return
+	}
+
+	var company models.Company
+	if err := h.DB.First(&company, companyID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+		return
+	}
+
+	// Limit request body size
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, utils.MaxFileSize)
+
+	file, err := c.FormFile("logo")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Logo upload failed"})
+		return
+	}
+
+	if err := utils.ValidateImage(file); err != nil {
+		if err.Error() == "file exceeds 5MB limit" {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	filePath, err := utils.SaveCompanyLogo(c, file, uint(companyID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save logo"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Logo uploaded successfully",
+		"logo_path": filePath,
+	})
+}
+
+// DownloadCompanyLogo serves the current logo of a company
+func (h *ImageHandler) DownloadCompanyLogo(c *gin.Context) {
+	companyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+		return
+	}
+
+	logoPath, err := utils.GetCompanyLogoPath(uint(companyID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No logo found for company"})
+		return
+	}
+
+	c.File(logoPath)
+}
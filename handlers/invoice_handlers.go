@@ -1,11 +1,17 @@
 package handlers
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 	"strconv"
 	"invoice-go/database"
 	"invoice-go/models"
+	"invoice-go/money"
+	"invoice-go/render"
+	"invoice-go/utils"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
@@ -16,16 +22,39 @@ type InvoiceHandler struct {
 
 // InvoiceRequest is used for creating an invoice
 type InvoiceRequest struct {
-	SenderCompanyID    uint      `gorm:"type:int unsigned;column:sender_company_id;not null" json:"sender_company_id"`
+	SenderCompanyID    uint      `gorm:"type:int unsigned;column:sender_company_id;not null" json:"sender_company_id" binding:"required"`
 	RecipientCompanyID uint      `gorm:"type:int unsigned;column:recipient_company_id;not null;index" json:"recipient_company_id"`
 	BillingAddressID   uint      `gorm:"type:int unsigned;column:billing_address_id;not null" json:"billing_address_id"`
 	ShippingAddressID  *uint     `gorm:"type:int unsigned;column:shipping_address_id" json:"shipping_address_id,omitempty"`
 	OrderID            *uint     `gorm:"type:int unsigned;column:order_id" json:"order_id,omitempty"`
-	InvoiceNumber      string    `json:"invoice_number" binding:"required,min=1,max=50"`
+	InvoiceNumber      string    `json:"invoice_number" binding:"omitempty,max=50"` // allocated from the sender's series when omitted
 	InvoiceDate        time.Time `json:"invoice_date" binding:"required"`
 	DueDate            time.Time `json:"due_date" binding:"required"`
 	InvoiceSubject     *string    `json:"invoice_subject" binding:"max=200"`
 	Notes              *string    `json:"notes" binding:"max=500"`
+	Currency           string     `json:"currency" binding:"omitempty,iso4217"` // defaults to the base currency
+	TaxInclusive       *bool      `json:"tax_inclusive"` // unit prices include the sales taxes; defaults to false, kept on update
+	DiscountPercentage float64    `json:"discount_percentage" binding:"gte=0,lte=100"` // invoice discount, spread over the lines before tax
+	DiscountAmount     money.Amount `json:"discount_amount"`
+	Items              []InvoiceItemRequest `json:"items" binding:"dive"`
+}
+
+// InvoiceItemRequest is a single line of an invoice. A line either references a
+// catalog item (description and unit price default to the catalog values) or is
+// a free-text line with its own description and unit price. Tax codes default
+// to the tax rules; tax_rate_percentage only applies when no code is found.
+// Line discounts are taken off before the invoice discount and the taxes.
+type InvoiceItemRequest struct {
+	ItemID             *uint         `json:"item_id,omitempty"`
+	OrderItemID        *uint         `json:"order_item_id,omitempty"` // the order line it bills, on invoices of an order
+	Description        string        `json:"description" binding:"max=255"`
+	Quantity           float64       `json:"quantity" binding:"required,gt=0"`
+	UnitPrice          *money.Amount `json:"unit_price,omitempty"`
+	TaxRatePercentage  float64       `json:"tax_rate_percentage" binding:"gte=0,lte=100"`
+	TaxCode            *string       `json:"tax_code,omitempty" binding:"omitempty,max=20"`
+	WithholdingTaxCode *string       `json:"withholding_tax_code,omitempty" binding:"omitempty,max=20"`
+	DiscountPercentage float64       `json:"discount_percentage" binding:"gte=0,lte=100"`
+	DiscountAmount     money.Amount  `json:"discount_amount"` // off the line, on top of the percentage
 }
 
 type InvoiceReportResponse struct {
@@ -55,7 +84,15 @@ func (h *InvoiceHandler) CreateInvoice(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
         return
     }
-    // TODO: parse dates (invoice_date, due_date) properly – here we just set now
+    if input.DueDate.Before(input.InvoiceDate) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "due_date must not be before invoice_date"})
+        return
+    }
+    if input.DiscountAmount.IsNegative() {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "discount_amount must not be negative"})
+        return
+    }
+
     now := time.Now()
     inv := models.Invoice{
         SenderCompanyID:    input.SenderCompanyID,
@@ -64,37 +101,135 @@ func (h *InvoiceHandler) CreateInvoice(c *gin.Context) {
         ShippingAddressID:  input.ShippingAddressID,
         OrderID:            input.OrderID,
         InvoiceNumber:      input.InvoiceNumber,
-        InvoiceDate:        now,
-        DueDate:            now.AddDate(0, 0, 30),
+        InvoiceDate:        input.InvoiceDate,
+        DueDate:            input.DueDate,
         InvoiceSubject:     input.InvoiceSubject,
         Notes:              input.Notes,
-        Subtotal:           0,
-        TaxTotal:           0,
-        GrandTotal:         0,
-        AmountPaid:         0,
-        AmountDue:          0,
-        Status:             "unpaid",
+        Currency:           input.Currency,
+        TaxInclusive:       input.TaxInclusive != nil && *input.TaxInclusive,
+        DiscountPercentage: input.DiscountPercentage,
+        DiscountAmount:     input.DiscountAmount,
+        Status:             models.InvoiceStatusDraft,
         CreatedAt:          now,
         UpdatedAt:          now,
     }
 
-    if err := h.DB.Create(&inv).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create invoice"})
+    // 3. Persist header and line items together, totals are computed server side
+    err = h.DB.Transaction(func(tx *gorm.DB) error {
+        currency := input.Currency
+        if currency == "" {
+            currency = utils.BaseCurrency()
+        }
+        items, err := buildInvoiceItems(tx, input.Items, currency, input.InvoiceDate)
+        if err != nil {
+            return err
+        }
+        return database.CreateInvoiceWithItems(tx, &inv, items)
+    })
+    if err != nil {
+        writeInvoiceError(c, err, "failed to create invoice")
         return
     }
     c.JSON(http.StatusCreated, gin.H{"invoice": inv})
 }
 
+// invoiceLineError reports an invalid line in an invoice payload
+type invoiceLineError struct {
+    line int
+    msg  string
+}
+
+func (e *invoiceLineError) Error() string {
+    return fmt.Sprintf("items[%d]: %s", e.line, e.msg)
+}
+
+// buildInvoiceItems turns the requested lines into invoice items, filling in
+// description and unit price from the catalog when an item_id is given.
+// Catalog prices are converted into the invoice currency at the invoice date,
+// and into the invoice's tax inclusion once the line's tax rate is resolved.
+func buildInvoiceItems(tx *gorm.DB, lines []InvoiceItemRequest, currency string, date time.Time) ([]models.InvoiceItem, error) {
+    items := make([]models.InvoiceItem, 0, len(lines))
+    for i, line := range lines {
+        item := models.InvoiceItem{
+            ItemID:             line.ItemID,
+            OrderItemID:        line.OrderItemID,
+            Description:        line.Description,
+            Quantity:           line.Quantity,
+            TaxRatePercentage:  line.TaxRatePercentage,
+            TaxCode:            line.TaxCode,
+            WithholdingTaxCode: line.WithholdingTaxCode,
+            DiscountPercentage: line.DiscountPercentage,
+            DiscountAmount:     line.DiscountAmount,
+        }
+        if line.DiscountAmount.IsNegative() {
+            return nil, &invoiceLineError{line: i, msg: "discount_amount must not be negative"}
+        }
+
+        if line.ItemID != nil {
+            var catalogItem models.Item
+            if err := tx.First(&catalogItem, *line.ItemID).Error; err != nil {
+                if errors.Is(err, gorm.ErrRecordNotFound) {
+                    return nil, &invoiceLineError{line: i, msg: "item not found"}
+                }
+                return nil, err
+            }
+            if item.Description == "" {
+                item.Description = catalogItem.Name
+            }
+            if line.UnitPrice == nil {
+                price, err := database.ConvertAmount(tx, catalogItem.UnitPrice, catalogItem.Currency, currency, date)
+                if err != nil {
+                    return nil, err
+                }
+                item.UnitPrice = price
+                item.PriceTaxInclusive = &catalogItem.TaxInclusive
+            }
+        } else if item.Description == "" {
+            return nil, &invoiceLineError{line: i, msg: "description is required when item_id is omitted"}
+        } else if line.UnitPrice == nil {
+            return nil, &invoiceLineError{line: i, msg: "unit_price is required when item_id is omitted"}
+        }
+        if line.UnitPrice != nil && line.UnitPrice.IsNegative() {
+            return nil, &invoiceLineError{line: i, msg: "unit_price must not be negative"}
+        }
+
+        if line.UnitPrice != nil {
+            item.UnitPrice = *line.UnitPrice
+        }
+        items = append(items, item)
+    }
+    return items, nil
+}
+
 // GET /invoice/:id - filter invoices by status
-// GET /invoice/:id[?status=…] – fetch invoices filtered by status, or single by ID if no status
+// GET /invoice/:id[?status=…][&overdue=…] – fetch invoices filtered by status or overdue
+// bucket (current, 1-30, 31-60, 61-90, 90+), or single by ID if no filter
 func (h *InvoiceHandler) GetInvoices(c *gin.Context) {
     idStr := c.Param("id")
     status := c.Query("status")
+    bucket := c.Query("overdue")
 
-    // If status query is present, ignore the path‐ID and filter all invoices
-    if status != "" {
+    // If a filter is present, or no ID, ignore the path‐ID and filter all invoices
+    if status != "" || bucket != "" || idStr == "" {
+        q := h.DB.Order("invoice_id")
+        if status != "" {
+            q = q.Where("status = ?", models.NormalizeInvoiceStatus(status))
+        }
+        if bucket != "" {
+            minDays, maxDays, ok := models.AgingBucketRange(bucket)
+            if !ok {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "overdue must be one of current, 1-30, 31-60, 61-90, 90+"})
+                return
+            }
+            q = q.Where("amount_due > 0 AND status IN ? AND days_overdue >= ?", []string{
+                models.InvoiceStatusIssued, models.InvoiceStatusPartiallyPaid, models.InvoiceStatusOverdue,
+            }, minDays)
+            if maxDays >= 0 {
+                q = q.Where("days_overdue <= ?", maxDays)
+            }
+        }
         var list []models.Invoice
-        if err := h.DB.Where("status = ?", status).Find(&list).Error; err != nil {
+        if err := q.Find(&list).Error; err != nil {
             c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch invoices"})
             return
         }
@@ -128,7 +263,7 @@ func (h *InvoiceHandler) GetInvoiceDetails(c *gin.Context) {
     // If status query is present, ignore the path‐ID and filter all invoices
     if status != "" {
         var list []models.Invoice
-        if err := h.DB.Where("status = ?", status).Find(&list).Error; err != nil {
+        if err := h.DB.Where("status = ?", models.NormalizeInvoiceStatus(status)).Find(&list).Error; err != nil {
             c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch invoices"})
             return
         }
@@ -159,7 +294,7 @@ func (h *InvoiceHandler) GetInvoiceReports (c *gin.Context) {
     // If status query is present, ignore the path‐ID and filter all invoices
     if status != "" {
         var list []models.Invoice
-        if err := h.DB.Where("status = ?", status).Find(&list).Error; err != nil {
+        if err := h.DB.Where("status = ?", models.NormalizeInvoiceStatus(status)).Find(&list).Error; err != nil {
             c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch invoices"})
             return
         }
@@ -183,6 +318,73 @@ func (h *InvoiceHandler) GetInvoiceReports (c *gin.Context) {
     c.JSON(http.StatusOK, report)
 }
 
+// loadInvoiceDocument fetches the report of the :id invoice and the active
+// template of its sender, writing the error response on failure
+func (h *InvoiceHandler) loadInvoiceDocument(c *gin.Context) (*models.InvoiceReportResponse, *models.InvoiceTemplate, bool) {
+    invID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invoice ID"})
+        return nil, nil, false
+    }
+
+    report, err := database.GenerateInvoiceReport(h.DB, uint(invID))
+    if err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            c.JSON(http.StatusNotFound, gin.H{"error": "invoice not found"})
+        } else {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate invoice reports"})
+        }
+        return nil, nil, false
+    }
+
+    tmpl, err := database.GetActiveInvoiceTemplate(h.DB, report.Invoice.SenderCompanyID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch invoice template"})
+        return nil, nil, false
+    }
+    return report, tmpl, true
+}
+
+// GET /invoice/:id/html - render the invoice with the sender's active template
+func (h *InvoiceHandler) GetInvoiceHTML(c *gin.Context) {
+    report, tmpl, ok := h.loadInvoiceDocument(c)
+    if !ok {
+        return
+    }
+
+    source := ""
+    if tmpl != nil {
+        source = tmpl.Body
+    }
+    var buf bytes.Buffer
+    if err := render.InvoiceHTML(&buf, report, source, render.LayoutFromTemplate(tmpl), companyLogoURL(report.Invoice.SenderCompanyID)); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render invoice"})
+        return
+    }
+    c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// GET /invoice/:id/pdf - render the invoice as a PDF document
+func (h *InvoiceHandler) GetInvoicePDF(c *gin.Context) {
+    report, tmpl, ok := h.loadInvoiceDocument(c)
+    if !ok {
+        return
+    }
+
+    // The logo is optional; invoices of senders without one are rendered without it
+    logoPath, _ := utils.GetCompanyLogoPath(report.Invoice.SenderCompanyID)
+
+    var buf bytes.Buffer
+    if err := render.InvoicePDF(&buf, report, logoPath, render.LayoutFromTemplate(tmpl)); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render invoice PDF"})
+        return
+    }
+
+    filename := fmt.Sprintf("invoice-%s.pdf", report.Invoice.InvoiceNumber)
+    c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+    c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
 // handlers/invoice_handlers.go
 
 func (h *InvoiceHandler) GetInvoiceStatus(c *gin.Context) {
@@ -209,7 +411,7 @@ func (h *InvoiceHandler) GetInvoiceStatus(c *gin.Context) {
 }
 
 
-// PUT /invoice/:id/status – update only the invoice status
+// PATCH /invoice/:id/status – move the invoice along its lifecycle
 func (h *InvoiceHandler) UpdateInvoiceStatus(c *gin.Context) {
     invID, err := strconv.ParseUint(c.Param("id"), 10, 64)
     if err != nil {
@@ -227,28 +429,105 @@ func (h *InvoiceHandler) UpdateInvoiceStatus(c *gin.Context) {
 
     var updated models.Invoice
     err = h.DB.Transaction(func(tx *gorm.DB) error {
-        res := tx.Model(&models.Invoice{}).
-            Where("invoice_id = ?", invID).
-            Updates(map[string]interface{}{
-                "status":     payload.Status,
-                "updated_at": time.Now(),
-            })
-        if res.Error != nil {
-            return res.Error
-        }
-        if res.RowsAffected == 0 {
-            return gorm.ErrRecordNotFound
+        if _, err := database.TransitionInvoiceStatus(tx, uint(invID), payload.Status); err != nil {
+            return err
         }
         return tx.First(&updated, invID).Error
     })
     if err != nil {
-        if err == gorm.ErrRecordNotFound {
-            c.JSON(http.StatusNotFound, gin.H{"error": "invoice not found"})
-        } else {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update invoice status"})
+        writeInvoiceError(c, err, "failed to update invoice status")
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"invoice": updated})
+}
+
+// PUT /invoice/:id – replace the header and line items of a draft invoice
+func (h *InvoiceHandler) UpdateInvoice(c *gin.Context) {
+    invID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invoice ID"})
+        return
+    }
+
+    var input InvoiceRequest
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+        return
+    }
+    if input.DueDate.Before(input.InvoiceDate) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "due_date must not be before invoice_date"})
+        return
+    }
+    if input.DiscountAmount.IsNegative() {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "discount_amount must not be negative"})
+        return
+    }
+
+    header := models.Invoice{
+        SenderCompanyID:    input.SenderCompanyID,
+        RecipientCompanyID: input.RecipientCompanyID,
+        BillingAddressID:   input.BillingAddressID,
+        ShippingAddressID:  input.ShippingAddressID,
+        OrderID:            input.OrderID,
+        InvoiceNumber:      input.InvoiceNumber,
+        InvoiceDate:        input.InvoiceDate,
+        DueDate:            input.DueDate,
+        InvoiceSubject:     input.InvoiceSubject,
+        Notes:              input.Notes,
+        Currency:           input.Currency,
+        DiscountPercentage: input.DiscountPercentage,
+        DiscountAmount:     input.DiscountAmount,
+    }
+
+    var updated *models.Invoice
+    err = h.DB.Transaction(func(tx *gorm.DB) error {
+        // Without a currency or tax inclusion in the payload the invoice keeps its own
+        var existing models.Invoice
+        if err := tx.Select("invoice_id", "currency", "tax_inclusive").First(&existing, invID).Error; err != nil {
+            return err
+        }
+        currency := input.Currency
+        if currency == "" {
+            currency = existing.Currency
+        }
+        header.TaxInclusive = existing.TaxInclusive
+        if input.TaxInclusive != nil {
+            header.TaxInclusive = *input.TaxInclusive
         }
+        items, err := buildInvoiceItems(tx, input.Items, currency, input.InvoiceDate)
+        if err != nil {
+            return err
+        }
+        updated, err = database.UpdateDraftInvoice(tx, uint(invID), header, items)
+        return err
+    })
+    if err != nil {
+        writeInvoiceError(c, err, "failed to update invoice")
         return
     }
 
     c.JSON(http.StatusOK, gin.H{"invoice": updated})
 }
+
+// writeInvoiceError maps invoice domain errors onto HTTP responses
+func writeInvoiceError(c *gin.Context, err error, fallback string) {
+    var lineErr *invoiceLineError
+    switch {
+    case errors.As(err, &lineErr):
+        c.JSON(http.StatusBadRequest, gin.H{"error": lineErr.Error()})
+    case errors.Is(err, database.ErrInvoiceNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+        c.JSON(http.StatusNotFound, gin.H{"error": "invoice not found"})
+    case errors.Is(err, database.ErrUnknownInvoiceStatus), errors.Is(err, database.ErrNoExchangeRate),
+        errors.Is(err, database.ErrTaxCodeNotEffective), errors.Is(err, database.ErrTaxCodeKind):
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    case errors.Is(err, database.ErrOrderNotFound), errors.Is(err, database.ErrOrderItemNotFound),
+        errors.Is(err, database.ErrSenderCompanyNotFound):
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    case errors.Is(err, database.ErrIllegalStatusTransition), errors.Is(err, database.ErrInvoiceLocked),
+        errors.Is(err, database.ErrOverInvoicing), errors.Is(err, database.ErrDuplicateInvoiceNumber):
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+    }
+}
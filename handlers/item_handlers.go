@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"invoice-go/models"
+	"invoice-go/money"
 	"invoice-go/utils"
 	"net/http"
 	"strconv"
@@ -16,14 +17,18 @@ type ItemHandler struct {
 type CreateItemInput struct {
 	Name        	string  `json:"name" binding:"required"`
 	Description 	string  `json:"description"`
-	UnitPrice       float64 `json:"unit_price" binding:"required,gte=0"`
+	UnitPrice       *money.Amount `json:"unit_price" binding:"required"`
+	Currency        string  `json:"currency" binding:"omitempty,iso4217"` // defaults to the base currency
+	TaxInclusive    bool    `json:"tax_inclusive"` // unit_price includes the sales tax
 	Type    		string  `json:"type" binding:"required"`
 }
 
 type UpdateItemInput struct {
 	Name        	string  `json:"name"`
 	Description 	string  `json:"description"`
-	UnitPrice       float64 `json:"unit_price" binding:"omitempty,gte=0"`
+	UnitPrice       *money.Amount `json:"unit_price"`
+	Currency        string  `json:"currency" binding:"omitempty,iso4217"`
+	TaxInclusive    *bool   `json:"tax_inclusive"`
 	Type    		string  `json:"type"`
 }
 
@@ -79,6 +84,10 @@ func (h *ItemHandler) CreateItem(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if input.UnitPrice.IsNegative() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unit_price must not be negative"})
+		return
+	}
 
 	/** Validate type
 	if !isValidType(input.Type) {
@@ -90,9 +99,14 @@ func (h *ItemHandler) CreateItem(c *gin.Context) {
 	item := models.Item{
 		Name:        		input.Name,
 		Description: 		input.Description,
-		UnitPrice:       	input.UnitPrice,
+		UnitPrice:       	*input.UnitPrice,
+		Currency:           input.Currency,
+		TaxInclusive:       input.TaxInclusive,
 		Type:    			input.Type,
 	}
+	if item.Currency == "" {
+		item.Currency = utils.BaseCurrency()
+	}
 
 	result := h.DB.Create(&item)
 	if result.Error != nil {
@@ -130,8 +144,20 @@ func (h *ItemHandler) UpdateItem(c *gin.Context) {
 		updates["description"] = input.Description
 	}
 	
-	if input.UnitPrice != 0 {
-		updates["unit_price"] = input.UnitPrice
+	if input.UnitPrice != nil {
+		if input.UnitPrice.IsNegative() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unit_price must not be negative"})
+			return
+		}
+		updates["unit_price"] = *input.UnitPrice
+	}
+
+	if input.Currency != "" {
+		updates["currency"] = input.Currency
+	}
+
+	if input.TaxInclusive != nil {
+		updates["tax_inclusive"] = *input.TaxInclusive
 	}
 	
 	if input.Type != "" {
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"errors"
+	"invoice-go/database"
+	"invoice-go/models"
+	"invoice-go/money"
+	"invoice-go/utils"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// LateFeeHandler manages the late fee policies of sender companies and the
+// late charges added to invoices
+type LateFeeHandler struct {
+	DB *gorm.DB
+}
+
+// LateFeePolicyInput is used for setting the late fee policy of a company
+type LateFeePolicyInput struct {
+	FlatFee            money.Amount  `json:"flat_fee"`
+	InterestPercentage float64       `json:"interest_percentage" binding:"gte=0,lte=100"` // per period, of the amount due
+	PeriodDays         *int          `json:"period_days"`                                 // defaults to 30
+	GraceDays          int           `json:"grace_days" binding:"gte=0"`
+	MaxAmount          *money.Amount `json:"max_amount"`                           // cap on the late charges of one invoice
+	Currency           string        `json:"currency" binding:"omitempty,iso4217"` // of flat_fee and max_amount, defaults to the base currency
+	Method             string        `json:"method"`                               // line_item or fee_invoice (default)
+	IsActive           *bool         `json:"is_active"`                            // defaults to true
+}
+
+// GET /companies/:id/late-fee-policy - show the late fee policy of a sender company
+func (h *LateFeeHandler) GetLateFeePolicy(c *gin.Context) {
+	company, ok := h.findCompany(c)
+	if !ok {
+		return
+	}
+
+	policy, err := database.GetLateFeePolicy(h.DB, company.CompanyID)
+	if err != nil {
+		writeLateFeePolicyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"late_fee_policy": policy})
+}
+
+// PUT /companies/:id/late-fee-policy - create or replace the late fee policy of a
+// sender company. Charges already added are kept.
+func (h *LateFeeHandler) SetLateFeePolicy(c *gin.Context) {
+	company, ok := h.findCompany(c)
+	if !ok {
+		return
+	}
+
+	var input LateFeePolicyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	policy, message := lateFeePolicyFromInput(company.CompanyID, input)
+	if message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return
+	}
+
+	status := http.StatusOK
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		existing, err := database.GetLateFeePolicy(tx, company.CompanyID)
+		switch {
+		case errors.Is(err, database.ErrLateFeePolicyNotFound):
+			status = http.StatusCreated
+			if err := tx.Create(&policy).Error; err != nil {
+				return err
+			}
+			// is_active defaults to true in the table, so a false value is not inserted
+			if !policy.IsActive {
+				return tx.Model(&policy).Update("is_active", false).Error
+			}
+			return nil
+		case err != nil:
+			return err
+		}
+		policy.LateFeePolicyID = existing.LateFeePolicyID
+		policy.CreatedAt = existing.CreatedAt
+		return tx.Save(&policy).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save late fee policy"})
+		return
+	}
+	c.JSON(status, gin.H{"late_fee_policy": policy})
+}
+
+// DELETE /companies/:id/late-fee-policy - stop charging late fees for a sender
+// company. Charges already added are kept.
+func (h *LateFeeHandler) DeleteLateFeePolicy(c *gin.Context) {
+	company, ok := h.findCompany(c)
+	if !ok {
+		return
+	}
+
+	policy, err := database.GetLateFeePolicy(h.DB, company.CompanyID)
+	if err != nil {
+		writeLateFeePolicyError(c, err)
+		return
+	}
+	if err := h.DB.Delete(policy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete late fee policy"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "late fee policy deleted"})
+}
+
+// GET /invoice/:id/late-fees - list the late charges added to an invoice, with
+// their calculation
+func (h *LateFeeHandler) GetInvoiceLateFees(c *gin.Context) {
+	invoiceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invoice ID"})
+		return
+	}
+
+	var invoice models.Invoice
+	if err := h.DB.First(&invoice, invoiceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch invoice"})
+		}
+		return
+	}
+
+	charges, err := database.GetLateFeeCharges(h.DB, invoice.InvoiceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch late fee charges"})
+		return
+	}
+	total := money.Zero()
+	for _, charge := range charges {
+		total = total.Add(charge.Amount)
+	}
+	c.JSON(http.StatusOK, gin.H{"late_fees": charges, "total": total, "currency": invoice.Currency})
+}
+
+// lateFeePolicyFromInput validates a late fee policy payload and builds the
+// policy of a company, returning the error message when invalid
+func lateFeePolicyFromInput(companyID uint, input LateFeePolicyInput) (models.LateFeePolicy, string) {
+	method := strings.ToLower(strings.TrimSpace(input.Method))
+	if method == "" {
+		method = models.LateFeeMethodFeeInvoice
+	}
+	periodDays := 30
+	if input.PeriodDays != nil {
+		periodDays = *input.PeriodDays
+	}
+	switch {
+	case method != models.LateFeeMethodLineItem && method != models.LateFeeMethodFeeInvoice:
+		return models.LateFeePolicy{}, "method must be one of line_item, fee_invoice"
+	case periodDays <= 0:
+		return models.LateFeePolicy{}, "period_days must be greater than zero"
+	case input.FlatFee.IsNegative():
+		return models.LateFeePolicy{}, "flat_fee must not be negative"
+	case input.MaxAmount != nil && input.MaxAmount.IsNegative():
+		return models.LateFeePolicy{}, "max_amount must not be negative"
+	case input.FlatFee.IsZero() && input.InterestPercentage == 0:
+		return models.LateFeePolicy{}, "flat_fee or interest_percentage must be set"
+	}
+
+	currency := utils.NormalizeCurrency(input.Currency)
+	if currency == "" {
+		currency = utils.BaseCurrency()
+	}
+	isActive := true
+	if input.IsActive != nil {
+		isActive = *input.IsActive
+	}
+	return models.LateFeePolicy{
+		CompanyID:          companyID,
+		FlatFee:            input.FlatFee,
+		InterestPercentage: input.InterestPercentage,
+		PeriodDays:         periodDays,
+		GraceDays:          input.GraceDays,
+		MaxAmount:          input.MaxAmount,
+		Currency:           currency,
+		Method:             method,
+		IsActive:           isActive,
+	}, ""
+}
+
+// writeLateFeePolicyError maps a late fee policy lookup error to its response
+func writeLateFeePolicyError(c *gin.Context, err error) {
+	if errors.Is(err, database.ErrLateFeePolicyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch late fee policy"})
+}
+
+// findCompany loads the company of the :id path parameter, writing the error response when missing
+func (h *LateFeeHandler) findCompany(c *gin.Context) (*models.Company, bool) {
+	companyID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+		return nil, false
+	}
+
+	var company models.Company
+	if err := h.DB.First(&company, companyID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+		return nil, false
+	}
+	return &company, true
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"invoice-go/database"
+	"invoice-go/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// NumberingHandler manages the document number series of sender companies
+type NumberingHandler struct {
+	DB *gorm.DB
+}
+
+// NumberSeriesInput is used for configuring a number series
+type NumberSeriesInput struct {
+	Prefix      string `json:"prefix" binding:"max=20"`
+	Pattern     string `json:"pattern" binding:"required,max=100"`
+	Padding     int    `json:"padding" binding:"omitempty,gte=1,lte=12"`
+	ResetYearly bool   `json:"reset_yearly"`
+	NextValue   int64  `json:"next_value" binding:"gte=0"`
+}
+
+// GetNumberSeries lists the number series of a company
+func (h *NumberingHandler) GetNumberSeries(c *gin.Context) {
+	companyID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+		return
+	}
+
+	series, err := database.GetNumberSeries(h.DB, uint(companyID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve number series"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"series": series})
+}
+
+// ConfigureNumberSeries creates or updates the number series of a company for a document type
+func (h *NumberingHandler) ConfigureNumberSeries(c *gin.Context) {
+	companyID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+		return
+	}
+	documentType := c.Param("type")
+	if !models.IsDocumentType(documentType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown document type"})
+		return
+	}
+
+	var input NumberSeriesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Padding == 0 {
+		input.Padding = 4
+	}
+
+	var company models.Company
+	if err := h.DB.First(&company, companyID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+		return
+	}
+
+	var series *models.DocumentNumberSeries
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		series, err = database.ConfigureNumberSeries(tx, company.CompanyID, documentType, models.DocumentNumberSeries{
+			Prefix:      input.Prefix,
+			Pattern:     input.Pattern,
+			Padding:     input.Padding,
+			ResetYearly: input.ResetYearly,
+			NextValue:   input.NextValue,
+		})
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrInvalidNumberPattern):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, database.ErrSeriesRewind):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update number series"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"errors"
+	"invoice-go/database"
 	"invoice-go/models"
+	"invoice-go/money"
+	"invoice-go/utils"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -15,13 +21,38 @@ type OrderHandler struct {
 }
 
 type OrderItemInput struct {
-	ItemID   uint    `json:"item_id" binding:"required"`
-	Quantity float64 `json:"quantity" binding:"required,gt=0"`
+	ItemID             uint          `json:"item_id" binding:"required"`
+	Quantity           float64       `json:"quantity" binding:"required,gt=0"`
+	DiscountPercentage float64       `json:"discount_percentage" binding:"gte=0,lte=100"`
+	DiscountAmount     *money.Amount `json:"discount_amount,omitempty"` // off the line, on top of the percentage
 }
 
 type CreateOrderInput struct {
 	CustomerCompanyID uint             `json:"customer_company_id" binding:"required"`
-	Items             []OrderItemInput `json:"items" binding:"required,min=1"`
+	Currency          string           `json:"currency" binding:"omitempty,iso4217"` // defaults to the base currency
+	DiscountCode      *string          `json:"discount_code,omitempty" binding:"omitempty,max=50"`
+	Items             []OrderItemInput `json:"items" binding:"required,min=1,dive"`
+}
+
+// CreateOrderInvoiceInput is used for generating an invoice from an order
+type CreateOrderInvoiceInput struct {
+	SenderCompanyID   *uint      `json:"sender_company_id"`
+	InvoiceNumber     string     `json:"invoice_number" binding:"max=50"`
+	InvoiceDate       *time.Time `json:"invoice_date"`
+	DueDate           *time.Time `json:"due_date"`
+	InvoiceSubject    *string    `json:"invoice_subject" binding:"omitempty,max=200"`
+	Notes             *string    `json:"notes" binding:"omitempty,max=500"`
+	TaxRatePercentage float64    `json:"tax_rate_percentage" binding:"gte=0,lte=100"`
+	Partial           bool       `json:"partial"`
+	// Optional split: either explicit order lines or a percentage of every line
+	Lines      []OrderInvoiceLineInput `json:"lines" binding:"omitempty,dive"`
+	Percentage float64                 `json:"percentage" binding:"gte=0,lte=100"`
+}
+
+// OrderInvoiceLineInput selects a quantity of an order line for a partial invoice
+type OrderInvoiceLineInput struct {
+	OrderItemID uint    `json:"order_item_id" binding:"required"`
+	Quantity    float64 `json:"quantity" binding:"required,gt=0"`
 }
 
 // GetOrders retrieves all orders with their items and company details
@@ -50,6 +81,12 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
 	}
+
+	// Report invoiced versus remaining amounts per line
+	if err := database.LoadOrderInvoicing(h.DB, &order); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load invoicing progress"})
+		return
+	}
 	c.JSON(http.StatusOK, order)
 }
 
@@ -76,7 +113,13 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		return
 	}
 
-	var totalPrice float64
+	currency := input.Currency
+	if currency == "" {
+		currency = utils.BaseCurrency()
+	}
+	orderDate := time.Now()
+
+	totalPrice := money.Zero()
 	var orderItems []models.OrderItem
 
 	// Process each order item
@@ -102,27 +145,69 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 			return
 		}
 
-		// Calculate item total
-		itemTotal := item.UnitPrice * itemInput.Quantity
-		totalPrice += itemTotal
+		// Price the item in the order currency
+		unitPrice, err := database.ConvertAmount(tx, item.UnitPrice, item.Currency, currency, orderDate)
+		if err != nil {
+			tx.Rollback()
+			if errors.Is(err, database.ErrNoExchangeRate) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert item price"})
+			}
+			return
+		}
+
+		// Calculate item total, net of the line discount
+		discountAmount := money.Zero()
+		if itemInput.DiscountAmount != nil {
+			if itemInput.DiscountAmount.IsNegative() {
+				tx.Rollback()
+				c.JSON(http.StatusBadRequest, gin.H{"error": "discount_amount must not be negative"})
+				return
+			}
+			discountAmount = *itemInput.DiscountAmount
+		}
+		amount := unitPrice.Mul(itemInput.Quantity).Round(currency)
+		discount := utils.ApplyDiscount(amount, itemInput.DiscountPercentage, discountAmount, currency)
+		itemTotal := amount.Sub(discount)
+		totalPrice = totalPrice.Add(itemTotal)
 
 		orderItems = append(orderItems, models.OrderItem{
-			ItemID:    itemInput.ItemID,
-			Quantity:  itemInput.Quantity,
-			UnitPrice: item.UnitPrice,
-			ItemTotal: itemTotal,
+			ItemID:             itemInput.ItemID,
+			Quantity:           itemInput.Quantity,
+			UnitPrice:          unitPrice,
+			DiscountPercentage: itemInput.DiscountPercentage,
+			DiscountAmount:     discountAmount,
+			Discount:           discount,
+			ItemTotal:          itemTotal,
 		})
 	}
 
 	// Create order
 	order := models.Order{
 		CustomerCompanyID: input.CustomerCompanyID,
-		OrderDate:         time.Now(),
-		TotalPrice:        &totalPrice,
+		OrderDate:         orderDate,
+		Currency:          currency,
 		Status:            "pending",
 		OrderItems:        orderItems,
 	}
 
+	// Redeem the promo code, its discount applies to the line totals
+	if input.DiscountCode != nil && *input.DiscountCode != "" {
+		discountCode, amount, err := database.RedeemDiscountCode(tx, *input.DiscountCode, currency, orderDate)
+		if err != nil {
+			tx.Rollback()
+			writeDiscountCodeError(c, err)
+			return
+		}
+		order.DiscountCode = &discountCode.Code
+		order.DiscountPercentage = discountCode.DiscountPercentage
+		order.DiscountAmount = amount
+		order.Discount = utils.ApplyDiscount(totalPrice, order.DiscountPercentage, order.DiscountAmount, currency)
+		totalPrice = totalPrice.Sub(order.Discount)
+	}
+	order.TotalPrice = &totalPrice
+
 	if err := tx.Create(&order).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
@@ -156,4 +241,71 @@ func (h *OrderHandler) GetRevenueByType(c *gin.Context) {
 	}
 	
 	c.JSON(http.StatusOK, results)
-}
\ No newline at end of file
+}
+
+// CreateOrderInvoice generates an invoice from an existing order
+func (h *OrderHandler) CreateOrderInvoice(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	// The body is optional, every field has a sensible default
+	var input CreateOrderInvoiceInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts := database.OrderInvoiceOptions{
+		SenderCompanyID:   input.SenderCompanyID,
+		InvoiceNumber:     input.InvoiceNumber,
+		InvoiceSubject:    input.InvoiceSubject,
+		Notes:             input.Notes,
+		TaxRatePercentage: input.TaxRatePercentage,
+		Partial:           input.Partial,
+		Percentage:        input.Percentage,
+	}
+	for _, line := range input.Lines {
+		opts.Lines = append(opts.Lines, database.OrderInvoiceLine{
+			OrderItemID: line.OrderItemID,
+			Quantity:    line.Quantity,
+		})
+	}
+	if input.InvoiceDate != nil {
+		opts.InvoiceDate = *input.InvoiceDate
+	}
+	if input.DueDate != nil {
+		opts.DueDate = *input.DueDate
+	}
+
+	var invoice *models.Invoice
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		invoice, err = database.InvoiceOrder(tx, uint(orderID), opts)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		case errors.Is(err, database.ErrOrderAlreadyInvoiced),
+			errors.Is(err, database.ErrOrderFullyInvoiced),
+			errors.Is(err, database.ErrOverInvoicing),
+			errors.Is(err, database.ErrDuplicateInvoiceNumber):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, database.ErrSenderCompanyRequired),
+			errors.Is(err, database.ErrOrderItemNotFound),
+			errors.Is(err, database.ErrInvalidInvoiceSplit),
+			errors.Is(err, database.ErrSenderCompanyNotFound),
+			errors.Is(err, database.ErrMissingBillingAddress):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invoice"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"invoice": invoice})
+}
@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
+	"invoice-go/database"
 	"invoice-go/models"
+	"invoice-go/money"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
@@ -17,11 +20,20 @@ type PaymentHandler struct {
 type PaymentRequest struct {
 	InvoiceID           	uint      	`json:"invoice_id" binding:"required"`
 	PaymentDate         	time.Time 	`json:"payment_date" binding:"required"`
-	Amount              	float64   	`json:"amount" binding:"required,min=0.01"`
+	Amount              	money.Amount	`json:"amount"` // must be positive
 	Method              	string    	`json:"method" binding:"required,min=1,max=50"`
 	TransactionReference 	string    	`json:"transaction_reference" binding:"max=100"`
 }
 
+// PaymentReversalRequest is used for refunding or charging back a payment
+type PaymentReversalRequest struct {
+	Amount               *money.Amount `json:"amount"` // defaults to what is left to reverse on the payment
+	Reason               string        `json:"reason" binding:"required,max=255"`
+	Date                 *time.Time    `json:"date"`                               // defaults to now
+	Method               *string       `json:"method" binding:"omitempty,max=50"` // defaults to the method of the payment
+	TransactionReference *string       `json:"transaction_reference" binding:"omitempty,max=255"`
+}
+
 
 // POST /payment/:id – record a new payment
 func (h *PaymentHandler) CreatePayment(c *gin.Context) {
@@ -34,39 +46,104 @@ func (h *PaymentHandler) CreatePayment(c *gin.Context) {
 
     // 2. Bind and validate JSON payload
     var input struct {
-        Amount  float64 `json:"amount" binding:"required"`
+        Amount  money.Amount `json:"amount"`
         Method  string  `json:"method"  binding:"required"`
         Status  string  `json:"status"  binding:"required"`
         Ref     *string `json:"transaction_reference"`
+        Currency string `json:"currency" binding:"omitempty,iso4217"` // must match the invoice currency
+        WithholdingAmount  money.Amount `json:"withholding_amount"` // tax withheld by the customer on top of amount
+        WithholdingTaxCode *string      `json:"withholding_tax_code" binding:"omitempty,max=20"`
+        CertificateNumber  *string      `json:"certificate_number" binding:"omitempty,max=100"`
+        CertificateDate    *time.Time   `json:"certificate_date"`
     }
     if err := c.ShouldBindJSON(&input); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
         return
     }
-    if input.Amount <= 0 {
+    if input.Amount.IsNegative() || input.WithholdingAmount.IsNegative() {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "amount and withholding_amount must not be negative"})
+        return
+    }
+    if !input.Amount.Add(input.WithholdingAmount).IsPositive() {
         c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive"})
         return
     }
+    status := models.NormalizePaymentStatus(input.Status)
+    if status == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": database.ErrPaymentStatus.Error()})
+        return
+    }
+    if input.CertificateNumber != nil && *input.CertificateNumber != "" && !input.WithholdingAmount.IsPositive() {
+        c.JSON(http.StatusBadRequest, gin.H{"error": database.ErrNoWithholding.Error()})
+        return
+    }
 
-    // 3. Build the model
+    // 3. Payments are only accepted on issued, unsettled invoices
+    var invoice models.Invoice
+    if err := h.DB.First(&invoice, invoiceID).Error; err != nil {
+        if err == gorm.ErrRecordNotFound {
+            c.JSON(http.StatusNotFound, gin.H{"error": "invoice not found"})
+        } else {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch invoice"})
+        }
+        return
+    }
+    if !models.InvoiceAcceptsPayments(invoice.Status) {
+        c.JSON(http.StatusConflict, gin.H{"error": "invoice does not accept payments in status " + invoice.Status})
+        return
+    }
+    if input.Currency != "" && input.Currency != invoice.Currency {
+        c.JSON(http.StatusBadRequest, gin.H{"error": database.ErrCurrencyMismatch.Error() + " " + invoice.Currency})
+        return
+    }
+
+    // 4. Build the model, the withheld tax is recorded apart from the cash
     payment := models.Payment{
         InvoiceID:           	uint(invoiceID),
         PaymentDate:         	time.Now(),
-        Amount:              	input.Amount,
+        Amount:              	input.Amount.Round(invoice.Currency),
+        WithholdingAmount:   	input.WithholdingAmount.Round(invoice.Currency),
+        Currency:            	invoice.Currency,
         Method:              	&input.Method,
-        Status:              	input.Status,
+        Status:              	status,
+        Type:                	models.PaymentTypePayment,
         TransactionReference: 	input.Ref,
         CreatedAt:           	time.Now(),
     }
+    if payment.WithholdingAmount.IsPositive() {
+        code, err := database.PaymentWithholdingTaxCode(h.DB, invoice.InvoiceID, input.WithholdingTaxCode, payment.PaymentDate)
+        if err != nil {
+            if errors.Is(err, database.ErrTaxCodeNotEffective) || errors.Is(err, database.ErrTaxCodeKind) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            } else {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch withholding tax code"})
+            }
+            return
+        }
+        payment.WithholdingTaxCode = code
+        if input.CertificateNumber != nil && *input.CertificateNumber != "" {
+            payment.CertificateNumber = input.CertificateNumber
+            payment.CertificateDate = input.CertificateDate
+            if payment.CertificateDate == nil {
+                payment.CertificateDate = &payment.PaymentDate
+            }
+        }
+    }
 
-    // 4. Persist to DB
-    if err := h.DB.Create(&payment).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record payment"})
+    // 5. Persist to DB along with the new invoice balance
+    err = h.DB.Transaction(func(tx *gorm.DB) error {
+        if err := database.RecordPayment(tx, &payment); err != nil {
+            return err
+        }
+        return tx.First(&invoice, invoiceID).Error
+    })
+    if err != nil {
+        writePaymentError(c, err, "failed to record payment")
         return
     }
 
-    // 5. Return success
-    c.JSON(http.StatusCreated, gin.H{"payment": payment})
+    // 6. Return success
+    c.JSON(http.StatusCreated, gin.H{"payment": payment, "invoice": invoice})
 }
 
 // GET /payment/:id[?status=…] – list payments for an invoice, optionally filtering by status
@@ -85,7 +162,7 @@ func (h *PaymentHandler) GetPayments(c *gin.Context) {
     var payments []models.Payment
     q := h.DB.Where("invoice_id = ?", invoiceID)
     if status != "" {
-        q = q.Where("status = ?", status)
+        q = q.Where("status = ?", models.NormalizePaymentStatus(status))
     }
     if err := q.Find(&payments).Error; err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch payments"})
@@ -116,8 +193,15 @@ func (h *PaymentHandler) GetPaymentDetails(c *gin.Context) {
         return
     }
 
-    // 3. Return detail
-    c.JSON(http.StatusOK, gin.H{"payment": payment})
+    // 3. Add the refunds and chargebacks of the payment
+    reversals, err := database.GetPaymentReversals(h.DB, payment.PaymentID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch payment reversals"})
+        return
+    }
+
+    // 4. Return detail
+    c.JSON(http.StatusOK, gin.H{"payment": payment, "reversals": reversals})
 }
 
 // GET /payment/:id/details – fetch one payment by its ID
@@ -145,7 +229,104 @@ func (h *PaymentHandler) GetPaymentStatus(c *gin.Context) {
 }
 
 
-// PUT /payment/:id/status - update payment status
+// PUT /payment/:id/certificate – record the withholding certificate of a payment
+func (h *PaymentHandler) RecordWithholdingCertificate(c *gin.Context) {
+    // 1. Parse payment ID
+    paymentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payment ID"})
+        return
+    }
+
+    // 2. Bind certificate reference, dated today when omitted
+    var payload struct {
+        CertificateNumber string     `json:"certificate_number" binding:"required,max=100"`
+        CertificateDate   *time.Time `json:"certificate_date"`
+    }
+    if err := c.ShouldBindJSON(&payload); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "certificate_number is required"})
+        return
+    }
+    date := time.Now()
+    if payload.CertificateDate != nil {
+        date = *payload.CertificateDate
+    }
+
+    // 3. Record
+    payment, err := database.RecordWithholdingCertificate(h.DB, uint(paymentID), payload.CertificateNumber, date)
+    if err != nil {
+        switch {
+        case errors.Is(err, database.ErrPaymentNotFound):
+            c.JSON(http.StatusNotFound, gin.H{"error": "payment not found"})
+        case errors.Is(err, database.ErrNoWithholding):
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        default:
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record certificate"})
+        }
+        return
+    }
+
+    // 4. Return updated resource
+    c.JSON(http.StatusOK, gin.H{"payment": payment})
+}
+
+// POST /payment/:id/refund – refund part or all of a payment
+func (h *PaymentHandler) RefundPayment(c *gin.Context) {
+    h.reversePayment(c, models.PaymentTypeRefund)
+}
+
+// POST /payment/:id/chargeback – record a chargeback of part or all of a payment
+func (h *PaymentHandler) ChargebackPayment(c *gin.Context) {
+    h.reversePayment(c, models.PaymentTypeChargeback)
+}
+
+// reversePayment records a refund or chargeback as a negative payment linked
+// to the original and recomputes the invoice balance in the same transaction
+func (h *PaymentHandler) reversePayment(c *gin.Context, reversalType string) {
+    // 1. Parse payment ID
+    paymentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payment ID"})
+        return
+    }
+
+    // 2. Bind the reversal, dated now when omitted
+    var input PaymentReversalRequest
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    reversal := database.PaymentReversal{
+        Type:                 reversalType,
+        Amount:               input.Amount,
+        Reason:               input.Reason,
+        Date:                 time.Now(),
+        Method:               input.Method,
+        TransactionReference: input.TransactionReference,
+    }
+    if input.Date != nil {
+        reversal.Date = *input.Date
+    }
+
+    // 3. Record it along with the new invoice balance
+    var reverse *models.Payment
+    var invoice models.Invoice
+    err = h.DB.Transaction(func(tx *gorm.DB) error {
+        var err error
+        if reverse, err = database.ReversePayment(tx, uint(paymentID), reversal); err != nil {
+            return err
+        }
+        return tx.First(&invoice, reverse.InvoiceID).Error
+    })
+    if err != nil {
+        writePaymentError(c, err, "failed to record "+reversalType)
+        return
+    }
+
+    // 4. Return the reversal
+    c.JSON(http.StatusCreated, gin.H{"payment": reverse, "invoice": invoice})
+}
+
 // PUT /payment/:id/status – update only the status of a payment
 func (h *PaymentHandler) UpdatePaymentStatus(c *gin.Context) {
     // 1. Parse payment ID
@@ -163,39 +344,64 @@ func (h *PaymentHandler) UpdatePaymentStatus(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "status field is required"})
         return
     }
-    if payload.Status == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "status cannot be empty"})
-        return
-    }
 
-    // 3. Update and fetch updated record in a transaction
-    var updated models.Payment
+    // 3. Update along with the invoice balance in a transaction
+    var updated *models.Payment
+    var invoice models.Invoice
     err = h.DB.Transaction(func(tx *gorm.DB) error {
-        // 3a. Update
-        result := tx.Model(&models.Payment{}).
-            Where("payment_id = ?", paymentID).
-            Updates(map[string]interface{}{
-                "status":     payload.Status,
-                "updated_at": time.Now(),
-            })
-        if result.Error != nil {
-            return result.Error
-        }
-        if result.RowsAffected == 0 {
-            return gorm.ErrRecordNotFound
+        var err error
+        if updated, err = database.UpdatePaymentStatus(tx, uint(paymentID), payload.Status); err != nil {
+            return err
         }
-        // 3b. Read back
-        return tx.First(&updated, paymentID).Error
+        return tx.First(&invoice, updated.InvoiceID).Error
     })
     if err != nil {
-        if err == gorm.ErrRecordNotFound {
-            c.JSON(http.StatusNotFound, gin.H{"error": "payment not found"})
-        } else {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update status"})
-        }
+        writePaymentError(c, err, "failed to update status")
         return
     }
 
     // 4. Return updated resource
-    c.JSON(http.StatusOK, gin.H{"payment": updated})
+    c.JSON(http.StatusOK, gin.H{"payment": updated, "invoice": invoice})
+}
+
+// DELETE /payment/:id – delete a payment recorded by mistake, or a refund or chargeback
+func (h *PaymentHandler) DeletePayment(c *gin.Context) {
+    // 1. Parse payment ID
+    paymentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payment ID"})
+        return
+    }
+
+    // 2. Delete along with the invoice balance in a transaction
+    var invoice *models.Invoice
+    err = h.DB.Transaction(func(tx *gorm.DB) error {
+        var err error
+        invoice, err = database.DeletePayment(tx, uint(paymentID))
+        return err
+    })
+    if err != nil {
+        writePaymentError(c, err, "failed to delete payment")
+        return
+    }
+
+    // 3. Return the invoice
+    c.JSON(http.StatusOK, gin.H{"message": "payment deleted", "invoice": invoice})
+}
+
+// writePaymentError maps payment errors onto HTTP responses
+func writePaymentError(c *gin.Context, err error, fallback string) {
+    switch {
+    case errors.Is(err, database.ErrPaymentNotFound), errors.Is(err, database.ErrInvoiceNotFound):
+        c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+    case errors.Is(err, database.ErrPaymentStatus), errors.Is(err, database.ErrCurrencyMismatch),
+        errors.Is(err, database.ErrReversalAmount), errors.Is(err, database.ErrReversalExceedsPaid):
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    case errors.Is(err, database.ErrInvoiceNotPayable), errors.Is(err, database.ErrPaymentNotReversible),
+        errors.Is(err, database.ErrPaymentReversed), errors.Is(err, database.ErrPaymentFromReceipt),
+        errors.Is(err, database.ErrPaymentIsReversal):
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+    }
 }
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"errors"
+	"invoice-go/database"
+	"invoice-go/models"
+	"invoice-go/money"
+	"invoice-go/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ReceiptHandler records the money received from customers and allocates it
+// across their invoices
+type ReceiptHandler struct {
+	DB *gorm.DB
+}
+
+// ReceiptAllocationInput allocates part of a receipt to one invoice
+type ReceiptAllocationInput struct {
+	InvoiceID uint         `json:"invoice_id" binding:"required"`
+	Amount    money.Amount `json:"amount"` // must be positive
+}
+
+// ReceiptInput is used for recording a receipt
+type ReceiptInput struct {
+	RecipientCompanyID   uint                     `json:"recipient_company_id" binding:"required"` // customer company the money came from
+	ReceiptDate          *time.Time               `json:"receipt_date"`                            // defaults to now
+	Amount               money.Amount             `json:"amount"`                                  // must be positive
+	Currency             string                   `json:"currency" binding:"omitempty,iso4217"`    // defaults to the base currency
+	Method               *string                  `json:"method" binding:"omitempty,max=50"`
+	TransactionReference *string                  `json:"transaction_reference" binding:"omitempty,max=255"`
+	Notes                *string                  `json:"notes"`
+	Allocations          []ReceiptAllocationInput `json:"allocations" binding:"dive"`
+	AutoAllocate         bool                     `json:"auto_allocate"` // allocate what is left to the oldest unpaid invoices
+}
+
+// AllocateReceiptInput is used for allocating the credit left on a receipt
+type AllocateReceiptInput struct {
+	Allocations  []ReceiptAllocationInput `json:"allocations" binding:"dive"`
+	AutoAllocate bool                     `json:"auto_allocate"`
+}
+
+// GET /receipts[?recipient_company_id=…] - list receipts, newest first
+func (h *ReceiptHandler) GetReceipts(c *gin.Context) {
+	q := h.DB.Order("receipt_date DESC, receipt_id DESC")
+	if companyID := c.Query("recipient_company_id"); companyID != "" {
+		id, err := strconv.ParseUint(companyID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid recipient_company_id"})
+			return
+		}
+		q = q.Where("recipient_company_id = ?", id)
+	}
+
+	var receipts []models.Receipt
+	if err := q.Find(&receipts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch receipts"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"receipts": receipts})
+}
+
+// GET /receipts/:id - get a receipt with its allocations
+func (h *ReceiptHandler) GetReceipt(c *gin.Context) {
+	receiptID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid receipt ID"})
+		return
+	}
+
+	receipt, err := database.GetReceipt(h.DB, uint(receiptID))
+	if err != nil {
+		writeReceiptError(c, err, "failed to fetch receipt")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"receipt": receipt})
+}
+
+// POST /receipts - record money received from a customer and allocate it to
+// its invoices, explicitly and/or oldest first. The unallocated remainder is
+// kept as credit of the customer.
+func (h *ReceiptHandler) CreateReceipt(c *gin.Context) {
+	var input ReceiptInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !input.Amount.IsPositive() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive"})
+		return
+	}
+
+	var company models.Company
+	if err := h.DB.First(&company, input.RecipientCompanyID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "recipient company not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch recipient company"})
+		}
+		return
+	}
+
+	receipt := models.Receipt{
+		RecipientCompanyID:   company.CompanyID,
+		ReceiptDate:          time.Now(),
+		Amount:               input.Amount,
+		Currency:             utils.NormalizeCurrency(input.Currency),
+		Method:               input.Method,
+		TransactionReference: input.TransactionReference,
+		Notes:                input.Notes,
+	}
+	if input.ReceiptDate != nil {
+		receipt.ReceiptDate = *input.ReceiptDate
+	}
+	if receipt.Currency == "" {
+		receipt.Currency = utils.BaseCurrency()
+	}
+
+	var created *models.Receipt
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := database.CreateReceipt(tx, &receipt, receiptAllocations(input.Allocations), input.AutoAllocate); err != nil {
+			return err
+		}
+		var err error
+		created, err = database.GetReceipt(tx, receipt.ReceiptID)
+		return err
+	})
+	if err != nil {
+		writeReceiptError(c, err, "failed to record receipt")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"receipt": created})
+}
+
+// POST /receipts/:id/allocations - allocate the credit left on a receipt to
+// invoices of its customer
+func (h *ReceiptHandler) AllocateReceipt(c *gin.Context) {
+	receiptID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid receipt ID"})
+		return
+	}
+
+	var input AllocateReceiptInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(input.Allocations) == 0 && !input.AutoAllocate {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "allocations or auto_allocate is required"})
+		return
+	}
+
+	var receipt *models.Receipt
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		receipt, err = database.AllocateReceipt(tx, uint(receiptID), receiptAllocations(input.Allocations), input.AutoAllocate)
+		return err
+	})
+	if err != nil {
+		writeReceiptError(c, err, "failed to allocate receipt")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"receipt": receipt})
+}
+
+// receiptAllocations converts the allocations of a request
+func receiptAllocations(inputs []ReceiptAllocationInput) []database.ReceiptAllocation {
+	allocations := make([]database.ReceiptAllocation, 0, len(inputs))
+	for _, input := range inputs {
+		allocations = append(allocations, database.ReceiptAllocation{InvoiceID: input.InvoiceID, Amount: input.Amount})
+	}
+	return allocations
+}
+
+// writeReceiptError maps receipt and allocation errors onto HTTP responses
+func writeReceiptError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, database.ErrReceiptNotFound), errors.Is(err, database.ErrInvoiceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrAllocationAmount), errors.Is(err, database.ErrOverAllocation),
+		errors.Is(err, database.ErrAllocationExceedsDue), errors.Is(err, database.ErrInvoiceNotOfCustomer),
+		errors.Is(err, database.ErrCurrencyMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrInvoiceNotPayable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"errors"
+	"invoice-go/database"
+	"invoice-go/models"
+	"invoice-go/money"
+	"invoice-go/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RecurringInvoiceHandler manages the schedules invoicing customers every interval
+type RecurringInvoiceHandler struct {
+	DB *gorm.DB
+}
+
+// RecurringInvoiceInput is used for creating or replacing a recurring invoice
+type RecurringInvoiceInput struct {
+	SenderCompanyID    uint                        `json:"sender_company_id" binding:"required"`
+	RecipientCompanyID uint                        `json:"recipient_company_id" binding:"required"`
+	BillingAddressID   uint                        `json:"billing_address_id" binding:"required"`
+	ShippingAddressID  *uint                       `json:"shipping_address_id"`
+	InvoiceSubject     *string                     `json:"invoice_subject" binding:"omitempty,max=200"`
+	Notes              *string                     `json:"notes" binding:"omitempty,max=500"`
+	Currency           string                      `json:"currency" binding:"omitempty,iso4217"` // defaults to the base currency
+	TaxInclusive       bool                        `json:"tax_inclusive"`
+	DiscountPercentage float64                     `json:"discount_percentage" binding:"gte=0,lte=100"`
+	DiscountAmount     money.Amount                `json:"discount_amount"`
+	Interval           string                      `json:"interval" binding:"required"`
+	StartDate          time.Time                   `json:"start_date" binding:"required"`
+	EndDate            *time.Time                  `json:"end_date"`
+	PaymentTermDays    *int                        `json:"payment_term_days" binding:"omitempty,gte=0"` // defaults to 30
+	AutoIssue          bool                        `json:"auto_issue"`
+	IsActive           *bool                       `json:"is_active"` // defaults to true
+	Items              []RecurringInvoiceItemInput `json:"items" binding:"required,min=1,dive"`
+}
+
+// RecurringInvoiceItemInput is a line of a recurring invoice. Lines referencing
+// a catalog item without a unit_price are priced from the catalog on every run.
+type RecurringInvoiceItemInput struct {
+	ItemID             *uint         `json:"item_id,omitempty"`
+	Description        string        `json:"description" binding:"max=255"`
+	Quantity           float64       `json:"quantity" binding:"required,gt=0"`
+	UnitPrice          *money.Amount `json:"unit_price,omitempty"`
+	TaxRatePercentage  float64       `json:"tax_rate_percentage" binding:"gte=0,lte=100"`
+	TaxCode            *string       `json:"tax_code,omitempty" binding:"omitempty,max=20"`
+	WithholdingTaxCode *string       `json:"withholding_tax_code,omitempty" binding:"omitempty,max=20"`
+	DiscountPercentage float64       `json:"discount_percentage" binding:"gte=0,lte=100"`
+	DiscountAmount     money.Amount  `json:"discount_amount"`
+}
+
+// GET /recurring-invoices[?recipient_company_id=…] - list recurring invoices
+func (h *RecurringInvoiceHandler) GetRecurringInvoices(c *gin.Context) {
+	q := h.DB.Preload("Items").Order("next_run_date, recurring_invoice_id")
+	if recipient := c.Query("recipient_company_id"); recipient != "" {
+		q = q.Where("recipient_company_id = ?", recipient)
+	}
+
+	var schedules []models.RecurringInvoice
+	if err := q.Find(&schedules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch recurring invoices"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recurring_invoices": schedules})
+}
+
+// GET /recurring-invoices/:id - fetch one recurring invoice with its lines
+func (h *RecurringInvoiceHandler) GetRecurringInvoice(c *gin.Context) {
+	schedule, ok := h.findRecurringInvoice(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recurring_invoice": schedule})
+}
+
+// POST /recurring-invoices - add a recurring invoice, first run on start_date
+func (h *RecurringInvoiceHandler) CreateRecurringInvoice(c *gin.Context) {
+	var input RecurringInvoiceInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var schedule models.RecurringInvoice
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		built, err := recurringInvoiceFromInput(tx, input)
+		if err != nil {
+			return err
+		}
+		schedule = *built
+		schedule.NextRunDate = schedule.StartDate
+		if err := tx.Create(&schedule).Error; err != nil {
+			return err
+		}
+		// is_active defaults to true in the table, so a false value is not inserted
+		if !schedule.IsActive {
+			return tx.Model(&schedule).Update("is_active", false).Error
+		}
+		return nil
+	})
+	if err != nil {
+		writeRecurringInvoiceError(c, err, "failed to create recurring invoice")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"recurring_invoice": schedule})
+}
+
+// PUT /recurring-invoices/:id - replace a recurring invoice and its lines. Runs
+// already generated or skipped stay done: the next run is the first one of the
+// new schedule on or after the current next run.
+func (h *RecurringInvoiceHandler) UpdateRecurringInvoice(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid recurring invoice ID"})
+		return
+	}
+
+	var input RecurringInvoiceInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var schedule models.RecurringInvoice
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var existing models.RecurringInvoice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&existing, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return database.ErrRecurringInvoiceNotFound
+			}
+			return err
+		}
+
+		built, err := recurringInvoiceFromInput(tx, input)
+		if err != nil {
+			return err
+		}
+		schedule = *built
+		schedule.RecurringInvoiceID = existing.RecurringInvoiceID
+		schedule.LastInvoiceID = existing.LastInvoiceID
+		schedule.CreatedAt = existing.CreatedAt
+		if existing.Occurrences > 0 {
+			schedule.Occurrences = database.NextRecurrence(schedule.StartDate, schedule.Interval, existing.NextRunDate)
+		}
+		schedule.NextRunDate = database.RecurrenceDate(schedule.StartDate, schedule.Interval, schedule.Occurrences)
+
+		if err := tx.Where("recurring_invoice_id = ?", schedule.RecurringInvoiceID).
+			Delete(&models.RecurringInvoiceItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Session(&gorm.Session{FullSaveAssociations: true}).Save(&schedule).Error
+	})
+	if err != nil {
+		writeRecurringInvoiceError(c, err, "failed to update recurring invoice")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recurring_invoice": schedule})
+}
+
+// DELETE /recurring-invoices/:id - remove a recurring invoice. Invoices it generated are kept.
+func (h *RecurringInvoiceHandler) DeleteRecurringInvoice(c *gin.Context) {
+	schedule, ok := h.findRecurringInvoice(c)
+	if !ok {
+		return
+	}
+	if err := h.DB.Select("Items").Delete(schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete recurring invoice"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "recurring invoice deleted"})
+}
+
+// POST /recurring-invoices/:id/run - generate the next run now, dated today
+func (h *RecurringInvoiceHandler) RunRecurringInvoice(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid recurring invoice ID"})
+		return
+	}
+
+	var invoice *models.Invoice
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		invoice, err = database.RunRecurringInvoice(tx, uint(id), time.Now())
+		return err
+	})
+	if err != nil {
+		writeRecurringInvoiceError(c, err, "failed to generate invoice")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"invoice": invoice})
+}
+
+// POST /recurring-invoices/:id/skip - move past the next run without invoicing it
+func (h *RecurringInvoiceHandler) SkipRecurringInvoice(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid recurring invoice ID"})
+		return
+	}
+
+	var schedule *models.RecurringInvoice
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		schedule, err = database.SkipRecurringInvoice(tx, uint(id))
+		return err
+	})
+	if err != nil {
+		writeRecurringInvoiceError(c, err, "failed to skip run")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recurring_invoice": schedule})
+}
+
+// recurringInvoiceFromInput validates a recurring invoice payload and builds the
+// schedule, filling line descriptions from the catalog
+func recurringInvoiceFromInput(tx *gorm.DB, input RecurringInvoiceInput) (*models.RecurringInvoice, error) {
+	interval := strings.ToLower(strings.TrimSpace(input.Interval))
+	switch {
+	case !models.IsRecurrenceInterval(interval):
+		return nil, recurringInvoiceError("interval must be one of weekly, monthly, quarterly, yearly")
+	case input.EndDate != nil && input.EndDate.Before(input.StartDate):
+		return nil, recurringInvoiceError("end_date must not be before start_date")
+	case input.DiscountAmount.IsNegative():
+		return nil, recurringInvoiceError("discount_amount must not be negative")
+	}
+
+	currency := utils.NormalizeCurrency(input.Currency)
+	if currency == "" {
+		currency = utils.BaseCurrency()
+	}
+	paymentTermDays := 30
+	if input.PaymentTermDays != nil {
+		paymentTermDays = *input.PaymentTermDays
+	}
+	isActive := true
+	if input.IsActive != nil {
+		isActive = *input.IsActive
+	}
+	var endDate *time.Time
+	if input.EndDate != nil {
+		end := truncateToDate(*input.EndDate)
+		endDate = &end
+	}
+
+	schedule := models.RecurringInvoice{
+		SenderCompanyID:    input.SenderCompanyID,
+		RecipientCompanyID: input.RecipientCompanyID,
+		BillingAddressID:   input.BillingAddressID,
+		ShippingAddressID:  input.ShippingAddressID,
+		InvoiceSubject:     input.InvoiceSubject,
+		Notes:              input.Notes,
+		Currency:           currency,
+		TaxInclusive:       input.TaxInclusive,
+		DiscountPercentage: input.DiscountPercentage,
+		DiscountAmount:     input.DiscountAmount,
+		Interval:           interval,
+		StartDate:          truncateToDate(input.StartDate),
+		EndDate:            endDate,
+		PaymentTermDays:    paymentTermDays,
+		AutoIssue:          input.AutoIssue,
+		IsActive:           isActive,
+	}
+
+	for i, line := range input.Items {
+		item := models.RecurringInvoiceItem{
+			ItemID:             line.ItemID,
+			Description:        line.Description,
+			Quantity:           line.Quantity,
+			UnitPrice:          line.UnitPrice,
+			TaxRatePercentage:  line.TaxRatePercentage,
+			TaxCode:            line.TaxCode,
+			WithholdingTaxCode: line.WithholdingTaxCode,
+			DiscountPercentage: line.DiscountPercentage,
+			DiscountAmount:     line.DiscountAmount,
+		}
+		if line.ItemID != nil {
+			var catalogItem models.Item
+			if err := tx.First(&catalogItem, *line.ItemID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil, &invoiceLineError{line: i, msg: "item not found"}
+				}
+				return nil, err
+			}
+			if item.Description == "" {
+				item.Description = catalogItem.Name
+			}
+		} else if item.Description == "" {
+			return nil, &invoiceLineError{line: i, msg: "description is required when item_id is omitted"}
+		} else if line.UnitPrice == nil {
+			return nil, &invoiceLineError{line: i, msg: "unit_price is required when item_id is omitted"}
+		}
+		if line.UnitPrice != nil && line.UnitPrice.IsNegative() {
+			return nil, &invoiceLineError{line: i, msg: "unit_price must not be negative"}
+		}
+		if line.DiscountAmount.IsNegative() {
+			return nil, &invoiceLineError{line: i, msg: "discount_amount must not be negative"}
+		}
+		schedule.Items = append(schedule.Items, item)
+	}
+	return &schedule, nil
+}
+
+// findRecurringInvoice loads the recurring invoice of the :id path parameter, writing the error response when missing
+func (h *RecurringInvoiceHandler) findRecurringInvoice(c *gin.Context) (*models.RecurringInvoice, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid recurring invoice ID"})
+		return nil, false
+	}
+
+	var schedule models.RecurringInvoice
+	if err := h.DB.Preload("Items").First(&schedule, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": database.ErrRecurringInvoiceNotFound.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch recurring invoice"})
+		}
+		return nil, false
+	}
+	return &schedule, true
+}
+
+// recurringInvoiceError reports an invalid recurring invoice payload
+type recurringInvoiceError string
+
+func (e recurringInvoiceError) Error() string {
+	return string(e)
+}
+
+// writeRecurringInvoiceError maps recurring invoice errors onto HTTP responses,
+// falling back to the invoice errors for failed runs
+func writeRecurringInvoiceError(c *gin.Context, err error, fallback string) {
+	var inputErr recurringInvoiceError
+	switch {
+	case errors.As(err, &inputErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": inputErr.Error()})
+	case errors.Is(err, database.ErrRecurringInvoiceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrRecurringInvoiceInactive), errors.Is(err, database.ErrRecurringInvoiceEnded):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		writeInvoiceError(c, err, fallback)
+	}
+}
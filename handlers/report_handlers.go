@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"invoice-go/database"
+	"invoice-go/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ReportHandler serves the receivables reports across invoices and customers
+type ReportHandler struct {
+	DB *gorm.DB
+}
+
+// GET /reports/withholding-certificates[?company_id=…] - withholding certificates
+// still to be collected, per customer
+func (h *ReportHandler) GetPendingCertificates(c *gin.Context) {
+	var companyID uint64
+	if id := c.Query("company_id"); id != "" {
+		parsed, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid company ID"})
+			return
+		}
+		companyID = parsed
+	}
+
+	customers, err := database.GetPendingCertificates(h.DB, uint(companyID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch pending certificates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"customers": customers})
+}
+
+// GET /reports/aging[?as_of=YYYY-MM-DD&format=csv] - accounts receivable aging
+// per customer as of a date, today by default
+func (h *ReportHandler) GetAgingReport(c *gin.Context) {
+	asOf := time.Now()
+	if d := c.Query("as_of"); d != "" {
+		parsed, err := time.Parse("2006-01-02", d)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "as_of must be formatted as YYYY-MM-DD"})
+			return
+		}
+		asOf = parsed
+	}
+
+	report, err := database.GetAgingReport(h.DB, asOf)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build aging report"})
+		return
+	}
+
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.JSON(http.StatusOK, report)
+	case "csv":
+		writeAgingCSV(c, report)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+	}
+}
+
+// writeAgingCSV writes an aging report as CSV, one row per customer followed
+// by a totals row
+func writeAgingCSV(c *gin.Context, report *models.AgingReport) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="aging-%s.csv"`, report.AsOf.Format("2006-01-02")))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	header := []string{"company_id", "company_name", "invoice_count"}
+	header = append(header, models.AgingBuckets...)
+	w.Write(append(header, "total"))
+
+	count := 0
+	for _, customer := range report.Customers {
+		count += customer.InvoiceCount
+		w.Write(agingCSVRow(strconv.FormatUint(uint64(customer.CompanyID), 10), customer.CompanyName,
+			customer.InvoiceCount, customer.AgingAmounts))
+	}
+	w.Write(agingCSVRow("", "Total", count, report.Totals))
+	w.Flush()
+}
+
+// agingCSVRow formats one row of the aging CSV
+func agingCSVRow(companyID, companyName string, invoiceCount int, amounts models.AgingAmounts) []string {
+	row := []string{companyID, companyName, strconv.Itoa(invoiceCount)}
+	for _, amount := range amounts.Buckets() {
+		row = append(row, amount.String())
+	}
+	return append(row, amounts.Total.String())
+}
@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"errors"
+	"invoice-go/database"
+	"invoice-go/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TaxHandler manages tax codes and the jurisdiction rules assigning them
+type TaxHandler struct {
+	DB *gorm.DB
+}
+
+// TaxCodeInput is used for creating a tax code, or a new rate of an existing
+// code from effective_date on
+type TaxCodeInput struct {
+	Code           string    `json:"code" binding:"required,max=20"`
+	Name           string    `json:"name" binding:"required,max=100"`
+	Kind           string    `json:"kind" binding:"required"`
+	RatePercentage float64   `json:"rate_percentage" binding:"gte=0,lte=100"`
+	EffectiveDate  time.Time `json:"effective_date" binding:"required"`
+}
+
+// UpdateTaxCodeInput is used for correcting a tax code version
+type UpdateTaxCodeInput struct {
+	Name           *string    `json:"name" binding:"omitempty,max=100"`
+	RatePercentage *float64   `json:"rate_percentage" binding:"omitempty,gte=0,lte=100"`
+	EffectiveDate  *time.Time `json:"effective_date"`
+}
+
+// TaxRuleInput is used for creating or replacing a tax rule. Empty criteria match anything.
+type TaxRuleInput struct {
+	TaxCode             string `json:"tax_code" binding:"required,max=20"`
+	SellerCountry       string `json:"seller_country" binding:"max=100"`
+	SellerStateProvince string `json:"seller_state_province" binding:"max=100"`
+	BuyerCountry        string `json:"buyer_country" binding:"max=100"`
+	BuyerStateProvince  string `json:"buyer_state_province" binding:"max=100"`
+	ItemType            string `json:"item_type" binding:"max=50"`
+	Priority            int    `json:"priority"`
+}
+
+// GET /tax-codes[?code=…] - list tax codes with all their rates, newest first
+func (h *TaxHandler) GetTaxCodes(c *gin.Context) {
+	q := h.DB.Order("code, effective_date DESC")
+	if code := c.Query("code"); code != "" {
+		q = q.Where("code = ?", code)
+	}
+
+	var codes []models.TaxCode
+	if err := q.Find(&codes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch tax codes"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tax_codes": codes})
+}
+
+// GET /tax-codes/:id - fetch one tax code version
+func (h *TaxHandler) GetTaxCode(c *gin.Context) {
+	taxCode, ok := h.findTaxCode(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tax_code": taxCode})
+}
+
+// POST /tax-codes - record a tax code, or its new rate from a date on
+func (h *TaxHandler) CreateTaxCode(c *gin.Context) {
+	var input TaxCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	taxCode := models.TaxCode{
+		Code:           strings.TrimSpace(input.Code),
+		Name:           input.Name,
+		Kind:           input.Kind,
+		RatePercentage: input.RatePercentage,
+		EffectiveDate:  truncateToDate(input.EffectiveDate),
+	}
+	if msg := validateTaxCode(taxCode); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var versions []models.TaxCode
+	if err := h.DB.Where("code = ?", taxCode.Code).Find(&versions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch tax codes"})
+		return
+	}
+	for _, version := range versions {
+		if version.Kind != taxCode.Kind {
+			c.JSON(http.StatusConflict, gin.H{"error": "tax code " + taxCode.Code + " already exists as a " + version.Kind + " code"})
+			return
+		}
+		if version.EffectiveDate.Format("2006-01-02") == taxCode.EffectiveDate.Format("2006-01-02") {
+			c.JSON(http.StatusConflict, gin.H{"error": "a rate for this tax code and effective date already exists"})
+			return
+		}
+	}
+
+	if err := h.DB.Create(&taxCode).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create tax code"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"tax_code": taxCode})
+}
+
+// PUT /tax-codes/:id - correct a tax code version. Invoices keep the rates they were created with.
+func (h *TaxHandler) UpdateTaxCode(c *gin.Context) {
+	taxCode, ok := h.findTaxCode(c)
+	if !ok {
+		return
+	}
+
+	var input UpdateTaxCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Name != nil {
+		taxCode.Name = *input.Name
+	}
+	if input.RatePercentage != nil {
+		taxCode.RatePercentage = *input.RatePercentage
+	}
+	if msg := validateTaxCode(*taxCode); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if input.EffectiveDate != nil {
+		taxCode.EffectiveDate = truncateToDate(*input.EffectiveDate)
+		var count int64
+		h.DB.Model(&models.TaxCode{}).
+			Where("code = ? AND effective_date = ? AND tax_code_id <> ?", taxCode.Code, taxCode.EffectiveDate.Format("2006-01-02"), taxCode.TaxCodeID).
+			Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "a rate for this tax code and effective date already exists"})
+			return
+		}
+	}
+
+	if err := h.DB.Save(taxCode).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update tax code"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tax_code": taxCode})
+}
+
+// DELETE /tax-codes/:id - remove a tax code version
+func (h *TaxHandler) DeleteTaxCode(c *gin.Context) {
+	taxCode, ok := h.findTaxCode(c)
+	if !ok {
+		return
+	}
+	if err := h.DB.Delete(taxCode).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete tax code"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "tax code deleted"})
+}
+
+// GET /tax-rules - list tax rules
+func (h *TaxHandler) GetTaxRules(c *gin.Context) {
+	var rules []models.TaxRule
+	if err := h.DB.Order("rule_id").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch tax rules"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tax_rules": rules})
+}
+
+// GET /tax-rules/resolve?company_id=…&address_id=…[&item_id=…|&item_type=…][&date=YYYY-MM-DD]
+// shows the tax codes the rules assign to a sale from a sender company to a billing address
+func (h *TaxHandler) ResolveTaxCodes(c *gin.Context) {
+	companyID, err := strconv.ParseUint(c.Query("company_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "company_id is required"})
+		return
+	}
+	addressID, err := strconv.ParseUint(c.Query("address_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "address_id is required"})
+		return
+	}
+	date := time.Now()
+	if d := c.Query("date"); d != "" {
+		parsed, err := time.Parse("2006-01-02", d)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be formatted as YYYY-MM-DD"})
+			return
+		}
+		date = parsed
+	}
+
+	itemType := c.Query("item_type")
+	if itemID := c.Query("item_id"); itemID != "" {
+		var item models.Item
+		if err := h.DB.First(&item, itemID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "item not found"})
+			return
+		}
+		itemType = item.Type
+	}
+
+	invoice := models.Invoice{SenderCompanyID: uint(companyID), BillingAddressID: uint(addressID)}
+	jurisdiction, err := database.LoadTaxJurisdiction(h.DB, &invoice)
+	if err != nil {
+		if errors.Is(err, database.ErrSenderCompanyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load jurisdiction"})
+		}
+		return
+	}
+	sales, withholding, err := database.ResolveTaxCodes(h.DB, jurisdiction, itemType, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve tax codes"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"jurisdiction": jurisdiction,
+		"item_type":    itemType,
+		"date":         date.Format("2006-01-02"),
+		"tax_code":     sales,
+		"withholding":  withholding,
+	})
+}
+
+// POST /tax-rules - add a rule assigning a tax code
+func (h *TaxHandler) CreateTaxRule(c *gin.Context) {
+	var input TaxRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.taxCodeExists(c, input.TaxCode) {
+		return
+	}
+
+	rule := taxRuleFromInput(input)
+	if err := h.DB.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create tax rule"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"tax_rule": rule})
+}
+
+// PUT /tax-rules/:id - replace the criteria and code of a rule
+func (h *TaxHandler) UpdateTaxRule(c *gin.Context) {
+	rule, ok := h.findTaxRule(c)
+	if !ok {
+		return
+	}
+
+	var input TaxRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.taxCodeExists(c, input.TaxCode) {
+		return
+	}
+
+	updated := taxRuleFromInput(input)
+	updated.RuleID = rule.RuleID
+	updated.CreatedAt = rule.CreatedAt
+	if err := h.DB.Save(&updated).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update tax rule"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tax_rule": updated})
+}
+
+// DELETE /tax-rules/:id - remove a tax rule
+func (h *TaxHandler) DeleteTaxRule(c *gin.Context) {
+	rule, ok := h.findTaxRule(c)
+	if !ok {
+		return
+	}
+	if err := h.DB.Delete(rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete tax rule"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "tax rule deleted"})
+}
+
+// validateTaxCode checks the kind and rate of a tax code, returning the error message
+func validateTaxCode(taxCode models.TaxCode) string {
+	switch {
+	case !models.IsTaxKind(taxCode.Kind):
+		return "kind must be one of standard, zero_rated, exempt, withholding"
+	case (taxCode.Kind == models.TaxKindZeroRated || taxCode.Kind == models.TaxKindExempt) && taxCode.RatePercentage != 0:
+		return "zero-rated and exempt codes must have a rate of 0"
+	case (taxCode.Kind == models.TaxKindStandard || taxCode.Kind == models.TaxKindWithholding) && taxCode.RatePercentage <= 0:
+		return "standard and withholding codes must have a positive rate"
+	}
+	return ""
+}
+
+// taxRuleFromInput builds a rule with trimmed criteria
+func taxRuleFromInput(input TaxRuleInput) models.TaxRule {
+	return models.TaxRule{
+		TaxCode:             strings.TrimSpace(input.TaxCode),
+		SellerCountry:       strings.TrimSpace(input.SellerCountry),
+		SellerStateProvince: strings.TrimSpace(input.SellerStateProvince),
+		BuyerCountry:        strings.TrimSpace(input.BuyerCountry),
+		BuyerStateProvince:  strings.TrimSpace(input.BuyerStateProvince),
+		ItemType:            strings.TrimSpace(input.ItemType),
+		Priority:            input.Priority,
+	}
+}
+
+// taxCodeExists checks that a rule refers to a recorded tax code, writing the error response when not
+func (h *TaxHandler) taxCodeExists(c *gin.Context, code string) bool {
+	var count int64
+	if err := h.DB.Model(&models.TaxCode{}).Where("code = ?", strings.TrimSpace(code)).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch tax codes"})
+		return false
+	}
+	if count == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": database.ErrTaxCodeNotFound.Error() + ": " + code})
+		return false
+	}
+	return true
+}
+
+// findTaxCode loads the tax code version of the :id path parameter, writing the error response when missing
+func (h *TaxHandler) findTaxCode(c *gin.Context) (*models.TaxCode, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tax code ID"})
+		return nil, false
+	}
+
+	var taxCode models.TaxCode
+	if err := h.DB.First(&taxCode, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": database.ErrTaxCodeNotFound.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch tax code"})
+		}
+		return nil, false
+	}
+	return &taxCode, true
+}
+
+// findTaxRule loads the tax rule of the :id path parameter, writing the error response when missing
+func (h *TaxHandler) findTaxRule(c *gin.Context) (*models.TaxRule, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tax rule ID"})
+		return nil, false
+	}
+
+	var rule models.TaxRule
+	if err := h.DB.First(&rule, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": database.ErrTaxRuleNotFound.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch tax rule"})
+		}
+		return nil, false
+	}
+	return &rule, true
+}
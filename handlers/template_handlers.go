@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"invoice-go/database"
+	"invoice-go/models"
+	"invoice-go/render"
+	"invoice-go/utils"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxTemplateSize limits uploaded template sources (1MB)
+const maxTemplateSize = 1 << 20
+
+// TemplateHandler manages the invoice templates of sender companies
+type TemplateHandler struct {
+	DB *gorm.DB
+}
+
+// InvoiceTemplateInput is used for uploading a template, either as JSON with
+// the source in body or as a multipart form with the source in the file field "template"
+type InvoiceTemplateInput struct {
+	Name         string  `form:"name" json:"name" binding:"required,max=100"`
+	Language     string  `form:"language" json:"language" binding:"omitempty,max=10"`
+	PrimaryColor string  `form:"primary_color" json:"primary_color" binding:"omitempty,hexcolor"`
+	AccentColor  string  `form:"accent_color" json:"accent_color" binding:"omitempty,hexcolor"`
+	FooterText   *string `form:"footer_text" json:"footer_text" binding:"omitempty,max=1000"`
+	BankDetails  *string `form:"bank_details" json:"bank_details" binding:"omitempty,max=1000"`
+	Body         string  `form:"body" json:"body"`
+}
+
+// POST /companies/:id/templates - upload an invoice template
+func (h *TemplateHandler) CreateTemplate(c *gin.Context) {
+	company, ok := h.findCompany(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxTemplateSize+utils.MaxFileSize)
+	var input InvoiceTemplateInput
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if file, err := c.FormFile("template"); err == nil {
+		if file.Size > maxTemplateSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "template exceeds 1MB limit"})
+			return
+		}
+		src, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "template upload failed"})
+			return
+		}
+		source, err := io.ReadAll(src)
+		src.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "template upload failed"})
+			return
+		}
+		input.Body = string(source)
+	}
+
+	language := strings.ToLower(input.Language)
+	if language == "" {
+		language = "en"
+	}
+	if !render.IsSupportedLanguage(language) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("unsupported language %q, supported: %s", input.Language, strings.Join(render.SupportedLanguages(), ", ")),
+		})
+		return
+	}
+
+	tmpl := models.InvoiceTemplate{
+		CompanyID:    company.CompanyID,
+		Name:         input.Name,
+		Language:     language,
+		PrimaryColor: input.PrimaryColor,
+		AccentColor:  input.AccentColor,
+		FooterText:   input.FooterText,
+		BankDetails:  input.BankDetails,
+		Body:         input.Body,
+	}
+	defaults := render.DefaultLayout()
+	if tmpl.PrimaryColor == "" {
+		tmpl.PrimaryColor = defaults.PrimaryColor
+	}
+	if tmpl.AccentColor == "" {
+		tmpl.AccentColor = defaults.AccentColor
+	}
+
+	// Reject templates that do not parse or fail on a sample invoice
+	if err := render.InvoiceHTML(io.Discard, render.SampleInvoiceReport(*company), tmpl.Body, render.LayoutFromTemplate(&tmpl), ""); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		return database.CreateInvoiceTemplate(tx, &tmpl)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save invoice template"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"template": tmpl})
+}
+
+// GET /companies/:id/templates - list the invoice templates of a company
+func (h *TemplateHandler) GetTemplates(c *gin.Context) {
+	company, ok := h.findCompany(c)
+	if !ok {
+		return
+	}
+
+	templates, err := database.GetInvoiceTemplates(h.DB, company.CompanyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch invoice templates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// PUT /companies/:id/templates/:template_id/activate - use a template for the company's invoices
+func (h *TemplateHandler) ActivateTemplate(c *gin.Context) {
+	company, ok := h.findCompany(c)
+	if !ok {
+		return
+	}
+	templateID, err := strconv.ParseUint(c.Param("template_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template ID"})
+		return
+	}
+
+	var tmpl *models.InvoiceTemplate
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		tmpl, err = database.ActivateInvoiceTemplate(tx, company.CompanyID, uint(templateID))
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrTemplateNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to activate invoice template"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"template": tmpl})
+}
+
+// GET /companies/:id/templates/:template_id/preview - render a template as HTML,
+// against the invoice given by ?invoice_id= or against sample data
+func (h *TemplateHandler) PreviewTemplate(c *gin.Context) {
+	company, ok := h.findCompany(c)
+	if !ok {
+		return
+	}
+	templateID, err := strconv.ParseUint(c.Param("template_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid template ID"})
+		return
+	}
+
+	tmpl, err := database.GetInvoiceTemplate(h.DB, company.CompanyID, uint(templateID))
+	if err != nil {
+		if errors.Is(err, database.ErrTemplateNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch invoice template"})
+		}
+		return
+	}
+
+	report := render.SampleInvoiceReport(*company)
+	if invoiceParam := c.Query("invoice_id"); invoiceParam != "" {
+		invID, err := strconv.ParseUint(invoiceParam, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invoice ID"})
+			return
+		}
+		report, err = database.GenerateInvoiceReport(h.DB, uint(invID))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "invoice not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate invoice reports"})
+			}
+			return
+		}
+		if report.Invoice.SenderCompanyID != company.CompanyID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invoice was not sent by this company"})
+			return
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := render.InvoiceHTML(&buf, report, tmpl.Body, render.LayoutFromTemplate(tmpl), companyLogoURL(company.CompanyID)); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// findCompany loads the company of the :id path parameter, writing the error response when missing
+func (h *TemplateHandler) findCompany(c *gin.Context) (*models.Company, bool) {
+	companyID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+		return nil, false
+	}
+
+	var company models.Company
+	if err := h.DB.Preload("DefaultBillingAddress").First(&company, companyID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+		return nil, false
+	}
+	return &company, true
+}
+
+// companyLogoURL returns the public URL of a company's logo, or "" without one
+func companyLogoURL(companyID uint) string {
+	logoPath, err := utils.GetCompanyLogoPath(companyID)
+	if err != nil {
+		return ""
+	}
+	return "/" + filepath.ToSlash(filepath.Clean(logoPath))
+}
@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"errors"
+	"invoice-go/database"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LateFees charges the late fees accrued by overdue invoices under the
+// policies of their senders. A run skipped because another instance holds the
+// lock is not a failure.
+var LateFees = Job{
+	Name: "late-fees",
+	Run: func(db *gorm.DB, now time.Time) error {
+		run, err := database.ChargeLateFees(db, now)
+		if errors.Is(err, database.ErrJobLocked) {
+			return nil
+		}
+		if run.Charged > 0 {
+			log.Printf("Charged late fees on %d invoices", run.Charged)
+		}
+		return err
+	},
+}
@@ -0,0 +1,26 @@
+package jobs
+
+import (
+	"errors"
+	"invoice-go/database"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OverdueInvoices marks the invoices past their due date as overdue. A run
+// skipped because another instance holds the lock is not a failure.
+var OverdueInvoices = Job{
+	Name: "overdue-invoices",
+	Run: func(db *gorm.DB, now time.Time) error {
+		run, err := database.MarkOverdueInvoices(db, now)
+		if errors.Is(err, database.ErrJobLocked) {
+			return nil
+		}
+		if run.Marked > 0 {
+			log.Printf("Marked %d invoices overdue", run.Marked)
+		}
+		return err
+	},
+}
@@ -0,0 +1,21 @@
+package jobs
+
+import (
+	"invoice-go/database"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecurringInvoices generates the invoices of the recurring schedules that fell due
+var RecurringInvoices = Job{
+	Name: "recurring-invoices",
+	Run: func(db *gorm.DB, now time.Time) error {
+		generated, err := database.GenerateDueRecurringInvoices(db, now)
+		if generated > 0 {
+			log.Printf("Generated %d recurring invoices", generated)
+		}
+		return err
+	},
+}
@@ -0,0 +1,30 @@
+package jobs
+
+import (
+	"errors"
+	"invoice-go/database"
+	"invoice-go/notify"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PaymentReminders returns the job that generates the reminders of the
+// dunning levels reached by unpaid invoices and sends them through notifier.
+// A run skipped because another instance holds the lock is not a failure.
+func PaymentReminders(notifier notify.Notifier) Job {
+	return Job{
+		Name: "payment-reminders",
+		Run: func(db *gorm.DB, now time.Time) error {
+			run, err := database.SendPaymentReminders(db, notifier, now)
+			if errors.Is(err, database.ErrJobLocked) {
+				return nil
+			}
+			if run.Generated > 0 || run.Sent > 0 || run.Failed > 0 || run.Cancelled > 0 {
+				log.Printf("Payment reminders: %d generated, %d sent, %d failed, %d cancelled", run.Generated, run.Sent, run.Failed, run.Cancelled)
+			}
+			return err
+		},
+	}
+}
@@ -0,0 +1,70 @@
+// Package jobs runs the background work of the service, such as generating
+// recurring invoices, on a fixed interval inside the server process.
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Job is a unit of background work. Jobs must be safe to run concurrently
+// from several instances of the service and to run again after a failure.
+type Job struct {
+	Name string
+	Run  func(db *gorm.DB, now time.Time) error
+}
+
+// Scheduler runs its jobs once at start and then every Interval
+type Scheduler struct {
+	DB       *gorm.DB
+	Interval time.Duration
+	Jobs     []Job
+}
+
+// NewScheduler returns a scheduler for the given jobs
+func NewScheduler(db *gorm.DB, interval time.Duration, jobs ...Job) *Scheduler {
+	return &Scheduler{DB: db, Interval: interval, Jobs: jobs}
+}
+
+// Start runs the jobs in the background until ctx is cancelled. A scheduler
+// without a positive interval does nothing.
+func (s *Scheduler) Start(ctx context.Context) {
+	if s.Interval <= 0 {
+		log.Println("Scheduler disabled")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+		for {
+			s.RunAll(time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunAll runs every job once, in order, logging failures
+func (s *Scheduler) RunAll(now time.Time) {
+	for _, job := range s.Jobs {
+		s.run(job, now)
+	}
+}
+
+// run runs one job, recovering from a panic so the other jobs keep running
+func (s *Scheduler) run(job Job, now time.Time) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job %s panicked: %v", job.Name, r)
+		}
+	}()
+	if err := job.Run(s.DB, now); err != nil {
+		log.Printf("Job %s failed: %v", job.Name, err)
+	}
+}
@@ -3,9 +3,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"invoice-go/database"
+	"invoice-go/jobs"
+	"invoice-go/notify"
 	"invoice-go/routes"
+	"invoice-go/utils"
 	"log"
 	"os"
 )
@@ -13,6 +17,15 @@ import (
 func main() {
 	seedDb := flag.Bool("seed", false, "Seed the database with initial data")
 	flag.Parse()
+
+	// Subcommands run once against the existing database and exit
+	if command := flag.Arg(0); command != "" {
+		if err := runCommand(command, flag.Args()[1:]); err != nil {
+			log.Fatalf("%s: %v", command, err)
+		}
+		return
+	}
+
 	// Create uploads directory if it doesn't exist
 	if _, err := os.Stat("uploads"); os.IsNotExist(err) {
 		os.Mkdir("uploads", 0755)
@@ -35,6 +48,11 @@ func main() {
 		log.Fatalf("Failed to create uploads directory: %v", err)
 	}
 
+	// Start the background jobs
+	scheduler := jobs.NewScheduler(db, utils.SchedulerInterval(),
+		jobs.RecurringInvoices, jobs.OverdueInvoices, jobs.LateFees, jobs.PaymentReminders(notify.FromEnv()))
+	scheduler.Start(context.Background())
+
 	// Setup router
 	r := routes.SetupRouter(db)
 
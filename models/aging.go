@@ -0,0 +1,101 @@
+package models
+
+import (
+	"invoice-go/money"
+	"time"
+)
+
+// Aging buckets grouping open invoices by how many days they are overdue
+const (
+	AgingCurrent = "current"
+	Aging1To30   = "1-30"
+	Aging31To60  = "31-60"
+	Aging61To90  = "61-90"
+	AgingOver90  = "90+"
+)
+
+// AgingBuckets lists the aging buckets from the most recent to the oldest
+var AgingBuckets = []string{AgingCurrent, Aging1To30, Aging31To60, Aging61To90, AgingOver90}
+
+// AgingBucket returns the bucket of an invoice overdue by the given days.
+// Invoices not yet due are current.
+func AgingBucket(daysOverdue int) string {
+	switch {
+	case daysOverdue <= 0:
+		return AgingCurrent
+	case daysOverdue <= 30:
+		return Aging1To30
+	case daysOverdue <= 60:
+		return Aging31To60
+	case daysOverdue <= 90:
+		return Aging61To90
+	}
+	return AgingOver90
+}
+
+// AgingBucketRange returns the days overdue covered by a bucket; maxDays is -1
+// for the open-ended oldest bucket. ok is false for unknown buckets.
+func AgingBucketRange(bucket string) (minDays, maxDays int, ok bool) {
+	switch bucket {
+	case AgingCurrent:
+		return 0, 0, true
+	case Aging1To30:
+		return 1, 30, true
+	case Aging31To60:
+		return 31, 60, true
+	case Aging61To90:
+		return 61, 90, true
+	case AgingOver90:
+		return 91, -1, true
+	}
+	return 0, 0, false
+}
+
+// AgingAmounts are outstanding amounts split into the aging buckets
+type AgingAmounts struct {
+	Current    money.Amount `json:"current"`
+	Days1To30  money.Amount `json:"1-30"`
+	Days31To60 money.Amount `json:"31-60"`
+	Days61To90 money.Amount `json:"61-90"`
+	Over90     money.Amount `json:"90+"`
+	Total      money.Amount `json:"total"`
+}
+
+// Add adds an amount to a bucket and to the total
+func (a *AgingAmounts) Add(bucket string, amount money.Amount) {
+	switch bucket {
+	case AgingCurrent:
+		a.Current = a.Current.Add(amount)
+	case Aging1To30:
+		a.Days1To30 = a.Days1To30.Add(amount)
+	case Aging31To60:
+		a.Days31To60 = a.Days31To60.Add(amount)
+	case Aging61To90:
+		a.Days61To90 = a.Days61To90.Add(amount)
+	default:
+		a.Over90 = a.Over90.Add(amount)
+	}
+	a.Total = a.Total.Add(amount)
+}
+
+// Buckets returns the amounts in the order of AgingBuckets
+func (a AgingAmounts) Buckets() []money.Amount {
+	return []money.Amount{a.Current, a.Days1To30, a.Days31To60, a.Days61To90, a.Over90}
+}
+
+// CustomerAging is the outstanding balance of one customer company by aging bucket
+type CustomerAging struct {
+	CompanyID    uint   `json:"company_id"`
+	CompanyName  string `json:"company_name"`
+	InvoiceCount int    `json:"invoice_count"`
+	AgingAmounts
+}
+
+// AgingReport is the accounts receivable aging of the invoices open on a
+// date, in the base reporting currency
+type AgingReport struct {
+	AsOf      time.Time       `json:"as_of"`
+	Currency  string          `json:"currency"`
+	Totals    AgingAmounts    `json:"totals"`
+	Customers []CustomerAging `json:"customers"`
+}
@@ -0,0 +1,73 @@
+package models
+
+import "strings"
+
+// Invoice lifecycle statuses stored in invoices.status
+const (
+	InvoiceStatusDraft         = "Draft"
+	InvoiceStatusIssued        = "Issued"
+	InvoiceStatusPartiallyPaid = "PartiallyPaid"
+	InvoiceStatusPaid          = "Paid"
+	InvoiceStatusOverdue       = "Overdue"
+	InvoiceStatusVoid          = "Void"
+	InvoiceStatusWrittenOff    = "WrittenOff"
+)
+
+// invoiceTransitions lists the statuses an invoice may move to from each status
+var invoiceTransitions = map[string][]string{
+	InvoiceStatusDraft:         {InvoiceStatusIssued, InvoiceStatusVoid},
+	InvoiceStatusIssued:        {InvoiceStatusPartiallyPaid, InvoiceStatusPaid, InvoiceStatusOverdue, InvoiceStatusVoid, InvoiceStatusWrittenOff},
+	InvoiceStatusPartiallyPaid: {InvoiceStatusPaid, InvoiceStatusOverdue, InvoiceStatusWrittenOff},
+	InvoiceStatusOverdue:       {InvoiceStatusPartiallyPaid, InvoiceStatusPaid, InvoiceStatusWrittenOff},
+	InvoiceStatusPaid:          {},
+	InvoiceStatusVoid:          {},
+	InvoiceStatusWrittenOff:    {},
+}
+
+// legacyInvoiceStatuses maps the free-form values written before the lifecycle
+// existed onto the lifecycle statuses
+var legacyInvoiceStatuses = map[string]string{
+	"unpaid":  InvoiceStatusIssued,
+	"sent":    InvoiceStatusIssued,
+	"partial": InvoiceStatusPartiallyPaid,
+}
+
+// NormalizeInvoiceStatus returns the canonical spelling of a status, accepting
+// any letter case and the legacy values. Unknown statuses are returned as "".
+func NormalizeInvoiceStatus(status string) string {
+	key := strings.ToLower(strings.TrimSpace(status))
+	if legacy, ok := legacyInvoiceStatuses[key]; ok {
+		return legacy
+	}
+	for canonical := range invoiceTransitions {
+		if strings.ToLower(canonical) == key {
+			return canonical
+		}
+	}
+	return ""
+}
+
+// CanTransitionInvoice reports whether an invoice may move from one status to another
+func CanTransitionInvoice(from, to string) bool {
+	for _, allowed := range invoiceTransitions[NormalizeInvoiceStatus(from)] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// InvoiceIsEditable reports whether the line items and totals of an invoice may
+// still change. Only drafts are editable.
+func InvoiceIsEditable(status string) bool {
+	return NormalizeInvoiceStatus(status) == InvoiceStatusDraft
+}
+
+// InvoiceAcceptsPayments reports whether payments may be recorded against an invoice
+func InvoiceAcceptsPayments(status string) bool {
+	switch NormalizeInvoiceStatus(status) {
+	case InvoiceStatusIssued, InvoiceStatusPartiallyPaid, InvoiceStatusOverdue:
+		return true
+	}
+	return false
+}
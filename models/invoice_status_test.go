@@ -0,0 +1,96 @@
+package models
+
+import "testing"
+
+func TestCanTransitionInvoice(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{InvoiceStatusDraft, InvoiceStatusIssued, true},
+		{InvoiceStatusDraft, InvoiceStatusVoid, true},
+		{InvoiceStatusDraft, InvoiceStatusPaid, false},
+		{InvoiceStatusDraft, InvoiceStatusOverdue, false},
+		{InvoiceStatusIssued, InvoiceStatusPartiallyPaid, true},
+		{InvoiceStatusIssued, InvoiceStatusPaid, true},
+		{InvoiceStatusIssued, InvoiceStatusOverdue, true},
+		{InvoiceStatusIssued, InvoiceStatusVoid, true},
+		{InvoiceStatusIssued, InvoiceStatusWrittenOff, true},
+		{InvoiceStatusIssued, InvoiceStatusDraft, false},
+		{InvoiceStatusPartiallyPaid, InvoiceStatusPaid, true},
+		{InvoiceStatusPartiallyPaid, InvoiceStatusOverdue, true},
+		{InvoiceStatusPartiallyPaid, InvoiceStatusVoid, false},
+		{InvoiceStatusPartiallyPaid, InvoiceStatusIssued, false},
+		{InvoiceStatusOverdue, InvoiceStatusPartiallyPaid, true},
+		{InvoiceStatusOverdue, InvoiceStatusPaid, true},
+		{InvoiceStatusOverdue, InvoiceStatusWrittenOff, true},
+		{InvoiceStatusOverdue, InvoiceStatusIssued, false},
+		{InvoiceStatusPaid, InvoiceStatusIssued, false},
+		{InvoiceStatusPaid, InvoiceStatusVoid, false},
+		{InvoiceStatusVoid, InvoiceStatusDraft, false},
+		{InvoiceStatusWrittenOff, InvoiceStatusPaid, false},
+		// The current status may be in any spelling, the target must be canonical
+		{"draft", InvoiceStatusIssued, true},
+		{"unpaid", InvoiceStatusPaid, true},
+		{"partial", InvoiceStatusOverdue, true},
+		{InvoiceStatusDraft, "issued", false},
+		{"unknown", InvoiceStatusIssued, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			if got := CanTransitionInvoice(tt.from, tt.to); got != tt.want {
+				t.Errorf("CanTransitionInvoice(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeInvoiceStatus(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Draft", InvoiceStatusDraft},
+		{" paid ", InvoiceStatusPaid},
+		{"PARTIALLYPAID", InvoiceStatusPartiallyPaid},
+		{"writtenoff", InvoiceStatusWrittenOff},
+		{"sent", InvoiceStatusIssued},
+		{"Unpaid", InvoiceStatusIssued},
+		{"partial", InvoiceStatusPartiallyPaid},
+		{"partially paid", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := NormalizeInvoiceStatus(tt.in); got != tt.want {
+				t.Errorf("NormalizeInvoiceStatus(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvoiceStatusPredicates(t *testing.T) {
+	tests := []struct {
+		status         string
+		editable       bool
+		acceptsPayment bool
+	}{
+		{InvoiceStatusDraft, true, false},
+		{InvoiceStatusIssued, false, true},
+		{InvoiceStatusPartiallyPaid, false, true},
+		{InvoiceStatusOverdue, false, true},
+		{InvoiceStatusPaid, false, false},
+		{InvoiceStatusVoid, false, false},
+		{InvoiceStatusWrittenOff, false, false},
+		{"unpaid", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			if got := InvoiceIsEditable(tt.status); got != tt.editable {
+				t.Errorf("InvoiceIsEditable(%q) = %v, want %v", tt.status, got, tt.editable)
+			}
+			if got := InvoiceAcceptsPayments(tt.status); got != tt.acceptsPayment {
+				t.Errorf("InvoiceAcceptsPayments(%q) = %v, want %v", tt.status, got, tt.acceptsPayment)
+			}
+		})
+	}
+}
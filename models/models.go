@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"invoice-go/money"
 )
 
 // Company represents the companies table.
@@ -15,8 +17,10 @@ type Company struct {
     IsVendor                 bool     `gorm:"column:is_vendor;not null;default:false;index" json:"is_vendor"`
     DefaultBillingAddressID  *uint    `gorm:"column:default_billing_address_id" json:"default_billing_address_id,omitempty"`
     DefaultShippingAddressID *uint    `gorm:"column:default_shipping_address_id" json:"default_shipping_address_id,omitempty"`
+    TaxRounding              string   `gorm:"column:tax_rounding;not null;default:'line'" json:"tax_rounding"` // TaxRoundingLine or TaxRoundingInvoice, for the invoices it sends
     CreatedAt                time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
     UpdatedAt                time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+    CreditBalance            []CreditBalance `gorm:"-" json:"credit_balance,omitempty"` // Filled in when a single company is fetched
 
     // Relations (without creating additional foreign keys in DB)
     /**
@@ -25,7 +29,7 @@ type Company struct {
     */
     DefaultBillingAddress    *Address  `gorm:"foreignKey:DefaultBillingAddressID;references:AddressID;constraint:false" json:"default_billing_address,omitempty"`
     DefaultShippingAddress   *Address  `gorm:"foreignKey:DefaultShippingAddressID;references:AddressID;constraint:false" json:"default_shipping_address,omitempty"`
-    Addresses              []Address   `gorm:"foreignKey:CompanyID;references:CompanyID;constraint:false  json:"addresses,omitempty"`
+    Addresses              []Address   `gorm:"foreignKey:CompanyID;references:CompanyID;constraint:false" json:"addresses,omitempty"`
 }
 
 // Address represents the unified addresses table.
@@ -48,7 +52,9 @@ type Item struct {
     ItemID      uint		`json:"item_id" gorm:"primaryKey;type:int unsigned"`
     Name        string    	`json:"name" gorm:"type:varchar(100);not null"`
     Description string    	`json:"description" gorm:"type:text"`
-    UnitPrice   float64   	`json:"unit_price" gorm:"type:decimal(10,2);not null"`
+    UnitPrice   money.Amount	`json:"unit_price" gorm:"type:decimal(10,2);not null"`
+    Currency    string    	`json:"currency" gorm:"type:char(3);not null;default:'IDR'"` // ISO 4217 code of UnitPrice
+    TaxInclusive bool     	`json:"tax_inclusive" gorm:"not null;default:false"` // UnitPrice includes the sales tax
 	Type    	string    	`json:"category" gorm:"size:50;not null"`
     Stock       int       	`json:"stock" gorm:"not null;default:0"`
     ImagePath   string    	`json:"image_path" gorm:"type:varchar(255)"`
@@ -59,51 +65,83 @@ type Item struct {
 
 // Order represents a customer order for a specific product
 type Order struct {
-    OrderID           uint       `gorm:"primaryKey;autoIncrement;column:order_id" json:"order_id"`
-    CustomerCompanyID uint       `gorm:"column:customer_company_id;not null;index" json:"customer_company_id"`
-    OrderDate         time.Time  `gorm:"column:order_date;not null" json:"order_date"` // Use DATE type mapping as needed
-    TotalPrice        *float64   `gorm:"column:total_price" json:"total_price,omitempty"`
-    Status            string     `gorm:"column:status;not null;default:'Pending';index" json:"status"`
-    CreatedAt         time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
-    UpdatedAt         time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+    OrderID            uint          `gorm:"primaryKey;autoIncrement;column:order_id" json:"order_id"`
+    CustomerCompanyID  uint          `gorm:"column:customer_company_id;not null;index" json:"customer_company_id"`
+    OrderDate          time.Time     `gorm:"column:order_date;not null" json:"order_date"` // Use DATE type mapping as needed
+    TotalPrice         *money.Amount `gorm:"column:total_price" json:"total_price,omitempty"` // Line totals less the order discount
+    DiscountCode       *string       `gorm:"column:discount_code" json:"discount_code,omitempty"` // Promo code redeemed by the order
+    DiscountPercentage float64       `gorm:"column:discount_percentage;type:decimal(5,2);not null;default:0.00" json:"discount_percentage"`
+    DiscountAmount     money.Amount  `gorm:"column:discount_amount;not null;default:0.00" json:"discount_amount"` // Fixed order discount in the order currency
+    Discount           money.Amount  `gorm:"column:discount;not null;default:0.00" json:"discount"` // Order discount applied, line discounts excluded
+    Currency           string        `gorm:"column:currency;type:char(3);not null;default:'IDR'" json:"currency"`
+    Status             string        `gorm:"column:status;not null;default:'Pending';index" json:"status"`
+    CreatedAt          time.Time     `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+    UpdatedAt          time.Time     `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+    // Invoicing progress, filled by database.LoadOrderInvoicing
+    InvoicedTotal      money.Amount  `gorm:"-" json:"invoiced_total"`
+    RemainingTotal     money.Amount  `gorm:"-" json:"remaining_total"`
     // Associations
-    OrderItems        []OrderItem `gorm:"foreignKey:OrderID" json:"order_items"`
-    CustomerCompany   Company     `gorm:"foreignKey:CustomerCompanyID;references:CompanyID" json:"customer"`
+    OrderItems         []OrderItem   `gorm:"foreignKey:OrderID" json:"order_items"`
+    CustomerCompany    Company       `gorm:"foreignKey:CustomerCompanyID;references:CompanyID" json:"customer"`
 }
 
 // OrderItem represents the order_items table.
 type OrderItem struct {
-    OrderItemID uint     `gorm:"primaryKey;autoIncrement;column:order_item_id" json:"order_item_id"`
-    OrderID     uint     `gorm:"column:order_id;not null;index" json:"order_id"`
-    ItemID      uint     `gorm:"column:item_id;not null" json:"item_id"`
-    Quantity    float64  `gorm:"column:quantity;not null" json:"quantity"`        // DECIMAL(10,2) for flexibility
-    UnitPrice   float64  `gorm:"column:unit_price;not null" json:"unit_price"`
-    ItemTotal   float64  `gorm:"column:item_total;not null" json:"item_total"`
+    OrderItemID        uint         `gorm:"primaryKey;autoIncrement;column:order_item_id" json:"order_item_id"`
+    OrderID            uint         `gorm:"column:order_id;not null;index" json:"order_id"`
+    ItemID             uint         `gorm:"column:item_id;not null" json:"item_id"`
+    Quantity           float64      `gorm:"column:quantity;not null" json:"quantity"`        // DECIMAL(10,2) for flexibility
+    UnitPrice          money.Amount `gorm:"column:unit_price;not null" json:"unit_price"`
+    DiscountPercentage float64      `gorm:"column:discount_percentage;type:decimal(5,2);not null;default:0.00" json:"discount_percentage"`
+    DiscountAmount     money.Amount `gorm:"column:discount_amount;not null;default:0.00" json:"discount_amount"` // Fixed amount off the line, on top of the percentage
+    Discount           money.Amount `gorm:"column:discount;not null;default:0.00" json:"discount"` // Line discount applied
+    ItemTotal          money.Amount `gorm:"column:item_total;not null" json:"item_total"` // Quantity × unit price less the line discount
+    // Invoicing progress, filled by database.LoadOrderInvoicing
+    InvoicedQuantity   float64      `gorm:"-" json:"invoiced_quantity"`
+    RemainingQuantity  float64      `gorm:"-" json:"remaining_quantity"`
+    InvoicedAmount     money.Amount `gorm:"-" json:"invoiced_amount"`
+    RemainingAmount    money.Amount `gorm:"-" json:"remaining_amount"`
     // Associations
-    Order       Order    `gorm:"foreignKey:OrderID;references:OrderID" json:"order"`
-    Item        Item     `gorm:"foreignKey:ItemID;references:ItemID" json:"item"`
+    Order              Order        `gorm:"foreignKey:OrderID;references:OrderID" json:"order"`
+    Item               Item         `gorm:"foreignKey:ItemID;references:ItemID" json:"item"`
 }
 
 
 // Invoice represents the invoices table.
 type Invoice struct {
     InvoiceID          uint         `gorm:"type:int unsigned;primaryKey;autoIncrement;column:invoice_id" json:"invoice_id"`
-    SenderCompanyID    uint         `gorm:"type:int unsigned;column:sender_company_id;not null" json:"sender_company_id"`
+    SenderCompanyID    uint         `gorm:"type:int unsigned;column:sender_company_id;not null;uniqueIndex:unique_invoice_number" json:"sender_company_id"`
     RecipientCompanyID uint         `gorm:"type:int unsigned;column:recipient_company_id;not null;index" json:"recipient_company_id"`
     BillingAddressID   uint         `gorm:"type:int unsigned;column:billing_address_id;not null" json:"billing_address_id"`
     ShippingAddressID  *uint        `gorm:"type:int unsigned;column:shipping_address_id" json:"shipping_address_id,omitempty"`
     OrderID            *uint        `gorm:"type:int unsigned;column:order_id" json:"order_id,omitempty"`
-    InvoiceNumber      string       `gorm:"column:invoice_number;not null;unique" json:"invoice_number"`
+    RecurringInvoiceID *uint        `gorm:"type:int unsigned;column:recurring_invoice_id;uniqueIndex:unique_invoice_recurrence" json:"recurring_invoice_id,omitempty"`
+    RecurrenceDate     *time.Time   `gorm:"column:recurrence_date;type:date;uniqueIndex:unique_invoice_recurrence" json:"recurrence_date,omitempty"` // Scheduled run that generated the invoice
+    InvoiceNumber      string       `gorm:"column:invoice_number;not null;uniqueIndex:unique_invoice_number" json:"invoice_number"`
     InvoiceDate        time.Time    `gorm:"column:invoice_date;not null" json:"invoice_date"`
     DueDate            time.Time    `gorm:"column:due_date;not null" json:"due_date"`
+    DaysOverdue        int          `gorm:"column:days_overdue;not null;default:0" json:"days_overdue"` // Kept up to date by the overdue job while an amount is due
+    DunningLevel       int          `gorm:"column:dunning_level;not null;default:0" json:"dunning_level"` // Highest dunning level a reminder was sent for, 0 for none
+    FeeForInvoiceID    *uint        `gorm:"type:int unsigned;column:fee_for_invoice_id;index" json:"fee_for_invoice_id,omitempty"` // Set on fee invoices, the overdue invoice they charge late fees on
     InvoiceSubject     *string      `gorm:"column:invoice_subject" json:"invoice_subject,omitempty"`
-    Subtotal           float64      `gorm:"column:subtotal;not null;default:0.00" json:"subtotal"`
-    TaxTotal           float64      `gorm:"column:tax_total;not null;default:0.00" json:"tax_total"`
-    GrandTotal         float64      `gorm:"column:grand_total;not null;default:0.00" json:"grand_total"`
-    AmountPaid         float64      `gorm:"column:amount_paid;not null;default:0.00" json:"amount_paid"`
-    AmountDue          float64      `gorm:"column:amount_due;not null;default:0.00" json:"amount_due"`
+    Subtotal           money.Amount `gorm:"column:subtotal;not null;default:0.00" json:"subtotal"`
+    DiscountPercentage float64      `gorm:"column:discount_percentage;type:decimal(5,2);not null;default:0.00" json:"discount_percentage"`
+    DiscountAmount     money.Amount `gorm:"column:discount_amount;not null;default:0.00" json:"discount_amount"` // Fixed invoice discount, on top of the percentage
+    Discount           money.Amount `gorm:"column:discount;not null;default:0.00" json:"discount"` // Invoice discount applied, line discounts excluded
+    TaxTotal           money.Amount `gorm:"column:tax_total;not null;default:0.00" json:"tax_total"`
+    GrandTotal         money.Amount `gorm:"column:grand_total;not null;default:0.00" json:"grand_total"`
+    AmountPaid         money.Amount `gorm:"column:amount_paid;not null;default:0.00" json:"amount_paid"`
+    AmountWithheld     money.Amount `gorm:"column:amount_withheld;not null;default:0.00" json:"amount_withheld"` // Tax withheld by the customer on its payments
+    AmountCredited     money.Amount `gorm:"column:amount_credited;not null;default:0.00" json:"amount_credited"` // Sum of credit notes, as a positive amount
+    CreditApplied      money.Amount `gorm:"column:credit_applied;not null;default:0.00" json:"credit_applied"` // Taken from the customer's credit balance, net of the excess moved into it
+    AmountDue          money.Amount `gorm:"column:amount_due;not null;default:0.00" json:"amount_due"`
+    WithholdingTotal   money.Amount `gorm:"column:withholding_total;not null;default:0.00" json:"withholding_total"` // Withheld by the buyer, not part of GrandTotal
     Status             string       `gorm:"column:status;not null;default:'Draft';index" json:"status"`
     Notes              *string      `gorm:"column:notes" json:"notes,omitempty"`
+    Currency           string       `gorm:"column:currency;type:char(3);not null;default:'IDR'" json:"currency"`
+    ExchangeRate       float64      `gorm:"column:exchange_rate;type:decimal(18,8);not null;default:1" json:"exchange_rate"` // Base currency units per unit of Currency, fixed when the invoice is created
+    TaxInclusive       bool         `gorm:"column:tax_inclusive;not null;default:false" json:"tax_inclusive"` // Unit prices and line totals include the sales taxes
+    TaxRounding        string       `gorm:"column:tax_rounding;not null;default:'line'" json:"tax_rounding"` // Copied from the sender company
     CreatedAt          time.Time    `gorm:"column:created_at;autoCreateTime" json:"created_at"`
     UpdatedAt          time.Time    `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
     // Associations
@@ -113,35 +151,300 @@ type Invoice struct {
     ShippingAddress    *Address     `gorm:"foreignKey:ShippingAddressID;references:AddressID;constraint:OnDelete:RESTRICT" json:"shipping_address,omitempty"`
     Order              *Order       `gorm:"foreignKey:OrderID;references:OrderID;constraint:OnDelete:RESTRICT" json:"order,omitempty"`
     InvoiceItems       []InvoiceItem `gorm:"foreignKey:InvoiceID;references:InvoiceID;constraint:OnDelete:CASCADE" json:"invoice_items"`
+    Taxes              []InvoiceTax  `gorm:"foreignKey:InvoiceID;references:InvoiceID;constraint:OnDelete:CASCADE" json:"taxes,omitempty"`
 }
 
 // InvoiceItem represents the invoice_items table.
 type InvoiceItem struct {
-    InvoiceItemID     uint     `gorm:"primaryKey;autoIncrement;column:invoice_item_id" json:"invoice_item_id"`
-    InvoiceID         uint     `gorm:"column:invoice_id;not null;index" json:"invoice_id"`
-    ItemID            *uint    `gorm:"column:item_id" json:"item_id,omitempty"` // Nullable: custom line items allowed
-    Description       string   `gorm:"column:description;not null" json:"description"`
-    Quantity          float64  `gorm:"column:quantity;not null" json:"quantity"`
-    UnitPrice         float64  `gorm:"column:unit_price;not null" json:"unit_price"`
-    ItemTotal         float64  `gorm:"column:item_total;not null" json:"item_total"`
-    TaxRatePercentage float64  `gorm:"column:tax_rate_percentage;default:0.00" json:"tax_rate_percentage"`
+    InvoiceItemID             uint         `gorm:"primaryKey;autoIncrement;column:invoice_item_id" json:"invoice_item_id"`
+    InvoiceID                 uint         `gorm:"column:invoice_id;not null;index" json:"invoice_id"`
+    ItemID                    *uint        `gorm:"column:item_id" json:"item_id,omitempty"` // Nullable: custom line items allowed
+    Description               string       `gorm:"column:description;not null" json:"description"`
+    Quantity                  float64      `gorm:"column:quantity;not null" json:"quantity"`
+    UnitPrice                 money.Amount `gorm:"column:unit_price;not null" json:"unit_price"`
+    DiscountPercentage        float64      `gorm:"column:discount_percentage;default:0.00" json:"discount_percentage"`
+    DiscountAmount            money.Amount `gorm:"column:discount_amount;not null;default:0.00" json:"discount_amount"` // Fixed amount off the line, on top of the percentage
+    Discount                  money.Amount `gorm:"column:discount;not null;default:0.00" json:"discount"` // Line discount applied
+    ItemTotal                 money.Amount `gorm:"column:item_total;not null" json:"item_total"` // Quantity × unit price less the line discount
+    InvoiceDiscount           money.Amount `gorm:"column:invoice_discount;not null;default:0.00" json:"invoice_discount"` // Share of the invoice discount
+    TaxRatePercentage         float64      `gorm:"column:tax_rate_percentage;default:0.00" json:"tax_rate_percentage"`
+    TaxCode                   *string      `gorm:"column:tax_code" json:"tax_code,omitempty"` // Nil for lines taxed at a free-typed rate
+    WithholdingTaxCode        *string      `gorm:"column:withholding_tax_code" json:"withholding_tax_code,omitempty"`
+    WithholdingRatePercentage float64      `gorm:"column:withholding_rate_percentage;default:0.00" json:"withholding_rate_percentage"`
+    OrderItemID               *uint        `gorm:"column:order_item_id" json:"order_item_id,omitempty"` // Set when the line bills an order line
+    PriceTaxInclusive         *bool        `gorm:"-" json:"-"` // Set when UnitPrice was taken from the catalog, converted to the invoice pricing once the tax rate is known
     // Associations
-    Invoice           Invoice  `gorm:"foreignKey:InvoiceID;references:InvoiceID" json:"invoice"`
-    Item              *Item    `gorm:"foreignKey:ItemID;references:ItemID" json:"item,omitempty"`
+    Invoice                   Invoice      `gorm:"foreignKey:InvoiceID;references:InvoiceID" json:"invoice"`
+    Item                      *Item        `gorm:"foreignKey:ItemID;references:ItemID" json:"item,omitempty"`
 }
 
 // Payment represents the payments table.
 type Payment struct {
-    PaymentID               uint       `gorm:"primaryKey;autoIncrement;column:payment_id" json:"payment_id"`
-    InvoiceID               uint       `gorm:"column:invoice_id;not null;index" json:"invoice_id"`
-    PaymentDate             time.Time  `gorm:"column:payment_date;not null" json:"payment_date"`
-    Amount                  float64    `gorm:"column:amount;not null" json:"amount"`
-    Method                  *string    `gorm:"column:method" json:"method,omitempty"` // e.g., Credit Card, Bank Transfer, etc.
-    TransactionReference    *string    `gorm:"column:transaction_references";"type:varchar(255)" json:"transaction_references"`
-    Status                  string     `gorm:"column:status;not null;default:'Completed'" json:"status"`
-    CreatedAt               time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+    PaymentID            uint         `gorm:"primaryKey;autoIncrement;column:payment_id" json:"payment_id"`
+    InvoiceID            uint         `gorm:"column:invoice_id;not null;index" json:"invoice_id"`
+    PaymentDate          time.Time    `gorm:"column:payment_date;not null" json:"payment_date"`
+    Amount               money.Amount `gorm:"column:amount;not null" json:"amount"` // Cash received
+    WithholdingAmount    money.Amount `gorm:"column:withholding_amount;not null;default:0.00" json:"withholding_amount"` // Tax withheld by the customer, settles the invoice along with Amount
+    WithholdingTaxCode   *string      `gorm:"column:withholding_tax_code" json:"withholding_tax_code,omitempty"`
+    CertificateNumber    *string      `gorm:"column:certificate_number" json:"certificate_number,omitempty"` // Withholding certificate issued by the customer, nil until collected
+    CertificateDate      *time.Time   `gorm:"column:certificate_date" json:"certificate_date,omitempty"`
+    Currency             string       `gorm:"column:currency;type:char(3);not null;default:'IDR'" json:"currency"` // Always the invoice currency
+    Method               *string      `gorm:"column:method" json:"method,omitempty"` // e.g., Credit Card, Bank Transfer, etc.
+    TransactionReference *string      `gorm:"column:transaction_reference;type:varchar(255)" json:"transaction_reference,omitempty"`
+    Status               string       `gorm:"column:status;not null;default:'completed'" json:"status"` // PaymentStatusCompleted and the other payment statuses
+    ReceiptID            *uint        `gorm:"column:receipt_id;index" json:"receipt_id,omitempty"` // Receipt the payment was allocated from, nil when recorded directly
+    Type                 string       `gorm:"column:type;not null;default:'payment'" json:"type"` // PaymentTypePayment, or a reversal with a negative Amount
+    ReversesPaymentID    *uint        `gorm:"column:reverses_payment_id;index" json:"reverses_payment_id,omitempty"` // Payment a refund or chargeback reverses
+    Reason               *string      `gorm:"column:reason" json:"reason,omitempty"` // Why a payment was reversed
+    CreatedAt            time.Time    `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+    // Associations
+    Invoice              Invoice      `gorm:"foreignKey:InvoiceID;references:InvoiceID" json:"invoice"`
+}
+
+// Payment types stored in payments.type. Refunds and chargebacks reverse part
+// or all of a payment with a negative amount.
+const (
+    PaymentTypePayment    = "payment"
+    PaymentTypeRefund     = "refund"     // Money paid back to the customer
+    PaymentTypeChargeback = "chargeback" // Payment pulled back by the customer's bank or card issuer
+)
+
+// Receipt represents the receipts table: money received from a customer
+// company in one transfer, allocated to its invoices as payments. The part not
+// allocated yet is kept as credit of the customer.
+type Receipt struct {
+    ReceiptID            uint         `gorm:"primaryKey;autoIncrement;column:receipt_id" json:"receipt_id"`
+    RecipientCompanyID   uint         `gorm:"column:recipient_company_id;not null;index" json:"recipient_company_id"` // Customer company the money came from
+    ReceiptDate          time.Time    `gorm:"column:receipt_date;not null" json:"receipt_date"`
+    Amount               money.Amount `gorm:"column:amount;not null" json:"amount"`
+    AmountAllocated      money.Amount `gorm:"column:amount_allocated;not null;default:0.00" json:"amount_allocated"`
+    AmountUnallocated    money.Amount `gorm:"column:amount_unallocated;not null;default:0.00" json:"amount_unallocated"` // Credit left for later allocations
+    Currency             string       `gorm:"column:currency;type:char(3);not null;default:'IDR'" json:"currency"` // ISO 4217 code, invoices are allocated in the same currency
+    Method               *string      `gorm:"column:method" json:"method,omitempty"`
+    TransactionReference *string      `gorm:"column:transaction_reference;type:varchar(255)" json:"transaction_reference,omitempty"`
+    Notes                *string      `gorm:"column:notes;type:text" json:"notes,omitempty"`
+    CreatedAt            time.Time    `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+    UpdatedAt            time.Time    `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+    // Associations
+    Allocations          []Payment    `gorm:"foreignKey:ReceiptID;references:ReceiptID" json:"allocations,omitempty"`
+}
+
+// Credit entry types stored in credit_entries.type
+const (
+    CreditEntryOverpayment = "overpayment" // Payments beyond the total of an invoice
+    CreditEntryCreditNote  = "credit_note" // Credit notes beyond what was left due on an invoice
+    CreditEntryReceipt     = "receipt"     // Part of a receipt not allocated to invoices, negative once allocated later
+    CreditEntryApplied     = "applied"     // Credit applied to an invoice
+    CreditEntryRefund      = "refund"      // Credit paid back to the customer
+)
+
+// CreditEntry represents the credit_entries table: the ledger of the credit
+// balance of a customer company. Positive amounts add to the balance and
+// negative amounts use it. Entries with an InvoiceID move credit between the
+// balance and that invoice.
+type CreditEntry struct {
+    CreditEntryID  uint         `gorm:"primaryKey;autoIncrement;column:credit_entry_id" json:"credit_entry_id"`
+    CompanyID      uint         `gorm:"column:company_id;not null;index" json:"company_id"`
+    EntryDate      time.Time    `gorm:"column:entry_date;not null" json:"entry_date"`
+    Type           string       `gorm:"column:type;not null" json:"type"`
+    Amount         money.Amount `gorm:"column:amount;not null" json:"amount"`
+    Currency       string       `gorm:"column:currency;type:char(3);not null" json:"currency"` // Balances are kept per currency
+    InvoiceID      *uint        `gorm:"column:invoice_id;index" json:"invoice_id,omitempty"`
+    ReceiptID      *uint        `gorm:"column:receipt_id" json:"receipt_id,omitempty"`
+    CreditRefundID *uint        `gorm:"column:credit_refund_id" json:"credit_refund_id,omitempty"`
+    Description    string       `gorm:"column:description" json:"description"`
+    CreatedAt      time.Time    `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// CreditRefund represents the credit_refunds table: credit balance paid back
+// to a customer company
+type CreditRefund struct {
+    CreditRefundID       uint         `gorm:"primaryKey;autoIncrement;column:credit_refund_id" json:"credit_refund_id"`
+    CompanyID            uint         `gorm:"column:company_id;not null;index" json:"company_id"`
+    RefundDate           time.Time    `gorm:"column:refund_date;not null" json:"refund_date"`
+    Amount               money.Amount `gorm:"column:amount;not null" json:"amount"`
+    Currency             string       `gorm:"column:currency;type:char(3);not null" json:"currency"`
+    Method               *string      `gorm:"column:method" json:"method,omitempty"`
+    TransactionReference *string      `gorm:"column:transaction_reference;type:varchar(255)" json:"transaction_reference,omitempty"`
+    Notes                *string      `gorm:"column:notes;type:text" json:"notes,omitempty"`
+    CreatedAt            time.Time    `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// CreditBalance is the credit a customer company holds in one currency
+type CreditBalance struct {
+    Currency string       `json:"currency"`
+    Amount   money.Amount `json:"amount"`
+}
+
+// Bank statement line statuses stored in bank_statement_lines.status. Lines
+// waiting for a human are unmatched or proposed.
+const (
+    BankLineUnmatched = "unmatched" // No open invoice looks like a match
+    BankLineProposed  = "proposed"  // Matches are proposed, waiting for confirmation
+    BankLineMatched   = "matched"   // Confirmed and recorded as a payment
+    BankLineIgnored   = "ignored"   // Not a customer payment, e.g. bank charges
+)
+
+// Rules a bank statement line was matched to an invoice by, stored in bank_matches.rule
+const (
+    BankMatchTransactionReference = "transaction_reference" // Reference of a payment recorded on the invoice
+    BankMatchInvoiceNumber        = "invoice_number"        // Invoice number in the description or reference
+    BankMatchAmount               = "amount"                // Amount due on the invoice
+)
+
+// BankStatement represents the bank_statements table: one uploaded statement file
+type BankStatement struct {
+    BankStatementID uint                `gorm:"primaryKey;autoIncrement;column:bank_statement_id" json:"bank_statement_id"`
+    FileName        string              `gorm:"column:file_name;not null" json:"file_name"`
+    Format          string              `gorm:"column:format;not null" json:"format"` // csv, ofx or mt940
+    Account         *string             `gorm:"column:account" json:"account,omitempty"` // Account number, when the file carries it
+    Currency        string              `gorm:"column:currency;type:char(3);not null" json:"currency"`
+    LineCount       int                 `gorm:"column:line_count;not null;default:0" json:"line_count"` // Lines imported
+    SkippedCount    int                 `gorm:"column:skipped_count;not null;default:0" json:"skipped_count"` // Lines skipped as imported before
+    CreatedAt       time.Time           `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+    // Associations
+    Lines           []BankStatementLine `gorm:"foreignKey:BankStatementID;references:BankStatementID" json:"lines,omitempty"`
+}
+
+// BankStatementLine represents the bank_statement_lines table: one
+// transaction of a bank statement, reconciled with a payment once matched
+type BankStatementLine struct {
+    BankStatementLineID uint         `gorm:"primaryKey;autoIncrement;column:bank_statement_line_id" json:"bank_statement_line_id"`
+    BankStatementID     uint         `gorm:"column:bank_statement_id;not null;index" json:"bank_statement_id"`
+    LineDate            time.Time    `gorm:"column:line_date;not null" json:"line_date"`
+    Amount              money.Amount `gorm:"column:amount;not null" json:"amount"` // Positive for money received, negative for money paid out
+    Currency            string       `gorm:"column:currency;type:char(3);not null" json:"currency"`
+    Description         string       `gorm:"column:description;type:text" json:"description"`
+    Reference           *string      `gorm:"column:reference" json:"reference,omitempty"` // Reference given by the payer
+    BankReference       *string      `gorm:"column:bank_reference" json:"bank_reference,omitempty"` // Identifier of the transaction at the bank
+    Status              string       `gorm:"column:status;not null;default:'unmatched';index" json:"status"`
+    PaymentID           *uint        `gorm:"column:payment_id;index" json:"payment_id,omitempty"` // Payment the line was reconciled with
+    CreatedAt           time.Time    `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+    UpdatedAt           time.Time    `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
     // Associations
-    Invoice                 Invoice    `gorm:"foreignKey:InvoiceID;references:InvoiceID" json:"invoice"`
+    Matches             []BankMatch  `gorm:"foreignKey:BankStatementLineID;references:BankStatementLineID" json:"matches,omitempty"`
+}
+
+// BankMatch represents the bank_matches table: an open invoice proposed as
+// the one a bank statement line pays, best score first
+type BankMatch struct {
+    BankMatchID         uint         `gorm:"primaryKey;autoIncrement;column:bank_match_id" json:"bank_match_id"`
+    BankStatementLineID uint         `gorm:"column:bank_statement_line_id;not null;index" json:"bank_statement_line_id"`
+    InvoiceID           uint         `gorm:"column:invoice_id;not null" json:"invoice_id"`
+    InvoiceNumber       string       `gorm:"column:invoice_number;not null" json:"invoice_number"`
+    PaymentID           *uint        `gorm:"column:payment_id" json:"payment_id,omitempty"` // Payment recorded before with the same reference, confirmed instead of creating one
+    Rule                string       `gorm:"column:rule;not null" json:"rule"`
+    Score               int          `gorm:"column:score;not null" json:"score"` // Up to 100
+    AmountDue           money.Amount `gorm:"column:amount_due;not null" json:"amount_due"` // Amount due on the invoice when proposed
+    CreatedAt           time.Time    `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// CreditNote represents the credit_notes table. A credit note reverses all or
+// part of an issued invoice; its totals are negative.
+type CreditNote struct {
+    CreditNoteID       uint             `gorm:"primaryKey;autoIncrement;column:credit_note_id" json:"credit_note_id"`
+    InvoiceID          uint             `gorm:"column:invoice_id;not null;index" json:"invoice_id"`
+    SenderCompanyID    uint             `gorm:"column:sender_company_id;not null;uniqueIndex:unique_credit_note_number" json:"sender_company_id"`
+    RecipientCompanyID uint             `gorm:"column:recipient_company_id;not null;index" json:"recipient_company_id"`
+    CreditNoteNumber   string           `gorm:"column:credit_note_number;not null;uniqueIndex:unique_credit_note_number" json:"credit_note_number"`
+    CreditNoteDate     time.Time        `gorm:"column:credit_note_date;not null" json:"credit_note_date"`
+    Reason             *string          `gorm:"column:reason" json:"reason,omitempty"`
+    Subtotal           money.Amount     `gorm:"column:subtotal;not null;default:0.00" json:"subtotal"`
+    TaxTotal           money.Amount     `gorm:"column:tax_total;not null;default:0.00" json:"tax_total"`
+    GrandTotal         money.Amount     `gorm:"column:grand_total;not null;default:0.00" json:"grand_total"`
+    Currency           string           `gorm:"column:currency;type:char(3);not null;default:'IDR'" json:"currency"` // Always the invoice currency
+    TaxInclusive       bool             `gorm:"column:tax_inclusive;not null;default:false" json:"tax_inclusive"` // Always the invoice pricing
+    CreatedAt          time.Time        `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+    UpdatedAt          time.Time        `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+    // Associations
+    CreditNoteItems    []CreditNoteItem `gorm:"foreignKey:CreditNoteID;references:CreditNoteID;constraint:OnDelete:CASCADE" json:"credit_note_items"`
+}
+
+// CreditNoteItem represents the credit_note_items table. Quantities and totals
+// are negative and each line references the invoice line it reverses.
+type CreditNoteItem struct {
+    CreditNoteItemID          uint         `gorm:"primaryKey;autoIncrement;column:credit_note_item_id" json:"credit_note_item_id"`
+    CreditNoteID              uint         `gorm:"column:credit_note_id;not null;index" json:"credit_note_id"`
+    InvoiceItemID             uint         `gorm:"column:invoice_item_id;not null;index" json:"invoice_item_id"`
+    ItemID                    *uint        `gorm:"column:item_id" json:"item_id,omitempty"`
+    Description               string       `gorm:"column:description;not null" json:"description"`
+    Quantity                  float64      `gorm:"column:quantity;not null" json:"quantity"`
+    UnitPrice                 money.Amount `gorm:"column:unit_price;not null" json:"unit_price"`
+    Discount                  money.Amount `gorm:"column:discount;not null;default:0.00" json:"discount"` // Line and invoice discounts of the credited quantity
+    ItemTotal                 money.Amount `gorm:"column:item_total;not null" json:"item_total"`
+    TaxRatePercentage         float64      `gorm:"column:tax_rate_percentage;default:0.00" json:"tax_rate_percentage"`
+    TaxCode                   *string      `gorm:"column:tax_code" json:"tax_code,omitempty"`
+    WithholdingTaxCode        *string      `gorm:"column:withholding_tax_code" json:"withholding_tax_code,omitempty"`
+    WithholdingRatePercentage float64      `gorm:"column:withholding_rate_percentage;default:0.00" json:"withholding_rate_percentage"`
+}
+
+// InvoiceTemplate represents the invoice_templates table. A sender company can
+// keep several html/template layouts; the active one is used when rendering.
+type InvoiceTemplate struct {
+    TemplateID   uint      `gorm:"primaryKey;autoIncrement;column:template_id" json:"template_id"`
+    CompanyID    uint      `gorm:"column:company_id;not null;index" json:"company_id"`
+    Name         string    `gorm:"column:name;not null" json:"name"`
+    Language     string    `gorm:"column:language;not null;default:'en'" json:"language"`
+    PrimaryColor string    `gorm:"column:primary_color;not null;default:'#333333'" json:"primary_color"`
+    AccentColor  string    `gorm:"column:accent_color;not null;default:'#E6E6E6'" json:"accent_color"`
+    FooterText   *string   `gorm:"column:footer_text" json:"footer_text,omitempty"`
+    BankDetails  *string   `gorm:"column:bank_details" json:"bank_details,omitempty"`
+    Body         string    `gorm:"column:body;type:mediumtext" json:"body,omitempty"` // html/template source; empty uses the built-in layout
+    IsActive     bool      `gorm:"column:is_active;not null;default:false" json:"is_active"`
+    CreatedAt    time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+    UpdatedAt    time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// CompanyBalance summarises what a customer company owes
+type CompanyBalance struct {
+    CompanyID     uint         `json:"company_id"`
+    Currency      string       `json:"currency"` // Base reporting currency of the amounts
+    TotalInvoiced money.Amount `json:"total_invoiced"`
+    TotalCredited money.Amount `json:"total_credited"`
+    TotalPaid     money.Amount `json:"total_paid"`
+    TotalWithheld money.Amount `json:"total_withheld"`
+    CreditBalance money.Amount `json:"credit_balance"` // Credit the customer holds, converted at today's rates
+    Outstanding   money.Amount `json:"outstanding"`
+}
+
+// DocumentNumberSeries represents the document_number_series table. Each sender
+// company has its own gap-free series per document type.
+type DocumentNumberSeries struct {
+    SeriesID      uint      `gorm:"primaryKey;autoIncrement;column:series_id" json:"series_id"`
+    CompanyID     uint      `gorm:"column:company_id;not null;uniqueIndex:idx_series_company_type" json:"company_id"`
+    DocumentType  string    `gorm:"column:document_type;not null;uniqueIndex:idx_series_company_type" json:"document_type"` // e.g., invoice
+    Prefix        string    `gorm:"column:prefix;not null" json:"prefix"`
+    Pattern       string    `gorm:"column:pattern;not null" json:"pattern"` // tokens: {PREFIX} {YYYY} {YY} {MM} {SEQ}
+    Padding       int       `gorm:"column:padding;not null;default:4" json:"padding"`
+    ResetYearly   bool      `gorm:"column:reset_yearly;not null;default:true" json:"reset_yearly"`
+    CurrentYear   int       `gorm:"column:current_year;not null;default:0" json:"current_year"`
+    NextValue     int64     `gorm:"column:next_value;not null;default:1" json:"next_value"`
+    CreatedAt     time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+    UpdatedAt     time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// DocumentNumberYear represents the document_number_years table: where a
+// yearly series stopped in a year it has moved on from, so documents dated in
+// that year keep being numbered in its sequence
+type DocumentNumberYear struct {
+    SeriesID  uint  `gorm:"primaryKey;column:series_id" json:"series_id"`
+    Year      int   `gorm:"primaryKey;column:year" json:"year"`
+    NextValue int64 `gorm:"column:next_value;not null;default:1" json:"next_value"`
+}
+
+// Document types with their own number series
+const (
+    DocumentTypeInvoice    = "invoice"
+    DocumentTypeCreditNote = "credit_note"
+)
+
+// IsDocumentType reports whether t is a document type with a number series
+func IsDocumentType(t string) bool {
+    switch t {
+    case DocumentTypeInvoice, DocumentTypeCreditNote:
+        return true
+    }
+    return false
 }
 
 /**
@@ -157,6 +460,7 @@ type CompanyRequest struct {
 	IsVendor                bool   `json:"is_vendor"`
 	DefaultBillingAddressID *uint  `json:"default_billing_address_id"`
 	DefaultShippingAddressID *uint `json:"default_shipping_address_id"`
+	TaxRounding             string `json:"tax_rounding" binding:"omitempty,oneof=line invoice"` // defaults to per-line rounding
 }
 
 // AddressRequest is used for creating/updating an address
@@ -174,7 +478,7 @@ type AddressRequest struct {
 type ItemRequest struct {
 	ItemName        string  `json:"item_name" binding:"required,min=1,max=100"`
 	ItemDescription string  `json:"item_description" binding:"max=500"`
-	UnitPrice       float64 `json:"unit_price" binding:"required,min=0"`
+	UnitPrice       money.Amount `json:"unit_price"` // Validated by the handler, must not be negative
 	ItemType        string  `json:"item_type" binding:"required,min=1,max=50"`
 	ImagePath       string  `json:"image_path" binding:"max=255"`
 }
@@ -195,15 +499,22 @@ type OrderItemRequest struct {
 
 // Invoice Details
 type InvoiceDetail struct {
-    InvoiceID         uint    `gorm:"column:invoice_id"`
-    Status            string  `gorm:"column:status"`
-    InvoiceItemID     uint    `gorm:"column:invoice_item_id"`
-    ItemName          string  `gorm:"column:name"`
-    Description       string  `gorm:"column:description"`
-    Quantity          float64 `gorm:"column:quantity"`
-    UnitPrice         float64 `gorm:"column:unit_price"`
-    ItemTotal         float64 `gorm:"column:item_total"`
-    TaxRatePercentage float64 `gorm:"column:tax_rate_percentage"`
+    InvoiceID                 uint         `gorm:"column:invoice_id"`
+    Status                    string       `gorm:"column:status"`
+    InvoiceItemID             uint         `gorm:"column:invoice_item_id"`
+    ItemName                  string       `gorm:"column:name"`
+    Description               string       `gorm:"column:description"`
+    Quantity                  float64      `gorm:"column:quantity"`
+    UnitPrice                 money.Amount `gorm:"column:unit_price"`
+    DiscountPercentage        float64      `gorm:"column:discount_percentage"`
+    DiscountAmount            money.Amount `gorm:"column:discount_amount"`
+    Discount                  money.Amount `gorm:"column:discount"`
+    ItemTotal                 money.Amount `gorm:"column:item_total"`
+    InvoiceDiscount           money.Amount `gorm:"column:invoice_discount"`
+    TaxRatePercentage         float64      `gorm:"column:tax_rate_percentage"`
+    TaxCode                   *string      `gorm:"column:tax_code"`
+    WithholdingTaxCode        *string      `gorm:"column:withholding_tax_code"`
+    WithholdingRatePercentage float64      `gorm:"column:withholding_rate_percentage"`
 }
 
 // InvoiceRequest is used for creating an invoice
@@ -224,7 +535,7 @@ type InvoiceRequest struct {
 type PaymentRequest struct {
 	InvoiceID           uint      `json:"invoice_id" binding:"required"`
 	PaymentDate         time.Time `json:"payment_date" binding:"required"`
-	Amount              float64   `json:"amount" binding:"required,min=0.01"`
+	Amount              money.Amount `json:"amount"` // Validated by the handler, must be positive
 	Method              string    `json:"method" binding:"required,min=1,max=50"`
 	TransactionReference string    `json:"transaction_reference" binding:"max=100"`
 }
@@ -239,5 +550,309 @@ type InvoiceReportResponse struct {
 	Order            Order         `json:"order"`
 	Items            []InvoiceItem `json:"items"`
 	Payments         []Payment     `json:"payments"`
+	CreditNotes      []CreditNote  `json:"credit_notes"`
 	PaymentStatus    string        `json:"payment_status"`
-}
\ No newline at end of file
+	BaseAmounts      BaseAmounts   `json:"base_amounts"`
+}
+
+// BaseAmounts are the totals of a document converted into the base reporting
+// currency with the exchange rate stored on the invoice
+type BaseAmounts struct {
+    Currency       string       `json:"currency"`
+    ExchangeRate   float64      `json:"exchange_rate"`
+    Subtotal       money.Amount `json:"subtotal"`
+    TaxTotal       money.Amount `json:"tax_total"`
+    GrandTotal     money.Amount `json:"grand_total"`
+    AmountPaid     money.Amount `json:"amount_paid"`
+    AmountWithheld money.Amount `json:"amount_withheld"`
+    AmountCredited money.Amount `json:"amount_credited"`
+    CreditApplied  money.Amount `json:"credit_applied"`
+    AmountDue      money.Amount `json:"amount_due"`
+}
+
+// ExchangeRate represents the exchange_rates table. One unit of FromCurrency is
+// worth Rate units of ToCurrency from EffectiveDate until the next rate of the pair.
+type ExchangeRate struct {
+    RateID        uint      `gorm:"primaryKey;autoIncrement;column:rate_id" json:"rate_id"`
+    FromCurrency  string    `gorm:"column:from_currency;type:char(3);not null;uniqueIndex:unique_exchange_rate" json:"from_currency"`
+    ToCurrency    string    `gorm:"column:to_currency;type:char(3);not null;uniqueIndex:unique_exchange_rate" json:"to_currency"`
+    Rate          float64   `gorm:"column:rate;type:decimal(18,8);not null" json:"rate"`
+    EffectiveDate time.Time `gorm:"column:effective_date;type:date;not null;uniqueIndex:unique_exchange_rate" json:"effective_date"`
+    CreatedAt     time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+    UpdatedAt     time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// Tax code kinds. Standard codes add tax to the invoice, zero-rated and exempt
+// codes carry a 0% rate, withholding codes are withheld by the buyer.
+const (
+    TaxKindStandard    = "standard"
+    TaxKindZeroRated   = "zero_rated"
+    TaxKindExempt      = "exempt"
+    TaxKindWithholding = "withholding"
+)
+
+// IsTaxKind reports whether k is a known tax code kind
+func IsTaxKind(k string) bool {
+    switch k {
+    case TaxKindStandard, TaxKindZeroRated, TaxKindExempt, TaxKindWithholding:
+        return true
+    }
+    return false
+}
+
+// Tax rounding policies of a sender company. Per line, the taxes of every line
+// are rounded before being summed; per invoice, the taxes are summed per tax
+// code and rate and rounded once.
+const (
+    TaxRoundingLine    = "line"
+    TaxRoundingInvoice = "invoice"
+)
+
+// IsTaxRounding reports whether r is a known tax rounding policy
+func IsTaxRounding(r string) bool {
+    return r == TaxRoundingLine || r == TaxRoundingInvoice
+}
+
+// TaxCode represents the tax_codes table. A code such as VAT11 keeps one row per
+// rate change; the latest row effective on the document date applies.
+type TaxCode struct {
+    TaxCodeID      uint      `gorm:"primaryKey;autoIncrement;column:tax_code_id" json:"tax_code_id"`
+    Code           string    `gorm:"column:code;not null;uniqueIndex:unique_tax_code" json:"code"`
+    Name           string    `gorm:"column:name;not null" json:"name"`
+    Kind           string    `gorm:"column:kind;not null;default:'standard'" json:"kind"`
+    RatePercentage float64   `gorm:"column:rate_percentage;type:decimal(5,2);not null;default:0.00" json:"rate_percentage"`
+    EffectiveDate  time.Time `gorm:"column:effective_date;type:date;not null;uniqueIndex:unique_tax_code" json:"effective_date"`
+    CreatedAt      time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+    UpdatedAt      time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// TaxRule represents the tax_rules table. A rule assigns a tax code to the lines
+// whose seller, buyer and item type match its criteria; empty criteria match
+// anything. Per kind of code (sales tax or withholding) the rule matching the
+// most criteria wins, then the highest priority.
+type TaxRule struct {
+    RuleID              uint      `gorm:"primaryKey;autoIncrement;column:rule_id" json:"rule_id"`
+    TaxCode             string    `gorm:"column:tax_code;not null;index" json:"tax_code"`
+    SellerCountry       string    `gorm:"column:seller_country;not null;default:''" json:"seller_country"`
+    SellerStateProvince string    `gorm:"column:seller_state_province;not null;default:''" json:"seller_state_province"`
+    BuyerCountry        string    `gorm:"column:buyer_country;not null;default:''" json:"buyer_country"`
+    BuyerStateProvince  string    `gorm:"column:buyer_state_province;not null;default:''" json:"buyer_state_province"`
+    ItemType            string    `gorm:"column:item_type;not null;default:''" json:"item_type"` // Item.Type, empty for custom lines
+    Priority            int       `gorm:"column:priority;not null;default:0" json:"priority"`
+    CreatedAt           time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+    UpdatedAt           time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// InvoiceTax represents the invoice_taxes table: the taxable amount and tax of an
+// invoice per tax code and rate. Name and rate are copied so the breakdown does
+// not change when a code is edited later.
+type InvoiceTax struct {
+    InvoiceTaxID   uint         `gorm:"primaryKey;autoIncrement;column:invoice_tax_id" json:"invoice_tax_id"`
+    InvoiceID      uint         `gorm:"column:invoice_id;not null;index" json:"invoice_id"`
+    TaxCode        string       `gorm:"column:tax_code;not null;default:''" json:"tax_code"` // Empty for lines taxed at a free-typed rate
+    Name           string       `gorm:"column:name;not null;default:''" json:"name"`
+    Kind           string       `gorm:"column:kind;not null;default:'standard'" json:"kind"`
+    RatePercentage float64      `gorm:"column:rate_percentage;type:decimal(5,2);not null" json:"rate_percentage"`
+    TaxableAmount  money.Amount `gorm:"column:taxable_amount;not null" json:"taxable_amount"`
+    TaxAmount      money.Amount `gorm:"column:tax_amount;not null" json:"tax_amount"`
+}
+
+// DiscountCode represents the discount_codes table: a reusable promo code that
+// takes a percentage or a fixed amount off an order
+type DiscountCode struct {
+    DiscountCodeID     uint         `gorm:"primaryKey;autoIncrement;column:discount_code_id" json:"discount_code_id"`
+    Code               string       `gorm:"column:code;not null;uniqueIndex" json:"code"`
+    Description        *string      `gorm:"column:description" json:"description,omitempty"`
+    DiscountPercentage float64      `gorm:"column:discount_percentage;type:decimal(5,2);not null;default:0.00" json:"discount_percentage"`
+    DiscountAmount     money.Amount `gorm:"column:discount_amount;not null;default:0.00" json:"discount_amount"`
+    Currency           string       `gorm:"column:currency;type:char(3);not null;default:'IDR'" json:"currency"` // ISO 4217 code of DiscountAmount
+    ValidFrom          *time.Time   `gorm:"column:valid_from" json:"valid_from,omitempty"`
+    ValidUntil         *time.Time   `gorm:"column:valid_until" json:"valid_until,omitempty"`
+    MaxUses            *int         `gorm:"column:max_uses" json:"max_uses,omitempty"` // Nil for unlimited
+    TimesUsed          int          `gorm:"column:times_used;not null;default:0" json:"times_used"`
+    IsActive           bool         `gorm:"column:is_active;not null;default:true" json:"is_active"`
+    CreatedAt          time.Time    `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+    UpdatedAt          time.Time    `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// PendingCertificate is a payment on which the customer withheld tax without
+// the withholding certificate having been collected yet
+type PendingCertificate struct {
+    PaymentID          uint         `gorm:"column:payment_id" json:"payment_id"`
+    InvoiceID          uint         `gorm:"column:invoice_id" json:"invoice_id"`
+    InvoiceNumber      string       `gorm:"column:invoice_number" json:"invoice_number"`
+    PaymentDate        time.Time    `gorm:"column:payment_date" json:"payment_date"`
+    WithholdingTaxCode *string      `gorm:"column:withholding_tax_code" json:"withholding_tax_code,omitempty"`
+    WithholdingAmount  money.Amount `gorm:"column:withholding_amount" json:"withholding_amount"`
+    Currency           string       `gorm:"column:currency" json:"currency"`
+    ExchangeRate       float64      `gorm:"column:exchange_rate" json:"-"`
+    CompanyID          uint         `gorm:"column:company_id" json:"-"`
+    CompanyName        string       `gorm:"column:company_name" json:"-"`
+}
+
+// CustomerPendingCertificates groups the withholding certificates still to be
+// collected from one customer company
+type CustomerPendingCertificates struct {
+    CompanyID     uint                 `json:"company_id"`
+    CompanyName   string               `json:"company_name"`
+    Currency      string               `json:"currency"` // Base reporting currency of TotalWithheld
+    TotalWithheld money.Amount         `json:"total_withheld"`
+    Payments      []PendingCertificate `json:"payments"`
+}
+
+// Intervals of a recurring invoice
+const (
+    RecurrenceWeekly    = "weekly"
+    RecurrenceMonthly   = "monthly"
+    RecurrenceQuarterly = "quarterly"
+    RecurrenceYearly    = "yearly"
+)
+
+// IsRecurrenceInterval reports whether i is a known recurring invoice interval
+func IsRecurrenceInterval(i string) bool {
+    switch i {
+    case RecurrenceWeekly, RecurrenceMonthly, RecurrenceQuarterly, RecurrenceYearly:
+        return true
+    }
+    return false
+}
+
+// RecurringInvoice represents the recurring_invoices table: a template from which
+// an invoice is generated every interval from StartDate until EndDate.
+// Occurrences counts the runs generated or skipped so far, so NextRunDate is
+// always the Occurrences-th interval after StartDate.
+type RecurringInvoice struct {
+    RecurringInvoiceID uint                   `gorm:"primaryKey;autoIncrement;column:recurring_invoice_id" json:"recurring_invoice_id"`
+    SenderCompanyID    uint                   `gorm:"column:sender_company_id;not null;index" json:"sender_company_id"`
+    RecipientCompanyID uint                   `gorm:"column:recipient_company_id;not null;index" json:"recipient_company_id"`
+    BillingAddressID   uint                   `gorm:"column:billing_address_id;not null" json:"billing_address_id"`
+    ShippingAddressID  *uint                  `gorm:"column:shipping_address_id" json:"shipping_address_id,omitempty"`
+    InvoiceSubject     *string                `gorm:"column:invoice_subject" json:"invoice_subject,omitempty"`
+    Notes              *string                `gorm:"column:notes" json:"notes,omitempty"`
+    Currency           string                 `gorm:"column:currency;type:char(3);not null;default:'IDR'" json:"currency"`
+    TaxInclusive       bool                   `gorm:"column:tax_inclusive;not null;default:false" json:"tax_inclusive"`
+    DiscountPercentage float64                `gorm:"column:discount_percentage;type:decimal(5,2);not null;default:0.00" json:"discount_percentage"`
+    DiscountAmount     money.Amount           `gorm:"column:discount_amount;not null;default:0.00" json:"discount_amount"`
+    Interval           string                 `gorm:"column:interval_unit;not null" json:"interval"` // weekly, monthly, quarterly or yearly
+    StartDate          time.Time              `gorm:"column:start_date;type:date;not null" json:"start_date"`
+    EndDate            *time.Time             `gorm:"column:end_date;type:date" json:"end_date,omitempty"` // Last date a run may fall on, nil for open-ended
+    NextRunDate        time.Time              `gorm:"column:next_run_date;type:date;not null;index" json:"next_run_date"`
+    Occurrences        int                    `gorm:"column:occurrences;not null;default:0" json:"occurrences"`
+    PaymentTermDays    int                    `gorm:"column:payment_term_days;not null;default:30" json:"payment_term_days"` // Due date of the generated invoices, in days after their date
+    AutoIssue          bool                   `gorm:"column:auto_issue;not null;default:false" json:"auto_issue"` // Issue generated invoices instead of leaving them as drafts
+    IsActive           bool                   `gorm:"column:is_active;not null;default:true" json:"is_active"`
+    LastInvoiceID      *uint                  `gorm:"column:last_invoice_id" json:"last_invoice_id,omitempty"`
+    CreatedAt          time.Time              `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+    UpdatedAt          time.Time              `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+    // Associations
+    Items              []RecurringInvoiceItem `gorm:"foreignKey:RecurringInvoiceID;references:RecurringInvoiceID;constraint:OnDelete:CASCADE" json:"items"`
+}
+
+// RecurringInvoiceItem represents the recurring_invoice_items table, a line
+// copied into every generated invoice. Lines without a unit price are priced
+// from the catalog item on the invoice date.
+type RecurringInvoiceItem struct {
+    RecurringInvoiceItemID uint          `gorm:"primaryKey;autoIncrement;column:recurring_invoice_item_id" json:"recurring_invoice_item_id"`
+    RecurringInvoiceID     uint          `gorm:"column:recurring_invoice_id;not null;index" json:"recurring_invoice_id"`
+    ItemID                 *uint         `gorm:"column:item_id" json:"item_id,omitempty"`
+    Description            string        `gorm:"column:description;not null" json:"description"`
+    Quantity               float64       `gorm:"column:quantity;not null" json:"quantity"`
+    UnitPrice              *money.Amount `gorm:"column:unit_price" json:"unit_price,omitempty"`
+    TaxRatePercentage      float64       `gorm:"column:tax_rate_percentage;default:0.00" json:"tax_rate_percentage"`
+    TaxCode                *string       `gorm:"column:tax_code" json:"tax_code,omitempty"`
+    WithholdingTaxCode     *string       `gorm:"column:withholding_tax_code" json:"withholding_tax_code,omitempty"`
+    DiscountPercentage     float64       `gorm:"column:discount_percentage;default:0.00" json:"discount_percentage"`
+    DiscountAmount         money.Amount  `gorm:"column:discount_amount;not null;default:0.00" json:"discount_amount"`
+}
+
+// Reminder delivery statuses
+const (
+    ReminderStatusPending   = "pending"
+    ReminderStatusSent      = "sent"
+    ReminderStatusFailed    = "failed"
+    ReminderStatusCancelled = "cancelled" // The invoice was paid or closed before the reminder went out
+)
+
+// DunningLevel represents the dunning_levels table: a reminder a sender
+// company sends about its unpaid invoices a number of days from their due
+// date, e.g. a friendly reminder 3 days before (-3) or a final notice 30 days
+// after (30). Higher levels are the later, sterner reminders.
+type DunningLevel struct {
+    DunningLevelID uint      `gorm:"primaryKey;autoIncrement;column:dunning_level_id" json:"dunning_level_id"`
+    CompanyID      uint      `gorm:"column:company_id;not null;uniqueIndex:unique_dunning_level" json:"company_id"`
+    Level          int       `gorm:"column:level;not null;uniqueIndex:unique_dunning_level" json:"level"`
+    Name           string    `gorm:"column:name;not null" json:"name"`
+    DaysAfterDue   int       `gorm:"column:days_after_due;not null" json:"days_after_due"` // Negative before the due date
+    Subject        string    `gorm:"column:subject;not null;default:''" json:"subject,omitempty"` // text/template source; empty uses the built-in subject
+    Body           string    `gorm:"column:body;type:text" json:"body,omitempty"` // text/template source; empty uses the built-in message
+    IsActive       bool      `gorm:"column:is_active;not null;default:true" json:"is_active"`
+    CreatedAt      time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+    UpdatedAt      time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// InvoiceReminder represents the invoice_reminders table: the reminder of a
+// dunning level generated for an invoice, with the message as it was sent.
+// An invoice gets at most one reminder per level.
+type InvoiceReminder struct {
+    ReminderID     uint       `gorm:"primaryKey;autoIncrement;column:reminder_id" json:"reminder_id"`
+    InvoiceID      uint       `gorm:"column:invoice_id;not null;uniqueIndex:unique_invoice_reminder" json:"invoice_id"`
+    DunningLevelID *uint      `gorm:"column:dunning_level_id" json:"dunning_level_id,omitempty"` // Nil once the level is deleted
+    Level          int        `gorm:"column:level;not null;uniqueIndex:unique_invoice_reminder" json:"level"`
+    Recipient      string     `gorm:"column:recipient;not null;default:''" json:"recipient"`
+    Subject        string     `gorm:"column:subject;not null" json:"subject"`
+    Body           string     `gorm:"column:body;type:text" json:"body"`
+    Status         string     `gorm:"column:status;not null;default:'pending';index" json:"status"`
+    Attempts       int        `gorm:"column:attempts;not null;default:0" json:"attempts"`
+    LastError      *string    `gorm:"column:last_error" json:"last_error,omitempty"`
+    SentAt         *time.Time `gorm:"column:sent_at" json:"sent_at,omitempty"`
+    CreatedAt      time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// Ways a late fee is charged
+const (
+    LateFeeMethodLineItem   = "line_item"   // Added as a line to the overdue invoice
+    LateFeeMethodFeeInvoice = "fee_invoice" // Billed on a separate invoice
+)
+
+// LateFeePolicy represents the late_fee_policies table: the late charges a
+// sender company applies to its overdue invoices. Once the grace days after
+// the due date have passed, the flat fee is charged once and the interest
+// percentage for every started period on the amount still due, up to the cap.
+type LateFeePolicy struct {
+    LateFeePolicyID    uint          `gorm:"primaryKey;autoIncrement;column:late_fee_policy_id" json:"late_fee_policy_id"`
+    CompanyID          uint          `gorm:"column:company_id;not null;uniqueIndex" json:"company_id"`
+    FlatFee            money.Amount  `gorm:"column:flat_fee;not null;default:0.00" json:"flat_fee"`
+    InterestPercentage float64       `gorm:"column:interest_percentage;type:decimal(5,2);not null;default:0.00" json:"interest_percentage"` // Per period
+    PeriodDays         int           `gorm:"column:period_days;not null;default:30" json:"period_days"`
+    GraceDays          int           `gorm:"column:grace_days;not null;default:0" json:"grace_days"`
+    MaxAmount          *money.Amount `gorm:"column:max_amount" json:"max_amount,omitempty"` // Cap on the late charges of one invoice, nil for none
+    Currency           string        `gorm:"column:currency;type:char(3);not null;default:'IDR'" json:"currency"` // ISO 4217 code of FlatFee and MaxAmount
+    Method             string        `gorm:"column:method;not null;default:'fee_invoice'" json:"method"` // LateFeeMethodLineItem or LateFeeMethodFeeInvoice
+    IsActive           bool          `gorm:"column:is_active;not null;default:true" json:"is_active"`
+    CreatedAt          time.Time     `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+    UpdatedAt          time.Time     `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// LateFeeCharge represents the late_fee_charges table: late charges added to
+// an overdue invoice, with the figures they were computed from for audit.
+// Amounts are in the currency of the invoice.
+type LateFeeCharge struct {
+    LateFeeChargeID   uint         `gorm:"primaryKey;autoIncrement;column:late_fee_charge_id" json:"late_fee_charge_id"`
+    InvoiceID         uint         `gorm:"column:invoice_id;not null;uniqueIndex:unique_late_fee_charge" json:"invoice_id"`
+    LateFeePolicyID   *uint        `gorm:"column:late_fee_policy_id" json:"late_fee_policy_id,omitempty"` // Nil once the policy is deleted
+    ChargeDate        time.Time    `gorm:"column:charge_date;type:date;not null;uniqueIndex:unique_late_fee_charge" json:"charge_date"`
+    DaysOverdue       int          `gorm:"column:days_overdue;not null" json:"days_overdue"`
+    Periods           int          `gorm:"column:periods;not null" json:"periods"` // Interest periods started after the grace days
+    Principal         money.Amount `gorm:"column:principal;not null" json:"principal"` // Amount due the interest is computed on, late charges excluded
+    FlatFee           money.Amount `gorm:"column:flat_fee;not null" json:"flat_fee"`
+    Interest          money.Amount `gorm:"column:interest;not null" json:"interest"`
+    Accrued           money.Amount `gorm:"column:accrued;not null" json:"accrued"` // Late charges due in total, capped
+    PreviouslyCharged money.Amount `gorm:"column:previously_charged;not null" json:"previously_charged"`
+    Amount            money.Amount `gorm:"column:amount;not null" json:"amount"` // Charged now, Accrued less PreviouslyCharged
+    Currency          string       `gorm:"column:currency;type:char(3);not null" json:"currency"`
+    Method            string       `gorm:"column:method;not null" json:"method"`
+    InvoiceItemID     *uint        `gorm:"column:invoice_item_id" json:"invoice_item_id,omitempty"` // Line added to the invoice
+    FeeInvoiceID      *uint        `gorm:"column:fee_invoice_id" json:"fee_invoice_id,omitempty"`   // Separate fee invoice
+    Calculation       string       `gorm:"column:calculation;type:text" json:"calculation"`
+    CreatedAt         time.Time    `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "strings"
+
+// Payment statuses stored in payments.status. Only completed payments count
+// towards the balance of their invoice.
+const (
+	PaymentStatusPending   = "pending"
+	PaymentStatusCompleted = "completed"
+	PaymentStatusFailed    = "failed"
+	PaymentStatusCancelled = "cancelled"
+)
+
+// paymentStatuses lists the known payment statuses
+var paymentStatuses = []string{PaymentStatusPending, PaymentStatusCompleted, PaymentStatusFailed, PaymentStatusCancelled}
+
+// NormalizePaymentStatus returns the canonical spelling of a payment status,
+// accepting any letter case, e.g. the 'Completed' the schema used to default
+// to. Unknown statuses are returned as "".
+func NormalizePaymentStatus(status string) string {
+	key := strings.ToLower(strings.TrimSpace(status))
+	if key == "canceled" {
+		return PaymentStatusCancelled
+	}
+	for _, canonical := range paymentStatuses {
+		if canonical == key {
+			return canonical
+		}
+	}
+	return ""
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"invoice-go/money"
+	"time"
+)
+
+// Statement entry types
+const (
+	StatementEntryInvoice     = "invoice"
+	StatementEntryCreditNote  = "credit_note"
+	StatementEntryPayment     = "payment"
+	StatementEntryWithholding = "withholding" // Tax withheld by the customer on a payment
+	StatementEntryUnallocated = "unallocated" // Part of a receipt not allocated to invoices, debited back once allocated later
+	StatementEntryRefund      = "refund"      // Credit balance or part of a payment paid back to the customer
+	StatementEntryChargeback  = "chargeback"  // Payment reversed by the customer's bank
+)
+
+// StatementEntry is one document on a statement of account. Debit and Credit
+// are in the statement currency; Amount is the document total in the
+// currency of its invoice.
+type StatementEntry struct {
+	Date          time.Time    `json:"date"`
+	Type          string       `json:"type"`
+	DocumentID    uint         `json:"document_id"` // Invoice, credit note, payment or credit entry ID, depending on Type
+	Reference     string       `json:"reference"`   // Document number, or the transaction reference of a payment, receipt or refund
+	InvoiceID     uint         `json:"invoice_id"`
+	InvoiceNumber string       `json:"invoice_number"`
+	Currency      string       `json:"currency"`
+	Amount        money.Amount `json:"amount"`
+	Debit         money.Amount `json:"debit"`
+	Credit        money.Amount `json:"credit"`
+	Balance       money.Amount `json:"balance"` // Running balance after the entry
+}
+
+// Statement is the statement of account of a customer company over a period,
+// in the base reporting currency. The opening balance is what the customer
+// owed before From; each entry moves the running balance up to the closing
+// balance owed at the end of To.
+type Statement struct {
+	Company        Company          `json:"company"`
+	SenderCompany  *Company         `json:"sender_company,omitempty"` // Set when the statement covers the documents of one sender only
+	From           time.Time        `json:"from"`
+	To             time.Time        `json:"to"`
+	Currency       string           `json:"currency"`
+	OpeningBalance money.Amount     `json:"opening_balance"`
+	TotalDebits    money.Amount     `json:"total_debits"`
+	TotalCredits   money.Amount     `json:"total_credits"`
+	ClosingBalance money.Amount     `json:"closing_balance"`
+	Entries        []StatementEntry `json:"entries"`
+}
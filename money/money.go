@@ -0,0 +1,238 @@
+// Package money provides the fixed-point amount type used for every monetary
+// value, so that amounts computed in Go always equal what the DECIMAL(10,2)
+// columns store.
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// StorageScale is the number of decimals of the DECIMAL(10,2) amount columns
+const StorageScale = 2
+
+// zeroDecimalCurrencies are ISO 4217 currencies without minor units
+var zeroDecimalCurrencies = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "ISK": true,
+	"JPY": true, "KMF": true, "KRW": true, "PYG": true, "RWF": true,
+	"UGX": true, "UYI": true, "VND": true, "VUV": true, "XAF": true,
+	"XOF": true, "XPF": true,
+}
+
+// Amount is a monetary amount held as a fixed-point decimal. The zero value is 0.
+// Amounts read from JSON or the database are rounded to the storage scale,
+// results of arithmetic are exact until rounded with Round.
+type Amount struct {
+	d decimal.Decimal
+}
+
+// Zero is the amount 0
+func Zero() Amount {
+	return Amount{}
+}
+
+// New returns value × 10^exp, e.g. New(1999, -2) is 19.99
+func New(value int64, exp int32) Amount {
+	return Amount{d: decimal.New(value, exp)}
+}
+
+// NewFromFloat converts a float, rounded to the storage scale
+func NewFromFloat(f float64) Amount {
+	return Amount{d: decimal.NewFromFloat(f).Round(StorageScale)}
+}
+
+// Parse reads a decimal string such as "1250.50", rounded to the storage scale
+func Parse(s string) (Amount, error) {
+	d, err := decimal.NewFromString(strings.TrimSpace(s))
+	if err != nil {
+		return Amount{}, fmt.Errorf("invalid amount %q", s)
+	}
+	return Amount{d: d.Round(StorageScale)}, nil
+}
+
+// MinorUnits returns the number of decimals a currency is rounded to. It never
+// exceeds the storage scale.
+func MinorUnits(currency string) int32 {
+	if zeroDecimalCurrencies[strings.ToUpper(strings.TrimSpace(currency))] {
+		return 0
+	}
+	return StorageScale
+}
+
+// Round rounds half away from zero to the minor units of the currency
+func (a Amount) Round(currency string) Amount {
+	return Amount{d: a.d.Round(MinorUnits(currency))}
+}
+
+// Add returns a + b
+func (a Amount) Add(b Amount) Amount {
+	return Amount{d: a.d.Add(b.d)}
+}
+
+// Sub returns a - b
+func (a Amount) Sub(b Amount) Amount {
+	return Amount{d: a.d.Sub(b.d)}
+}
+
+// Neg returns -a
+func (a Amount) Neg() Amount {
+	return Amount{d: a.d.Neg()}
+}
+
+// Abs returns |a|
+func (a Amount) Abs() Amount {
+	return Amount{d: a.d.Abs()}
+}
+
+// Mul multiplies the amount by a quantity or an exchange rate. The factor is
+// taken at its shortest decimal representation, so 0.1 is exactly 0.1.
+func (a Amount) Mul(factor float64) Amount {
+	return Amount{d: a.d.Mul(decimal.NewFromFloat(factor))}
+}
+
+// Percent returns rate percent of the amount, e.g. the tax at an 11% rate
+func (a Amount) Percent(rate float64) Amount {
+	return Amount{d: a.d.Mul(decimal.NewFromFloat(rate)).Div(decimal.NewFromInt(100))}
+}
+
+// IncludedPercent returns the part of a tax-inclusive amount that is the tax at
+// rate percent, when the amount includes taxes totalling totalRate percent
+func (a Amount) IncludedPercent(rate, totalRate float64) Amount {
+	return Amount{d: a.d.Mul(decimal.NewFromFloat(rate)).Div(decimal.NewFromFloat(100 + totalRate))}
+}
+
+// Share returns the part of the amount proportional to part out of whole,
+// e.g. the share of a discount falling on one line. whole must not be zero.
+func (a Amount) Share(part, whole Amount) Amount {
+	return Amount{d: a.d.Mul(part.d).Div(whole.d)}
+}
+
+// Cmp compares a and b and returns -1, 0 or +1
+func (a Amount) Cmp(b Amount) int {
+	return a.d.Cmp(b.d)
+}
+
+// Equal reports whether a equals b
+func (a Amount) Equal(b Amount) bool {
+	return a.d.Equal(b.d)
+}
+
+// GreaterThan reports whether a > b
+func (a Amount) GreaterThan(b Amount) bool {
+	return a.d.GreaterThan(b.d)
+}
+
+// LessThan reports whether a < b
+func (a Amount) LessThan(b Amount) bool {
+	return a.d.LessThan(b.d)
+}
+
+// IsZero reports whether the amount is 0
+func (a Amount) IsZero() bool {
+	return a.d.IsZero()
+}
+
+// IsPositive reports whether the amount is greater than 0
+func (a Amount) IsPositive() bool {
+	return a.d.IsPositive()
+}
+
+// IsNegative reports whether the amount is less than 0
+func (a Amount) IsNegative() bool {
+	return a.d.IsNegative()
+}
+
+// Decimal returns the underlying decimal
+func (a Amount) Decimal() decimal.Decimal {
+	return a.d
+}
+
+// Float64 returns the nearest float, for presentation only
+func (a Amount) Float64() float64 {
+	return a.d.InexactFloat64()
+}
+
+// String formats the amount with the storage scale, e.g. "1250.50"
+func (a Amount) String() string {
+	return a.d.StringFixed(StorageScale)
+}
+
+// Sum adds up amounts
+func Sum(amounts ...Amount) Amount {
+	total := Zero()
+	for _, amount := range amounts {
+		total = total.Add(amount)
+	}
+	return total
+}
+
+// Min returns the smaller of two amounts
+func Min(a, b Amount) Amount {
+	if a.LessThan(b) {
+		return a
+	}
+	return b
+}
+
+// MarshalJSON encodes the amount as a JSON number with two decimals
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number, a decimal string or null
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(string(data), `"`)
+	if text == "null" || text == "" {
+		*a = Zero()
+		return nil
+	}
+	parsed, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner for DECIMAL columns
+func (a *Amount) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*a = Zero()
+		return nil
+	case []byte:
+		parsed, err := Parse(string(v))
+		if err != nil {
+			return err
+		}
+		*a = parsed
+	case string:
+		parsed, err := Parse(v)
+		if err != nil {
+			return err
+		}
+		*a = parsed
+	case float64:
+		*a = NewFromFloat(v)
+	case float32:
+		*a = NewFromFloat(float64(v))
+	case int64:
+		*a = New(v, 0)
+	default:
+		return fmt.Errorf("cannot scan %T into money.Amount", value)
+	}
+	return nil
+}
+
+// Value implements driver.Valuer, writing the amount at the storage scale
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// GormDataType is the column type used when the schema is migrated by gorm
+func (Amount) GormDataType() string {
+	return "decimal(10,2)"
+}
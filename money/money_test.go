@@ -0,0 +1,103 @@
+package money
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     string
+	}{
+		{"10.005", "USD", "10.01"},
+		{"10.004", "USD", "10.00"},
+		{"-10.005", "USD", "-10.01"},
+		{"0.125", "IDR", "0.13"},
+		{"1499.5", "JPY", "1500.00"},
+		{"-1499.5", "JPY", "-1500.00"},
+		{"1499.49", "jpy", "1499.00"},
+		{"2.5", "KRW", "3.00"},
+		{"99.999", "EUR", "100.00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.amount+" "+tt.currency, func(t *testing.T) {
+			amount := exact(t, tt.amount)
+			if got := amount.Round(tt.currency); got.String() != tt.want {
+				t.Errorf("Round(%s) = %s, want %s", tt.currency, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"1250.50", "1250.50", false},
+		{" 12 ", "12.00", false},
+		{"0.005", "0.01", false},
+		{"-0.004", "0.00", false},
+		{"1,250.50", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPercentAndShare(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Amount
+		want string
+	}{
+		// 11% VAT on 1,234,567 IDR, rounded per line
+		{"percent", exact(t, "1234567").Percent(11).Round("IDR"), "135802.37"},
+		{"percent of cents", exact(t, "0.10").Percent(15).Round("USD"), "0.02"},
+		// Tax included in 111.00 at 11%
+		{"included percent", exact(t, "111").IncludedPercent(11, 11).Round("USD"), "11.00"},
+		{"included percent of two taxes", exact(t, "120").IncludedPercent(10, 20).Round("USD"), "10.00"},
+		// A third of a 10.00 discount falls on one of three equal lines
+		{"share", exact(t, "10").Share(exact(t, "1"), exact(t, "3")).Round("USD"), "3.33"},
+		{"mul by quantity", exact(t, "19.99").Mul(3).Round("USD"), "59.97"},
+		{"mul by exchange rate", exact(t, "100").Mul(15823.5).Round("IDR"), "1582350.00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got.String() != tt.want {
+				t.Errorf("got %s, want %s", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFromFloat(t *testing.T) {
+	// Float noise is rounded away at the storage scale
+	if got := NewFromFloat(0.1 + 0.2); got.String() != "0.30" {
+		t.Errorf("NewFromFloat(0.1 + 0.2) = %s, want 0.30", got)
+	}
+}
+
+// exact builds an amount without rounding it to the storage scale, like the
+// intermediate results of arithmetic
+func exact(t *testing.T, s string) Amount {
+	t.Helper()
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Amount{d: d}
+}
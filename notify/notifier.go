@@ -0,0 +1,50 @@
+// Package notify delivers messages, such as payment reminders, to customers.
+package notify
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// Message is a plain-text message addressed to one or more recipients
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers messages. Implementations must be safe for concurrent use.
+type Notifier interface {
+	Notify(msg Message) error
+}
+
+// LogNotifier writes messages to the log instead of delivering them, for
+// development and deployments without a mail server
+type LogNotifier struct{}
+
+// Notify logs the message
+func (LogNotifier) Notify(msg Message) error {
+	log.Printf("Notification to %s: %s\n%s", strings.Join(msg.To, ", "), msg.Subject, msg.Body)
+	return nil
+}
+
+// FromEnv returns the SMTP notifier configured by the SMTP_* environment
+// variables, or a LogNotifier when SMTP_HOST is not set
+func FromEnv() Notifier {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return LogNotifier{}
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "25"
+	}
+	return &SMTPNotifier{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+}
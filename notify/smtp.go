@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPNotifier sends messages as plain-text email through an SMTP server.
+// STARTTLS is used when the server offers it; credentials are only sent when
+// Username is set.
+type SMTPNotifier struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Notify sends the message as one email to all its recipients
+func (n *SMTPNotifier) Notify(msg Message) error {
+	if len(msg.To) == 0 {
+		return errors.New("message has no recipient")
+	}
+	if n.From == "" {
+		return errors.New("SMTP sender address is not configured")
+	}
+	for _, address := range append([]string{n.From}, msg.To...) {
+		if strings.ContainsAny(address, "\r\n") {
+			return fmt.Errorf("invalid email address %q", address)
+		}
+	}
+
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+	if err := smtp.SendMail(net.JoinHostPort(n.Host, n.Port), auth, n.From, msg.To, n.message(msg)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// message formats the headers and body of an email
+func (n *SMTPNotifier) message(msg Message) []byte {
+	var b strings.Builder
+	header := func(name, value string) {
+		b.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", n.From)
+	header("To", strings.Join(msg.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(msg.Subject), " ")))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	b.WriteString("\r\n")
+	// SMTP requires CRLF line endings
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,192 @@
+package notify
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSession is what the fake SMTP server received in one session
+type smtpSession struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTPServer accepts one SMTP session on a local port, offering neither
+// STARTTLS nor AUTH, and sends what it received on the returned channel
+func fakeSMTPServer(t *testing.T) (host, port string, received <-chan smtpSession) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		text := textproto.NewConn(conn)
+		var session smtpSession
+
+		text.PrintfLine("220 localhost ESMTP fake")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				text.PrintfLine("250-localhost")
+				text.PrintfLine("250 8BITMIME")
+			case strings.HasPrefix(command, "MAIL FROM:"):
+				session.from = envelopeAddress(line[len("MAIL FROM:"):])
+				text.PrintfLine("250 OK")
+			case strings.HasPrefix(command, "RCPT TO:"):
+				session.to = append(session.to, envelopeAddress(line[len("RCPT TO:"):]))
+				text.PrintfLine("250 OK")
+			case command == "DATA":
+				text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+				data, err := text.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				session.data = string(data)
+				text.PrintfLine("250 OK")
+			case command == "QUIT":
+				text.PrintfLine("221 Bye")
+				sessions <- session
+				return
+			default:
+				text.PrintfLine("250 OK")
+			}
+		}
+	}()
+
+	host, port, err = net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to split address: %v", err)
+	}
+	return host, port, sessions
+}
+
+// envelopeAddress reads the address of a MAIL FROM or RCPT TO argument such
+// as "<billing@example.com> BODY=8BITMIME"
+func envelopeAddress(arg string) string {
+	start, end := strings.IndexByte(arg, '<'), strings.IndexByte(arg, '>')
+	if start < 0 || end < start {
+		return strings.TrimSpace(arg)
+	}
+	return arg[start+1 : end]
+}
+
+func TestSMTPNotifierNotify(t *testing.T) {
+	host, port, received := fakeSMTPServer(t)
+	notifier := &SMTPNotifier{Host: host, Port: port, From: "billing@example.com"}
+
+	err := notifier.Notify(Message{
+		To:      []string{"ap@customer.example", "finance@customer.example"},
+		Subject: "Reminder: invoice INV-2025-0001 is due\n",
+		Body:    "Dear customer,\nInvoice INV-2025-0001 is due.\n.\nRegards",
+	})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	var session smtpSession
+	select {
+	case session = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fake SMTP server received no complete session")
+	}
+
+	if session.from != "billing@example.com" {
+		t.Errorf("MAIL FROM = %q, want billing@example.com", session.from)
+	}
+	if got := strings.Join(session.to, ","); got != "ap@customer.example,finance@customer.example" {
+		t.Errorf("RCPT TO = %q", got)
+	}
+
+	// ReadDotBytes returns the message with LF line endings and dots unstuffed
+	headers, body, ok := strings.Cut(session.data, "\n\n")
+	if !ok {
+		t.Fatalf("message has no header/body separator: %q", session.data)
+	}
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(headers + "\n\n")))
+	header, err := reader.ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("failed to read headers: %v", err)
+	}
+	wantHeaders := map[string]string{
+		"From":                      "billing@example.com",
+		"To":                        "ap@customer.example, finance@customer.example",
+		"Subject":                   "Reminder: invoice INV-2025-0001 is due",
+		"Mime-Version":              "1.0",
+		"Content-Type":              "text/plain; charset=utf-8",
+		"Content-Transfer-Encoding": "8bit",
+	}
+	for name, want := range wantHeaders {
+		if got := header.Get(name); got != want {
+			t.Errorf("header %s = %q, want %q", name, got, want)
+		}
+	}
+	if header.Get("Date") == "" {
+		t.Error("Date header is missing")
+	}
+	if want := "Dear customer,\nInvoice INV-2025-0001 is due.\n.\nRegards\n"; body != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
+
+func TestSMTPNotifierMessage(t *testing.T) {
+	notifier := &SMTPNotifier{From: "billing@example.com"}
+	message := string(notifier.message(Message{
+		To:      []string{"ap@customer.example"},
+		Subject: "Pengingat: faktur jatuh tempo – INV-0001",
+		Body:    "Line one\r\nLine two\nLine three",
+	}))
+
+	headers, body, ok := strings.Cut(message, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("message has no CRLF header/body separator: %q", message)
+	}
+	if !strings.Contains(headers, "Subject: =?utf-8?q?") {
+		t.Errorf("non-ASCII subject is not Q-encoded: %q", headers)
+	}
+	if want := "Line one\r\nLine two\r\nLine three"; body != want {
+		t.Errorf("body = %q, want CRLF line endings %q", body, want)
+	}
+}
+
+func TestSMTPNotifierRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		notifier SMTPNotifier
+		msg      Message
+	}{
+		{"no recipient", SMTPNotifier{From: "billing@example.com"}, Message{Subject: "s"}},
+		{"no sender", SMTPNotifier{}, Message{To: []string{"ap@customer.example"}}},
+		{"header injection in recipient", SMTPNotifier{From: "billing@example.com"},
+			Message{To: []string{"ap@customer.example\r\nBcc: x@example.com"}}},
+		{"header injection in sender", SMTPNotifier{From: "billing@example.com\nBcc: x@example.com"},
+			Message{To: []string{"ap@customer.example"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Nothing listens on port 1, so a message that got past the
+			// checks fails with "failed to send email"
+			tt.notifier.Host, tt.notifier.Port = "127.0.0.1", "1"
+			err := tt.notifier.Notify(tt.msg)
+			if err == nil || strings.Contains(err.Error(), "failed to send email") {
+				t.Errorf("Notify() error = %v, want a validation error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package render
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"invoice-go/models"
+	"invoice-go/money"
+	"invoice-go/utils"
+)
+
+//go:embed templates/invoice.html
+var defaultTemplates embed.FS
+
+// InvoiceView is the data an invoice template is executed with. The report and
+// layout fields are promoted, e.g. {{.Invoice.InvoiceNumber}} or {{.Labels.Total}}.
+type InvoiceView struct {
+	*models.InvoiceReportResponse
+	Layout
+	Taxes        []TaxLine
+	Withholdings []TaxLine // Withheld by the buyer, shown after the total
+	Discounted   bool      // Some line has a discount
+	LogoURL      string
+}
+
+// templateFuncs are available to every invoice template
+var templateFuncs = template.FuncMap{
+	"money":        formatAmount,
+	"quantity":     formatQuantity,
+	"date":         func(t time.Time) string { return t.Format(dateLayout) },
+	"addressLines": addressLines,
+	"discount":     LineDiscountLabel,
+	"lines":        func(text string) []string { return strings.Split(strings.TrimSpace(text), "\n") },
+}
+
+// ParseInvoiceTemplate parses the source of an invoice template. An empty
+// source yields the built-in layout.
+func ParseInvoiceTemplate(source string) (*template.Template, error) {
+	if strings.TrimSpace(source) == "" {
+		return template.New("invoice.html").Funcs(templateFuncs).ParseFS(defaultTemplates, "templates/invoice.html")
+	}
+	return template.New("invoice").Funcs(templateFuncs).Parse(source)
+}
+
+// InvoiceHTML executes an invoice template against an invoice report
+func InvoiceHTML(w io.Writer, report *models.InvoiceReportResponse, source string, layout Layout, logoURL string) error {
+	tmpl, err := ParseInvoiceTemplate(source)
+	if err != nil {
+		return fmt.Errorf("failed to parse invoice template: %w", err)
+	}
+
+	view := InvoiceView{
+		InvoiceReportResponse: report,
+		Layout:                layout,
+		LogoURL:               logoURL,
+	}
+	view.Taxes, view.Withholdings = TaxBreakdown(report, layout.Labels)
+	view.Discounted = HasLineDiscounts(report)
+	if err := tmpl.Execute(w, view); err != nil {
+		return fmt.Errorf("failed to render invoice template: %w", err)
+	}
+	return nil
+}
+
+// SampleInvoiceReport builds a fictitious invoice sent by the given company,
+// used to preview templates before any real invoice exists
+func SampleInvoiceReport(sender models.Company) *models.InvoiceReportResponse {
+	now := time.Now()
+	subject := "Sample invoice"
+	method := "Bank Transfer"
+	address := &models.Address{
+		AddressType: "Billing",
+		Street:      "1 Sample Street",
+		City:        "Sample City",
+		PostalCode:  "12345",
+		Country:     "Indonesia",
+	}
+	items := []models.InvoiceItem{
+		{InvoiceItemID: 1, Description: "Consulting services", Quantity: 10, UnitPrice: money.New(150, 0), ItemTotal: money.New(1500, 0), TaxRatePercentage: 11},
+		{InvoiceItemID: 2, Description: "Hosting (monthly)", Quantity: 1, UnitPrice: money.New(250, 0), ItemTotal: money.New(250, 0), TaxRatePercentage: 11},
+		{InvoiceItemID: 3, Description: "Training materials", Quantity: 5, UnitPrice: money.New(20, 0), ItemTotal: money.New(100, 0), TaxRatePercentage: 0},
+	}
+
+	invoice := models.Invoice{
+		SenderCompanyID: sender.CompanyID,
+		InvoiceNumber:   "SAMPLE-0001",
+		InvoiceDate:     now,
+		DueDate:         now.AddDate(0, 0, 30),
+		InvoiceSubject:  &subject,
+		Subtotal:        money.New(1850, 0),
+		TaxTotal:        money.New(1925, -1),
+		GrandTotal:      money.New(20425, -1),
+		AmountPaid:      money.New(1000, 0),
+		AmountDue:       money.New(10425, -1),
+		Status:          models.InvoiceStatusPartiallyPaid,
+		Currency:        utils.BaseCurrency(),
+		ExchangeRate:    1,
+	}
+
+	return &models.InvoiceReportResponse{
+		Invoice:          invoice,
+		SenderCompany:    sender,
+		RecipientCompany: models.Company{CompanyName: "Sample Customer Ltd."},
+		BillingAddress:   address,
+		ShippingAddress:  address,
+		Items:            items,
+		Payments: []models.Payment{
+			{PaymentDate: now, Amount: money.New(1000, 0), Method: &method, Status: models.PaymentStatusCompleted},
+		},
+		PaymentStatus: models.InvoiceStatusPartiallyPaid,
+	}
+}
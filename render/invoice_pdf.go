@@ -0,0 +1,403 @@
+// Package render turns invoice data into documents that can be sent to customers.
+package render
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"invoice-go/models"
+	"invoice-go/money"
+	"invoice-go/utils"
+
+	"github.com/go-pdf/fpdf"
+)
+
+const (
+	pageMargin = 15.0
+	lineHeight = 6.0
+	dateLayout = "02 Jan 2006"
+)
+
+// TaxLine is the taxable amount and tax of the lines sharing a tax code and rate
+type TaxLine struct {
+	Code           string
+	Label          string // Name of the tax code, or the generic label for free-typed rates
+	RatePercentage float64
+	Withholding    bool
+	Taxable        money.Amount
+	Tax            money.Amount
+}
+
+// HasLineDiscounts reports whether any line of the invoice is discounted
+func HasLineDiscounts(report *models.InvoiceReportResponse) bool {
+	for _, item := range report.Items {
+		if !item.Discount.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// LineDiscountLabel describes the discount of a line, e.g. "15.00 (10%)";
+// empty for lines without a discount
+func LineDiscountLabel(item models.InvoiceItem) string {
+	if item.Discount.IsZero() {
+		return ""
+	}
+	if item.DiscountPercentage > 0 {
+		return formatAmount(item.Discount) + " (" + formatQuantity(item.DiscountPercentage) + "%)"
+	}
+	return formatAmount(item.Discount)
+}
+
+// TaxBreakdown splits the tax breakdown of an invoice into the taxes added to
+// the invoice and the taxes withheld by the buyer, lowest rate first. Invoices
+// without a stored breakdown have it computed from their lines.
+func TaxBreakdown(report *models.InvoiceReportResponse, labels Labels) (taxes, withholdings []TaxLine) {
+	stored := report.Invoice.Taxes
+	if len(stored) == 0 {
+		lines := make([]utils.InvoiceLine, 0, len(report.Items))
+		for _, item := range report.Items {
+			line := utils.InvoiceLine{Quantity: item.Quantity, UnitPrice: item.UnitPrice, DiscountAmount: item.Discount.Add(item.InvoiceDiscount)}
+			line.Taxes = append(line.Taxes, utils.LineTax{RatePercentage: item.TaxRatePercentage})
+			if item.TaxCode != nil {
+				line.Taxes[0].Code = *item.TaxCode
+			}
+			if item.WithholdingTaxCode != nil {
+				line.Taxes = append(line.Taxes, utils.LineTax{Code: *item.WithholdingTaxCode, RatePercentage: item.WithholdingRatePercentage, Withholding: true})
+			}
+			lines = append(lines, line)
+		}
+		for _, summary := range utils.CalculateInvoiceTotals(lines, report.Invoice.Currency, utils.Pricing{TaxInclusive: report.Invoice.TaxInclusive, Rounding: report.Invoice.TaxRounding}).Taxes {
+			kind := models.TaxKindStandard
+			if summary.Withholding {
+				kind = models.TaxKindWithholding
+			}
+			stored = append(stored, models.InvoiceTax{
+				TaxCode:        summary.Code,
+				Kind:           kind,
+				RatePercentage: summary.RatePercentage,
+				TaxableAmount:  summary.Taxable,
+				TaxAmount:      summary.Tax,
+			})
+		}
+	}
+
+	for _, tax := range stored {
+		line := TaxLine{
+			Code:           tax.TaxCode,
+			Label:          tax.Name,
+			RatePercentage: tax.RatePercentage,
+			Withholding:    tax.Kind == models.TaxKindWithholding,
+			Taxable:        tax.TaxableAmount,
+			Tax:            tax.TaxAmount,
+		}
+		if line.Withholding {
+			if line.Label == "" {
+				line.Label = labels.Withholding
+			}
+			withholdings = append(withholdings, line)
+		} else {
+			if line.Label == "" {
+				line.Label = labels.Tax
+			}
+			taxes = append(taxes, line)
+		}
+	}
+	byRate := func(lines []TaxLine) {
+		sort.SliceStable(lines, func(i, j int) bool {
+			return lines[i].RatePercentage < lines[j].RatePercentage
+		})
+	}
+	byRate(taxes)
+	byRate(withholdings)
+	return taxes, withholdings
+}
+
+// InvoicePDF writes the invoice report as a PDF document in the colours,
+// language, footer and bank details of the layout. The logo is drawn in the
+// top left corner when logoPath points to a PNG or JPEG file.
+func InvoicePDF(w io.Writer, report *models.InvoiceReportResponse, logoPath string, layout Layout) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pageMargin, pageMargin, pageMargin)
+	pdf.SetAutoPageBreak(true, pageMargin)
+	// The core fonts are cp1252 encoded
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pageWidth, _ := pdf.GetPageSize()
+	contentWidth := pageWidth - 2*pageMargin
+	labels := layout.Labels
+	primaryR, primaryG, primaryB := rgb(layout.PrimaryColor)
+	accentR, accentG, accentB := rgb(layout.AccentColor)
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-pageMargin)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.SetTextColor(128, 128, 128)
+		footer := fmt.Sprintf("%s %d", labels.Page, pdf.PageNo())
+		if layout.FooterText != "" {
+			footer = strings.Join(strings.Fields(layout.FooterText), " ") + "  |  " + footer
+		}
+		pdf.CellFormat(0, 5, tr(footer), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	invoice := report.Invoice
+
+	// Header: logo and sender on the left, document title on the right
+	top := pdf.GetY()
+	if logoPath != "" {
+		pdf.ImageOptions(logoPath, pageMargin, top, 0, 20, false,
+			fpdf.ImageOptions{ImageType: imageType(logoPath), ReadDpi: true}, 0, "")
+		pdf.SetY(top + 22)
+	}
+	pdf.SetFont("Helvetica", "B", 12)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.CellFormat(contentWidth/2, lineHeight, tr(report.SenderCompany.CompanyName), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	for _, line := range companyContact(report.SenderCompany) {
+		pdf.CellFormat(contentWidth/2, 4.5, tr(line), "", 1, "L", false, 0, "")
+	}
+	headerBottom := pdf.GetY()
+
+	pdf.SetXY(pageMargin+contentWidth/2, top)
+	pdf.SetFont("Helvetica", "B", 20)
+	pdf.SetTextColor(primaryR, primaryG, primaryB)
+	pdf.CellFormat(contentWidth/2, 10, tr(labels.Invoice), "", 2, "R", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont("Helvetica", "", 9)
+	for _, line := range []string{
+		labels.InvoiceNumber + ": " + invoice.InvoiceNumber,
+		labels.InvoiceDate + ": " + invoice.InvoiceDate.Format(dateLayout),
+		labels.DueDate + ": " + invoice.DueDate.Format(dateLayout),
+		labels.Status + ": " + invoice.Status,
+	} {
+		pdf.CellFormat(contentWidth/2, 4.5, tr(line), "", 2, "R", false, 0, "")
+	}
+	if pdf.GetY() > headerBottom {
+		headerBottom = pdf.GetY()
+	}
+	pdf.SetXY(pageMargin, headerBottom+8)
+
+	// Recipient with billing and shipping addresses
+	columnWidth := contentWidth / 2
+	blockTop := pdf.GetY()
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(columnWidth, lineHeight, tr(labels.BillTo), "", 2, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	billTo := append([]string{report.RecipientCompany.CompanyName}, addressLines(report.BillingAddress)...)
+	for _, line := range billTo {
+		pdf.CellFormat(columnWidth, 4.5, tr(line), "", 2, "L", false, 0, "")
+	}
+	blockBottom := pdf.GetY()
+
+	if report.ShippingAddress != nil {
+		pdf.SetXY(pageMargin+columnWidth, blockTop)
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(columnWidth, lineHeight, tr(labels.ShipTo), "", 2, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		shipTo := append([]string{report.RecipientCompany.CompanyName}, addressLines(report.ShippingAddress)...)
+		for _, line := range shipTo {
+			pdf.CellFormat(columnWidth, 4.5, tr(line), "", 2, "L", false, 0, "")
+		}
+		if pdf.GetY() > blockBottom {
+			blockBottom = pdf.GetY()
+		}
+	}
+	pdf.SetXY(pageMargin, blockBottom+6)
+
+	if invoice.InvoiceSubject != nil && *invoice.InvoiceSubject != "" {
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.MultiCell(contentWidth, lineHeight, tr(*invoice.InvoiceSubject), "", "L", false)
+		pdf.Ln(2)
+	}
+
+	// Line items, with a discount column when any line is discounted
+	widths := []float64{contentWidth - 100, 20, 30, 20, 30}
+	headers := []string{labels.Description, labels.Quantity, labels.UnitPrice, labels.TaxRate, labels.Amount}
+	aligns := []string{"L", "R", "R", "R", "R"}
+	lineDiscounts := HasLineDiscounts(report)
+	if lineDiscounts {
+		widths = []float64{contentWidth - 120, 18, 27, 25, 20, 30}
+		headers = []string{labels.Description, labels.Quantity, labels.UnitPrice, labels.Discount, labels.TaxRate, labels.Amount}
+		aligns = []string{"L", "R", "R", "R", "R", "R"}
+	}
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.SetFillColor(accentR, accentG, accentB)
+	for i, header := range headers {
+		pdf.CellFormat(widths[i], 7, tr(header), "B", 0, aligns[i], true, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont("Helvetica", "", 9)
+	for _, item := range report.Items {
+		description := item.Description
+		if item.Item != nil && item.Item.Name != "" && item.Item.Name != description {
+			description = item.Item.Name + " - " + description
+		}
+		cells := []string{tr(description), formatQuantity(item.Quantity), formatAmount(item.UnitPrice)}
+		if lineDiscounts {
+			cells = append(cells, LineDiscountLabel(item))
+		}
+		cells = append(cells, formatQuantity(item.TaxRatePercentage), formatAmount(item.ItemTotal))
+		// Long descriptions are shortened to keep one row per line item
+		for pdf.GetStringWidth(cells[0]) > widths[0]-2 && len(cells[0]) > 4 {
+			cells[0] = strings.TrimSuffix(cells[0][:len(cells[0])-4], " ") + "..."
+		}
+		for i, cell := range cells {
+			pdf.CellFormat(widths[i], lineHeight, cell, "B", 0, aligns[i], false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	if invoice.TaxInclusive {
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.CellFormat(contentWidth, lineHeight, tr(labels.TaxIncluded), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	// Totals with the tax breakdown
+	labelWidth := contentWidth - 30
+	totalRow := func(label string, amount money.Amount, bold bool) {
+		style := ""
+		if bold {
+			style = "B"
+		}
+		pdf.SetFont("Helvetica", style, 9)
+		pdf.CellFormat(labelWidth, 5, tr(label), "", 0, "R", false, 0, "")
+		pdf.CellFormat(30, 5, formatAmount(amount), "", 1, "R", false, 0, "")
+	}
+	totalRow(labels.Subtotal, invoice.Subtotal, false)
+	if !invoice.Discount.IsZero() {
+		label := labels.Discount
+		if invoice.DiscountPercentage > 0 {
+			label += " " + formatQuantity(invoice.DiscountPercentage) + "%"
+		}
+		totalRow(label, invoice.Discount.Neg(), false)
+	}
+	taxes, withholdings := TaxBreakdown(report, labels)
+	for _, tax := range taxes {
+		label := fmt.Sprintf("%s %s%% (%s)", tax.Label, formatQuantity(tax.RatePercentage), formatAmount(tax.Taxable))
+		totalRow(label, tax.Tax, false)
+	}
+	totalRow(labels.Total+" ("+invoice.Currency+")", invoice.GrandTotal, true)
+	for _, tax := range withholdings {
+		label := fmt.Sprintf("%s %s%% (%s)", tax.Label, formatQuantity(tax.RatePercentage), formatAmount(tax.Taxable))
+		totalRow(label, tax.Tax.Neg(), false)
+	}
+	for _, creditNote := range report.CreditNotes {
+		totalRow(labels.CreditNote+" "+creditNote.CreditNoteNumber, creditNote.GrandTotal, false)
+	}
+
+	// Payments received
+	if len(report.Payments) > 0 {
+		pdf.Ln(4)
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(contentWidth, lineHeight, tr(labels.PaymentsReceived), "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		for _, payment := range report.Payments {
+			label := payment.PaymentDate.Format(dateLayout)
+			if payment.Method != nil && *payment.Method != "" {
+				label += " - " + *payment.Method
+			}
+			if payment.TransactionReference != nil && *payment.TransactionReference != "" {
+				label += " (" + *payment.TransactionReference + ")"
+			}
+			if models.NormalizePaymentStatus(payment.Status) != models.PaymentStatusCompleted {
+				label += " [" + payment.Status + "]"
+			}
+			pdf.CellFormat(labelWidth, 5, tr(label), "", 0, "L", false, 0, "")
+			pdf.CellFormat(30, 5, formatAmount(payment.Amount), "", 1, "R", false, 0, "")
+		}
+	}
+
+	pdf.Ln(4)
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.SetFillColor(accentR, accentG, accentB)
+	pdf.CellFormat(labelWidth, 8, tr(labels.AmountDue+" ("+invoice.Currency+")"), "T", 0, "R", true, 0, "")
+	pdf.CellFormat(30, 8, formatAmount(invoice.AmountDue), "T", 1, "R", true, 0, "")
+
+	if invoice.Notes != nil && *invoice.Notes != "" {
+		pdf.Ln(6)
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.MultiCell(contentWidth, 4.5, tr(*invoice.Notes), "", "L", false)
+	}
+
+	if layout.BankDetails != "" {
+		pdf.Ln(6)
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(contentWidth, lineHeight, tr(labels.BankDetails), "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.MultiCell(contentWidth, 4.5, tr(layout.BankDetails), "", "L", false)
+	}
+
+	if err := pdf.Error(); err != nil {
+		return fmt.Errorf("failed to render invoice PDF: %w", err)
+	}
+	return pdf.Output(w)
+}
+
+// companyContact lists the contact details printed under a company name
+func companyContact(company models.Company) []string {
+	var lines []string
+	if company.DefaultBillingAddress != nil {
+		lines = append(lines, addressLines(company.DefaultBillingAddress)...)
+	}
+	for _, field := range []*string{company.ContactPerson, company.Email, company.Phone} {
+		if field != nil && *field != "" {
+			lines = append(lines, *field)
+		}
+	}
+	return lines
+}
+
+// addressLines formats an address as printable lines
+func addressLines(address *models.Address) []string {
+	if address == nil {
+		return nil
+	}
+	city := address.City
+	if address.PostalCode != "" {
+		city = address.PostalCode + " " + city
+	}
+	if address.StateProvince != nil && *address.StateProvince != "" {
+		city += ", " + *address.StateProvince
+	}
+	return []string{address.Street, city, address.Country}
+}
+
+// imageType returns the fpdf image type of a logo file
+func imageType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return "PNG"
+	default:
+		return "JPG"
+	}
+}
+
+// formatAmount formats a monetary amount with two decimals and thousands separators
+func formatAmount(amount money.Amount) string {
+	sign := ""
+	if amount.IsNegative() {
+		sign = "-"
+		amount = amount.Neg()
+	}
+	text := amount.String()
+	whole, fraction := text[:len(text)-3], text[len(text)-2:]
+
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+	return sign + grouped.String() + "." + fraction
+}
+
+// formatQuantity prints a quantity or percentage without trailing zeros
+func formatQuantity(value float64) string {
+	text := strings.TrimRight(fmt.Sprintf("%.2f", value), "0")
+	return strings.TrimSuffix(text, ".")
+}
@@ -0,0 +1,209 @@
+package render
+
+import (
+	"strconv"
+	"strings"
+
+	"invoice-go/models"
+)
+
+// Layout holds the presentation settings of a sender's invoice template that
+// both the HTML and the PDF renderer honour
+type Layout struct {
+	Language     string
+	PrimaryColor string
+	AccentColor  string
+	FooterText   string
+	BankDetails  string
+	Labels       Labels
+}
+
+// Labels are the fixed texts printed on an invoice or a statement
+type Labels struct {
+	Invoice          string
+	InvoiceNumber    string
+	InvoiceDate      string
+	DueDate          string
+	Status           string
+	BillTo           string
+	ShipTo           string
+	Description      string
+	Quantity         string
+	UnitPrice        string
+	TaxRate          string
+	Amount           string
+	Discount         string
+	TaxIncluded      string
+	Subtotal         string
+	Tax              string
+	Withholding      string
+	Total            string
+	CreditNote       string
+	PaymentsReceived string
+	AmountDue        string
+	BankDetails      string
+	Page             string
+	Statement        string
+	Period           string
+	Date             string
+	Reference        string
+	Debit            string
+	Credit           string
+	Balance          string
+	Payment          string
+	Unallocated      string
+	Refund           string
+	Chargeback       string
+	OpeningBalance   string
+	ClosingBalance   string
+}
+
+// labels by language; unknown languages fall back to English
+var labels = map[string]Labels{
+	"en": {
+		Invoice:          "INVOICE",
+		InvoiceNumber:    "Invoice no.",
+		InvoiceDate:      "Invoice date",
+		DueDate:          "Due date",
+		Status:           "Status",
+		BillTo:           "Bill to",
+		ShipTo:           "Ship to",
+		Description:      "Description",
+		Quantity:         "Qty",
+		UnitPrice:        "Unit price",
+		TaxRate:          "Tax %",
+		Amount:           "Amount",
+		Discount:         "Discount",
+		TaxIncluded:      "Prices include tax",
+		Subtotal:         "Subtotal",
+		Tax:              "Tax",
+		Withholding:      "Withholding tax",
+		Total:            "Total",
+		CreditNote:       "Credit note",
+		PaymentsReceived: "Payments received",
+		AmountDue:        "Amount due",
+		BankDetails:      "Bank details",
+		Page:             "Page",
+		Statement:        "STATEMENT OF ACCOUNT",
+		Period:           "Period",
+		Date:             "Date",
+		Reference:        "Reference",
+		Debit:            "Debit",
+		Credit:           "Credit",
+		Balance:          "Balance",
+		Payment:          "Payment",
+		Unallocated:      "Unallocated payment",
+		Refund:           "Refund",
+		Chargeback:       "Chargeback",
+		OpeningBalance:   "Opening balance",
+		ClosingBalance:   "Closing balance",
+	},
+	"id": {
+		Invoice:          "FAKTUR",
+		InvoiceNumber:    "No. faktur",
+		InvoiceDate:      "Tanggal faktur",
+		DueDate:          "Jatuh tempo",
+		Status:           "Status",
+		BillTo:           "Tagihan kepada",
+		ShipTo:           "Kirim ke",
+		Description:      "Deskripsi",
+		Quantity:         "Jml",
+		UnitPrice:        "Harga satuan",
+		TaxRate:          "Pajak %",
+		Amount:           "Jumlah",
+		Discount:         "Diskon",
+		TaxIncluded:      "Harga sudah termasuk pajak",
+		Subtotal:         "Subtotal",
+		Tax:              "Pajak",
+		Withholding:      "Pajak dipotong",
+		Total:            "Total",
+		CreditNote:       "Nota kredit",
+		PaymentsReceived: "Pembayaran diterima",
+		AmountDue:        "Sisa tagihan",
+		BankDetails:      "Rekening bank",
+		Page:             "Halaman",
+		Statement:        "LAPORAN REKENING",
+		Period:           "Periode",
+		Date:             "Tanggal",
+		Reference:        "Referensi",
+		Debit:            "Debit",
+		Credit:           "Kredit",
+		Balance:          "Saldo",
+		Payment:          "Pembayaran",
+		Unallocated:      "Pembayaran belum dialokasikan",
+		Refund:           "Pengembalian dana",
+		Chargeback:       "Chargeback",
+		OpeningBalance:   "Saldo awal",
+		ClosingBalance:   "Saldo akhir",
+	},
+}
+
+// SupportedLanguages lists the languages invoice labels are available in
+func SupportedLanguages() []string {
+	return []string{"en", "id"}
+}
+
+// IsSupportedLanguage reports whether invoice labels exist for a language
+func IsSupportedLanguage(language string) bool {
+	_, ok := labels[strings.ToLower(language)]
+	return ok
+}
+
+// DefaultLayout is used for senders without an active template
+func DefaultLayout() Layout {
+	return Layout{
+		Language:     "en",
+		PrimaryColor: "#333333",
+		AccentColor:  "#E6E6E6",
+		Labels:       labels["en"],
+	}
+}
+
+// LayoutFromTemplate derives the layout of an invoice template. A nil template
+// yields the default layout.
+func LayoutFromTemplate(tmpl *models.InvoiceTemplate) Layout {
+	layout := DefaultLayout()
+	if tmpl == nil {
+		return layout
+	}
+
+	if language := strings.ToLower(tmpl.Language); IsSupportedLanguage(language) {
+		layout.Language = language
+		layout.Labels = labels[language]
+	}
+	if _, _, _, ok := parseHexColor(tmpl.PrimaryColor); ok {
+		layout.PrimaryColor = tmpl.PrimaryColor
+	}
+	if _, _, _, ok := parseHexColor(tmpl.AccentColor); ok {
+		layout.AccentColor = tmpl.AccentColor
+	}
+	if tmpl.FooterText != nil {
+		layout.FooterText = *tmpl.FooterText
+	}
+	if tmpl.BankDetails != nil {
+		layout.BankDetails = *tmpl.BankDetails
+	}
+	return layout
+}
+
+// parseHexColor parses a #RRGGBB or #RGB colour
+func parseHexColor(color string) (r, g, b int, ok bool) {
+	hex := strings.TrimPrefix(color, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 || !strings.HasPrefix(color, "#") {
+		return 0, 0, 0, false
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	return int(value >> 16 & 0xFF), int(value >> 8 & 0xFF), int(value & 0xFF), true
+}
+
+// rgb returns the components of a layout colour, black when it cannot be parsed
+func rgb(color string) (int, int, int) {
+	r, g, b, _ := parseHexColor(color)
+	return r, g, b
+}
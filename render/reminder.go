@@ -0,0 +1,103 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"invoice-go/models"
+	"invoice-go/money"
+	"invoice-go/utils"
+)
+
+// Built-in reminder texts, used for dunning levels without their own
+const (
+	defaultReminderSubject = `{{.Level.Name}}: invoice {{.Invoice.InvoiceNumber}}`
+	defaultReminderBody    = `Dear {{.Customer.CompanyName}},
+
+{{if gt .DaysOverdue 0 -}}
+Our records show that invoice {{.Invoice.InvoiceNumber}} of {{date .Invoice.InvoiceDate}} was due on {{date .Invoice.DueDate}}, {{.DaysOverdue}} days ago.
+{{- else -}}
+This is a reminder that invoice {{.Invoice.InvoiceNumber}} of {{date .Invoice.InvoiceDate}} is due on {{date .Invoice.DueDate}}.
+{{- end}}
+The amount of {{.Invoice.Currency}} {{money .Invoice.AmountDue}} is still outstanding.
+
+Please disregard this message if the payment is already on its way.
+
+Kind regards,
+{{.Sender.CompanyName}}
+`
+)
+
+// ReminderView is the data the subject and body of a reminder are executed
+// with, e.g. {{.Invoice.InvoiceNumber}} or {{money .Invoice.AmountDue}}
+type ReminderView struct {
+	Invoice     models.Invoice
+	Customer    models.Company
+	Sender      models.Company
+	Level       models.DunningLevel
+	DaysOverdue int // Negative before the due date
+}
+
+// reminderFuncs are available to every reminder template
+var reminderFuncs = template.FuncMap{
+	"money": formatAmount,
+	"date":  func(t time.Time) string { return t.Format(dateLayout) },
+}
+
+// ReminderMessage executes the subject and body templates of a dunning level,
+// or the built-in ones when the level has none
+func ReminderMessage(view ReminderView) (subject, body string, err error) {
+	subjectSource, bodySource := view.Level.Subject, view.Level.Body
+	if strings.TrimSpace(subjectSource) == "" {
+		subjectSource = defaultReminderSubject
+	}
+	if strings.TrimSpace(bodySource) == "" {
+		bodySource = defaultReminderBody
+	}
+
+	if subject, err = executeReminderTemplate("subject", subjectSource, view); err != nil {
+		return "", "", err
+	}
+	if body, err = executeReminderTemplate("body", bodySource, view); err != nil {
+		return "", "", err
+	}
+	// Subjects are a single header line
+	return strings.Join(strings.Fields(subject), " "), body, nil
+}
+
+// executeReminderTemplate parses and executes one reminder template
+func executeReminderTemplate(name, source string, view ReminderView) (string, error) {
+	tmpl, err := template.New(name).Funcs(reminderFuncs).Parse(source)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse reminder %s: %w", name, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, view); err != nil {
+		return "", fmt.Errorf("failed to render reminder %s: %w", name, err)
+	}
+	return b.String(), nil
+}
+
+// SampleReminderView builds a fictitious overdue invoice of the given sender,
+// used to check reminder templates before they are saved
+func SampleReminderView(sender models.Company, level models.DunningLevel) ReminderView {
+	now := time.Now()
+	return ReminderView{
+		Invoice: models.Invoice{
+			SenderCompanyID: sender.CompanyID,
+			InvoiceNumber:   "SAMPLE-0001",
+			InvoiceDate:     now.AddDate(0, 0, -30-level.DaysAfterDue),
+			DueDate:         now.AddDate(0, 0, -level.DaysAfterDue),
+			GrandTotal:      money.New(20425, -1),
+			AmountDue:       money.New(10425, -1),
+			Status:          models.InvoiceStatusOverdue,
+			Currency:        utils.BaseCurrency(),
+		},
+		Customer:    models.Company{CompanyName: "Sample Customer Ltd."},
+		Sender:      sender,
+		Level:       level,
+		DaysOverdue: level.DaysAfterDue,
+	}
+}
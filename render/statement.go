@@ -0,0 +1,221 @@
+package render
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"invoice-go/models"
+	"invoice-go/money"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// StatementEntryDescription describes a statement entry in the language of
+// the labels, e.g. "Credit note CN-0001 (INV-0001)". Entries of invoices in
+// another currency than the statement show the document amount.
+func StatementEntryDescription(entry models.StatementEntry, currency string, labels Labels) string {
+	var description string
+	switch entry.Type {
+	case models.StatementEntryInvoice:
+		description = labels.InvoiceNumber + " " + entry.InvoiceNumber
+	case models.StatementEntryCreditNote:
+		description = labels.CreditNote + " " + entry.Reference + " (" + entry.InvoiceNumber + ")"
+	case models.StatementEntryPayment:
+		description = labels.Payment
+		if entry.Reference != "" {
+			description += " " + entry.Reference
+		}
+		description += " (" + entry.InvoiceNumber + ")"
+	case models.StatementEntryWithholding:
+		description = labels.Withholding + " (" + entry.InvoiceNumber + ")"
+	case models.StatementEntryUnallocated, models.StatementEntryRefund, models.StatementEntryChargeback:
+		switch entry.Type {
+		case models.StatementEntryUnallocated:
+			description = labels.Unallocated
+		case models.StatementEntryRefund:
+			description = labels.Refund
+		default:
+			description = labels.Chargeback
+		}
+		if entry.Reference != "" {
+			description += " " + entry.Reference
+		}
+		// Refunds and chargebacks of payments belong to an invoice
+		if entry.InvoiceNumber != "" {
+			description += " (" + entry.InvoiceNumber + ")"
+		}
+	default:
+		description = entry.Reference
+	}
+	if entry.Currency != "" && entry.Currency != currency {
+		description += " " + entry.Currency + " " + formatAmount(entry.Amount)
+	}
+	return description
+}
+
+// StatementCSV writes a statement as CSV: the opening balance, one row per
+// entry and the closing balance with the period totals
+func StatementCSV(w io.Writer, statement *models.Statement) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"date", "type", "reference", "invoice_number", "currency", "amount", "debit", "credit", "balance"})
+	out.Write([]string{statement.From.Format("2006-01-02"), "opening_balance", "", "", statement.Currency, "", "", "", statement.OpeningBalance.String()})
+	for _, entry := range statement.Entries {
+		out.Write([]string{
+			entry.Date.Format("2006-01-02"),
+			entry.Type,
+			entry.Reference,
+			entry.InvoiceNumber,
+			entry.Currency,
+			entry.Amount.String(),
+			csvAmount(entry.Debit),
+			csvAmount(entry.Credit),
+			entry.Balance.String(),
+		})
+	}
+	out.Write([]string{statement.To.Format("2006-01-02"), "closing_balance", "", "", statement.Currency, "",
+		statement.TotalDebits.String(), statement.TotalCredits.String(), statement.ClosingBalance.String()})
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return fmt.Errorf("failed to write statement CSV: %w", err)
+	}
+	return nil
+}
+
+// csvAmount leaves zero debits and credits blank
+func csvAmount(amount money.Amount) string {
+	if amount.IsZero() {
+		return ""
+	}
+	return amount.String()
+}
+
+// StatementPDF writes a statement of account as a PDF document in the
+// colours, language, footer and bank details of the layout. Statements of a
+// single sender carry its name and contact details, and its logo when
+// logoPath points to a PNG or JPEG file.
+func StatementPDF(w io.Writer, statement *models.Statement, logoPath string, layout Layout) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pageMargin, pageMargin, pageMargin)
+	pdf.SetAutoPageBreak(true, pageMargin)
+	// The core fonts are cp1252 encoded
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pageWidth, _ := pdf.GetPageSize()
+	contentWidth := pageWidth - 2*pageMargin
+	labels := layout.Labels
+	primaryR, primaryG, primaryB := rgb(layout.PrimaryColor)
+	accentR, accentG, accentB := rgb(layout.AccentColor)
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-pageMargin)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.SetTextColor(128, 128, 128)
+		footer := fmt.Sprintf("%s %d", labels.Page, pdf.PageNo())
+		if layout.FooterText != "" {
+			footer = strings.Join(strings.Fields(layout.FooterText), " ") + "  |  " + footer
+		}
+		pdf.CellFormat(0, 5, tr(footer), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	// Header: logo and sender on the left, document title on the right
+	top := pdf.GetY()
+	if statement.SenderCompany != nil {
+		if logoPath != "" {
+			pdf.ImageOptions(logoPath, pageMargin, top, 0, 20, false,
+				fpdf.ImageOptions{ImageType: imageType(logoPath), ReadDpi: true}, 0, "")
+			pdf.SetY(top + 22)
+		}
+		pdf.SetFont("Helvetica", "B", 12)
+		pdf.SetTextColor(0, 0, 0)
+		pdf.CellFormat(contentWidth/2, lineHeight, tr(statement.SenderCompany.CompanyName), "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		for _, line := range companyContact(*statement.SenderCompany) {
+			pdf.CellFormat(contentWidth/2, 4.5, tr(line), "", 1, "L", false, 0, "")
+		}
+	}
+	headerBottom := pdf.GetY()
+
+	pdf.SetXY(pageMargin+contentWidth/2, top)
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.SetTextColor(primaryR, primaryG, primaryB)
+	pdf.CellFormat(contentWidth/2, 10, tr(labels.Statement), "", 2, "R", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont("Helvetica", "", 9)
+	period := labels.Period + ": " + statement.From.Format(dateLayout) + " - " + statement.To.Format(dateLayout)
+	pdf.CellFormat(contentWidth/2, 4.5, tr(period), "", 2, "R", false, 0, "")
+	if pdf.GetY() > headerBottom {
+		headerBottom = pdf.GetY()
+	}
+	pdf.SetXY(pageMargin, headerBottom+8)
+
+	// Customer with its billing address
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(contentWidth, lineHeight, tr(labels.BillTo), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	billTo := append([]string{statement.Company.CompanyName}, addressLines(statement.Company.DefaultBillingAddress)...)
+	for _, line := range billTo {
+		pdf.CellFormat(contentWidth, 4.5, tr(line), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(6)
+
+	// Entries between the opening and closing balances
+	widths := []float64{22, contentWidth - 106, 28, 28, 28}
+	aligns := []string{"L", "L", "R", "R", "R"}
+	row := func(cells []string, style, border string, fill bool) {
+		pdf.SetFont("Helvetica", style, 9)
+		// Long descriptions are shortened to keep one row per entry
+		for pdf.GetStringWidth(cells[1]) > widths[1]-2 && len(cells[1]) > 4 {
+			cells[1] = strings.TrimSuffix(cells[1][:len(cells[1])-4], " ") + "..."
+		}
+		for i, cell := range cells {
+			pdf.CellFormat(widths[i], lineHeight, cell, border, 0, aligns[i], fill, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.SetFillColor(accentR, accentG, accentB)
+	row([]string{tr(labels.Date), tr(labels.Description), tr(labels.Debit), tr(labels.Credit),
+		tr(labels.Balance + " (" + statement.Currency + ")")}, "B", "B", true)
+	row([]string{statement.From.Format(dateLayout), tr(labels.OpeningBalance), "", "",
+		formatAmount(statement.OpeningBalance)}, "I", "B", false)
+	for _, entry := range statement.Entries {
+		row([]string{
+			entry.Date.Format(dateLayout),
+			tr(StatementEntryDescription(entry, statement.Currency, labels)),
+			pdfAmount(entry.Debit),
+			pdfAmount(entry.Credit),
+			formatAmount(entry.Balance),
+		}, "", "B", false)
+	}
+	row([]string{statement.To.Format(dateLayout), tr(labels.ClosingBalance), formatAmount(statement.TotalDebits),
+		formatAmount(statement.TotalCredits), formatAmount(statement.ClosingBalance)}, "B", "T", true)
+
+	if layout.BankDetails != "" {
+		pdf.Ln(6)
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(contentWidth, lineHeight, tr(labels.BankDetails), "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.MultiCell(contentWidth, 4.5, tr(layout.BankDetails), "", "L", false)
+	}
+
+	if err := pdf.Error(); err != nil {
+		return fmt.Errorf("failed to render statement PDF: %w", err)
+	}
+	return pdf.Output(w)
+}
+
+// pdfAmount leaves zero debits and credits blank
+func pdfAmount(amount money.Amount) string {
+	if amount.IsZero() {
+		return ""
+	}
+	return formatAmount(amount)
+}
+
+// StatementFilename is the download name of a statement, e.g. statement-12-2025-03-31.csv
+func StatementFilename(statement *models.Statement, extension string) string {
+	return "statement-" + strconv.FormatUint(uint64(statement.Company.CompanyID), 10) + "-" +
+		statement.To.Format("2006-01-02") + "." + extension
+}
@@ -3,6 +3,7 @@ package routes
 
 import (
 	"invoice-go/handlers"
+	"invoice-go/money"
 	"invoice-go/utils"
 	"net/http"
 	"log"
@@ -17,8 +18,8 @@ type InvoiceDetail struct {
     ItemName          string  `gorm:"column:name"`
     Description       string  `gorm:"column:description"`
     Quantity          float64 `gorm:"column:quantity"`
-    UnitPrice         float64 `gorm:"column:unit_price"`
-    ItemTotal         float64 `gorm:"column:item_total"`
+    UnitPrice         money.Amount `gorm:"column:unit_price"`
+    ItemTotal         money.Amount `gorm:"column:item_total"`
     TaxRatePercentage float64 `gorm:"column:tax_rate_percentage"`
 }
 
@@ -48,6 +49,19 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 	addressHandler := &handlers.AddressHandler{DB: db}
 	invoiceHandler := &handlers.InvoiceHandler{DB: db}
 	paymentHandler := &handlers.PaymentHandler{DB: db}
+	numberingHandler := &handlers.NumberingHandler{DB: db}
+	creditNoteHandler := &handlers.CreditNoteHandler{DB: db}
+	templateHandler := &handlers.TemplateHandler{DB: db}
+	exchangeRateHandler := &handlers.ExchangeRateHandler{DB: db}
+	taxHandler := &handlers.TaxHandler{DB: db}
+	discountCodeHandler := &handlers.DiscountCodeHandler{DB: db}
+	reportHandler := &handlers.ReportHandler{DB: db}
+	recurringInvoiceHandler := &handlers.RecurringInvoiceHandler{DB: db}
+	dunningHandler := &handlers.DunningHandler{DB: db}
+	lateFeeHandler := &handlers.LateFeeHandler{DB: db}
+	receiptHandler := &handlers.ReceiptHandler{DB: db}
+	creditHandler := &handlers.CreditHandler{DB: db}
+	bankStatementHandler := &handlers.BankStatementHandler{DB: db}
 
 	// Static file serving
 	r.Static("/uploads", "./uploads")
@@ -82,6 +96,26 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 		companyRoutes.GET("/:id", companyHandler.GetCompanyByID)
 		companyRoutes.POST("", companyHandler.CreateCompany)
 		companyRoutes.PUT("/:id", companyHandler.UpdateCompany)
+		companyRoutes.GET("/:id/balance", companyHandler.GetCompanyBalance)
+		companyRoutes.GET("/:id/statement", companyHandler.GetCompanyStatement)
+		companyRoutes.POST("/:id/logo", utils.PathTraversalMiddleware(), imageHandler.UploadCompanyLogo)
+		companyRoutes.GET("/:id/logo", utils.PathTraversalMiddleware(), imageHandler.DownloadCompanyLogo)
+		companyRoutes.GET("/:id/numbering", numberingHandler.GetNumberSeries)
+		companyRoutes.PUT("/:id/numbering/:type", numberingHandler.ConfigureNumberSeries)
+		companyRoutes.GET("/:id/templates", templateHandler.GetTemplates)
+		companyRoutes.POST("/:id/templates", templateHandler.CreateTemplate)
+		companyRoutes.PUT("/:id/templates/:template_id/activate", templateHandler.ActivateTemplate)
+		companyRoutes.GET("/:id/templates/:template_id/preview", templateHandler.PreviewTemplate)
+		companyRoutes.GET("/:id/dunning-levels", dunningHandler.GetDunningLevels)
+		companyRoutes.POST("/:id/dunning-levels", dunningHandler.CreateDunningLevel)
+		companyRoutes.PUT("/:id/dunning-levels/:level_id", dunningHandler.UpdateDunningLevel)
+		companyRoutes.DELETE("/:id/dunning-levels/:level_id", dunningHandler.DeleteDunningLevel)
+		companyRoutes.GET("/:id/late-fee-policy", lateFeeHandler.GetLateFeePolicy)
+		companyRoutes.PUT("/:id/late-fee-policy", lateFeeHandler.SetLateFeePolicy)
+		companyRoutes.DELETE("/:id/late-fee-policy", lateFeeHandler.DeleteLateFeePolicy)
+		companyRoutes.GET("/:id/credit", creditHandler.GetCredit)
+		companyRoutes.POST("/:id/credit/apply", creditHandler.ApplyCredit)
+		companyRoutes.POST("/:id/credit/refunds", creditHandler.RefundCredit)
 	}
 
 	// Address routes
@@ -100,17 +134,80 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 		orderRoutes.GET("", orderHandler.GetOrders)
 		orderRoutes.GET("/:id", orderHandler.GetOrder)
 		orderRoutes.POST("", orderHandler.CreateOrder)
+		orderRoutes.POST("/:id/invoice", orderHandler.CreateOrderInvoice)
 		// orderRoutes.GET("/revenue", orderHandler.GetRevenueByCategory)
 	}
 
 	invoices := r.Group("/invoice")
 	{
 		invoices.POST("/:id",          invoiceHandler.CreateInvoice)
+		invoices.GET("",               invoiceHandler.GetInvoices)
 		invoices.GET("/:id",           invoiceHandler.GetInvoices)
+		invoices.PUT("/:id",           invoiceHandler.UpdateInvoice)
 		invoices.GET("/:id/details",   invoiceHandler.GetInvoiceDetails)
 		invoices.GET("/:id/reports",   invoiceHandler.GetInvoiceReports)
+		invoices.GET("/:id/pdf",       invoiceHandler.GetInvoicePDF)
+		invoices.GET("/:id/html",      invoiceHandler.GetInvoiceHTML)
 		invoices.GET("/:id/status",   invoiceHandler.GetInvoiceStatus)
 		invoices.PATCH("/:id/status",    invoiceHandler.UpdateInvoiceStatus)
+		invoices.POST("/:id/credit-notes", creditNoteHandler.CreateCreditNote)
+		invoices.GET("/:id/credit-notes",  creditNoteHandler.GetInvoiceCreditNotes)
+		invoices.GET("/:id/reminders",     dunningHandler.GetInvoiceReminders)
+		invoices.GET("/:id/late-fees",     lateFeeHandler.GetInvoiceLateFees)
+	}
+
+	recurringInvoices := r.Group("/recurring-invoices")
+	{
+		recurringInvoices.GET("", recurringInvoiceHandler.GetRecurringInvoices)
+		recurringInvoices.GET("/:id", recurringInvoiceHandler.GetRecurringInvoice)
+		recurringInvoices.POST("", recurringInvoiceHandler.CreateRecurringInvoice)
+		recurringInvoices.PUT("/:id", recurringInvoiceHandler.UpdateRecurringInvoice)
+		recurringInvoices.DELETE("/:id", recurringInvoiceHandler.DeleteRecurringInvoice)
+		recurringInvoices.POST("/:id/run", recurringInvoiceHandler.RunRecurringInvoice)
+		recurringInvoices.POST("/:id/skip", recurringInvoiceHandler.SkipRecurringInvoice)
+	}
+
+	creditNotes := r.Group("/credit-notes")
+	{
+		creditNotes.GET("/:id", creditNoteHandler.GetCreditNote)
+	}
+
+	exchangeRates := r.Group("/exchange-rates")
+	{
+		exchangeRates.GET("", exchangeRateHandler.GetExchangeRates)
+		exchangeRates.GET("/effective", exchangeRateHandler.GetEffectiveRate)
+		exchangeRates.GET("/:id", exchangeRateHandler.GetExchangeRate)
+		exchangeRates.POST("", exchangeRateHandler.CreateExchangeRate)
+		exchangeRates.PUT("/:id", exchangeRateHandler.UpdateExchangeRate)
+		exchangeRates.DELETE("/:id", exchangeRateHandler.DeleteExchangeRate)
+	}
+
+	taxCodes := r.Group("/tax-codes")
+	{
+		taxCodes.GET("", taxHandler.GetTaxCodes)
+		taxCodes.GET("/:id", taxHandler.GetTaxCode)
+		taxCodes.POST("", taxHandler.CreateTaxCode)
+		taxCodes.PUT("/:id", taxHandler.UpdateTaxCode)
+		taxCodes.DELETE("/:id", taxHandler.DeleteTaxCode)
+	}
+
+	taxRules := r.Group("/tax-rules")
+	{
+		taxRules.GET("", taxHandler.GetTaxRules)
+		taxRules.GET("/resolve", taxHandler.ResolveTaxCodes)
+		taxRules.POST("", taxHandler.CreateTaxRule)
+		taxRules.PUT("/:id", taxHandler.UpdateTaxRule)
+		taxRules.DELETE("/:id", taxHandler.DeleteTaxRule)
+	}
+
+	// Discount code routes
+	discountCodes := r.Group("/discount-codes")
+	{
+		discountCodes.GET("", discountCodeHandler.GetDiscountCodes)
+		discountCodes.GET("/:id", discountCodeHandler.GetDiscountCode)
+		discountCodes.POST("", discountCodeHandler.CreateDiscountCode)
+		discountCodes.PUT("/:id", discountCodeHandler.UpdateDiscountCode)
+		discountCodes.DELETE("/:id", discountCodeHandler.DeleteDiscountCode)
 	}
 
 	payments := r.Group("/payment")
@@ -119,6 +216,39 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 		payments.GET("/:id",        paymentHandler.GetPayments)
 		payments.GET("/:id/details",paymentHandler.GetPaymentDetails)
 		payments.PUT("/:id/status", paymentHandler.UpdatePaymentStatus)
+		payments.DELETE("/:id", paymentHandler.DeletePayment)
+		payments.PUT("/:id/certificate", paymentHandler.RecordWithholdingCertificate)
+		payments.POST("/:id/refund", paymentHandler.RefundPayment)
+		payments.POST("/:id/chargeback", paymentHandler.ChargebackPayment)
+	}
+
+	receipts := r.Group("/receipts")
+	{
+		receipts.GET("", receiptHandler.GetReceipts)
+		receipts.GET("/:id", receiptHandler.GetReceipt)
+		receipts.POST("", receiptHandler.CreateReceipt)
+		receipts.POST("/:id/allocations", receiptHandler.AllocateReceipt)
+	}
+
+	bankStatements := r.Group("/bank-statements")
+	{
+		bankStatements.GET("", bankStatementHandler.GetBankStatements)
+		bankStatements.GET("/:id", bankStatementHandler.GetBankStatement)
+		bankStatements.POST("", bankStatementHandler.ImportBankStatement)
+	}
+
+	reconciliation := r.Group("/reconciliation")
+	{
+		reconciliation.GET("/queue", bankStatementHandler.GetReconciliationQueue)
+		reconciliation.POST("/lines/:id/confirm", bankStatementHandler.ConfirmBankLine)
+		reconciliation.POST("/lines/:id/rematch", bankStatementHandler.RematchBankLine)
+		reconciliation.POST("/lines/:id/ignore", bankStatementHandler.IgnoreBankLine)
+	}
+
+	reports := r.Group("/reports")
+	{
+		reports.GET("/withholding-certificates", reportHandler.GetPendingCertificates)
+		reports.GET("/aging", reportHandler.GetAgingReport)
 	}
 
 
@@ -16,8 +16,8 @@ import (
 	"github.com/google/uuid"
 	"invoice-go/models"
 	"time"
-	"math/rand"
-	"strconv"
+	"math"
+	"invoice-go/money"
 )
 
 const (
@@ -25,6 +25,8 @@ const (
 	MaxFileSize = 5 << 20
 	// Base upload directory
 	UploadDir = "./uploads/items"
+	// Upload directory for company logos
+	CompanyUploadDir = "./uploads/companies"
 )
 
 // ValidateImage checks if the file is a valid image and within size limits
@@ -243,6 +245,58 @@ func DeleteItemImages(itemID uint ) error {
 	return os.RemoveAll(itemDir)
 }
 
+// SaveCompanyLogo saves an uploaded logo in the company's upload directory
+func SaveCompanyLogo(c *gin.Context, file *multipart.FileHeader, companyID uint) (string, error) {
+	fileExt := strings.ToLower(filepath.Ext(file.Filename))
+	newFilename := uuid.New().String() + "-CompanyLogo" + fileExt
+
+	companyDir := filepath.Join(CompanyUploadDir, fmt.Sprintf("%d", companyID))
+	if err := os.MkdirAll(companyDir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	dst := filepath.Join(companyDir, newFilename)
+	if err := c.SaveUploadedFile(file, dst); err != nil {
+		return "", err
+	}
+
+	return dst, nil
+}
+
+// GetCompanyLogoPath retrieves the most recently uploaded logo of a company
+func GetCompanyLogoPath(companyID uint) (string, error) {
+	companyDir := filepath.Join(CompanyUploadDir, fmt.Sprintf("%d", companyID))
+
+	files, err := os.ReadDir(companyDir)
+	if err != nil {
+		return "", fmt.Errorf("no logo found for company")
+	}
+
+	var latestFile string
+	var latestTime time.Time
+	for _, file := range files {
+		name := strings.ToLower(file.Name())
+		if file.IsDir() || !strings.Contains(name, "-companylogo") ||
+			!(strings.HasSuffix(name, ".jpg") || strings.HasSuffix(name, ".jpeg") || strings.HasSuffix(name, ".png")) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		if latestFile == "" || info.ModTime().After(latestTime) {
+			latestFile = file.Name()
+			latestTime = info.ModTime()
+		}
+	}
+
+	if latestFile == "" {
+		return "", fmt.Errorf("no logo found for company")
+	}
+
+	return filepath.Join(companyDir, latestFile), nil
+}
+
 // PathTraversalMiddleware prevents path traversal attacks
 func PathTraversalMiddleware() gin.HandlerFunc {
     return func(c *gin.Context) {
@@ -259,13 +313,17 @@ func PathTraversalMiddleware() gin.HandlerFunc {
     }
 }
 
-// GenerateInvoiceNumber creates a unique invoice number with prefix and date
-func GenerateInvoiceNumber() string {
-	// Format: INV-YYYY-XXXX where XXXX is a random number
-	year := time.Now().Format("2006")
-	randomNum := 1000 + rand.Intn(9000) // Random 4-digit number
-	
-	return fmt.Sprintf("INV-%s-%04d", year, randomNum)
+// FormatDocumentNumber renders a document number from a series pattern.
+// Supported tokens: {PREFIX}, {YYYY}, {YY}, {MM} and {SEQ} (zero padded to padding digits).
+func FormatDocumentNumber(pattern, prefix string, padding int, date time.Time, seq int64) string {
+	replacer := strings.NewReplacer(
+		"{PREFIX}", prefix,
+		"{YYYY}", date.Format("2006"),
+		"{YY}", date.Format("06"),
+		"{MM}", date.Format("01"),
+		"{SEQ}", fmt.Sprintf("%0*d", padding, seq),
+	)
+	return replacer.Replace(pattern)
 }
 
 // sanitizeFilename removes potentially harmful characters from filenames
@@ -283,46 +341,225 @@ func sanitizeFilename(filename string) string {
 	}, filename)
 }
 
-// CalculateInvoiceTotals calculates subtotal, tax, and grand total for invoice items
-func CalculateInvoiceTotals(items []map[string]interface{}) (float64, float64, float64) {
-	var subtotal, taxTotal, grandTotal float64
-	
-	for _, item := range items {
-		quantity := toFloat64(item["quantity"])
-		unitPrice := toFloat64(item["unit_price"])
-		taxRate := toFloat64(item["tax_rate_percentage"]) / 100.0
-		
-		itemTotal := quantity * unitPrice
-		itemTax := itemTotal * taxRate
-		
-		subtotal += itemTotal
-		taxTotal += itemTax
+// LineTax is a tax applied to an invoice line
+type LineTax struct {
+	Code           string // Empty for a free-typed rate
+	RatePercentage float64
+	Withholding    bool // Withheld by the buyer instead of added to the total
+}
+
+// InvoiceLine is a line of an invoice or credit note as far as totals are concerned
+type InvoiceLine struct {
+	Quantity           float64
+	UnitPrice          money.Amount
+	DiscountPercentage float64      // Off quantity × unit price
+	DiscountAmount     money.Amount // Off the line, on top of the percentage
+	Taxes              []LineTax
+}
+
+// LineTotal is how the amount of a line is discounted
+type LineTotal struct {
+	Amount          money.Amount // Quantity × unit price
+	Discount        money.Amount // Line discount
+	Total           money.Amount // Amount less the line discount
+	InvoiceDiscount money.Amount // Share of the invoice discount, taxes apply to Total less this share
+}
+
+// TaxSummary is the taxable amount and tax of the lines sharing a tax code and rate
+type TaxSummary struct {
+	LineTax
+	Taxable money.Amount
+	Tax     money.Amount
+}
+
+// InvoiceTotals are the totals of an invoice with its tax breakdown.
+// Subtotal - Discount + TaxTotal always equals GrandTotal.
+type InvoiceTotals struct {
+	Subtotal         money.Amount // Line totals, net of the sales taxes for tax-inclusive prices
+	Discount         money.Amount // Invoice discount
+	TaxTotal         money.Amount // Taxes added to the invoice
+	WithholdingTotal money.Amount // Taxes withheld by the buyer, not part of GrandTotal
+	GrandTotal       money.Amount
+	Taxes            []TaxSummary // Ordered by first appearance on the lines
+	Lines            []LineTotal  // In the order of the lines
+}
+
+// Pricing is how the unit prices of a document are taxed, discounted and rounded
+type Pricing struct {
+	TaxInclusive       bool         // Unit prices include the sales taxes
+	Rounding           string       // models.TaxRoundingLine (the default) or models.TaxRoundingInvoice
+	DiscountPercentage float64      // Invoice discount, off the line totals
+	DiscountAmount     money.Amount // Invoice discount on top of the percentage
+}
+
+// ApplyDiscount returns percentage percent of a total plus a fixed amount,
+// rounded to the currency and never more than the total itself. Totals and
+// amounts of credit notes are negative.
+func ApplyDiscount(total money.Amount, percentage float64, amount money.Amount, currency string) money.Amount {
+	discount := total.Percent(percentage).Round(currency).Add(amount.Round(currency))
+	if discount.Abs().GreaterThan(total.Abs()) {
+		return total
 	}
-	
-	grandTotal = subtotal + taxTotal
-	
-	return subtotal, taxTotal, grandTotal
+	return discount
 }
 
-// toFloat64 safely converts an interface{} to float64
-func toFloat64(v interface{}) float64 {
-	switch val := v.(type) {
-	case float64:
-		return val
-	case float32:
-		return float64(val)
-	case int:
-		return float64(val)
-	case int64:
-		return float64(val)
-	case int32:
-		return float64(val)
-	case string:
-		if f, err := strconv.ParseFloat(val, 64); err == nil {
-			return f
+// allocateDiscount splits a discount over the line totals in proportion to
+// them; the last line takes the rounding difference
+func allocateDiscount(discount money.Amount, totals []money.Amount, currency string) []money.Amount {
+	shares := make([]money.Amount, len(totals))
+	sum := money.Sum(totals...)
+	if discount.IsZero() || sum.IsZero() {
+		return shares
+	}
+	left := discount
+	last := -1
+	for i, total := range totals {
+		if !total.IsZero() {
+			last = i
+		}
+	}
+	for i, total := range totals {
+		if i == last {
+			shares[i] = left
+			break
+		}
+		shares[i] = discount.Share(total, sum).Round(currency)
+		left = left.Sub(shares[i])
+	}
+	return shares
+}
+
+// CalculateInvoiceTotals calculates subtotal, discounts, tax, and grand total for
+// invoice items. Each line total is quantity × unit price rounded to the currency,
+// less the line discount. The invoice discount is spread over the line totals,
+// and taxes apply to what remains. Tax-exclusive lines are taxed on top; for
+// tax-inclusive lines the sales taxes are back-calculated, so the discounted line
+// totals add up to the grand total. Withholding taxes are always computed on the
+// net amount. Rounding per line rounds every tax of every line before summing;
+// rounding per invoice sums the unrounded taxes per tax code and rate and rounds
+// each sum once.
+func CalculateInvoiceTotals(items []InvoiceLine, currency string, pricing Pricing) InvoiceTotals {
+	totals := InvoiceTotals{Lines: make([]LineTotal, len(items))}
+	index := make(map[LineTax]int)
+	perInvoice := pricing.Rounding == models.TaxRoundingInvoice
+	round := func(a money.Amount) money.Amount {
+		if perInvoice {
+			return a
+		}
+		return a.Round(currency)
+	}
+
+	lineTotals := make([]money.Amount, len(items))
+	for i, item := range items {
+		line := &totals.Lines[i]
+		line.Amount = item.UnitPrice.Mul(item.Quantity).Round(currency)
+		line.Discount = ApplyDiscount(line.Amount, item.DiscountPercentage, item.DiscountAmount, currency)
+		line.Total = line.Amount.Sub(line.Discount)
+		lineTotals[i] = line.Total
+	}
+	lineTotal := money.Sum(lineTotals...)
+	totals.Discount = ApplyDiscount(lineTotal, pricing.DiscountPercentage, pricing.DiscountAmount, currency)
+	for i, share := range allocateDiscount(totals.Discount, lineTotals, currency) {
+		totals.Lines[i].InvoiceDiscount = share
+	}
+
+	for i, item := range items {
+		base := totals.Lines[i].Total.Sub(totals.Lines[i].InvoiceDiscount)
+
+		// Back-calculate the sales taxes included in the line total
+		net := base
+		taxes := make([]money.Amount, len(item.Taxes))
+		if pricing.TaxInclusive {
+			salesRate := 0.0
+			for _, tax := range item.Taxes {
+				if !tax.Withholding {
+					salesRate += tax.RatePercentage
+				}
+			}
+			for j, tax := range item.Taxes {
+				if !tax.Withholding {
+					taxes[j] = round(base.IncludedPercent(tax.RatePercentage, salesRate))
+					net = net.Sub(taxes[j])
+				}
+			}
+		}
+
+		for j, tax := range item.Taxes {
+			if tax.Withholding || !pricing.TaxInclusive {
+				taxes[j] = round(net.Percent(tax.RatePercentage))
+			}
+			k, ok := index[tax]
+			if !ok {
+				k = len(totals.Taxes)
+				index[tax] = k
+				totals.Taxes = append(totals.Taxes, TaxSummary{LineTax: tax})
+			}
+			totals.Taxes[k].Taxable = totals.Taxes[k].Taxable.Add(net)
+			totals.Taxes[k].Tax = totals.Taxes[k].Tax.Add(taxes[j])
+		}
+	}
+
+	for i := range totals.Taxes {
+		summary := &totals.Taxes[i]
+		if pricing.TaxInclusive && !summary.Withholding {
+			// Keep taxable + tax equal to the rounded tax-inclusive amount
+			gross := summary.Taxable.Add(summary.Tax).Round(currency)
+			summary.Tax = summary.Tax.Round(currency)
+			summary.Taxable = gross.Sub(summary.Tax)
+		} else {
+			summary.Tax = summary.Tax.Round(currency)
+			summary.Taxable = summary.Taxable.Round(currency)
+		}
+
+		if summary.Withholding {
+			totals.WithholdingTotal = totals.WithholdingTotal.Add(summary.Tax)
+		} else {
+			totals.TaxTotal = totals.TaxTotal.Add(summary.Tax)
 		}
-	default:
-		// unsupported type or nil, default to zero
 	}
-	return 0
-}
\ No newline at end of file
+
+	if pricing.TaxInclusive {
+		totals.Subtotal = lineTotal.Sub(totals.TaxTotal)
+		totals.GrandTotal = lineTotal.Sub(totals.Discount)
+	} else {
+		totals.Subtotal = lineTotal
+		totals.GrandTotal = lineTotal.Sub(totals.Discount).Add(totals.TaxTotal)
+	}
+	return totals
+}
+
+// RoundAmount rounds a quantity to 2 decimal places to match the DECIMAL(10,2) columns.
+// Monetary values are money.Amount and rounded with Amount.Round.
+func RoundAmount(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// BaseCurrency returns the ISO 4217 code of the base reporting currency,
+// configured with BASE_CURRENCY (IDR when unset)
+func BaseCurrency() string {
+	if code := NormalizeCurrency(os.Getenv("BASE_CURRENCY")); code != "" {
+		return code
+	}
+	return "IDR"
+}
+
+// SchedulerInterval returns how often the background jobs run, configured
+// with SCHEDULER_INTERVAL as a Go duration such as 15m (one hour when unset).
+// Zero or an invalid value disables the scheduler.
+func SchedulerInterval() time.Duration {
+	value := strings.TrimSpace(os.Getenv("SCHEDULER_INTERVAL"))
+	if value == "" {
+		return time.Hour
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid SCHEDULER_INTERVAL %q, scheduler disabled", value)
+		return 0
+	}
+	return interval
+}
+
+// NormalizeCurrency returns a currency code in its canonical upper case form
+func NormalizeCurrency(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"testing"
+
+	"invoice-go/models"
+	"invoice-go/money"
+)
+
+func TestApplyDiscount(t *testing.T) {
+	tests := []struct {
+		name       string
+		total      string
+		percentage float64
+		amount     string
+		currency   string
+		want       string
+	}{
+		{"percentage", "100", 10, "0", "USD", "10.00"},
+		{"percentage and amount", "100", 10, "5", "USD", "15.00"},
+		{"percentage rounded half away from zero", "10.01", 50, "0", "USD", "5.01"},
+		{"percentage in a currency without decimals", "1001", 50, "0", "JPY", "501.00"},
+		{"amount larger than the total", "100", 0, "150", "USD", "100.00"},
+		{"percentage and amount larger than the total", "100", 60, "50", "USD", "100.00"},
+		{"credit note", "-100", 10, "-5", "USD", "-15.00"},
+		{"credit note amount larger than the total", "-100", 0, "-150", "USD", "-100.00"},
+		{"zero total", "0", 10, "5", "USD", "0.00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ApplyDiscount(amount(tt.total), tt.percentage, amount(tt.amount), tt.currency)
+			if got.String() != tt.want {
+				t.Errorf("ApplyDiscount(%s, %v, %s) = %s, want %s", tt.total, tt.percentage, tt.amount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateInvoiceTotals(t *testing.T) {
+	vat10 := LineTax{Code: "VAT10", RatePercentage: 10}
+	vat11 := LineTax{Code: "VAT11", RatePercentage: 11}
+	wht2 := LineTax{Code: "WHT2", RatePercentage: 2, Withholding: true}
+	exempt := LineTax{Code: "EXEMPT"}
+
+	type taxWant struct {
+		code, taxable, tax string
+	}
+	tests := []struct {
+		name        string
+		items       []InvoiceLine
+		currency    string
+		pricing     Pricing
+		subtotal    string
+		discount    string
+		taxTotal    string
+		withholding string
+		grandTotal  string
+		taxes       []taxWant
+		shares      []string // Invoice discount per line, checked when set
+	}{
+		{
+			name: "exclusive, rounded per line",
+			items: []InvoiceLine{
+				{Quantity: 3, UnitPrice: amount("33.33"), Taxes: []LineTax{vat11}},
+				{Quantity: 1, UnitPrice: amount("0.05"), Taxes: []LineTax{vat11}},
+			},
+			currency: "USD",
+			subtotal: "100.04", discount: "0.00", taxTotal: "11.01", withholding: "0.00", grandTotal: "111.05",
+			taxes: []taxWant{{"VAT11", "100.04", "11.01"}},
+		},
+		{
+			name: "exclusive, rounded per invoice",
+			items: []InvoiceLine{
+				{Quantity: 3, UnitPrice: amount("33.33"), Taxes: []LineTax{vat11}},
+				{Quantity: 1, UnitPrice: amount("0.05"), Taxes: []LineTax{vat11}},
+			},
+			currency: "USD",
+			pricing:  Pricing{Rounding: models.TaxRoundingInvoice},
+			subtotal: "100.04", discount: "0.00", taxTotal: "11.00", withholding: "0.00", grandTotal: "111.04",
+			taxes: []taxWant{{"VAT11", "100.04", "11.00"}},
+		},
+		{
+			name: "inclusive, rounded per line",
+			items: []InvoiceLine{
+				{Quantity: 1, UnitPrice: amount("5.00"), Taxes: []LineTax{vat10}},
+				{Quantity: 1, UnitPrice: amount("5.00"), Taxes: []LineTax{vat10}},
+				{Quantity: 1, UnitPrice: amount("5.00"), Taxes: []LineTax{vat10}},
+			},
+			currency: "USD",
+			pricing:  Pricing{TaxInclusive: true},
+			subtotal: "13.65", discount: "0.00", taxTotal: "1.35", withholding: "0.00", grandTotal: "15.00",
+			taxes: []taxWant{{"VAT10", "13.65", "1.35"}},
+		},
+		{
+			name: "inclusive, rounded per invoice",
+			items: []InvoiceLine{
+				{Quantity: 1, UnitPrice: amount("5.00"), Taxes: []LineTax{vat10}},
+				{Quantity: 1, UnitPrice: amount("5.00"), Taxes: []LineTax{vat10}},
+				{Quantity: 1, UnitPrice: amount("5.00"), Taxes: []LineTax{vat10}},
+			},
+			currency: "USD",
+			pricing:  Pricing{TaxInclusive: true, Rounding: models.TaxRoundingInvoice},
+			subtotal: "13.64", discount: "0.00", taxTotal: "1.36", withholding: "0.00", grandTotal: "15.00",
+			taxes: []taxWant{{"VAT10", "13.64", "1.36"}},
+		},
+		{
+			name: "mixed tax codes with withholding",
+			items: []InvoiceLine{
+				{Quantity: 10, UnitPrice: amount("100"), Taxes: []LineTax{vat11, wht2}},
+				{Quantity: 1, UnitPrice: amount("500"), Taxes: []LineTax{vat11}},
+				{Quantity: 1, UnitPrice: amount("200"), Taxes: []LineTax{exempt}},
+			},
+			currency: "IDR",
+			subtotal: "1700.00", discount: "0.00", taxTotal: "165.00", withholding: "20.00", grandTotal: "1865.00",
+			taxes: []taxWant{{"VAT11", "1500.00", "165.00"}, {"WHT2", "1000.00", "20.00"}, {"EXEMPT", "200.00", "0.00"}},
+		},
+		{
+			// Withholding is on the amount net of the included sales taxes
+			name: "inclusive with withholding",
+			items: []InvoiceLine{
+				{Quantity: 1, UnitPrice: amount("1110"), Taxes: []LineTax{vat11, wht2}},
+			},
+			currency: "IDR",
+			pricing:  Pricing{TaxInclusive: true},
+			subtotal: "1000.00", discount: "0.00", taxTotal: "110.00", withholding: "20.00", grandTotal: "1110.00",
+			taxes: []taxWant{{"VAT11", "1000.00", "110.00"}, {"WHT2", "1000.00", "20.00"}},
+		},
+		{
+			// The last line takes the rounding difference of the shares
+			name: "invoice discount allocated over the lines",
+			items: []InvoiceLine{
+				{Quantity: 1, UnitPrice: amount("10"), Taxes: []LineTax{vat10}},
+				{Quantity: 1, UnitPrice: amount("10"), Taxes: []LineTax{vat10}},
+				{Quantity: 1, UnitPrice: amount("10"), Taxes: []LineTax{vat10}},
+			},
+			currency: "USD",
+			pricing:  Pricing{DiscountAmount: amount("10")},
+			subtotal: "30.00", discount: "10.00", taxTotal: "2.01", withholding: "0.00", grandTotal: "22.01",
+			taxes:  []taxWant{{"VAT10", "20.00", "2.01"}},
+			shares: []string{"3.33", "3.33", "3.34"},
+		},
+		{
+			name: "line discount and invoice percentage",
+			items: []InvoiceLine{
+				{Quantity: 1, UnitPrice: amount("200"), DiscountPercentage: 10, DiscountAmount: amount("5"), Taxes: []LineTax{vat11}},
+			},
+			currency: "USD",
+			pricing:  Pricing{DiscountPercentage: 10},
+			subtotal: "175.00", discount: "17.50", taxTotal: "17.33", withholding: "0.00", grandTotal: "174.83",
+			taxes:  []taxWant{{"VAT11", "157.50", "17.33"}},
+			shares: []string{"17.50"},
+		},
+		{
+			name: "fixed discount larger than the subtotal",
+			items: []InvoiceLine{
+				{Quantity: 2, UnitPrice: amount("30"), Taxes: []LineTax{vat10}},
+				{Quantity: 1, UnitPrice: amount("40"), Taxes: []LineTax{vat10}},
+			},
+			currency: "USD",
+			pricing:  Pricing{DiscountAmount: amount("150")},
+			subtotal: "100.00", discount: "100.00", taxTotal: "0.00", withholding: "0.00", grandTotal: "0.00",
+			taxes:  []taxWant{{"VAT10", "0.00", "0.00"}},
+			shares: []string{"60.00", "40.00"},
+		},
+		{
+			name: "credit note",
+			items: []InvoiceLine{
+				{Quantity: -2, UnitPrice: amount("50"), Taxes: []LineTax{vat11}},
+			},
+			currency: "USD",
+			subtotal: "-100.00", discount: "0.00", taxTotal: "-11.00", withholding: "0.00", grandTotal: "-111.00",
+			taxes: []taxWant{{"VAT11", "-100.00", "-11.00"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CalculateInvoiceTotals(tt.items, tt.currency, tt.pricing)
+
+			for _, field := range []struct {
+				name string
+				got  money.Amount
+				want string
+			}{
+				{"Subtotal", got.Subtotal, tt.subtotal},
+				{"Discount", got.Discount, tt.discount},
+				{"TaxTotal", got.TaxTotal, tt.taxTotal},
+				{"WithholdingTotal", got.WithholdingTotal, tt.withholding},
+				{"GrandTotal", got.GrandTotal, tt.grandTotal},
+			} {
+				if field.got.String() != field.want {
+					t.Errorf("%s = %s, want %s", field.name, field.got, field.want)
+				}
+			}
+			if sum := got.Subtotal.Sub(got.Discount).Add(got.TaxTotal); !sum.Equal(got.GrandTotal) {
+				t.Errorf("Subtotal - Discount + TaxTotal = %s, GrandTotal = %s", sum, got.GrandTotal)
+			}
+
+			if len(got.Taxes) != len(tt.taxes) {
+				t.Fatalf("got %d tax summaries, want %d: %+v", len(got.Taxes), len(tt.taxes), got.Taxes)
+			}
+			for i, want := range tt.taxes {
+				summary := got.Taxes[i]
+				if summary.Code != want.code || summary.Taxable.String() != want.taxable || summary.Tax.String() != want.tax {
+					t.Errorf("tax %d = %s taxable %s tax %s, want %s taxable %s tax %s",
+						i, summary.Code, summary.Taxable, summary.Tax, want.code, want.taxable, want.tax)
+				}
+			}
+
+			if tt.shares != nil {
+				for i, want := range tt.shares {
+					if share := got.Lines[i].InvoiceDiscount; share.String() != want {
+						t.Errorf("line %d invoice discount = %s, want %s", i, share, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// amount parses an amount written in a test table
+func amount(s string) money.Amount {
+	a, err := money.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}